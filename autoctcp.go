@@ -0,0 +1,148 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sorcix/irc/ctcp"
+)
+
+// Default rate limit of a CTCPResponder: a burst of 4 replies, and one more
+// every 2 seconds.
+const (
+	ctcpBurst = 4
+	ctcpEvery = 2 * time.Second
+)
+
+// A CTCPHandler returns the reply to a CTCP request, given the message
+// carrying the request and the data after the tag. No reply is sent if ok is
+// false.
+type CTCPHandler func(m *Message, message string) (reply string, ok bool)
+
+// A CTCPResponder answers CTCP requests received by a Conn, see AutoCTCP.
+type CTCPResponder struct {
+	mu       sync.Mutex
+	handlers map[string]CTCPHandler
+	limit    *Limiter
+}
+
+// AutoCTCP enables automatic replies to CTCP VERSION, PING, TIME and
+// CLIENTINFO requests. Every such request read using Decode or DecodeContext
+// is answered with a CTCP NOTICE, and is still returned to the caller:
+//
+//    :nick!user@host PRIVMSG me :\x01PING 1234\x01
+//    NOTICE nick :\x01PING 1234\x01
+//
+// The VERSION reply contains version, or the Go version if empty. PING
+// replies echo the data of the request.
+//
+// Replies are limited to a burst of 4, and one more every 2 seconds, so the
+// connection can't be used to flood others or get ourselves disconnected.
+// Requests exceeding the limit are not answered. Use the returned responder
+// to change replies and the rate limit.
+func (c *Conn) AutoCTCP(version string) *CTCPResponder {
+	r := &CTCPResponder{
+		handlers: make(map[string]CTCPHandler),
+		limit:    NewLimiter(ctcpBurst, ctcpEvery),
+	}
+
+	r.handlers[ctcp.VERSION] = func(*Message, string) (string, bool) {
+		if len(version) > 0 {
+			return version, true
+		}
+		_, reply, _ := ctcp.Decode(ctcp.VersionReply())
+		return reply, true
+	}
+	r.handlers[ctcp.PING] = func(m *Message, message string) (string, bool) {
+		return message, true
+	}
+	r.handlers[ctcp.TIME] = func(*Message, string) (string, bool) {
+		return time.Now().Format(time.RFC1123Z), true
+	}
+	r.handlers[ctcp.CLIENTINFO] = func(*Message, string) (string, bool) {
+		return r.clientInfo(), true
+	}
+
+	c.mu.Lock()
+	c.ctcp = r
+	c.mu.Unlock()
+
+	return r
+}
+
+// Handle sets the handler for CTCP requests with the given tag, replacing the
+// default handler if any. A nil handler stops replying to the tag.
+func (r *CTCPResponder) Handle(tag string, handler CTCPHandler) {
+	tag = strings.ToUpper(tag)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if handler == nil {
+		delete(r.handlers, tag)
+		return
+	}
+	r.handlers[tag] = handler
+}
+
+// SetRateLimit changes the number of replies sent at once, and the time
+// between replies after that.
+func (r *CTCPResponder) SetRateLimit(burst int, every time.Duration) {
+	r.mu.Lock()
+	r.limit = NewLimiter(burst, every)
+	r.mu.Unlock()
+}
+
+// clientInfo returns the supported tags for a CLIENTINFO reply.
+func (r *CTCPResponder) clientInfo() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tags := make([]string, 0, len(r.handlers))
+	for tag := range r.handlers {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return strings.Join(tags, " ")
+}
+
+// respond returns the reply to m if it is a CTCP request we can answer
+// within the rate limit. Nicks are compared using mapping.
+func (r *CTCPResponder) respond(m *Message, myNick string, mapping CaseMapping) (*Message, bool) {
+	if m.Command != PRIVMSG || m.Prefix == nil || len(m.Prefix.Name) <= 0 || m.IsEcho(myNick, mapping) {
+		return nil, false
+	}
+
+	tag, message, ok := ctcp.Decode(m.Trailing)
+	if !ok {
+		return nil, false
+	}
+
+	tag = strings.ToUpper(tag)
+
+	r.mu.Lock()
+	handler := r.handlers[tag]
+	limit := r.limit
+	r.mu.Unlock()
+
+	if handler == nil {
+		return nil, false
+	}
+
+	reply, ok := handler(m, message)
+	if !ok || !limit.Allow() {
+		return nil, false
+	}
+
+	return &Message{
+		Command:  NOTICE,
+		Params:   []string{m.Prefix.Name},
+		Trailing: ctcp.Encode(tag, reply),
+	}, true
+}
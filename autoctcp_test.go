@@ -0,0 +1,101 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sorcix/irc/ctcp"
+)
+
+func TestConn_AutoCTCP(t *testing.T) {
+	input := ":nick!user@host PRIVMSG me :\x01PING 1234 5678\x01\r\n" +
+		":nick!user@host PRIVMSG me :\x01VERSION\x01\r\n" +
+		":nick!user@host PRIVMSG me :\x01CLIENTINFO\x01\r\n" +
+		":nick!user@host PRIVMSG #channel :Hello\r\n" +
+		":nick!user@host NOTICE me :\x01VERSION test\x01\r\n" +
+		":nick!user@host PRIVMSG me :\x01FINGER\x01\r\n"
+
+	buffer := new(bufferConn)
+	conn := NewConn(&readWriter{strings.NewReader(input), buffer})
+	conn.AutoCTCP("test 1.0")
+
+	for i := 0; i < 6; i++ {
+		if _, err := conn.Decode(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	expected := "NOTICE nick :\x01PING 1234 5678\x01\r\n" +
+		"NOTICE nick :\x01VERSION test 1.0\x01\r\n" +
+		"NOTICE nick :\x01CLIENTINFO CLIENTINFO PING TIME VERSION\x01\r\n"
+
+	if buffer.String() != expected {
+		t.Errorf("Unexpected replies: %q", buffer.String())
+	}
+}
+
+func TestConn_AutoCTCP_time(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(&readWriter{strings.NewReader(":nick!user@host PRIVMSG me :\x01TIME\x01\r\n"), buffer})
+	conn.AutoCTCP("")
+
+	if _, err := conn.Decode(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	reply := ParseMessage(buffer.String())
+	tag, message, ok := ctcp.Decode(reply.Trailing)
+	if !ok || tag != ctcp.TIME {
+		t.Fatalf("Unexpected reply: %q", buffer.String())
+	}
+	if _, err := time.Parse(time.RFC1123Z, message); err != nil {
+		t.Errorf("Unexpected time: %v", err)
+	}
+}
+
+func TestCTCPResponder_Handle(t *testing.T) {
+	input := ":nick!user@host PRIVMSG me :\x01VERSION\x01\r\n" +
+		":nick!user@host PRIVMSG me :\x01PING 1\x01\r\n" +
+		":nick!user@host PRIVMSG me :\x01finger\x01\r\n"
+
+	buffer := new(bufferConn)
+	conn := NewConn(&readWriter{strings.NewReader(input), buffer})
+
+	r := conn.AutoCTCP("")
+	r.Handle(ctcp.VERSION, nil)
+	r.Handle(ctcp.FINGER, func(m *Message, message string) (string, bool) {
+		return "Hello " + m.Prefix.Name, true
+	})
+
+	for i := 0; i < 3; i++ {
+		conn.Decode()
+	}
+
+	expected := "NOTICE nick :\x01PING 1\x01\r\n" +
+		"NOTICE nick :\x01FINGER Hello nick\x01\r\n"
+
+	if buffer.String() != expected {
+		t.Errorf("Unexpected replies: %q", buffer.String())
+	}
+}
+
+func TestCTCPResponder_rateLimit(t *testing.T) {
+	input := strings.Repeat(":nick!user@host PRIVMSG #channel :\x01PING x\x01\r\n", 10)
+
+	buffer := new(bufferConn)
+	conn := NewConn(&readWriter{strings.NewReader(input), buffer})
+	conn.AutoCTCP("").SetRateLimit(3, time.Hour)
+
+	for i := 0; i < 10; i++ {
+		conn.Decode()
+	}
+
+	if buffer.String() != strings.Repeat("NOTICE nick :\x01PING x\x01\r\n", 3) {
+		t.Errorf("Unexpected replies: %q", buffer.String())
+	}
+}
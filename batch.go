@@ -0,0 +1,103 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+// A Batch is a group of related messages, as sent by servers supporting the
+// IRCv3 batch capability:
+//
+//    :irc.example.org BATCH +ref chathistory #channel
+//    @batch=ref :nick!user@host PRIVMSG #channel :Hello
+//    :irc.example.org BATCH -ref
+//
+// Messages that are not part of a batch are delivered as a batch without
+// type or reference, containing just that message.
+type Batch struct {
+	Ref    string   // Reference tag, without the leading +
+	Type   string   // Type of batch, like chathistory or netsplit
+	Params []string // Additional parameters of the BATCH command
+
+	Messages []*Message // Messages in this batch, in order of arrival
+	Nested   []*Batch   // Batches referencing this one, in order of completion
+
+	parent string
+}
+
+// A BatchDecoder reads messages using a Decoder, and groups them into batches.
+type BatchDecoder struct {
+	dec  *Decoder
+	open map[string]*Batch
+}
+
+// NewBatchDecoder returns a new BatchDecoder reading from dec.
+func NewBatchDecoder(dec *Decoder) *BatchDecoder {
+	return &BatchDecoder{
+		dec:  dec,
+		open: make(map[string]*Batch),
+	}
+}
+
+// Decode reads messages until a batch is complete. Nested batches are
+// delivered as part of their outermost batch.
+//
+// Incomplete batches are discarded if reading fails.
+func (b *BatchDecoder) Decode() (*Batch, error) {
+	for {
+		m, err := b.dec.Decode()
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			continue
+		}
+
+		if batch := b.add(m); batch != nil {
+			return batch, nil
+		}
+	}
+}
+
+// add adds m to the open batches, and returns the batch it completed.
+func (b *BatchDecoder) add(m *Message) *Batch {
+	ref := m.Tags["batch"]
+
+	if m.Command == BATCH && len(m.Params) > 0 && len(m.Params[0]) > 1 {
+		switch m.Params[0][0] {
+		case '+':
+			batch := &Batch{
+				Ref:    m.Params[0][1:],
+				Type:   m.param(1),
+				parent: ref,
+			}
+			if len(m.Params) > 2 {
+				batch.Params = m.Params[2:]
+			}
+			if len(m.Trailing) > 0 {
+				batch.Params = append(batch.Params, m.Trailing)
+			}
+			b.open[batch.Ref] = batch
+			return nil
+
+		case '-':
+			batch, ok := b.open[m.Params[0][1:]]
+			if !ok {
+				break
+			}
+			delete(b.open, batch.Ref)
+
+			if parent, ok := b.open[batch.parent]; ok {
+				parent.Nested = append(parent.Nested, batch)
+				return nil
+			}
+			return batch
+		}
+	}
+
+	if batch, ok := b.open[ref]; ok && len(ref) > 0 {
+		batch.Messages = append(batch.Messages, m)
+		return nil
+	}
+
+	return &Batch{Messages: []*Message{m}}
+}
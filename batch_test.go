@@ -0,0 +1,75 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBatchDecoder(t *testing.T) {
+	stream := strings.Join([]string{
+		":irc.example.org NOTICE me :Before",
+		":irc.example.org BATCH +outer chathistory #channel",
+		"@batch=outer :nick!user@host PRIVMSG #channel :First",
+		"@batch=outer :irc.example.org BATCH +inner netsplit irc.example.org irc2.example.org",
+		":irc.example.org PING :Unbatched",
+		"@batch=inner :nick!user@host QUIT :irc.example.org irc2.example.org",
+		"@batch=outer :nick!user@host PRIVMSG #channel :Second",
+		":irc.example.org BATCH -inner",
+		":irc.example.org BATCH -outer",
+		"@batch=unknown :irc.example.org NOTICE me :After",
+		":irc.example.org BATCH -unknown",
+		"",
+	}, "\r\n")
+
+	dec := NewBatchDecoder(NewDecoder(strings.NewReader(stream)))
+
+	var batches []*Batch
+	for {
+		batch, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		batches = append(batches, batch)
+	}
+
+	if len(batches) != 5 {
+		t.Fatalf("Wrong number of batches: %d", len(batches))
+	}
+
+	single := []string{"Before", "Unbatched"}
+	for i, batch := range batches[:2] {
+		if len(batch.Type) > 0 || len(batch.Messages) != 1 || batch.Messages[0].Trailing != single[i] {
+			t.Errorf("Batch %d should be a single message: %+v", i, batch)
+		}
+	}
+
+	outer := batches[2]
+	if outer.Ref != "outer" || outer.Type != "chathistory" || !reflect.DeepEqual(outer.Params, []string{"#channel"}) {
+		t.Errorf("Wrong outer batch: %+v", outer)
+	}
+	if len(outer.Messages) != 2 || outer.Messages[1].Trailing != "Second" {
+		t.Errorf("Wrong outer messages: %v", outer.Messages)
+	}
+	if len(outer.Nested) != 1 {
+		t.Fatalf("Wrong number of nested batches: %d", len(outer.Nested))
+	}
+
+	inner := outer.Nested[0]
+	if inner.Type != "netsplit" || len(inner.Params) != 2 || len(inner.Messages) != 1 || inner.Messages[0].Command != QUIT {
+		t.Errorf("Wrong inner batch: %+v", inner)
+	}
+
+	// Messages referring to unknown batches are delivered on their own.
+	if len(batches[3].Messages) != 1 || batches[4].Messages[0].Command != BATCH {
+		t.Errorf("Wrong unknown batch messages: %+v %+v", batches[3], batches[4])
+	}
+}
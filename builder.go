@@ -0,0 +1,109 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"errors"
+	"strings"
+)
+
+// Errors returned for messages that can't be encoded.
+var (
+	ErrInvalidCommand = errors.New("irc: invalid command")
+	ErrInvalidParam   = errors.New("irc: invalid parameter")
+)
+
+// A Builder constructs a Message step by step:
+//
+//    m, err := irc.Build(irc.PRIVMSG).Tag("label", "1").Params("#go-nuts").Trailing("Hello there").Message()
+//
+// Only the trailing parameter may contain spaces, be empty or start with a
+// colon. The first error is returned by Message.
+type Builder struct {
+	m        Message
+	trailing bool
+	err      error
+}
+
+// Build returns a Builder for a message with the given command.
+func Build(command string) *Builder {
+	return &Builder{m: Message{Command: command}}
+}
+
+// Prefix sets the prefix of the message.
+func (b *Builder) Prefix(p *Prefix) *Builder {
+	b.m.Prefix = p
+	return b
+}
+
+// Tag adds a message tag. An empty value sends the tag without value.
+func (b *Builder) Tag(key, value string) *Builder {
+	if len(key) <= 0 || strings.ContainsAny(key, " ;=") {
+		b.fail(ErrInvalidParam)
+	}
+	if b.m.Tags == nil {
+		b.m.Tags = make(map[string]string)
+	}
+	b.m.Tags[key] = value
+	return b
+}
+
+// Params adds middle parameters, which must not contain spaces, be empty or
+// start with a colon.
+func (b *Builder) Params(params ...string) *Builder {
+	for _, param := range params {
+		if needsColon(param) {
+			b.fail(ErrInvalidParam)
+		}
+	}
+
+	// The trailing parameter must be the last one.
+	if b.trailing {
+		b.fail(ErrInvalidParam)
+	}
+	b.m.Params = append(b.m.Params, params...)
+	return b
+}
+
+// Trailing sets the last parameter, which may contain spaces.
+func (b *Builder) Trailing(text string) *Builder {
+	b.m.Trailing = text
+	b.trailing = true
+	return b
+}
+
+// Message returns the constructed message, or the first error.
+//
+// The trailing parameter is only sent with a leading colon if it needs one:
+// when it contains spaces, is empty or starts with a colon. Otherwise it is
+// added to Params instead of Trailing.
+func (b *Builder) Message() (*Message, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.m.Command) <= 0 || !validCommand(b.m.Command) {
+		return nil, ErrInvalidCommand
+	}
+
+	m := b.m.Copy()
+
+	if b.trailing {
+		if needsColon(m.Trailing) {
+			m.EmptyTrailing = len(m.Trailing) <= 0
+		} else {
+			m.Params = append(m.Params, m.Trailing)
+			m.Trailing = ""
+		}
+	}
+
+	return m, nil
+}
+
+// fail records err, unless an earlier error was recorded already.
+func (b *Builder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	tests := [...]struct {
+		b   *Builder
+		raw string
+	}{
+		{Build(PRIVMSG).Prefix(&Prefix{Name: "nick", User: "user", Host: "host"}).Tag("label", "1").Params("#go-nuts").Trailing("Hello there"), "@label=1 :nick!user@host PRIVMSG #go-nuts :Hello there"},
+		{Build(PRIVMSG).Params("#go-nuts").Trailing("Hello"), "PRIVMSG #go-nuts Hello"},
+		{Build(PRIVMSG).Params("#go-nuts").Trailing(":-)"), "PRIVMSG #go-nuts ::-)"},
+		{Build(TOPIC).Params("#go-nuts").Trailing(""), "TOPIC #go-nuts :"},
+		{Build(MODE).Params("#go-nuts", "+o", "nick"), "MODE #go-nuts +o nick"},
+		{Build(RPL_WELCOME).Params("nick").Trailing("Welcome"), "001 nick Welcome"},
+	}
+
+	for i, test := range tests {
+		m, err := test.b.Message()
+		if err != nil {
+			t.Errorf("Failed to build message %d: %v", i, err)
+			continue
+		}
+		if m.String() != test.raw {
+			t.Errorf("Failed to build message %d:", i)
+			t.Logf("Output: %s", m.String())
+		}
+	}
+}
+
+func TestBuilder_invalid(t *testing.T) {
+	tests := [...]*Builder{
+		Build(PRIVMSG).Params("#go nuts"),
+		Build(PRIVMSG).Params(""),
+		Build(PRIVMSG).Params(":#go-nuts"),
+		Build(PRIVMSG).Trailing("Hello").Params("#go-nuts"),
+		Build(PRIVMSG).Tag("", "value"),
+		Build(""),
+		Build("PRIV MSG"),
+	}
+
+	for i, b := range tests {
+		if m, err := b.Message(); err == nil {
+			t.Errorf("Message %d should be invalid: %s", i, m)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"sort"
+	"strings"
+)
+
+// Maximum length of the capability list in a single CAP REQ.
+const capReqLength = 400
+
+// CapError is returned by NegotiateCaps when the server refused to enable
+// some of the requested capabilities.
+type CapError struct {
+	Rejected []string // Capabilities in a CAP NAK reply
+}
+
+func (e *CapError) Error() string {
+	return "irc: capabilities rejected: " + strings.Join(e.Rejected, " ")
+}
+
+// NegotiateCaps performs IRCv3 capability negotiation. It lists the
+// capabilities supported by the server using CAP LS 302, requests those that
+// are also in wanted, and ends negotiation using CAP END.
+//
+// Returns the capabilities acknowledged by the server. If the server refused
+// some of them, the capabilities that were enabled are returned together with
+// a *CapError. Servers that don't support capability negotiation enable
+// nothing, which is not an error. A FAIL standard reply for CAP or for no
+// command in particular aborts negotiation, returning a *StandardReply.
+//
+// Capabilities in wanted that are offered later using CAP NEW, as sent by
+// servers supporting cap-notify, are requested when received using Decode or
+// DecodeContext. Capabilities removed using CAP DEL are disabled. See
+// EnabledCaps.
+//
+// NegotiateCaps should be called before registering using NICK and USER. Like
+// SASLPlain it reads from the connection itself until done or the timeout set
+// by SetTimeout expires. To authenticate using SASL, which has to happen
+// before negotiation ends, use RequestCaps instead.
+func (c *Conn) NegotiateCaps(wanted []string) (enabled []string, err error) {
+	defer func() {
+		if end := c.EndCaps(); err == nil {
+			err = end
+		}
+	}()
+	return c.RequestCaps(wanted)
+}
+
+// RequestCaps is like NegotiateCaps, but leaves negotiation open, so SASLPlain
+// or SASLExternal can authenticate before registering:
+//
+//    conn.RequestCaps([]string{"sasl", "multi-prefix"})
+//    conn.SASLPlain("user", "password")
+//    conn.EndCaps()
+//
+// EndCaps must be called afterwards, also after an error, or the server won't
+// complete registration.
+func (c *Conn) RequestCaps(wanted []string) (enabled []string, err error) {
+
+	c.mu.Lock()
+	c.wantedCaps = append([]string(nil), wanted...)
+	c.mu.Unlock()
+
+	if err = c.Encode(&Message{Command: CAP, Params: []string{CAP_LS, "302"}}); err != nil {
+		return nil, err
+	}
+
+	available := make(map[string]bool)
+	unsupported := false
+
+	err = c.await(func(m *Message) (bool, error) {
+		if m.Command == ERR_UNKNOWNCOMMAND && m.param(1) == CAP {
+			unsupported = true
+			return true, nil
+		}
+		if err := failure(m, "*", CAP); err != nil {
+			return true, err
+		}
+		if m.Command != CAP || m.param(1) != CAP_LS {
+			return false, nil
+		}
+
+		// Capabilities may have a value, like sasl=PLAIN,EXTERNAL.
+		for _, token := range capList(m) {
+			if i := indexByte(token, '='); i >= 0 {
+				token = token[:i]
+			}
+			available[token] = true
+		}
+
+		// More lines follow "CAP * LS * :multi-prefix sasl".
+		return m.param(2) != "*", nil
+	})
+	if err != nil || unsupported {
+		return nil, err
+	}
+
+	// We started capability negotiation, so it has to be ended.
+	c.beginCaps()
+
+	requests := capRequests(wanted, available)
+
+	for _, request := range requests {
+		if err = c.Encode(&Message{Command: CAP, Params: []string{CAP_REQ}, Trailing: request}); err != nil {
+			return nil, err
+		}
+	}
+
+	var rejected []string
+	pending := len(requests)
+
+	if pending > 0 {
+		err = c.await(func(m *Message) (bool, error) {
+			if err := failure(m, "*", CAP); err != nil {
+				return true, err
+			}
+			if m.Command != CAP {
+				return false, nil
+			}
+
+			switch m.param(1) {
+			case CAP_ACK:
+				for _, name := range capList(m) {
+					if name[0] != '-' {
+						enabled = append(enabled, name)
+					}
+				}
+			case CAP_NAK:
+				rejected = append(rejected, capList(m)...)
+			default:
+				return false, nil
+			}
+
+			// Each request is answered by a single ACK or NAK, unless
+			// the reply is split across multiple lines.
+			if m.param(2) != "*" {
+				pending--
+			}
+			return pending <= 0, nil
+		})
+	}
+
+	c.enableCaps(enabled)
+
+	if err == nil && len(rejected) > 0 {
+		err = &CapError{Rejected: rejected}
+	}
+
+	return enabled, err
+}
+
+// capRequests returns the wanted capabilities that are available, grouped
+// into CAP REQ parameters not exceeding capReqLength.
+func capRequests(wanted []string, available map[string]bool) (requests []string) {
+	var request string
+
+	for _, name := range wanted {
+		if !available[name] {
+			continue
+		}
+
+		// Don't request the same capability twice.
+		available[name] = false
+
+		if len(request) > 0 && len(request)+len(name)+1 > capReqLength {
+			requests = append(requests, request)
+			request = ""
+		}
+		if len(request) > 0 {
+			request += " "
+		}
+		request += name
+	}
+
+	if len(request) > 0 {
+		requests = append(requests, request)
+	}
+
+	return
+}
+
+// enableCaps records capabilities acknowledged by the server.
+func (c *Conn) enableCaps(names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.caps == nil {
+		c.caps = make(map[string]bool)
+	}
+	for _, name := range names {
+		c.caps[name] = true
+	}
+}
+
+// EnabledCaps returns the capabilities currently enabled, sorted by name.
+// The set is filled by NegotiateCaps and updated by CAP ACK and CAP DEL
+// messages received later using Decode or DecodeContext.
+func (c *Conn) EnabledCaps() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.caps))
+	for name, enabled := range c.caps {
+		if enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// capList returns the capabilities listed in a CAP reply, which are sent as
+// the last parameter, with or without a colon:
+//
+//    :irc.example.org CAP * LS :multi-prefix sasl
+//    :irc.example.org CAP * LS sasl
+func capList(m *Message) []string {
+	if params := m.allParams(); len(params) > 2 {
+		return strings.Fields(params[len(params)-1])
+	}
+	return nil
+}
+
+// updateCaps handles CAP ACK, NEW and DEL messages received after
+// negotiation. Returns the CAP REQ parameters for newly offered capabilities
+// we want. The caller must hold c.mu.
+//
+//    :irc.example.org CAP me NEW :away-notify sasl=PLAIN
+//    :irc.example.org CAP me DEL :sasl
+func (c *Conn) updateCaps(m *Message) (requests []string) {
+	names := capList(m)
+
+	if c.caps == nil {
+		c.caps = make(map[string]bool)
+	}
+
+	switch m.param(1) {
+	case CAP_ACK:
+		for _, name := range names {
+			if name[0] == '-' {
+				delete(c.caps, name[1:])
+			} else {
+				c.caps[name] = true
+			}
+		}
+
+	case CAP_DEL:
+		for _, name := range names {
+			delete(c.caps, name)
+		}
+
+	case CAP_NEW:
+		offered := make(map[string]bool)
+		for _, name := range names {
+			if i := indexByte(name, '='); i >= 0 {
+				name = name[:i]
+			}
+			offered[name] = !c.caps[name]
+		}
+		return capRequests(c.wantedCaps, offered)
+	}
+
+	return nil
+}
+
+// beginCaps records that capability negotiation started, and returns false if
+// it was started before.
+func (c *Conn) beginCaps() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	started := !c.capOpen
+	c.capOpen = true
+	return started
+}
+
+// EndCaps ends capability negotiation started by RequestCaps using CAP END.
+// This does nothing if negotiation was ended already, or never started.
+func (c *Conn) EndCaps() error {
+	c.mu.Lock()
+	open := c.capOpen
+	c.capOpen = false
+	c.mu.Unlock()
+
+	if !open {
+		return nil
+	}
+	return c.Encode(&Message{Command: CAP, Params: []string{CAP_END}})
+}
+
+// capEnabled returns true if the server acknowledged capability name.
+func (c *Conn) capEnabled(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.caps[name]
+}
@@ -0,0 +1,181 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConn_NegotiateCaps(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"CAP LS 302": {
+			":irc.example.org CAP * LS * :multi-prefix sasl=PLAIN,EXTERNAL",
+			":irc.example.org NOTICE * :Ignored",
+			":irc.example.org CAP * LS :away-notify server-time",
+		},
+		"CAP REQ :sasl server-time multi-prefix": {":irc.example.org CAP * ACK :sasl server-time multi-prefix"},
+		"CAP END":                                nil,
+		"AUTHENTICATE PLAIN":                     {"AUTHENTICATE +"},
+		"AUTHENTICATE dXNlcgB1c2VyAHBhc3M=":      {":irc.example.org 903 * :SASL authentication successful"},
+	})
+	defer conn.Close()
+
+	enabled, err := conn.NegotiateCaps([]string{"sasl", "server-time", "multi-prefix", "sasl", "batch"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(enabled, []string{"sasl", "server-time", "multi-prefix"}) {
+		t.Errorf("Wrong capabilities: %v", enabled)
+	}
+
+	// The sasl capability is enabled already, so no CAP REQ is expected.
+	if err := conn.SASLPlain("user", "pass"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestConn_RequestCaps(t *testing.T) {
+	conn, received := recordScript(t, map[string][]string{
+		"CAP LS 302":                        {":irc.example.org CAP * LS :sasl"},
+		"CAP REQ :sasl":                     {":irc.example.org CAP * ACK :sasl"},
+		"AUTHENTICATE PLAIN":                {"AUTHENTICATE +"},
+		"AUTHENTICATE dXNlcgB1c2VyAHBhc3M=": {":irc.example.org 903 * :SASL authentication successful"},
+		"CAP END":                           nil,
+	})
+
+	if _, err := conn.RequestCaps([]string{"sasl"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := conn.SASLPlain("user", "pass"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := conn.EndCaps(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	conn.Close()
+
+	// Negotiation ends once, after authenticating.
+	expected := []string{"CAP LS 302", "CAP REQ :sasl", "AUTHENTICATE PLAIN", "AUTHENTICATE dXNlcgB1c2VyAHBhc3M=", "CAP END"}
+	if lines := received(); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Wrong lines sent:")
+		t.Logf("Output: %q", lines)
+		t.Logf("Expected: %q", expected)
+	}
+}
+
+func TestConn_NegotiateCaps_noColon(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"CAP LS 302":    {":irc.example.org CAP * LS sasl"},
+		"CAP REQ :sasl": {":irc.example.org CAP * ACK sasl"},
+		"CAP END":       nil,
+	})
+	defer conn.Close()
+
+	enabled, err := conn.NegotiateCaps([]string{"sasl"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(enabled, []string{"sasl"}) {
+		t.Errorf("Wrong capabilities: %v", enabled)
+	}
+}
+
+func TestConn_NegotiateCaps_rejected(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"CAP LS 302":                 {":irc.example.org CAP * LS :multi-prefix sasl"},
+		"CAP REQ :multi-prefix sasl": {":irc.example.org CAP * NAK :multi-prefix sasl"},
+		"CAP END":                    nil,
+	})
+	defer conn.Close()
+
+	enabled, err := conn.NegotiateCaps([]string{"multi-prefix", "sasl"})
+	if len(enabled) > 0 {
+		t.Errorf("No capabilities should be enabled: %v", enabled)
+	}
+	if !reflect.DeepEqual(err, &CapError{Rejected: []string{"multi-prefix", "sasl"}}) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestConn_NegotiateCaps_fail(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"CAP LS 302":    {":irc.example.org CAP * LS :sasl"},
+		"CAP REQ :sasl": {":irc.example.org FAIL CAP INVALID_REQUEST :Try again later"},
+		"CAP END":       nil,
+	})
+	defer conn.Close()
+
+	_, err := conn.NegotiateCaps([]string{"sasl"})
+	if r, ok := err.(*StandardReply); !ok || r.Code != "INVALID_REQUEST" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestConn_NegotiateCaps_unsupported(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"CAP LS 302": {":irc.example.org 421 * CAP :Unknown command"},
+	})
+	defer conn.Close()
+
+	if enabled, err := conn.NegotiateCaps([]string{"sasl"}); err != nil || len(enabled) > 0 {
+		t.Errorf("Unexpected result: %v, %v", enabled, err)
+	}
+}
+
+func TestCapRequests(t *testing.T) {
+	var wanted []string
+	available := make(map[string]bool)
+
+	for i := 0; i < 100; i++ {
+		name := "example.org/capability" + strings.Repeat("x", i%10)
+		wanted = append(wanted, name+string(rune('a'+i%26))+string(rune('a'+i/26)))
+		available[wanted[i]] = true
+	}
+
+	requests := capRequests(wanted, available)
+	if len(requests) < 2 {
+		t.Fatalf("Expected multiple requests, got %d", len(requests))
+	}
+
+	var names []string
+	for _, request := range requests {
+		if len(request) > capReqLength {
+			t.Errorf("Request too long: %d", len(request))
+		}
+		names = append(names, strings.Fields(request)...)
+	}
+	if !reflect.DeepEqual(names, wanted) {
+		t.Error("Requests should contain every capability in order.")
+	}
+}
+
+func TestConn_capNotify(t *testing.T) {
+	input := strings.Join([]string{
+		":irc.example.org CAP me NEW :away-notify batch=draft sasl=PLAIN",
+		":irc.example.org CAP me ACK :away-notify batch",
+		":irc.example.org CAP me DEL :multi-prefix",
+		":irc.example.org CAP me ACK :-sasl",
+	}, "\r\n") + "\r\n"
+
+	buffer := new(bufferConn)
+	conn := NewConn(&readWriter{strings.NewReader(input), buffer})
+	conn.wantedCaps = []string{"batch", "away-notify", "sasl", "chghost"}
+	conn.caps = map[string]bool{"sasl": true, "multi-prefix": true}
+
+	for i := 0; i < 4; i++ {
+		if _, err := conn.Decode(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if expected := "CAP REQ :batch away-notify\r\n"; buffer.String() != expected {
+		t.Errorf("Wrong request: %q", buffer.String())
+	}
+	if enabled := conn.EnabledCaps(); !reflect.DeepEqual(enabled, []string{"away-notify", "batch"}) {
+		t.Errorf("Wrong capabilities: %v", enabled)
+	}
+}
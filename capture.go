@@ -0,0 +1,58 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bufio"
+	"compress/gzip"
+	"os"
+	"strings"
+)
+
+// Magic bytes at the start of a gzip file.
+const gzipMagic = "\x1f\x8b"
+
+// OpenCapture opens a file containing recorded IRC traffic, one message per
+// line, and returns a Decoder reading from it. Files ending in ".gz" or
+// starting with the gzip magic bytes are decompressed transparently, other
+// files are read as is:
+//
+//    dec, closeCapture, err := irc.OpenCapture("testdata/session.irc.gz")
+//    if err != nil {
+//        return err
+//    }
+//    defer closeCapture()
+//
+// The returned function closes the file. The Decoder returns io.EOF at the
+// end of the capture.
+func OpenCapture(path string) (*Decoder, func() error, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader := bufio.NewReaderSize(file, DefaultReadBufferSize)
+	magic, _ := reader.Peek(len(gzipMagic))
+
+	if !strings.HasSuffix(path, ".gz") && string(magic) != gzipMagic {
+		return NewDecoder(reader), file.Close, nil
+	}
+
+	unzip, err := gzip.NewReader(reader)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	closeCapture := func() error {
+		err := unzip.Close()
+		if ferr := file.Close(); err == nil {
+			err = ferr
+		}
+		return err
+	}
+
+	return NewDecoder(unzip), closeCapture, nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const captureTraffic = ":irc.example.org 001 me :Welcome\r\n" +
+	":nick!user@host PRIVMSG #channel :Hello\r\n" +
+	"PING :irc.example.org\r\n"
+
+func writeCapture(t *testing.T, path string, compress bool) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer file.Close()
+
+	var w io.Writer = file
+	if compress {
+		zip := gzip.NewWriter(file)
+		defer zip.Close()
+		w = zip
+	}
+
+	if _, err := io.WriteString(w, captureTraffic); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestOpenCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "irc-capture")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, test := range []struct {
+		name     string
+		compress bool
+	}{
+		{"session.log", false},
+		{"session.irc.gz", true},
+		{"session.irc", true}, // Detected using the magic bytes
+	} {
+		path := filepath.Join(dir, test.name)
+		writeCapture(t, path, test.compress)
+
+		dec, closeCapture, err := OpenCapture(path)
+		if err != nil {
+			t.Errorf("Failed to open capture %d: %v", i, err)
+			continue
+		}
+
+		commands := ""
+		for {
+			m, err := dec.Decode()
+			if err != nil {
+				if err != io.EOF {
+					t.Errorf("Unexpected error in capture %d: %v", i, err)
+				}
+				break
+			}
+			commands += m.Command + " "
+		}
+
+		if commands != "001 PRIVMSG PING " {
+			t.Errorf("Failed to read capture %d: %q", i, commands)
+		}
+		if err := closeCapture(); err != nil {
+			t.Errorf("Failed to close capture %d: %v", i, err)
+		}
+	}
+}
+
+func TestOpenCapture_invalid(t *testing.T) {
+	if _, _, err := OpenCapture(filepath.Join("testdata", "missing.irc")); !os.IsNotExist(err) {
+		t.Errorf("Expected a not exist error, got: %v", err)
+	}
+
+	file, err := ioutil.TempFile("", "irc-capture-*.gz")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer os.Remove(file.Name())
+
+	file.WriteString(captureTraffic)
+	file.Close()
+
+	if _, _, err := OpenCapture(file.Name()); err != gzip.ErrHeader {
+		t.Errorf("Expected gzip.ErrHeader, got: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+// A CaseMapping determines which nicks and channel names are equal. Servers
+// advertise it using the CASEMAPPING token in RPL_ISUPPORT, see
+// ISupport.CaseMapping.
+//
+// The zero value is rfc1459, the default.
+type CaseMapping string
+
+// Casemappings in use by servers.
+const (
+	CaseMappingASCII         CaseMapping = "ascii"
+	CaseMappingRFC1459       CaseMapping = "rfc1459"
+	CaseMappingStrictRFC1459 CaseMapping = "strict-rfc1459"
+)
+
+// Fold returns s folded to lower case, see Casefold.
+func (c CaseMapping) Fold(s string) string {
+	return Casefold(s, string(c))
+}
+
+// Equal returns true if a and b are the same name using this casemapping.
+func (c CaseMapping) Equal(a, b string) bool {
+	return c.Fold(a) == c.Fold(b)
+}
+
+// MatchMask is like the MatchMask function, but uses this casemapping.
+func (c CaseMapping) MatchMask(mask, hostmask string) bool {
+	return matchWildcard([]rune(c.Fold(mask)), []rune(c.Fold(hostmask)))
+}
+
+// Casefold returns s folded to lower case using the given casemapping, as
+// advertised by the CASEMAPPING token in RPL_ISUPPORT:
+//
+//    ascii:          A-Z equal a-z
+//    rfc1459:        Like ascii, and []\^ equal {}|~
+//    strict-rfc1459: Like ascii, and []\ equal {}|
+//
+// The rfc1459-strict spelling is accepted as well. Unknown casemappings are
+// treated as rfc1459, which is the default.
+// Characters outside of ASCII are never folded.
+func Casefold(s string, mapping string) string {
+	var upper byte
+	switch mapping {
+	case "ascii":
+		upper = 'Z'
+	case "strict-rfc1459", "rfc1459-strict":
+		upper = ']'
+	default:
+		upper = '^'
+	}
+
+	// Fast path, most names are lower case already.
+	i := 0
+	for ; i < len(s); i++ {
+		if s[i] >= 'A' && s[i] <= upper {
+			break
+		}
+	}
+	if i >= len(s) {
+		return s
+	}
+
+	b := []byte(s)
+	for ; i < len(b); i++ {
+		if b[i] >= 'A' && b[i] <= upper {
+			b[i] += 'a' - 'A'
+		}
+	}
+
+	return string(b)
+}
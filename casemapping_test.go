@@ -0,0 +1,58 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"testing"
+)
+
+func TestCasefold(t *testing.T) {
+	tests := [...]struct {
+		s, mapping, folded string
+	}{
+		{"Nick[]\\^", "ascii", "nick[]\\^"},
+		{"Nick[]\\^", "rfc1459", "nick{}|~"},
+		{"Nick[]\\^", "strict-rfc1459", "nick{}|^"},
+		{"Nick[]\\^", "unknown", "nick{}|~"},
+		{"already{}lower", "rfc1459", "already{}lower"},
+		{"ÀNick", "rfc1459", "Ànick"},
+	}
+
+	for i, test := range tests {
+		if folded := Casefold(test.s, test.mapping); folded != test.folded {
+			t.Errorf("Failed to fold %d: %q", i, folded)
+		}
+	}
+}
+
+func TestCaseMapping(t *testing.T) {
+	tests := [...]struct {
+		mapping CaseMapping
+		a, b    string
+		equal   bool
+	}{
+		{CaseMappingASCII, "Nick", "nick", true},
+		{CaseMappingASCII, "Nick[]\\^", "nick{}|~", false},
+		{CaseMappingASCII, "Nick[]\\^", "NICK[]\\^", true},
+		{CaseMappingRFC1459, "Nick[]\\^", "nick{}|~", true},
+		{CaseMappingStrictRFC1459, "Nick[]\\", "nick{}|", true},
+		{CaseMappingStrictRFC1459, "Nick^", "nick~", false},
+		{CaseMapping("rfc1459-strict"), "Nick^", "nick~", false},
+		{CaseMapping(""), "Nick^", "nick~", true},
+	}
+
+	for i, test := range tests {
+		if test.mapping.Equal(test.a, test.b) != test.equal {
+			t.Errorf("Failed to compare names %d: %q %q", i, test.a, test.b)
+		}
+	}
+
+	if !CaseMappingASCII.MatchMask("*!*@*.EXAMPLE.org", "nick!user@host.example.org") {
+		t.Error("Masks should be matched case-insensitively.")
+	}
+	if CaseMappingASCII.MatchMask("[nick]!*@*", "{nick}!user@host") {
+		t.Error("Masks should be matched using ascii.")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Batch type of the IRCv3 draft/chathistory specification.
+const chathistoryBatch = "chathistory"
+
+// A ChatHistoryRequest describes a CHATHISTORY command:
+//
+//    CHATHISTORY LATEST #channel * 50
+//    CHATHISTORY BEFORE #channel timestamp=2020-01-01T10:00:00.000Z 50
+//    CHATHISTORY BETWEEN #channel msgid=abc msgid=def 50
+type ChatHistoryRequest struct {
+	Subcommand string // CHATHISTORY_LATEST if empty
+	Target     string // Channel or nick
+
+	// References like "timestamp=2020-01-01T10:00:00.000Z", "msgid=abc" or
+	// "*". Reference defaults to "*", End is only used by BETWEEN.
+	Reference string
+	End       string
+
+	Limit int // Maximum number of messages, 50 if zero
+}
+
+// params returns the parameters of the CHATHISTORY command.
+func (r ChatHistoryRequest) params() []string {
+	subcommand, reference, limit := r.Subcommand, r.Reference, r.Limit
+	if len(subcommand) <= 0 {
+		subcommand = CHATHISTORY_LATEST
+	}
+	if len(reference) <= 0 {
+		reference = "*"
+	}
+	if limit <= 0 {
+		limit = 50
+	}
+
+	params := []string{subcommand, r.Target, reference}
+	if strings.EqualFold(subcommand, CHATHISTORY_BETWEEN) {
+		params = append(params, r.End)
+	}
+	return append(params, strconv.Itoa(limit))
+}
+
+// FetchHistory sends a CHATHISTORY command and returns the messages in the
+// resulting chathistory batch, sorted by their server-time tag. Messages
+// without a time tag are sorted first. Nested draft/multiline batches are
+// combined using JoinMultiline. Returns an empty slice if the server has no
+// history for the target.
+//
+// The draft/chathistory, batch and server-time capabilities should be
+// enabled, see NegotiateCaps. Returns a *StandardReply if the server answered
+// with FAIL, and ErrTimeout if the batch was not complete within the timeout
+// set by SetTimeout. Like NegotiateCaps, this reads from conn itself.
+func FetchHistory(conn *Conn, req ChatHistoryRequest) ([]*Message, error) {
+	if err := conn.Encode(&Message{Command: CHATHISTORY, Params: req.params()}); err != nil {
+		return nil, err
+	}
+
+	var (
+		batches  = &BatchDecoder{open: make(map[string]*Batch)}
+		messages []*Message
+	)
+
+	err := conn.await(func(m *Message) (bool, error) {
+		batch := batches.add(m)
+		switch {
+		case batch == nil:
+			return false, nil
+
+		case batch.Type == chathistoryBatch && len(batch.Params) > 0 && strings.EqualFold(batch.Params[0], req.Target):
+			messages = append(make([]*Message, 0, len(batch.Messages)), batch.Messages...)
+			for _, nested := range batch.Nested {
+				if m, ok := JoinMultiline(nested); ok {
+					messages = append(messages, m)
+				}
+			}
+			return true, nil
+
+		case m.Command == FAIL:
+			if err := failure(m, CHATHISTORY); err != nil {
+				return true, err
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(messages, func(i, j int) bool {
+		ti, _ := messages[i].Time()
+		tj, _ := messages[j].Time()
+		return ti.Before(tj)
+	})
+
+	return messages, nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"testing"
+)
+
+func TestFetchHistory(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"CHATHISTORY LATEST #channel * 50": {
+			":irc.example.org BATCH +h chathistory #channel",
+			"@batch=h;time=2020-01-01T10:00:02.000Z :nick!user@host PRIVMSG #channel :Second",
+			":irc.example.org NOTICE me :Ignored",
+			"@batch=h;time=2020-01-01T10:00:01.000Z :nick!user@host PRIVMSG #channel :First",
+			"@batch=h :nick!user@host BATCH +ml draft/multiline #channel",
+			"@batch=ml;time=2020-01-01T10:00:03.000Z :nick!user@host PRIVMSG #channel :Third",
+			"@batch=ml;time=2020-01-01T10:00:03.000Z :nick!user@host PRIVMSG #channel :line",
+			":nick!user@host BATCH -ml",
+			":irc.example.org BATCH -h",
+		},
+		"CHATHISTORY BETWEEN #empty msgid=a msgid=b 10": {
+			":irc.example.org BATCH +e chathistory #empty",
+			":irc.example.org BATCH -e",
+		},
+		"CHATHISTORY BEFORE #secret timestamp=2020-01-01T10:00:00.000Z 50": {
+			":irc.example.org FAIL CHATHISTORY INVALID_TARGET BEFORE #secret :Messages could not be retrieved",
+		},
+	})
+	defer conn.Close()
+
+	messages, err := FetchHistory(conn, ChatHistoryRequest{Target: "#channel"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"First", "Second", "Third\nline"}
+	if len(messages) != len(expected) {
+		t.Fatalf("Wrong number of messages: %v", messages)
+	}
+	for i, m := range messages {
+		if m.Trailing != expected[i] {
+			t.Errorf("Wrong message %d: %s", i, m)
+		}
+	}
+
+	messages, err = FetchHistory(conn, ChatHistoryRequest{
+		Subcommand: CHATHISTORY_BETWEEN,
+		Target:     "#empty",
+		Reference:  "msgid=a",
+		End:        "msgid=b",
+		Limit:      10,
+	})
+	if err != nil || len(messages) != 0 {
+		t.Errorf("Unexpected result: %v, %v", messages, err)
+	}
+
+	_, err = FetchHistory(conn, ChatHistoryRequest{
+		Subcommand: CHATHISTORY_BEFORE,
+		Target:     "#secret",
+		Reference:  "timestamp=2020-01-01T10:00:00.000Z",
+	})
+	if reply, ok := err.(*StandardReply); !ok || reply.Code != "INVALID_TARGET" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
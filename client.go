@@ -0,0 +1,326 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Number of alternative nicks a Client or Session tries if its nick is taken.
+const clientAltNicks = 3
+
+// A Client connects to a server, registers, and dispatches the messages it
+// receives to the handlers registered using On:
+//
+//    client := irc.NewClient(func(ctx context.Context) (*irc.Conn, error) {
+//        return irc.DialContext(ctx, "irc.example.org:6667")
+//    }, "nick", "user", "Real Name")
+//
+//    client.OnConnect(func(c *irc.Conn) {
+//        c.Join("#go-nuts")
+//    })
+//    client.On(irc.PRIVMSG, func(c *irc.Conn, m *irc.Message) {
+//        ...
+//    })
+//
+//    err := client.Run(ctx)
+//
+// PING messages are answered automatically. Capabilities are negotiated and
+// SASL authentication is done before registering, if configured. The dial
+// function may configure each new Conn further, for example using
+// SetRateLimit.
+//
+// A Client is configured before calling Run. It may be used from multiple
+// goroutines.
+type Client struct {
+	dial     func(ctx context.Context) (*Conn, error)
+	nick     string
+	user     string
+	realname string
+
+	pass       []string      // Server password, see SetPassword
+	caps       []string      // Capabilities to request, see SetCaps
+	saslUser   string        // Account for SASL PLAIN, see SetSASLPlain
+	saslPass   string        // Password for SASL PLAIN
+	reconnect  bool          // Reconnect after disconnecting, see SetReconnect
+	policy     BackoffPolicy // Delay between connection attempts
+	handlers   map[string][]Handler
+	connect    []func(*Conn)
+	disconnect []func(error)
+
+	mu       sync.Mutex
+	conn     *Conn // Current connection, nil if not registered
+	quitting bool  // Set by Quit
+}
+
+// NewClient returns a new Client connecting using dial, and registering with
+// the given nick, username and real name. If the nick is taken, alternatives
+// created by AlternativeNicks are tried.
+func NewClient(dial func(ctx context.Context) (*Conn, error), nick, user, realname string) *Client {
+	return &Client{
+		dial:     dial,
+		nick:     nick,
+		user:     user,
+		realname: realname,
+		handlers: make(map[string][]Handler),
+	}
+}
+
+// SetPassword sets the server password, sent using PASS before registering.
+func (c *Client) SetPassword(password string) {
+	c.mu.Lock()
+	c.pass = []string{password}
+	c.mu.Unlock()
+}
+
+// SetCaps sets the capabilities requested before registering, see
+// NegotiateCaps. Capabilities the server does not support are ignored.
+func (c *Client) SetCaps(caps ...string) {
+	c.mu.Lock()
+	c.caps = append([]string(nil), caps...)
+	c.mu.Unlock()
+}
+
+// SetSASLPlain authenticates using SASL PLAIN before registering, see
+// SASLPlain. Failing to authenticate is fatal.
+func (c *Client) SetSASLPlain(user, password string) {
+	c.mu.Lock()
+	c.saslUser, c.saslPass = user, password
+	c.mu.Unlock()
+}
+
+// SetReconnect makes Run connect again after the connection was lost, waiting
+// as configured by policy before every attempt. Without this, which is the
+// default, Run returns when the connection is lost.
+//
+// Run still returns if the server refused registration, or when the policy
+// allows no more attempts.
+func (c *Client) SetReconnect(policy BackoffPolicy) {
+	c.mu.Lock()
+	c.reconnect, c.policy = true, policy
+	c.mu.Unlock()
+}
+
+// On registers handler to be called for every message with the given command,
+// after registration. Commands are matched case-insensitively, both named
+// commands like PRIVMSG and numeric replies can be used. Several handlers may
+// be registered for a command, they are called in order.
+//
+// Handlers are called from the goroutine running Run, so a slow handler
+// delays reading the next message.
+func (c *Client) On(command string, handler func(c *Conn, m *Message)) {
+	command = strings.ToUpper(command)
+
+	c.mu.Lock()
+	c.handlers[command] = append(c.handlers[command], HandlerFunc(handler))
+	c.mu.Unlock()
+}
+
+// OnConnect registers fn to be called after every successful registration,
+// for example to join channels.
+func (c *Client) OnConnect(fn func(c *Conn)) {
+	c.mu.Lock()
+	c.connect = append(c.connect, fn)
+	c.mu.Unlock()
+}
+
+// OnDisconnect registers fn to be called after a registered connection was
+// lost, with the error that ended it.
+func (c *Client) OnDisconnect(fn func(err error)) {
+	c.mu.Lock()
+	c.disconnect = append(c.disconnect, fn)
+	c.mu.Unlock()
+}
+
+// Conn returns the current connection, or nil if the Client is not connected
+// and registered.
+func (c *Client) Conn() *Conn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn
+}
+
+// Quit disconnects using Conn.Quit with the given reason, after which Run
+// returns nil instead of reconnecting.
+func (c *Client) Quit(reason string) error {
+	c.mu.Lock()
+	c.quitting = true
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+	return conn.Quit(reason)
+}
+
+// Run connects, registers and dispatches messages until ctx is done, the
+// connection is lost, or Quit was called. Returns ctx.Err(), the error that
+// ended the connection, or nil after Quit.
+//
+// If reconnecting was enabled using SetReconnect, lost connections and
+// failed attempts to connect are retried instead. Returns a *RegisterError,
+// *SASLError or *StandardReply if the server refused us, which is never
+// retried.
+func (c *Client) Run(ctx context.Context) error {
+	attempt := 0 // Attempts to reconnect since the last registration
+
+	for {
+		conn, err := c.register(ctx)
+		if err == nil {
+			attempt = 0
+			err = c.serve(ctx, conn)
+		}
+
+		c.mu.Lock()
+		quitting, reconnect, policy := c.quitting, c.reconnect, c.policy
+		c.mu.Unlock()
+
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case quitting:
+			return nil
+		case !reconnect || fatal(err):
+			return err
+		case policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts:
+			return err
+		}
+
+		timer := time.NewTimer(policy.delay(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		attempt++
+	}
+}
+
+// fatal returns true if err means reconnecting would not help.
+func fatal(err error) bool {
+	switch err.(type) {
+	case *RegisterError, *SASLError, *StandardReply:
+		return true
+	}
+	return false
+}
+
+// register connects, negotiates capabilities, authenticates and registers.
+func (c *Client) register(ctx context.Context) (*Conn, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Abort registration when ctx is done.
+	stop := closeWhenDone(ctx, conn)
+	defer stop()
+
+	c.mu.Lock()
+	caps := append([]string(nil), c.caps...)
+	saslUser, saslPass, pass := c.saslUser, c.saslPass, c.pass
+	c.mu.Unlock()
+
+	conn.HandlePing()
+
+	if len(saslUser) > 0 {
+		caps = append(caps, "sasl")
+	}
+	if len(caps) > 0 {
+		if _, err = conn.RequestCaps(caps); err != nil {
+			if _, rejected := err.(*CapError); !rejected {
+				conn.Close()
+				return nil, err
+			}
+		}
+	}
+	if len(saslUser) > 0 {
+		if err = conn.SASLPlain(saslUser, saslPass); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if err = conn.EndCaps(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if _, err = conn.RegisterNicks(AlternativeNicks(c.nick, clientAltNicks), c.user, c.realname, pass...); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// serve dispatches messages from conn until reading fails or ctx is done.
+func (c *Client) serve(ctx context.Context, conn *Conn) error {
+	stop := closeWhenDone(ctx, conn)
+	defer stop()
+
+	c.mu.Lock()
+	if c.quitting {
+		// Quit was called while registering.
+		c.mu.Unlock()
+		return conn.Close()
+	}
+	c.conn = conn
+	connect := c.connect
+	c.mu.Unlock()
+
+	for _, fn := range connect {
+		fn(conn)
+	}
+
+	var err error
+	for {
+		var m *Message
+		if m, err = conn.Decode(); err != nil {
+			break
+		}
+		if m != nil {
+			c.dispatch(conn, m)
+		}
+	}
+	conn.Close()
+
+	c.mu.Lock()
+	c.conn = nil
+	disconnect := c.disconnect
+	c.mu.Unlock()
+
+	for _, fn := range disconnect {
+		fn(err)
+	}
+	return err
+}
+
+// dispatch calls the handlers registered for the command of m.
+func (c *Client) dispatch(conn *Conn, m *Message) {
+	c.mu.Lock()
+	handlers := c.handlers[strings.ToUpper(m.Command)]
+	c.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler.ServeIRC(conn, m)
+	}
+}
+
+// closeWhenDone closes conn once ctx is done, until stop is called.
+func closeWhenDone(ctx context.Context, conn *Conn) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,122 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestClient_Run(t *testing.T) {
+	dial := func(ctx context.Context) (*Conn, error) {
+		return script(t, map[string][]string{
+			"CAP LS 302":                        {":irc.example.org CAP * LS :sasl multi-prefix"},
+			"CAP REQ :multi-prefix sasl":        {":irc.example.org CAP * ACK :multi-prefix sasl"},
+			"CAP END":                           nil,
+			"AUTHENTICATE PLAIN":                {"AUTHENTICATE +"},
+			"AUTHENTICATE dXNlcgB1c2VyAHBhc3M=": {":irc.example.org 903 * :SASL authentication successful"},
+			"NICK sorcix":                       nil,
+			"USER sorcix 0 * :Vic D":            {":irc.example.org 001 sorcix :Welcome"},
+			"JOIN #channel":                     {"PING :cookie"},
+			"PONG :cookie":                      {":friend!user@example.org PRIVMSG sorcix :Hello"},
+		}), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	client := NewClient(dial, "sorcix", "sorcix", "Vic D")
+	client.SetCaps("multi-prefix")
+	client.SetSASLPlain("user", "pass")
+
+	var connected, disconnected bool
+	var received *Message
+
+	client.OnConnect(func(c *Conn) {
+		connected = true
+		c.Join("#channel")
+	})
+	client.OnDisconnect(func(err error) {
+		disconnected = true
+	})
+	client.On("privmsg", func(c *Conn, m *Message) {
+		received = m
+		cancel()
+	})
+
+	if err := client.Run(ctx); err != context.Canceled {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !connected || !disconnected {
+		t.Errorf("Callbacks not called: connect %t, disconnect %t", connected, disconnected)
+	}
+	if received == nil || received.Trailing != "Hello" {
+		t.Errorf("Wrong message: %v", received)
+	}
+	if client.Conn() != nil {
+		t.Errorf("Conn not reset after disconnecting")
+	}
+}
+
+func TestClient_Run_reconnect(t *testing.T) {
+	refused := errors.New("connection refused")
+	dials := 0
+
+	dial := func(ctx context.Context) (*Conn, error) {
+		if dials++; dials == 2 {
+			return nil, refused
+		}
+		return script(t, map[string][]string{
+			"NICK sorcix":       nil,
+			"USER sorcix 0 * :": {":irc.example.org 001 sorcix :Welcome"},
+		}), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	client := NewClient(dial, "sorcix", "sorcix", "")
+	client.SetReconnect(BackoffPolicy{Min: time.Millisecond, MaxAttempts: 2})
+
+	var errs []error
+	client.OnConnect(func(c *Conn) {
+		if dials == 1 {
+			c.Close()
+		} else {
+			cancel()
+		}
+	})
+	client.OnDisconnect(func(err error) {
+		errs = append(errs, err)
+	})
+
+	if err := client.Run(ctx); err != context.Canceled {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if dials != 3 {
+		t.Errorf("Wrong number of dials: %d", dials)
+	}
+	if len(errs) != 2 || errs[0] != ErrConnClosed {
+		t.Errorf("Wrong disconnect errors: %v", errs)
+	}
+}
+
+func TestClient_Run_refused(t *testing.T) {
+	dial := func(ctx context.Context) (*Conn, error) {
+		return script(t, map[string][]string{
+			"NICK sorcix":       nil,
+			"USER sorcix 0 * :": {":irc.example.org 465 * :You are banned"},
+		}), nil
+	}
+
+	client := NewClient(dial, "sorcix", "sorcix", "")
+	client.SetReconnect(BackoffPolicy{Min: time.Millisecond})
+
+	if _, ok := client.Run(context.Background()).(*RegisterError); !ok {
+		t.Errorf("Expected a *RegisterError")
+	}
+}
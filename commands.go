@@ -0,0 +1,265 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sorcix/irc/ctcp"
+)
+
+// The methods in this file are shortcuts for sending common commands.
+//
+// They all build a Message and call Encode, so they may be used from multiple
+// goroutines. As with Message.Bytes, text exceeding the maximum message length
+// is truncated.
+
+// SendRaw formats according to a format specifier and writes the result as a
+// single raw line. Unlike the other helpers, the result is not checked for
+// line breaks, so don't use it with untrusted arguments.
+func (c *Conn) SendRaw(format string, args ...interface{}) (err error) {
+	_, err = c.Write([]byte(fmt.Sprintf(format, args...)))
+	return
+}
+
+// Privmsg sends text to target, which is either a nick or a channel.
+func (c *Conn) Privmsg(target, text string) error {
+	return c.Encode(&Message{
+		Command:  PRIVMSG,
+		Params:   []string{target},
+		Trailing: text,
+	})
+}
+
+// DefaultPrefixLength is a conservative estimate of the length of the
+// nick!user@host prefix the server adds to our messages.
+const DefaultPrefixLength = 100
+
+// PrivmsgSplit sends text to target, split over as many PRIVMSG messages as
+// needed to avoid truncation. See SplitPrivmsg.
+//
+// The length of our prefix is estimated using DefaultPrefixLength, see
+// MaxPayload. Use SplitPrivmsg directly to use a better estimate.
+func (c *Conn) PrivmsgSplit(target, text string) error {
+	for _, part := range splitText(text, MaxPayload(nil, PRIVMSG, target)) {
+		if err := c.Privmsg(target, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MaxPayload returns the number of bytes available for the text of a message
+// sending command to target, after the server added the given prefix:
+//
+//    :nick!user@host PRIVMSG #channel :text
+//
+// The whole line, including CR+LF, must fit in 512 bytes to reach other
+// clients completely. A nil prefix is assumed to be DefaultPrefixLength long,
+// as the server may use a different hostmask than we know.
+func MaxPayload(prefix *Prefix, command, target string) int {
+	length := DefaultPrefixLength
+	if prefix != nil {
+		length = prefix.Len()
+	}
+	return maxPayload(length, command, target)
+}
+
+// maxPayload is like MaxPayload, using the length of the prefix.
+func maxPayload(prefixLength int, command, target string) int {
+	// :prefix COMMAND target :text
+	n := maxLength - prefixLength - len(command) - len(target) - 5
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// SplitPrivmsg returns PRIVMSG messages sending text to target, each short
+// enough to reach other clients completely after the server has added our
+// nick!user@host prefix of the given length.
+//
+// The text is split between words where possible, very long words are split
+// between UTF-8 encoded characters. Returns nil for empty text. See
+// MaxPayload.
+func SplitPrivmsg(target, text string, prefixLength int) (messages []*Message) {
+	for _, part := range splitText(text, maxPayload(prefixLength, PRIVMSG, target)) {
+		messages = append(messages, &Message{
+			Command:  PRIVMSG,
+			Params:   []string{target},
+			Trailing: part,
+		})
+	}
+
+	return messages
+}
+
+// splitText splits text into parts of at most n bytes, preferably at spaces.
+// Parts contain at least one character, even if it is longer than n.
+func splitText(text string, n int) (parts []string) {
+	for len(text) > n {
+
+		// A space right after the limit can be dropped as well.
+		if i := strings.LastIndex(text[:n+1], " "); i > 0 {
+			parts = append(parts, text[:i])
+			text = text[i+1:]
+			continue
+		}
+
+		i := n
+		for i > 0 && !utf8.RuneStart(text[i]) {
+			i--
+		}
+		if i <= 0 {
+			_, i = utf8.DecodeRuneInString(text)
+		}
+
+		parts = append(parts, text[:i])
+		text = text[i:]
+	}
+
+	if len(text) > 0 {
+		parts = append(parts, text)
+	}
+
+	return parts
+}
+
+// Action sends a CTCP ACTION to target, which is shown like "* nick text".
+func (c *Conn) Action(target, text string) error {
+	return c.Privmsg(target, ctcp.Action(text))
+}
+
+// Join joins channel.
+func (c *Conn) Join(channel string) error {
+	return c.Encode(&Message{
+		Command: JOIN,
+		Params:  []string{channel},
+	})
+}
+
+// Part leaves channel. The reason is optional.
+func (c *Conn) Part(channel, reason string) error {
+	return c.Encode(&Message{
+		Command:  PART,
+		Params:   []string{channel},
+		Trailing: reason,
+	})
+}
+
+// Topic changes the topic of channel. An empty topic removes it.
+//
+// Topics longer than TOPICLEN, as advertised by the server, are truncated
+// instead of leaving that to the server.
+func (c *Conn) Topic(channel, topic string) error {
+	c.mu.Lock()
+	n, ok := c.support.TopicLen()
+	c.mu.Unlock()
+
+	if ok {
+		topic = truncateString(topic, n)
+	}
+
+	return c.Encode(&Message{
+		Command:       TOPIC,
+		Params:        []string{channel},
+		Trailing:      topic,
+		EmptyTrailing: len(topic) <= 0,
+	})
+}
+
+// Away marks us as away with the given message, which is sent to users
+// messaging us. Messages longer than AWAYLEN, as advertised by the server, are
+// truncated. An empty message is the same as Back.
+func (c *Conn) Away(message string) error {
+	c.mu.Lock()
+	n, ok := c.support.AwayLen()
+	c.mu.Unlock()
+
+	if ok {
+		message = truncateString(message, n)
+	}
+
+	return c.Encode(&Message{Command: AWAY, Trailing: message})
+}
+
+// Back marks us as no longer away.
+func (c *Conn) Back() error {
+	return c.Encode(&Message{Command: AWAY})
+}
+
+// truncateString shortens s to at most n bytes, without splitting a UTF-8
+// encoded character.
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return string(truncateUTF8([]byte(s), n))
+}
+
+// Nick sets or changes the nickname.
+func (c *Conn) Nick(name string) error {
+	return c.Encode(&Message{
+		Command: NICK,
+		Params:  []string{name},
+	})
+}
+
+// Pass sets the connection password. It must be sent before Nick.
+func (c *Conn) Pass(password string) error {
+	return c.Encode(&Message{
+		Command: PASS,
+		Params:  []string{password},
+	})
+}
+
+// User sends the username and real name used to register the connection.
+// It must be sent after Nick.
+func (c *Conn) User(user, realname string) error {
+	return c.Encode(&Message{
+		Command:       USER,
+		Params:        []string{user, "0", "*"},
+		Trailing:      realname,
+		EmptyTrailing: true,
+	})
+}
+
+// ErrInvalidIP is returned by WebIRC if the IP address is not valid.
+var ErrInvalidIP = errors.New("irc: invalid IP address")
+
+// WebIRC passes the real hostname and IP address of a user connecting through
+// a gateway to the server, using the password configured for the gateway.
+// It must be sent before anything else, so also before using Register.
+//
+// Returns ErrInvalidIP if ip is not a valid IP address, and ErrInvalidParam
+// if the password, gateway or hostname is empty, contains spaces or starts
+// with a colon.
+func (c *Conn) WebIRC(password, gateway, hostname, ip string) error {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ErrInvalidIP
+	}
+
+	for _, param := range []string{password, gateway, hostname} {
+		if len(param) == 0 || strings.ContainsRune(param, ' ') || param[0] == ':' {
+			return ErrInvalidParam
+		}
+	}
+
+	// Parameters can't start with a colon, as in "::1".
+	ip = addr.String()
+	if ip[0] == ':' {
+		ip = "0" + ip
+	}
+
+	return c.Encode(&Message{
+		Command: WEBIRC,
+		Params:  []string{password, gateway, hostname, ip},
+	})
+}
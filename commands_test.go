@@ -0,0 +1,270 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+// bufferConn is an io.ReadWriteCloser that records everything written.
+type bufferConn struct {
+	bytes.Buffer
+	mu sync.Mutex
+}
+
+func (b *bufferConn) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func (b *bufferConn) Close() error {
+	return nil
+}
+
+func TestConn_commands(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(buffer)
+
+	conn.Pass("secret")
+	conn.Nick("sorcix")
+	conn.Join("#test")
+	conn.Privmsg("#test", "Hello there!")
+	conn.Action("#test", "waves")
+	conn.Part("#test", "")
+	conn.Part("#test", "Bye!")
+	conn.SendRaw("MODE %s %s", "sorcix", "+i")
+
+	expected := "PASS secret\r\n" +
+		"NICK sorcix\r\n" +
+		"JOIN #test\r\n" +
+		"PRIVMSG #test :Hello there!\r\n" +
+		"PRIVMSG #test :\x01ACTION waves\x01\r\n" +
+		"PART #test\r\n" +
+		"PART #test :Bye!\r\n" +
+		"MODE sorcix +i\r\n"
+
+	if buffer.String() != expected {
+		t.Errorf("Commands were not encoded correctly:\n%s", buffer.String())
+	}
+}
+
+func TestConn_Topic(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(&readWriter{strings.NewReader(":irc.example.org 005 me TOPICLEN=7 :are supported by this server\r\n"), buffer})
+
+	conn.Topic("#test", "Welcome to #test")
+	conn.Decode()
+	conn.Topic("#test", "Welcome to #test")
+	conn.Topic("#test", "Grüüüü")
+	conn.Topic("#test", "")
+
+	expected := "TOPIC #test :Welcome to #test\r\n" +
+		"TOPIC #test :Welcome\r\n" +
+		"TOPIC #test :Grüü\r\n" +
+		"TOPIC #test :\r\n"
+
+	if buffer.String() != expected {
+		t.Errorf("Commands were not encoded correctly:\n%s", buffer.String())
+	}
+
+	if features := conn.ISupport(); !features.Has("TOPICLEN") {
+		t.Errorf("Features should be tracked: %v", features.Tokens)
+	}
+}
+
+func TestConn_Away(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(&readWriter{strings.NewReader(":irc.example.org 005 me AWAYLEN=4 :are supported by this server\r\n"), buffer})
+
+	conn.Away("Gone fishing")
+	conn.Back()
+	conn.Decode()
+	conn.Away("Gone fishing")
+	conn.Away("")
+
+	expected := "AWAY :Gone fishing\r\n" +
+		"AWAY\r\n" +
+		"AWAY :Gone\r\n" +
+		"AWAY\r\n"
+
+	if buffer.String() != expected {
+		t.Errorf("Commands were not encoded correctly:\n%s", buffer.String())
+	}
+}
+
+func TestConn_WebIRC(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(buffer)
+
+	conn.WebIRC("secret", "gateway", "host.example.org", "192.0.2.1")
+	conn.WebIRC("secret", "gateway", "host.example.org", "::1")
+
+	expected := "WEBIRC secret gateway host.example.org 192.0.2.1\r\n" +
+		"WEBIRC secret gateway host.example.org 0::1\r\n"
+
+	if buffer.String() != expected {
+		t.Errorf("Commands were not encoded correctly:\n%s", buffer.String())
+	}
+
+	if err := conn.WebIRC("secret", "gateway", "host.example.org", "192.0.2"); err != ErrInvalidIP {
+		t.Errorf("Expected ErrInvalidIP, got: %v", err)
+	}
+	if err := conn.WebIRC("secret", "gateway", "evil host", "192.0.2.1"); err != ErrInvalidParam {
+		t.Errorf("Expected ErrInvalidParam, got: %v", err)
+	}
+	for i, password := range []string{"", "two words", ":secret"} {
+		if err := conn.WebIRC(password, "gateway", "host.example.org", "192.0.2.1"); err != ErrInvalidParam {
+			t.Errorf("Expected ErrInvalidParam for password %d, got: %v", i, err)
+		}
+	}
+	if buffer.String() != expected {
+		t.Errorf("Invalid commands should not be sent:\n%s", buffer.String())
+	}
+}
+
+func TestConn_Privmsg_injection(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(buffer)
+
+	if err := conn.Privmsg("#chan", "hi\r\nJOIN #evil"); err != ErrInvalidParam {
+		t.Errorf("Expected ErrInvalidParam, got: %v", err)
+	}
+
+	conn.SetStripInvalid(true)
+	conn.Privmsg("#chan", "hi\r\nJOIN #evil")
+
+	if buffer.String() != "PRIVMSG #chan :hiJOIN #evil\r\n" {
+		t.Errorf("Only a single command should be sent: %q", buffer.String())
+	}
+}
+
+func TestConn_Privmsg_long(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(buffer)
+
+	conn.Privmsg("#test", strings.Repeat("a", 1000))
+
+	if buffer.Len() != maxLength+len(endline) {
+		t.Errorf("Long message should be truncated, got %d bytes", buffer.Len())
+	}
+}
+
+func TestConn_concurrent(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(buffer)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn.Privmsg("#test", "Hello there!")
+		}()
+	}
+	wg.Wait()
+
+	if buffer.String() != strings.Repeat("PRIVMSG #test :Hello there!\r\n", 50) {
+		t.Error("Concurrent messages were corrupted!")
+	}
+}
+
+func TestConn_Quit(t *testing.T) {
+	client, server := net.Pipe()
+	conn := NewConn(client)
+	peer := NewConn(server)
+
+	go func() {
+		peer.Decode()
+		peer.Write([]byte("ERROR :Closing link"))
+		peer.Close()
+	}()
+
+	if err := conn.Quit("Bye!"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := conn.Quit("Bye!"); err != nil {
+		t.Fatalf("Second call should do nothing, got: %v", err)
+	}
+
+	if _, err := client.Write([]byte("test")); err == nil {
+		t.Fatal("Connection should be closed!")
+	}
+}
+
+func TestSplitPrivmsg(t *testing.T) {
+	prefix := &Prefix{Name: strings.Repeat("n", 9), User: strings.Repeat("u", 10), Host: strings.Repeat("h", 30)}
+
+	long := strings.Repeat("word ", 300) + strings.Repeat("€", 300) + " end"
+	messages := SplitPrivmsg("#test", long, prefix.Len())
+
+	var parts []string
+	for i, m := range messages {
+		m.Prefix = prefix
+
+		if len(m.String()) > maxLength {
+			t.Errorf("Message %d is too long: %d bytes", i, len(m.String()))
+		}
+
+		if p := ParseMessage(m.String()); p == nil || p.Params[0] != "#test" || p.Trailing != m.Trailing {
+			t.Errorf("Message %d failed the encode-decode sequence!", i)
+		}
+
+		parts = append(parts, m.Trailing)
+	}
+
+	// Only spaces used for splitting are lost.
+	if strings.Replace(strings.Join(parts, ""), " ", "", -1) != strings.Replace(long, " ", "", -1) {
+		t.Error("Split messages don't contain the original text!")
+	}
+
+	for i, part := range parts[:len(parts)-1] {
+		if strings.HasSuffix(part, " ") || !utf8.ValidString(part) {
+			t.Errorf("Part %d was split badly: %q", i, part)
+		}
+	}
+
+	if SplitPrivmsg("#test", "", 0) != nil {
+		t.Error("Empty text should not result in messages!")
+	}
+	if len(SplitPrivmsg("#test", "short", DefaultPrefixLength)) != 1 {
+		t.Error("Short text should not be split!")
+	}
+}
+
+func TestMaxPayload(t *testing.T) {
+	prefix := &Prefix{Name: "nick", User: "user", Host: "example.org"}
+
+	n := MaxPayload(prefix, PRIVMSG, "#channel")
+	m := &Message{Prefix: prefix, Command: PRIVMSG, Params: []string{"#channel"}, Trailing: strings.Repeat("a", n)}
+	if length := len(m.Bytes()) + 2; length != 512 {
+		t.Errorf("Payload of %d bytes should fill the line exactly, got %d bytes", n, length)
+	}
+
+	if unknown := MaxPayload(nil, PRIVMSG, "#channel"); unknown >= n || unknown != 510-DefaultPrefixLength-len("PRIVMSG")-len("#channel")-5 {
+		t.Errorf("Unknown prefix should assume DefaultPrefixLength: %d", unknown)
+	}
+
+	if n := MaxPayload(prefix, PRIVMSG, strings.Repeat("#", 600)); n != 0 {
+		t.Errorf("Payload should not be negative: %d", n)
+	}
+}
+
+func TestConn_PrivmsgSplit(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(buffer)
+
+	conn.PrivmsgSplit("#test", strings.Repeat("a", 800))
+
+	if strings.Count(buffer.String(), "PRIVMSG #test :") != 3 || strings.Count(buffer.String(), "a") != 800 {
+		t.Errorf("Message was not split correctly: %q", buffer.String())
+	}
+}
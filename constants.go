@@ -234,6 +234,13 @@ const (
 	ERR_USERSDONTMATCH    = "502"
 )
 
+// Numeric IRC replies that are not part of an RFC, but are used by most servers.
+const (
+	RPL_WHOISACCOUNT = "330"
+	RPL_TOPICWHOTIME = "333"
+	RPL_WHOSPCRPL    = "354" // WHOX reply
+)
+
 // IRC commands extracted from the IRCv3 spec at http://www.ircv3.org/.
 const (
 	CAP       = "CAP"
@@ -244,8 +251,28 @@ const (
 	CAP_NAK   = "NAK"   // Subcommand (param)
 	CAP_CLEAR = "CLEAR" // Subcommand (param)
 	CAP_END   = "END"   // Subcommand (param)
+	CAP_NEW   = "NEW"   // Subcommand (param)
+	CAP_DEL   = "DEL"   // Subcommand (param)
+
+	CHATHISTORY         = "CHATHISTORY"
+	CHATHISTORY_LATEST  = "LATEST"  // Subcommand (param)
+	CHATHISTORY_BEFORE  = "BEFORE"  // Subcommand (param)
+	CHATHISTORY_AFTER   = "AFTER"   // Subcommand (param)
+	CHATHISTORY_AROUND  = "AROUND"  // Subcommand (param)
+	CHATHISTORY_BETWEEN = "BETWEEN" // Subcommand (param)
 
+	ACCOUNT      = "ACCOUNT"
 	AUTHENTICATE = "AUTHENTICATE"
+	BATCH        = "BATCH"
+	CHGHOST      = "CHGHOST"
+	FAIL         = "FAIL"
+	MONITOR      = "MONITOR"
+	NOTE         = "NOTE"
+	SETNAME      = "SETNAME"
+	STARTTLS     = "STARTTLS"
+	TAGMSG       = "TAGMSG"
+	WARN         = "WARN"
+	WEBIRC       = "WEBIRC"
 )
 
 // Numeric IRC replies extracted from the IRCv3 spec.
@@ -259,4 +286,183 @@ const (
 	ERR_SASLABORTED = "906"
 	ERR_SASLALREADY = "907"
 	RPL_SASLMECHS   = "908"
+	RPL_STARTTLS    = "670"
+	ERR_STARTTLS    = "691"
+
+	RPL_MONONLINE    = "730"
+	RPL_MONOFFLINE   = "731"
+	RPL_MONLIST      = "732"
+	RPL_ENDOFMONLIST = "733"
+	ERR_MONLISTFULL  = "734"
 )
+
+// numericNames maps numeric replies to their symbolic names.
+//
+// RPL_BOUNCE is omitted in favour of RPL_ISUPPORT, which uses the same number.
+var numericNames = map[string]string{
+	RPL_WELCOME:           "RPL_WELCOME",
+	RPL_YOURHOST:          "RPL_YOURHOST",
+	RPL_CREATED:           "RPL_CREATED",
+	RPL_MYINFO:            "RPL_MYINFO",
+	RPL_ISUPPORT:          "RPL_ISUPPORT",
+	RPL_USERHOST:          "RPL_USERHOST",
+	RPL_ISON:              "RPL_ISON",
+	RPL_AWAY:              "RPL_AWAY",
+	RPL_UNAWAY:            "RPL_UNAWAY",
+	RPL_NOWAWAY:           "RPL_NOWAWAY",
+	RPL_WHOISUSER:         "RPL_WHOISUSER",
+	RPL_WHOISSERVER:       "RPL_WHOISSERVER",
+	RPL_WHOISOPERATOR:     "RPL_WHOISOPERATOR",
+	RPL_WHOISIDLE:         "RPL_WHOISIDLE",
+	RPL_ENDOFWHOIS:        "RPL_ENDOFWHOIS",
+	RPL_WHOISCHANNELS:     "RPL_WHOISCHANNELS",
+	RPL_WHOWASUSER:        "RPL_WHOWASUSER",
+	RPL_ENDOFWHOWAS:       "RPL_ENDOFWHOWAS",
+	RPL_LISTSTART:         "RPL_LISTSTART",
+	RPL_LIST:              "RPL_LIST",
+	RPL_LISTEND:           "RPL_LISTEND",
+	RPL_UNIQOPIS:          "RPL_UNIQOPIS",
+	RPL_CHANNELMODEIS:     "RPL_CHANNELMODEIS",
+	RPL_NOTOPIC:           "RPL_NOTOPIC",
+	RPL_TOPIC:             "RPL_TOPIC",
+	RPL_INVITING:          "RPL_INVITING",
+	RPL_SUMMONING:         "RPL_SUMMONING",
+	RPL_INVITELIST:        "RPL_INVITELIST",
+	RPL_ENDOFINVITELIST:   "RPL_ENDOFINVITELIST",
+	RPL_EXCEPTLIST:        "RPL_EXCEPTLIST",
+	RPL_ENDOFEXCEPTLIST:   "RPL_ENDOFEXCEPTLIST",
+	RPL_VERSION:           "RPL_VERSION",
+	RPL_WHOREPLY:          "RPL_WHOREPLY",
+	RPL_ENDOFWHO:          "RPL_ENDOFWHO",
+	RPL_NAMREPLY:          "RPL_NAMREPLY",
+	RPL_ENDOFNAMES:        "RPL_ENDOFNAMES",
+	RPL_LINKS:             "RPL_LINKS",
+	RPL_ENDOFLINKS:        "RPL_ENDOFLINKS",
+	RPL_BANLIST:           "RPL_BANLIST",
+	RPL_ENDOFBANLIST:      "RPL_ENDOFBANLIST",
+	RPL_INFO:              "RPL_INFO",
+	RPL_ENDOFINFO:         "RPL_ENDOFINFO",
+	RPL_MOTDSTART:         "RPL_MOTDSTART",
+	RPL_MOTD:              "RPL_MOTD",
+	RPL_ENDOFMOTD:         "RPL_ENDOFMOTD",
+	RPL_YOUREOPER:         "RPL_YOUREOPER",
+	RPL_REHASHING:         "RPL_REHASHING",
+	RPL_YOURESERVICE:      "RPL_YOURESERVICE",
+	RPL_TIME:              "RPL_TIME",
+	RPL_USERSSTART:        "RPL_USERSSTART",
+	RPL_USERS:             "RPL_USERS",
+	RPL_ENDOFUSERS:        "RPL_ENDOFUSERS",
+	RPL_NOUSERS:           "RPL_NOUSERS",
+	RPL_TRACELINK:         "RPL_TRACELINK",
+	RPL_TRACECONNECTING:   "RPL_TRACECONNECTING",
+	RPL_TRACEHANDSHAKE:    "RPL_TRACEHANDSHAKE",
+	RPL_TRACEUNKNOWN:      "RPL_TRACEUNKNOWN",
+	RPL_TRACEOPERATOR:     "RPL_TRACEOPERATOR",
+	RPL_TRACEUSER:         "RPL_TRACEUSER",
+	RPL_TRACESERVER:       "RPL_TRACESERVER",
+	RPL_TRACESERVICE:      "RPL_TRACESERVICE",
+	RPL_TRACENEWTYPE:      "RPL_TRACENEWTYPE",
+	RPL_TRACECLASS:        "RPL_TRACECLASS",
+	RPL_TRACERECONNECT:    "RPL_TRACERECONNECT",
+	RPL_TRACELOG:          "RPL_TRACELOG",
+	RPL_TRACEEND:          "RPL_TRACEEND",
+	RPL_STATSLINKINFO:     "RPL_STATSLINKINFO",
+	RPL_STATSCOMMANDS:     "RPL_STATSCOMMANDS",
+	RPL_ENDOFSTATS:        "RPL_ENDOFSTATS",
+	RPL_STATSUPTIME:       "RPL_STATSUPTIME",
+	RPL_STATSOLINE:        "RPL_STATSOLINE",
+	RPL_UMODEIS:           "RPL_UMODEIS",
+	RPL_SERVLIST:          "RPL_SERVLIST",
+	RPL_SERVLISTEND:       "RPL_SERVLISTEND",
+	RPL_LUSERCLIENT:       "RPL_LUSERCLIENT",
+	RPL_LUSEROP:           "RPL_LUSEROP",
+	RPL_LUSERUNKNOWN:      "RPL_LUSERUNKNOWN",
+	RPL_LUSERCHANNELS:     "RPL_LUSERCHANNELS",
+	RPL_LUSERME:           "RPL_LUSERME",
+	RPL_ADMINME:           "RPL_ADMINME",
+	RPL_ADMINLOC1:         "RPL_ADMINLOC1",
+	RPL_ADMINLOC2:         "RPL_ADMINLOC2",
+	RPL_ADMINEMAIL:        "RPL_ADMINEMAIL",
+	RPL_TRYAGAIN:          "RPL_TRYAGAIN",
+	ERR_NOSUCHNICK:        "ERR_NOSUCHNICK",
+	ERR_NOSUCHSERVER:      "ERR_NOSUCHSERVER",
+	ERR_NOSUCHCHANNEL:     "ERR_NOSUCHCHANNEL",
+	ERR_CANNOTSENDTOCHAN:  "ERR_CANNOTSENDTOCHAN",
+	ERR_TOOMANYCHANNELS:   "ERR_TOOMANYCHANNELS",
+	ERR_WASNOSUCHNICK:     "ERR_WASNOSUCHNICK",
+	ERR_TOOMANYTARGETS:    "ERR_TOOMANYTARGETS",
+	ERR_NOSUCHSERVICE:     "ERR_NOSUCHSERVICE",
+	ERR_NOORIGIN:          "ERR_NOORIGIN",
+	ERR_NORECIPIENT:       "ERR_NORECIPIENT",
+	ERR_NOTEXTTOSEND:      "ERR_NOTEXTTOSEND",
+	ERR_NOTOPLEVEL:        "ERR_NOTOPLEVEL",
+	ERR_WILDTOPLEVEL:      "ERR_WILDTOPLEVEL",
+	ERR_BADMASK:           "ERR_BADMASK",
+	ERR_UNKNOWNCOMMAND:    "ERR_UNKNOWNCOMMAND",
+	ERR_NOMOTD:            "ERR_NOMOTD",
+	ERR_NOADMININFO:       "ERR_NOADMININFO",
+	ERR_FILEERROR:         "ERR_FILEERROR",
+	ERR_NONICKNAMEGIVEN:   "ERR_NONICKNAMEGIVEN",
+	ERR_ERRONEUSNICKNAME:  "ERR_ERRONEUSNICKNAME",
+	ERR_NICKNAMEINUSE:     "ERR_NICKNAMEINUSE",
+	ERR_NICKCOLLISION:     "ERR_NICKCOLLISION",
+	ERR_UNAVAILRESOURCE:   "ERR_UNAVAILRESOURCE",
+	ERR_USERNOTINCHANNEL:  "ERR_USERNOTINCHANNEL",
+	ERR_NOTONCHANNEL:      "ERR_NOTONCHANNEL",
+	ERR_USERONCHANNEL:     "ERR_USERONCHANNEL",
+	ERR_NOLOGIN:           "ERR_NOLOGIN",
+	ERR_SUMMONDISABLED:    "ERR_SUMMONDISABLED",
+	ERR_USERSDISABLED:     "ERR_USERSDISABLED",
+	ERR_NOTREGISTERED:     "ERR_NOTREGISTERED",
+	ERR_NEEDMOREPARAMS:    "ERR_NEEDMOREPARAMS",
+	ERR_ALREADYREGISTRED:  "ERR_ALREADYREGISTRED",
+	ERR_NOPERMFORHOST:     "ERR_NOPERMFORHOST",
+	ERR_PASSWDMISMATCH:    "ERR_PASSWDMISMATCH",
+	ERR_YOUREBANNEDCREEP:  "ERR_YOUREBANNEDCREEP",
+	ERR_YOUWILLBEBANNED:   "ERR_YOUWILLBEBANNED",
+	ERR_KEYSET:            "ERR_KEYSET",
+	ERR_CHANNELISFULL:     "ERR_CHANNELISFULL",
+	ERR_UNKNOWNMODE:       "ERR_UNKNOWNMODE",
+	ERR_INVITEONLYCHAN:    "ERR_INVITEONLYCHAN",
+	ERR_BANNEDFROMCHAN:    "ERR_BANNEDFROMCHAN",
+	ERR_BADCHANNELKEY:     "ERR_BADCHANNELKEY",
+	ERR_BADCHANMASK:       "ERR_BADCHANMASK",
+	ERR_NOCHANMODES:       "ERR_NOCHANMODES",
+	ERR_BANLISTFULL:       "ERR_BANLISTFULL",
+	ERR_NOPRIVILEGES:      "ERR_NOPRIVILEGES",
+	ERR_CHANOPRIVSNEEDED:  "ERR_CHANOPRIVSNEEDED",
+	ERR_CANTKILLSERVER:    "ERR_CANTKILLSERVER",
+	ERR_RESTRICTED:        "ERR_RESTRICTED",
+	ERR_UNIQOPPRIVSNEEDED: "ERR_UNIQOPPRIVSNEEDED",
+	ERR_NOOPERHOST:        "ERR_NOOPERHOST",
+	ERR_UMODEUNKNOWNFLAG:  "ERR_UMODEUNKNOWNFLAG",
+	ERR_USERSDONTMATCH:    "ERR_USERSDONTMATCH",
+	RPL_WHOISACCOUNT:      "RPL_WHOISACCOUNT",
+	RPL_TOPICWHOTIME:      "RPL_TOPICWHOTIME",
+	RPL_WHOSPCRPL:         "RPL_WHOSPCRPL",
+	RPL_LOGGEDIN:          "RPL_LOGGEDIN",
+	RPL_LOGGEDOUT:         "RPL_LOGGEDOUT",
+	RPL_NICKLOCKED:        "RPL_NICKLOCKED",
+	RPL_SASLSUCCESS:       "RPL_SASLSUCCESS",
+	ERR_SASLFAIL:          "ERR_SASLFAIL",
+	ERR_SASLTOOLONG:       "ERR_SASLTOOLONG",
+	ERR_SASLABORTED:       "ERR_SASLABORTED",
+	ERR_SASLALREADY:       "ERR_SASLALREADY",
+	RPL_SASLMECHS:         "RPL_SASLMECHS",
+	RPL_STARTTLS:          "RPL_STARTTLS",
+	ERR_STARTTLS:          "ERR_STARTTLS",
+	RPL_MONONLINE:         "RPL_MONONLINE",
+	RPL_MONOFFLINE:        "RPL_MONOFFLINE",
+	RPL_MONLIST:           "RPL_MONLIST",
+	RPL_ENDOFMONLIST:      "RPL_ENDOFMONLIST",
+	ERR_MONLISTFULL:       "ERR_MONLISTFULL",
+}
+
+// CommandName returns the symbolic name of a numeric reply, like
+// "RPL_WELCOME" for "001". Other commands are returned unchanged.
+func CommandName(command string) string {
+	if name, ok := numericNames[command]; ok {
+		return name
+	}
+	return command
+}
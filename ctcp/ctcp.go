@@ -19,6 +19,8 @@ import (
 const (
 	delimiter byte = 0x01 // Prefix and suffix for CTCP tagged messages.
 	space     byte = 0x20 // Token separator
+	quote     byte = 0x10 // Low level quoting character (M-QUOTE)
+	escape    byte = 0x5c // CTCP level quoting character (X-QUOTE)
 
 	empty = "" // The empty string
 
@@ -43,11 +45,16 @@ const (
 //
 // If the message text does not contain tagged data, ok will be false.
 //
+// Low level quoting of NUL, CR, LF and the quote character itself is removed
+// before decoding.
+//
 //    <text>  ::= <delim> <tag> [<SPACE> <message>] <delim>
 //    <delim> ::= 0x01
 //
 func Decode(text string) (tag, message string, ok bool) {
 
+	text = lowDequote(text)
+
 	// Fast path, return if this text does not contain a CTCP message.
 	if len(text) < 3 || text[0] != delimiter || text[len(text)-1] != delimiter {
 		return empty, empty, false
@@ -66,6 +73,9 @@ func Decode(text string) (tag, message string, ok bool) {
 
 // Encode returns the IRC message text for CTCP tagged data.
 //
+// NUL, CR, LF and the quote character are quoted using low level quoting,
+// so the message may contain any data.
+//
 //    <text>  ::= <delim> <tag> [<SPACE> <message>] <delim>
 //    <delim> ::= 0x01
 //
@@ -79,13 +89,128 @@ func Encode(tag, message string) (text string) {
 
 	// Tagged data with a message
 	case len(message) > 0:
-		return string(delimiter) + tag + string(space) + message + string(delimiter)
+		return lowQuote(string(delimiter) + tag + string(space) + message + string(delimiter))
 
 	// Tagged data without a message
 	default:
-		return string(delimiter) + tag + string(delimiter)
+		return lowQuote(string(delimiter) + tag + string(delimiter))
+
+	}
+}
+
+// Quote applies both levels of CTCP quoting to arbitrary data, so the result
+// can be sent as message text or inside tagged data. The delimiter and the
+// backslash are quoted first:
+//
+//    0x01 -> \a
+//    \    -> \\
+//
+// followed by low level quoting of NUL, CR, LF and the quote character:
+//
+//    0x00 -> 0x10 0
+//    LF   -> 0x10 n
+//    CR   -> 0x10 r
+//    0x10 -> 0x10 0x10
+//
+// Dequote reverses this.
+func Quote(data string) string {
+	return lowQuote(ctcpQuoter.Replace(data))
+}
+
+// Dequote removes both levels of CTCP quoting applied by Quote, in reverse
+// order. Unknown quoted characters are kept, the quoting character is dropped.
+func Dequote(text string) string {
+	return ctcpDequote(lowDequote(text))
+}
+
+// ctcpQuoter applies CTCP level quoting.
+var ctcpQuoter = strings.NewReplacer(
+	string(escape), string(escape)+string(escape),
+	string(delimiter), string(escape)+"a",
+)
+
+// ctcpDequote removes CTCP level quoting from text.
+func ctcpDequote(text string) string {
+
+	// Fast path, most messages don't contain quoted characters.
+	if strings.IndexByte(text, escape) < 0 {
+		return text
+	}
+
+	buffer := make([]byte, 0, len(text))
 
+	for i := 0; i < len(text); i++ {
+
+		if text[i] != escape {
+			buffer = append(buffer, text[i])
+			continue
+		}
+
+		// Skip the quote character.
+		if i++; i >= len(text) {
+			break
+		}
+
+		if text[i] == 'a' {
+			buffer = append(buffer, delimiter)
+		} else {
+			buffer = append(buffer, text[i])
+		}
+	}
+
+	return string(buffer)
+}
+
+// lowQuoter applies low level quoting.
+var lowQuoter = strings.NewReplacer(
+	string(quote), string(quote)+string(quote),
+	"\x00", string(quote)+"0",
+	"\n", string(quote)+"n",
+	"\r", string(quote)+"r",
+)
+
+// lowQuote applies low level quoting to text.
+func lowQuote(text string) string {
+	return lowQuoter.Replace(text)
+}
+
+// lowDequote removes low level quoting from text.
+//
+// Unknown quoted characters are kept, the quote character is dropped.
+func lowDequote(text string) string {
+
+	// Fast path, most messages don't contain quoted characters.
+	if strings.IndexByte(text, quote) < 0 {
+		return text
+	}
+
+	buffer := make([]byte, 0, len(text))
+
+	for i := 0; i < len(text); i++ {
+
+		if text[i] != quote {
+			buffer = append(buffer, text[i])
+			continue
+		}
+
+		// Skip the quote character.
+		if i++; i >= len(text) {
+			break
+		}
+
+		switch text[i] {
+		case '0':
+			buffer = append(buffer, 0x00)
+		case 'n':
+			buffer = append(buffer, '\n')
+		case 'r':
+			buffer = append(buffer, '\r')
+		default:
+			buffer = append(buffer, text[i])
+		}
 	}
+
+	return string(buffer)
 }
 
 // Action is a shortcut for Encode(ctcp.ACTION, message).
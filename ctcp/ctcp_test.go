@@ -5,6 +5,7 @@
 package ctcp
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -29,6 +30,44 @@ func TestDecode(t *testing.T) {
 	}
 }
 
+func TestDecode_quoting(t *testing.T) {
+	if tag, message, ok := Decode("\x01PING a\x10nb\x10rc\x100d\x10\x10e\x10xf\x01"); tag != "PING" || message != "a\nb\rc\x00d\x10exf" || !ok {
+		t.Errorf("Low level quoting was not removed: %q", message)
+	}
+}
+
+func TestEncode_quoting(t *testing.T) {
+	if text := Encode("PING", "a\nb\rc\x00d\x10e"); text != "\x01PING a\x10nb\x10rc\x100d\x10\x10e\x01" {
+		t.Errorf("Low level quoting was not applied: %q", text)
+	}
+
+	payload := "binary\x00\r\n\x10\x10n data"
+	if tag, message, ok := Decode(Encode("PING", payload)); tag != "PING" || message != payload || !ok {
+		t.Errorf("Payload did not survive the encode-decode sequence: %q", message)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if text := Quote("a\x01b\\c\nd\x10e\x00"); text != "a\\ab\\\\c\x10nd\x10\x10e\x100" {
+		t.Errorf("Quoting was not applied: %q", text)
+	}
+	if data := Dequote("a\\ab\\\\c\x10nd\x10\x10e\x100\\x"); data != "a\x01b\\c\nd\x10e\x00x" {
+		t.Errorf("Quoting was not removed: %q", data)
+	}
+
+	payload := make([]byte, 0, 512)
+	for i := 0; i < 256; i++ {
+		payload = append(payload, byte(i), '\\')
+	}
+	text := Quote(string(payload))
+	if strings.ContainsAny(text, "\x00\x01\r\n") {
+		t.Errorf("Quoted text contains reserved characters: %q", text)
+	}
+	if data := Dequote(text); data != string(payload) {
+		t.Errorf("Payload did not survive the quote-dequote sequence: %q", data)
+	}
+}
+
 func TestEncode(t *testing.T) {
 	if text := Encode("", "INVALID"); len(text) > 0 {
 		t.Error("Message is invalid, but returns a non-empty string.")
@@ -0,0 +1,157 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package ctcp
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// DCC is the tag used for Direct Client-to-Client negotiation.
+const DCC = "DCC"
+
+// Types of DCC offers.
+const (
+	DCCSend   = "SEND"
+	DCCChat   = "CHAT"
+	DCCResume = "RESUME"
+	DCCAccept = "ACCEPT"
+)
+
+// ErrInvalidDCC is returned by ParseDCC for malformed DCC messages.
+var ErrInvalidDCC = errors.New("ctcp: invalid DCC message")
+
+// A DCCOffer is a DCC request to send a file or start a chat.
+type DCCOffer struct {
+	Type     string // SEND, CHAT, RESUME or ACCEPT
+	Filename string // File name, or the protocol for CHAT (usually "chat")
+
+	IP   net.IP // Address to connect to, nil for RESUME and ACCEPT
+	Port int    // Zero for passive offers, where the receiver listens instead
+
+	// File size for SEND, position to resume at for RESUME and ACCEPT.
+	Size int64
+
+	// Token identifying a passive (reverse) offer.
+	Token string
+}
+
+// Passive returns true if the sender can't accept connections, and asks the
+// receiver to listen instead.
+func (o *DCCOffer) Passive() bool {
+	return len(o.Token) > 0
+}
+
+// ParseDCC parses a DCC message, either CTCP tagged as received or the
+// decoded tag and message:
+//
+//    DCC SEND <filename> <ip> <port> [<size> [<token>]]
+//    DCC CHAT <protocol> <ip> <port> [<token>]
+//    DCC RESUME|ACCEPT <filename> <port> <position> [<token>]
+//
+// The address is usually a 32-bit integer, but IPv6 addresses are written as
+// is. Filenames containing spaces are enclosed in double quotes.
+func ParseDCC(ctcpText string) (*DCCOffer, error) {
+	if tag, message, ok := Decode(ctcpText); ok {
+		ctcpText = tag + string(space) + message
+	}
+
+	fields, ok := dccFields(ctcpText)
+	if !ok || len(fields) < 4 || fields[0] != DCC {
+		return nil, ErrInvalidDCC
+	}
+
+	o := &DCCOffer{
+		Type:     strings.ToUpper(fields[1]),
+		Filename: fields[2],
+	}
+	fields = fields[3:]
+
+	var err error
+
+	switch o.Type {
+	case DCCSend, DCCChat:
+		if len(fields) < 2 {
+			return nil, ErrInvalidDCC
+		}
+		if o.IP = parseDCCAddress(fields[0]); o.IP == nil {
+			return nil, ErrInvalidDCC
+		}
+		if o.Port, err = strconv.Atoi(fields[1]); err != nil {
+			return nil, ErrInvalidDCC
+		}
+		fields = fields[2:]
+
+		if o.Type == DCCSend && len(fields) > 0 {
+			if o.Size, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+				return nil, ErrInvalidDCC
+			}
+			fields = fields[1:]
+		}
+
+	case DCCResume, DCCAccept:
+		if len(fields) < 2 {
+			return nil, ErrInvalidDCC
+		}
+		if o.Port, err = strconv.Atoi(fields[0]); err != nil {
+			return nil, ErrInvalidDCC
+		}
+		if o.Size, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+			return nil, ErrInvalidDCC
+		}
+		fields = fields[2:]
+
+	default:
+		return nil, ErrInvalidDCC
+	}
+
+	if len(fields) > 0 {
+		o.Token = fields[0]
+	}
+
+	if o.Port < 0 || o.Port > 65535 || (o.Port == 0 && !o.Passive() && o.IP != nil) {
+		return nil, ErrInvalidDCC
+	}
+
+	return o, nil
+}
+
+// parseDCCAddress parses an IPv4 address written as 32-bit integer, or an
+// address in its usual notation.
+func parseDCCAddress(s string) net.IP {
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	return net.ParseIP(s)
+}
+
+// dccFields splits text at spaces, keeping quoted filenames together.
+func dccFields(text string) (fields []string, ok bool) {
+	for {
+		text = strings.TrimLeft(text, " ")
+		if len(text) <= 0 {
+			return fields, true
+		}
+
+		if text[0] == '"' {
+			end := strings.IndexByte(text[1:], '"')
+			if end < 0 {
+				return nil, false
+			}
+			fields = append(fields, text[1:end+1])
+			text = text[end+2:]
+			continue
+		}
+
+		end := strings.IndexByte(text, space)
+		if end < 0 {
+			end = len(text)
+		}
+		fields = append(fields, text[:end])
+		text = text[end:]
+	}
+}
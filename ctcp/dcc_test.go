@@ -0,0 +1,75 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package ctcp
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+var dccTests = [...]struct {
+	text  string
+	offer *DCCOffer
+}{
+	{
+		text:  "DCC SEND filename 3232235777 4000 12345",
+		offer: &DCCOffer{Type: DCCSend, Filename: "filename", IP: net.IPv4(192, 168, 1, 1), Port: 4000, Size: 12345},
+	},
+	{
+		text:  "\x01DCC SEND \"my file.txt\" 3232235777 4000 12345\x01",
+		offer: &DCCOffer{Type: DCCSend, Filename: "my file.txt", IP: net.IPv4(192, 168, 1, 1), Port: 4000, Size: 12345},
+	},
+	{
+		text:  "DCC SEND file.txt 3232235777 0 12345 7",
+		offer: &DCCOffer{Type: DCCSend, Filename: "file.txt", IP: net.IPv4(192, 168, 1, 1), Size: 12345, Token: "7"},
+	},
+	{
+		text:  "DCC SEND file.txt ::1 4000",
+		offer: &DCCOffer{Type: DCCSend, Filename: "file.txt", IP: net.ParseIP("::1"), Port: 4000},
+	},
+	{
+		text:  "DCC CHAT chat 2130706433 5000",
+		offer: &DCCOffer{Type: DCCChat, Filename: "chat", IP: net.IPv4(127, 0, 0, 1), Port: 5000},
+	},
+	{
+		text:  "DCC RESUME \"my file.txt\" 4000 1024",
+		offer: &DCCOffer{Type: DCCResume, Filename: "my file.txt", Port: 4000, Size: 1024},
+	},
+	{
+		text:  "DCC ACCEPT file.txt 0 1024 7",
+		offer: &DCCOffer{Type: DCCAccept, Filename: "file.txt", Size: 1024, Token: "7"},
+	},
+	{text: "DCC SEND file.txt 3232235777"},
+	{text: "DCC SEND file.txt 3232235777 0"},
+	{text: "DCC SEND \"file.txt 3232235777 4000"},
+	{text: "DCC SEND file.txt nowhere 4000"},
+	{text: "DCC SEND file.txt 3232235777 70000"},
+	{text: "DCC UNKNOWN file.txt 3232235777 4000"},
+	{text: "VERSION"},
+}
+
+func TestParseDCC(t *testing.T) {
+	for i, test := range dccTests {
+		offer, err := ParseDCC(test.text)
+
+		if test.offer == nil {
+			if err != ErrInvalidDCC {
+				t.Errorf("DCC message %d should be invalid: %+v", i, offer)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Failed to parse DCC message %d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(offer, test.offer) {
+			t.Errorf("Failed to parse DCC message %d:", i)
+			t.Logf("Output: %+v", offer)
+			t.Logf("Expected: %+v", test.offer)
+		}
+	}
+}
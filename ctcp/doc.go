@@ -11,7 +11,9 @@
 //
 // Most IRC clients support only a subset of the protocol, and only a few
 // commands are actually used. This package aims to implement the most basic
-// CTCP messages: a single command per IRC message. Quoting is not supported.
+// CTCP messages: a single command per IRC message. Low level quoting of NUL,
+// CR and LF is applied by Encode and Decode. Quote and Dequote apply CTCP
+// level quoting as well, for arbitrary data.
 //
 // Example using the irc.Message type:
 //
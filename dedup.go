@@ -0,0 +1,84 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"hash/fnv"
+	"strings"
+	"sync"
+)
+
+// dedup remembers recently received messages, see Decoder.SetDedupWindow.
+type dedup struct {
+	mu     sync.Mutex
+	window int
+	seen   map[uint64]int // Number of occurrences in recent, by key
+	recent []uint64       // Keys of the last window messages, oldest first
+	count  uint64         // Number of duplicates skipped
+}
+
+// SetDedupWindow skips messages identical to one of the last n messages
+// received, like those repeated when replaying history after reconnecting.
+// Messages with a msgid tag are identified by that tag, others by the line as
+// received, including tags. PING and PONG messages are never skipped. Zero
+// disables this, which is the default.
+//
+// Skipped messages are treated like invalid lines: Decode returns a nil
+// message, and DecodeInto continues with the next line. See Duplicates.
+func (dec *Decoder) SetDedupWindow(n int) {
+	dec.dedup.mu.Lock()
+	defer dec.dedup.mu.Unlock()
+
+	dec.dedup.window = n
+	dec.dedup.seen = make(map[uint64]int, n)
+	dec.dedup.recent = nil
+}
+
+// Duplicates returns the number of messages skipped because of
+// SetDedupWindow.
+func (dec *Decoder) Duplicates() uint64 {
+	dec.dedup.mu.Lock()
+	defer dec.dedup.mu.Unlock()
+
+	return dec.dedup.count
+}
+
+// duplicate returns true if m, parsed from line, was seen recently, and
+// remembers it otherwise.
+func (d *dedup) duplicate(m *Message, line string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.window <= 0 || m.Command == PING || m.Command == PONG {
+		return false
+	}
+
+	h := fnv.New64a()
+	if id, ok := m.MsgID(); ok {
+		h.Write([]byte("msgid "))
+		h.Write([]byte(id))
+	} else {
+		h.Write([]byte("line "))
+		h.Write([]byte(strings.TrimFunc(line, cutsetFunc)))
+	}
+	key := h.Sum64()
+
+	if d.seen[key] > 0 {
+		d.count++
+		return true
+	}
+
+	d.seen[key]++
+	d.recent = append(d.recent, key)
+	if len(d.recent) > d.window {
+		oldest := d.recent[0]
+		d.recent = d.recent[1:]
+		if d.seen[oldest]--; d.seen[oldest] <= 0 {
+			delete(d.seen, oldest)
+		}
+	}
+
+	return false
+}
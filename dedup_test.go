@@ -0,0 +1,63 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecoder_SetDedupWindow(t *testing.T) {
+	stream := strings.Join([]string{
+		"@msgid=a :nick!user@host PRIVMSG #channel :Hello",
+		"@msgid=a;time=2020-01-01T10:00:00.000Z :nick!user@host PRIVMSG #channel :Hello",
+		":nick!user@host PRIVMSG #channel :Same",
+		"PING :irc.example.org",
+		"PING :irc.example.org",
+		":nick!user@host PRIVMSG #channel :Same",
+		"@msgid=b :nick!user@host PRIVMSG #channel :Hello",
+		":nick!user@host PRIVMSG #channel :Other",
+		"@msgid=a :nick!user@host PRIVMSG #channel :Hello",
+		"",
+	}, "\r\n")
+
+	dec := NewDecoder(strings.NewReader(stream))
+	dec.SetDedupWindow(3)
+
+	var lines []string
+	for {
+		var m Message
+		if err := dec.DecodeInto(&m); err != nil {
+			break
+		}
+		lines = append(lines, m.Raw)
+	}
+
+	expected := []string{
+		"@msgid=a :nick!user@host PRIVMSG #channel :Hello",
+		":nick!user@host PRIVMSG #channel :Same",
+		"PING :irc.example.org",
+		"PING :irc.example.org",
+		"@msgid=b :nick!user@host PRIVMSG #channel :Hello",
+		":nick!user@host PRIVMSG #channel :Other",
+		"@msgid=a :nick!user@host PRIVMSG #channel :Hello",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Wrong messages:\n%s", strings.Join(lines, "\n"))
+	}
+	if dec.Duplicates() != 2 {
+		t.Errorf("Wrong number of duplicates: %d", dec.Duplicates())
+	}
+
+	// Decode returns nil for duplicates.
+	dec = NewDecoder(strings.NewReader("PRIVMSG #channel :Hello\r\nPRIVMSG #channel :Hello\r\n"))
+	dec.SetDedupWindow(1)
+	if m, err := dec.Decode(); m == nil || err != nil {
+		t.Errorf("Unexpected result: %v, %v", m, err)
+	}
+	if m, err := dec.Decode(); m != nil || err != nil {
+		t.Errorf("Duplicate should be skipped: %v, %v", m, err)
+	}
+}
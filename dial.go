@@ -0,0 +1,227 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+)
+
+// A DialFunc connects to the address on the named network, like
+// net.Dialer.DialContext does. It can be used to connect through a proxy:
+//
+//    dialer, _ := proxy.SOCKS5("tcp", "localhost:9050", nil, proxy.Direct)
+//    irc.WithDialFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+//        return dialer.Dial(network, addr)
+//    })
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// A DialOption configures how DialContext connects.
+type DialOption func(*dialConfig)
+
+// dialConfig contains the settings changed by a DialOption.
+type dialConfig struct {
+	dial DialFunc
+	tls  *tls.Config // Use TLS if not nil
+
+	keepAlive    bool          // Configure TCP keepalive, see WithKeepAlive
+	keepAliveFor time.Duration // Period between probes, disabled if negative
+
+	happyEyeballs bool // Race IPv6 and IPv4, see WithHappyEyeballs
+}
+
+// Head start of IPv6 when dialing using happy eyeballs, as recommended by
+// RFC 6555.
+const happyEyeballsDelay = 300 * time.Millisecond
+
+// WithDialer connects using d, to set a connect timeout, TCP keepalive
+// interval or local address.
+func WithDialer(d *net.Dialer) DialOption {
+	return func(config *dialConfig) {
+		config.dial = d.DialContext
+	}
+}
+
+// WithDialFunc connects using fn.
+func WithDialFunc(fn DialFunc) DialOption {
+	return func(config *dialConfig) {
+		config.dial = fn
+	}
+}
+
+// WithTLSConfig connects using TLS with config. If config has no ServerName,
+// the hostname of the address is verified. Dialing wss:// URLs using
+// WebSocketConn always uses TLS, with a default config unless set.
+func WithTLSConfig(config *tls.Config) DialOption {
+	return func(c *dialConfig) {
+		c.tls = config
+	}
+}
+
+// WithKeepAlive configures TCP keepalive probes after connecting, see
+// Conn.SetKeepAlive. Probes are sent every period, or at the system default
+// interval if zero. A negative period disables keepalive probes. There is no
+// effect if the dialer does not return a TCP connection, as a proxy might.
+func WithKeepAlive(period time.Duration) DialOption {
+	return func(c *dialConfig) {
+		c.keepAlive = true
+		c.keepAliveFor = period
+	}
+}
+
+// WithHappyEyeballs connects using both IPv6 and IPv4 if enable is true, as
+// described in RFC 6555. IPv6 is tried first, and IPv4 as well if that did
+// not connect within 300ms or failed. The first connection wins, the other
+// attempt is cancelled.
+//
+// This avoids waiting for the full timeout if one of the address families is
+// broken. Dialing fails only if both attempts failed, returning the IPv6
+// error unless the host has no IPv6 address.
+func WithHappyEyeballs(enable bool) DialOption {
+	return func(c *dialConfig) {
+		c.happyEyeballs = enable
+	}
+}
+
+// connect dials addr using TCP, as configured.
+func (config *dialConfig) connect(ctx context.Context, addr string) (net.Conn, error) {
+	if !config.happyEyeballs {
+		return config.dial(ctx, "tcp", addr)
+	}
+	return dialHappyEyeballs(ctx, config.dial, addr)
+}
+
+// dialHappyEyeballs races a tcp6 and a tcp4 connection to addr, giving the
+// former a head start.
+func dialHappyEyeballs(ctx context.Context, dial DialFunc, addr string) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		network string
+		c       net.Conn
+		err     error
+	}
+	results := make(chan result, 2)
+
+	attempt := func(network string) {
+		c, err := dial(ctx, network, addr)
+		results <- result{network, c, err}
+	}
+
+	go attempt("tcp6")
+
+	fallback := time.NewTimer(happyEyeballsDelay)
+	defer fallback.Stop()
+
+	errs := make(map[string]error)
+	started := 1
+
+	for len(errs) < 2 {
+		select {
+		case <-fallback.C:
+		case r := <-results:
+			if r.err == nil {
+				// Close the other connection if it wins as well.
+				if pending := started - len(errs) - 1; pending > 0 {
+					go func() {
+						if r := <-results; r.err == nil {
+							r.c.Close()
+						}
+					}()
+				}
+				return r.c, nil
+			}
+			errs[r.network] = r.err
+		}
+
+		if started < 2 {
+			started++
+			go attempt("tcp4")
+		}
+	}
+
+	if err, ok := errs["tcp6"]; ok && !noAddress(err) {
+		return nil, err
+	}
+	return nil, errs["tcp4"]
+}
+
+// noAddress returns true if err means the host has no address of the
+// requested family.
+func noAddress(err error) bool {
+	var addrErr *net.AddrError
+	var dnsErr *net.DNSError
+	return errors.As(err, &addrErr) || (errors.As(err, &dnsErr) && dnsErr.IsNotFound)
+}
+
+// configure applies the keepalive settings to a new connection.
+func (config *dialConfig) configure(c net.Conn) error {
+	if tcp := tcpConn(c); config.keepAlive && tcp != nil {
+		return setKeepAlive(tcp, config.keepAliveFor >= 0, config.keepAliveFor)
+	}
+	return nil
+}
+
+// dialTLS starts a TLS handshake on plain, for a connection to addr.
+func dialTLS(ctx context.Context, plain net.Conn, addr string, config *tls.Config) (net.Conn, error) {
+	if config == nil {
+		config = new(tls.Config)
+	}
+	if len(config.ServerName) <= 0 {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		config = config.Clone()
+		config.ServerName = host
+	}
+
+	secure := tls.Client(plain, config)
+	if err := secure.HandshakeContext(ctx); err != nil {
+		plain.Close()
+		return nil, err
+	}
+	return secure, nil
+}
+
+// DialContext connects to the given address using TCP, or TLS if configured
+// using WithTLSConfig, and then returns a new Conn for the connection.
+// Connecting is aborted when ctx is done, which does not affect the returned
+// connection.
+//
+// A zero net.Dialer is used unless changed using a DialOption.
+func DialContext(ctx context.Context, addr string, options ...DialOption) (*Conn, error) {
+	config := dialConfig{
+		dial: new(net.Dialer).DialContext,
+	}
+	for _, option := range options {
+		option(&config)
+	}
+
+	c, err := config.connect(ctx, addr)
+
+	if err != nil {
+		return nil, err
+	}
+	if err = config.configure(c); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	tcp := tcpConn(c)
+	if config.tls != nil {
+		if c, err = dialTLS(ctx, c, addr, config.tls); err != nil {
+			return nil, err
+		}
+	}
+
+	conn := NewConn(c)
+	conn.tcp = tcp
+	return conn, nil
+}
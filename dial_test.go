@@ -0,0 +1,158 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"testing"
+	"time"
+)
+
+// Use DialContext with a net.Dialer to give up connecting after a timeout.
+func ExampleDialContext() {
+	conn, err := DialContext(context.Background(), "irc.quakenet.org:6667", WithDialer(&net.Dialer{Timeout: 10 * time.Second}))
+	if err != nil {
+		log.Fatalln("Could not connect to IRC server")
+	}
+
+	conn.Close()
+}
+
+func TestDialContext(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		c, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		c.Write([]byte(":irc.example.org NOTICE * :Hello\r\n"))
+		c.Close()
+	}()
+
+	conn, err := DialContext(context.Background(), listener.Addr().String(), WithDialer(&net.Dialer{Timeout: time.Second}))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	if m, err := conn.Decode(); err != nil || m.Command != NOTICE {
+		t.Errorf("Unexpected result: %v, %v", m, err)
+	}
+}
+
+func TestDialContext_dialFunc(t *testing.T) {
+	errDial := errors.New("dial failed")
+
+	var network, address string
+	_, err := DialContext(context.Background(), "irc.example.org:6667", WithDialFunc(func(ctx context.Context, n, addr string) (net.Conn, error) {
+		network, address = n, addr
+		return nil, errDial
+	}))
+
+	if err != errDial || network != "tcp" || address != "irc.example.org:6667" {
+		t.Errorf("Unexpected result: %v, %s, %s", err, network, address)
+	}
+}
+
+func TestDialContext_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := DialContext(ctx, "127.0.0.1:1"); err == nil {
+		t.Error("Dialing should fail when cancelled.")
+	}
+}
+
+func TestDialContext_happyEyeballs(t *testing.T) {
+	cancelled := make(chan bool, 1)
+
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if network == "tcp6" {
+			<-ctx.Done()
+			cancelled <- true
+			return nil, ctx.Err()
+		}
+		client, server := net.Pipe()
+		go func() {
+			server.Write([]byte(":irc.example.org NOTICE * :Hello\r\n"))
+			server.Close()
+		}()
+		return client, nil
+	}
+
+	conn, err := DialContext(context.Background(), "irc.example.org:6667", WithDialFunc(dial), WithHappyEyeballs(true))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	if m, err := conn.Decode(); err != nil || m.Command != NOTICE {
+		t.Errorf("Unexpected result: %v, %v", m, err)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("IPv6 attempt was not cancelled")
+	}
+}
+
+func TestDialContext_happyEyeballsFailed(t *testing.T) {
+	errIPv6 := errors.New("network unreachable")
+	errIPv4 := errors.New("connection refused")
+
+	var networks []string
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		networks = append(networks, network)
+		if network == "tcp6" {
+			return nil, errIPv6
+		}
+		return nil, errIPv4
+	}
+
+	_, err := DialContext(context.Background(), "irc.example.org:6667", WithDialFunc(dial), WithHappyEyeballs(true))
+	if err != errIPv6 || len(networks) != 2 {
+		t.Errorf("Unexpected result: %v, %v", err, networks)
+	}
+}
+
+func TestConn_SetKeepAlive(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		if c, err := listener.Accept(); err == nil {
+			defer c.Close()
+			c.Read(make([]byte, 1))
+		}
+	}()
+
+	conn, err := DialContext(context.Background(), listener.Addr().String(), WithKeepAlive(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.SetKeepAlive(false, 0); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	client, server := net.Pipe()
+	defer server.Close()
+	if err := NewConn(client).SetKeepAlive(true, time.Minute); err != ErrNotTCP {
+		t.Errorf("Unexpected error for a pipe: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"github.com/sorcix/irc/ctcp"
+)
+
+// An Event is a typed view of a message, returned by Classify. It is one of
+// JoinEvent, PartEvent, KickEvent, QuitEvent, NickEvent, PrivmsgEvent,
+// ActionEvent, NoticeEvent or UnknownEvent:
+//
+//    switch e := irc.Classify(m).(type) {
+//    case irc.JoinEvent:
+//        log.Printf("%s joined %s", e.Nick, e.Channel)
+//    case irc.ActionEvent:
+//        log.Printf("* %s %s", e.From, e.Text)
+//    }
+type Event interface {
+	event()
+}
+
+// JoinEvent is a user joining a channel.
+type JoinEvent struct {
+	Nick    string
+	Channel string
+}
+
+// PartEvent is a user leaving a channel.
+type PartEvent struct {
+	Nick    string
+	Channel string
+	Reason  string // Optional
+}
+
+// KickEvent is a user removed from a channel by another user.
+type KickEvent struct {
+	Nick    string // The user who kicked
+	Channel string
+	Target  string // The user who was kicked
+	Reason  string // Optional
+}
+
+// QuitEvent is a user disconnecting from the network.
+type QuitEvent struct {
+	Nick   string
+	Reason string
+}
+
+// NickEvent is a user changing nick.
+type NickEvent struct {
+	Nick    string
+	NewNick string
+}
+
+// PrivmsgEvent is a message sent to a channel or user. CTCP messages other than
+// ACTION are left encoded in Text.
+type PrivmsgEvent struct {
+	From   string
+	Target string
+	Text   string
+}
+
+// ActionEvent is a CTCP ACTION sent using PRIVMSG, shown like "* nick text".
+type ActionEvent struct {
+	From   string
+	Target string
+	Text   string
+}
+
+// NoticeEvent is a notice sent to a channel or user.
+type NoticeEvent struct {
+	From   string
+	Target string
+	Text   string
+}
+
+// UnknownEvent holds a message not recognized by Classify, or a recognized
+// message that lacks the prefix or parameters of its event.
+type UnknownEvent struct {
+	Raw *Message
+}
+
+func (JoinEvent) event()    {}
+func (PartEvent) event()    {}
+func (KickEvent) event()    {}
+func (QuitEvent) event()    {}
+func (NickEvent) event()    {}
+func (PrivmsgEvent) event() {}
+func (ActionEvent) event()  {}
+func (NoticeEvent) event()  {}
+func (UnknownEvent) event() {}
+
+// Classify returns the Event for a message received from the server.
+func Classify(m *Message) Event {
+	if m.Prefix == nil || len(m.Prefix.Name) <= 0 {
+		return UnknownEvent{m}
+	}
+	nick := m.Prefix.Name
+
+	switch m.Command {
+	case JOIN:
+		if channel := firstParam(m); len(channel) > 0 {
+			return JoinEvent{Nick: nick, Channel: channel}
+		}
+
+	case PART:
+		if params := m.allParams(); len(params) > 0 {
+			e := PartEvent{Nick: nick, Channel: params[0]}
+			if len(params) > 1 {
+				e.Reason = params[1]
+			}
+			return e
+		}
+
+	case KICK:
+		if params := m.allParams(); len(params) > 1 {
+			e := KickEvent{Nick: nick, Channel: params[0], Target: params[1]}
+			if len(params) > 2 {
+				e.Reason = params[2]
+			}
+			return e
+		}
+
+	case QUIT:
+		return QuitEvent{Nick: nick, Reason: m.Trailing}
+
+	case NICK:
+		if newNick := firstParam(m); len(newNick) > 0 {
+			return NickEvent{Nick: nick, NewNick: newNick}
+		}
+
+	case PRIVMSG:
+		if len(m.Params) <= 0 {
+			break
+		}
+		if tag, text, ok := ctcp.Decode(m.Trailing); ok && tag == ctcp.ACTION {
+			return ActionEvent{From: nick, Target: m.Params[0], Text: text}
+		}
+		return PrivmsgEvent{From: nick, Target: m.Params[0], Text: m.Trailing}
+
+	case NOTICE:
+		if len(m.Params) > 0 {
+			return NoticeEvent{From: nick, Target: m.Params[0], Text: m.Trailing}
+		}
+	}
+
+	return UnknownEvent{m}
+}
@@ -0,0 +1,54 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"testing"
+)
+
+var classifyTests = [...]struct {
+	line  string
+	event Event
+}{
+	{":nick!user@host JOIN #channel", JoinEvent{"nick", "#channel"}},
+	{":nick!user@host JOIN :#channel", JoinEvent{"nick", "#channel"}},
+	{":nick!user@host JOIN #channel account :Real Name", JoinEvent{"nick", "#channel"}},
+	{":nick!user@host PART #channel", PartEvent{"nick", "#channel", ""}},
+	{":nick!user@host PART #channel :Bye!", PartEvent{"nick", "#channel", "Bye!"}},
+	{":op!op@host KICK #channel nick :Behave", KickEvent{"op", "#channel", "nick", "Behave"}},
+	{":op!op@host KICK #channel :nick", KickEvent{"op", "#channel", "nick", ""}},
+	{":nick!user@host QUIT :Ping timeout", QuitEvent{"nick", "Ping timeout"}},
+	{":nick!user@host NICK :other", NickEvent{"nick", "other"}},
+	{":nick!user@host PRIVMSG #channel :Hello there", PrivmsgEvent{"nick", "#channel", "Hello there"}},
+	{":nick!user@host PRIVMSG me :\x01VERSION\x01", PrivmsgEvent{"nick", "me", "\x01VERSION\x01"}},
+	{":nick!user@host PRIVMSG #channel :\x01ACTION waves\x01", ActionEvent{"nick", "#channel", "waves"}},
+	{":irc.example.org NOTICE * :Looking up your hostname", NoticeEvent{"irc.example.org", "*", "Looking up your hostname"}},
+}
+
+func TestClassify(t *testing.T) {
+	for i, test := range classifyTests {
+		if event := Classify(ParseMessage(test.line)); !reflect.DeepEqual(event, test.event) {
+			t.Errorf("Failed to classify message %d:", i)
+			t.Logf("Output: %#v", event)
+			t.Logf("Expected: %#v", test.event)
+		}
+	}
+}
+
+func TestClassify_unknown(t *testing.T) {
+	for i, line := range []string{
+		"PING :irc.example.org",
+		"JOIN #channel",
+		":irc.example.org 001 me :Welcome",
+		":nick!user@host KICK #channel",
+		":nick!user@host PRIVMSG :Hello",
+	} {
+		m := ParseMessage(line)
+		if event, ok := Classify(m).(UnknownEvent); !ok || event.Raw != m {
+			t.Errorf("Failed to classify unknown message %d: %#v", i, Classify(m))
+		}
+	}
+}
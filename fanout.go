@@ -0,0 +1,156 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"sync"
+)
+
+// A FanoutPolicy determines what a Fanout does when a subscriber's buffer is
+// full.
+type FanoutPolicy int
+
+const (
+	// FanoutDrop discards messages for subscribers that can't keep up, so one
+	// slow subscriber does not delay the others.
+	FanoutDrop FanoutPolicy = iota
+
+	// FanoutBlock waits until every subscriber accepted the message, so no
+	// message is lost.
+	FanoutBlock
+)
+
+// A Fanout delivers every message from a single stream to several
+// subscribers, such as a logger, a State and a Mux.
+//
+// Every subscriber receives its own copy of each message, so subscribers may
+// modify or retain them.
+type Fanout struct {
+	buffer int
+	policy FanoutPolicy
+
+	mu     sync.Mutex
+	subs   map[<-chan *Message]*subscriber
+	closed bool
+}
+
+// subscriber is a single channel returned by Fanout.Subscribe.
+type subscriber struct {
+	ch       chan *Message
+	done     chan struct{} // Closed by Unsubscribe to abort a blocked send
+	doneOnce sync.Once
+
+	mu     sync.Mutex // Held while sending
+	closed bool
+}
+
+// NewFanout returns a Fanout delivering the messages read from messages, as
+// returned by Decoder.Messages. Every subscriber has a buffer of the given
+// size, the policy determines what happens when it fills up.
+//
+// Subscriber channels are closed when messages is closed.
+func NewFanout(messages <-chan *Message, buffer int, policy FanoutPolicy) *Fanout {
+	f := &Fanout{
+		buffer: buffer,
+		policy: policy,
+		subs:   make(map[<-chan *Message]*subscriber),
+	}
+	go f.run(messages)
+	return f
+}
+
+// Subscribe returns a channel receiving every message from now on. The channel
+// is closed if the stream ends, or after Unsubscribe.
+func (f *Fanout) Subscribe() <-chan *Message {
+	sub := &subscriber{
+		ch:   make(chan *Message, f.buffer),
+		done: make(chan struct{}),
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		sub.close()
+	} else {
+		f.subs[sub.ch] = sub
+	}
+
+	return sub.ch
+}
+
+// Unsubscribe stops delivering messages to ch, and closes it. Unknown channels
+// are ignored.
+func (f *Fanout) Unsubscribe(ch <-chan *Message) {
+	f.mu.Lock()
+	sub, ok := f.subs[ch]
+	delete(f.subs, ch)
+	f.mu.Unlock()
+
+	if ok {
+		sub.close()
+	}
+}
+
+// run delivers messages until the stream ends.
+func (f *Fanout) run(messages <-chan *Message) {
+	for m := range messages {
+		f.mu.Lock()
+		subs := make([]*subscriber, 0, len(f.subs))
+		for _, sub := range f.subs {
+			subs = append(subs, sub)
+		}
+		f.mu.Unlock()
+
+		for _, sub := range subs {
+			sub.send(m.Copy(), f.policy)
+		}
+	}
+
+	f.mu.Lock()
+	f.closed = true
+	subs := f.subs
+	f.subs = nil
+	f.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.close()
+	}
+}
+
+// send delivers m unless the subscriber is closed.
+func (sub *subscriber) send(m *Message, policy FanoutPolicy) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if sub.closed {
+		return
+	}
+
+	if policy == FanoutBlock {
+		select {
+		case sub.ch <- m:
+		case <-sub.done:
+		}
+		return
+	}
+
+	select {
+	case sub.ch <- m:
+	default:
+	}
+}
+
+// close closes the channel, aborting a blocked send first.
+func (sub *subscriber) close() {
+	sub.doneOnce.Do(func() {
+		close(sub.done)
+
+		sub.mu.Lock()
+		sub.closed = true
+		close(sub.ch)
+		sub.mu.Unlock()
+	})
+}
@@ -0,0 +1,73 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFanout(t *testing.T) {
+	messages := make(chan *Message)
+	f := NewFanout(messages, 1, FanoutBlock)
+
+	a, b := f.Subscribe(), f.Subscribe()
+
+	m := &Message{Command: PRIVMSG, Params: []string{"#channel"}, Trailing: "Hello"}
+	messages <- m
+
+	ma, mb := <-a, <-b
+	if ma.String() != m.String() || mb.String() != m.String() {
+		t.Errorf("Wrong messages: %s %s", ma, mb)
+	}
+	if ma == m || ma == mb || &ma.Params[0] == &mb.Params[0] {
+		t.Error("Subscribers should receive copies.")
+	}
+
+	// The second subscriber blocks the stream after filling its buffer,
+	// until it unsubscribes.
+	messages <- m
+	messages <- m
+	<-a
+	f.Unsubscribe(b)
+
+	select {
+	case <-a:
+	case <-time.After(time.Second):
+		t.Fatal("Unsubscribe should unblock the stream.")
+	}
+
+	for range b {
+	}
+
+	close(messages)
+	if _, ok := <-a; ok {
+		t.Error("Subscribers should be closed at the end of the stream.")
+	}
+	if _, ok := <-f.Subscribe(); ok {
+		t.Error("New subscribers should be closed at the end of the stream.")
+	}
+}
+
+func TestFanout_drop(t *testing.T) {
+	messages := make(chan *Message)
+	f := NewFanout(messages, 1, FanoutDrop)
+
+	slow, fast := f.Subscribe(), f.Subscribe()
+
+	for i := 0; i < 3; i++ {
+		messages <- &Message{Command: PING}
+		<-fast
+	}
+	close(messages)
+
+	count := 0
+	for range slow {
+		count++
+	}
+	if count != 1 {
+		t.Errorf("Slow subscriber should only receive its buffer: %d", count)
+	}
+}
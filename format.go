@@ -0,0 +1,247 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Formatting codes, as used by most IRC clients.
+const (
+	Bold          = "\x02"
+	Italic        = "\x1D"
+	Underline     = "\x1F"
+	Strikethrough = "\x1E"
+	Monospace     = "\x11"
+	Reverse       = "\x16"
+	Reset         = "\x0F" // Remove all formatting
+
+	colorCode    byte = 0x03 // Followed by the color numbers
+	hexColorCode byte = 0x04 // Followed by hexadecimal RGB colors
+)
+
+// Colors available for Color, as defined by mIRC.
+const (
+	ColorWhite = iota
+	ColorBlack
+	ColorBlue
+	ColorGreen
+	ColorRed
+	ColorBrown
+	ColorPurple
+	ColorOrange
+	ColorYellow
+	ColorLightGreen
+	ColorCyan
+	ColorLightCyan
+	ColorLightBlue
+	ColorPink
+	ColorGrey
+	ColorLightGrey
+)
+
+// Color returns the code that sets the foreground and background color of the
+// following text. A negative background keeps the current background.
+//
+// Colors are always written as two digits, so text starting with a digit
+// can safely follow.
+func Color(fg, bg int) string {
+	s := string(colorCode) + twoDigits(fg)
+	if bg >= 0 {
+		s = s + "," + twoDigits(bg)
+	}
+	return s
+}
+
+// twoDigits formats a color number using two digits.
+func twoDigits(n int) string {
+	if n >= 0 && n < 10 {
+		return "0" + strconv.Itoa(n)
+	}
+	return strconv.Itoa(n)
+}
+
+// StripFormatting removes all formatting and color codes from s.
+func StripFormatting(s string) string {
+
+	// Fast path, most messages don't contain formatting codes.
+	if strings.IndexFunc(s, isFormatting) < 0 {
+		return s
+	}
+
+	buffer := make([]byte, 0, len(s))
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case colorCode:
+			i = skipColor(s, i+1, 2, isDigit) - 1
+		case hexColorCode:
+			i = skipColor(s, i+1, 6, isHexDigit) - 1
+		case 0x02, 0x1D, 0x1F, 0x1E, 0x11, 0x16, 0x0F:
+			// Skip formatting code.
+		default:
+			buffer = append(buffer, s[i])
+		}
+	}
+
+	return string(buffer)
+}
+
+// skipColor returns the index after the optional "fg[,bg]" color numbers
+// starting at i, each consisting of up to n digits.
+func skipColor(s string, i, n int, digit func(byte) bool) int {
+	j := skipDigits(s, i, n, digit)
+
+	// The comma is only part of the code if a background color follows.
+	if j > i && j+1 < len(s) && s[j] == ',' && digit(s[j+1]) {
+		j = skipDigits(s, j+1, n, digit)
+	}
+
+	return j
+}
+
+// skipDigits returns the index after up to n digits starting at i.
+func skipDigits(s string, i, n int, digit func(byte) bool) int {
+	for n > 0 && i < len(s) && digit(s[i]) {
+		i++
+		n--
+	}
+	return i
+}
+
+// ANSI foreground colors for the mIRC colors, add 10 for the background.
+var ansiColors = [...]int{97, 30, 34, 32, 91, 31, 35, 33, 93, 92, 36, 96, 94, 95, 90, 37}
+
+// Escape character starting ANSI escape sequences.
+const ansiEscape byte = 0x1B
+
+// ansiState is the formatting applied to text.
+type ansiState struct {
+	bold, italic, underline, strikethrough, reverse bool
+
+	fg, bg int // Index in ansiColors, -1 for the default color
+}
+
+var ansiDefault = ansiState{fg: -1, bg: -1}
+
+// escape returns the ANSI escape sequence setting this state.
+func (st ansiState) escape() []byte {
+	code := []byte{ansiEscape, '[', '0'}
+
+	for _, attr := range [...]struct {
+		set  bool
+		code int
+	}{{st.bold, 1}, {st.italic, 3}, {st.underline, 4}, {st.reverse, 7}, {st.strikethrough, 9}} {
+		if attr.set {
+			code = strconv.AppendInt(append(code, ';'), int64(attr.code), 10)
+		}
+	}
+
+	if st.fg >= 0 {
+		code = strconv.AppendInt(append(code, ';'), int64(ansiColors[st.fg]), 10)
+	}
+	if st.bg >= 0 {
+		code = strconv.AppendInt(append(code, ';'), int64(ansiColors[st.bg]+10), 10)
+	}
+
+	return append(code, 'm')
+}
+
+// ansiColor returns the index in ansiColors for a mIRC color number, or -1
+// for 99 (the default color) and colors without ANSI equivalent.
+func ansiColor(digits string) int {
+	if n, _ := strconv.Atoi(digits); n < len(ansiColors) {
+		return n
+	}
+	return -1
+}
+
+// FormatANSI translates the formatting codes in s to ANSI escape sequences,
+// for display in a terminal. The 16 basic colors, bold, italic, underline,
+// strikethrough and reverse are supported, other codes are removed.
+//
+// The formatting is reset at the end of s, so it never affects the next line.
+// Escape characters in s are removed, so they can't be used to change the
+// terminal state either.
+func FormatANSI(s string) string {
+
+	// Fast path, most messages don't contain formatting codes.
+	if strings.IndexFunc(s, isFormatting) < 0 && strings.IndexByte(s, ansiEscape) < 0 {
+		return s
+	}
+
+	buffer := make([]byte, 0, len(s))
+	st, written := ansiDefault, ansiDefault
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case colorCode:
+			j := skipDigits(s, i+1, 2, isDigit)
+			if j == i+1 {
+				// A color code without numbers resets the colors.
+				st.fg, st.bg = -1, -1
+			} else {
+				st.fg = ansiColor(s[i+1 : j])
+				if j+1 < len(s) && s[j] == ',' && isDigit(s[j+1]) {
+					k := skipDigits(s, j+1, 2, isDigit)
+					st.bg = ansiColor(s[j+1 : k])
+					j = k
+				}
+			}
+			i = j - 1
+		case hexColorCode:
+			i = skipColor(s, i+1, 6, isHexDigit) - 1
+		case 0x02:
+			st.bold = !st.bold
+		case 0x1D:
+			st.italic = !st.italic
+		case 0x1F:
+			st.underline = !st.underline
+		case 0x1E:
+			st.strikethrough = !st.strikethrough
+		case 0x16:
+			st.reverse = !st.reverse
+		case 0x0F:
+			st = ansiDefault
+		case 0x11, ansiEscape:
+			// Not supported.
+		default:
+			if st != written {
+				buffer = append(buffer, st.escape()...)
+				written = st
+			}
+			buffer = append(buffer, s[i])
+		}
+	}
+
+	if written != ansiDefault {
+		buffer = append(buffer, ansiDefault.escape()...)
+	}
+
+	return string(buffer)
+}
+
+// RenderANSI returns m as a line of text for display in a terminal, with
+// formatting translated using FormatANSI.
+func RenderANSI(m *Message) string {
+	return FormatANSI(m.String())
+}
+
+func isFormatting(r rune) bool {
+	switch r {
+	case 0x02, 0x03, 0x04, 0x1D, 0x1F, 0x1E, 0x11, 0x16, 0x0F:
+		return true
+	}
+	return false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
@@ -0,0 +1,83 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"fmt"
+	"testing"
+)
+
+func ExampleColor() {
+	text := Bold + "Warning:" + Reset + " " + Color(ColorRed, -1) + "2" + Reset + " errors"
+
+	fmt.Println(StripFormatting(text))
+
+	// Output: Warning: 2 errors
+}
+
+func TestColor(t *testing.T) {
+	if s := Color(ColorRed, -1); s != "\x0304" {
+		t.Errorf("Wrong color code: %q", s)
+	}
+	if s := Color(ColorLightGrey, ColorBlack); s != "\x0315,01" {
+		t.Errorf("Wrong color code: %q", s)
+	}
+}
+
+func TestStripFormatting(t *testing.T) {
+	tests := []struct {
+		input, output string
+	}{
+		{"plain text", "plain text"},
+		{"\x02bold\x02 \x1Ditalic\x1D \x1Funderline\x1F\x0F", "bold italic underline"},
+		{"\x034red\x03 text", "red text"},
+		{"\x0304,01red on black", "red on black"},
+		{"\x03041234", "1234"},
+		{"\x034,1234", "34"},
+		{"\x034,text", ",text"},
+		{"\x03,04text", ",04text"},
+		{"\x03", ""},
+		{"\x04FF0000red\x04", "red"},
+		{"\x04FF0000,00FF00red on green", "red on green"},
+		{"\x16\x1E\x11mixed", "mixed"},
+	}
+
+	for i, test := range tests {
+		if output := StripFormatting(test.input); output != test.output {
+			t.Errorf("Failed to strip formatting %d: %q", i, output)
+		}
+	}
+}
+
+func TestFormatANSI(t *testing.T) {
+	tests := []struct {
+		input, output string
+	}{
+		{"plain text", "plain text"},
+		{"\x02bold\x02 text", "\x1b[0;1mbold\x1b[0m text"},
+		{"\x02\x1Fbold underline", "\x1b[0;1;4mbold underline\x1b[0m"},
+		{"\x034red\x03 text", "\x1b[0;91mred\x1b[0m text"},
+		{"\x0304,01red on black\x0F.", "\x1b[0;91;40mred on black\x1b[0m."},
+		{"\x0399,99default", "default"},
+		{"\x0342extended", "extended"},
+		{"\x0302blue \x02bold\x0F", "\x1b[0;34mblue \x1b[0;1;34mbold\x1b[0m"},
+		{"\x0312,08\x03,text", ",text"},
+		{"\x04FF0000red\x04", "red"},
+		{"\x16\x1D\x11mixed", "\x1b[0;3;7mmixed\x1b[0m"},
+		{"\x1b[31mfake", "[31mfake"},
+		{"\x02", ""},
+	}
+
+	for i, test := range tests {
+		if output := FormatANSI(test.input); output != test.output {
+			t.Errorf("Failed to format %d: %q", i, output)
+		}
+	}
+
+	m := ParseMessage(":nick PRIVMSG #channel :\x02Hello")
+	if s := RenderANSI(m); s != ":nick PRIVMSG #channel :\x1b[0;1mHello\x1b[0m" {
+		t.Errorf("Failed to render message: %q", s)
+	}
+}
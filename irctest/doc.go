@@ -0,0 +1,29 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+// Package irctest provides a scripted fake IRC server for testing clients
+// built on package irc, without opening network connections.
+//
+// A FakeServer is connected to a client *irc.Conn using net.Pipe. Tests
+// expect the lines sent by the client and send canned replies:
+//
+//    fs := irctest.NewFakeServer(t)
+//    defer fs.Close()
+//
+//    registered := make(chan error)
+//    go func() {
+//        registered <- fs.Conn().Register("foo", "foo", "Foo")
+//    }()
+//
+//    fs.Expect("NICK foo")
+//    fs.Expect("USER foo 0 * :Foo")
+//    fs.Send(":irc.example.org 001 foo :Welcome")
+//
+//    if err := <-registered; err != nil {
+//        t.Fatal(err)
+//    }
+//
+// Expect fails the test if the client sends something else, or nothing at
+// all before the timeout expires.
+package irctest
@@ -0,0 +1,173 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irctest
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sorcix/irc"
+)
+
+// DefaultTimeout is the time Expect waits for the client, unless changed
+// using SetTimeout.
+const DefaultTimeout = 5 * time.Second
+
+// Number of lines Send queues before blocking.
+const sendQueue = 64
+
+// A FakeServer plays the server side of a connection to a client *irc.Conn.
+//
+// Expect and Close call t.Fatalf, so they must be called from the goroutine
+// running the test. The client should run in another goroutine, as writes
+// to the connection block until the other side reads them.
+type FakeServer struct {
+	t       testing.TB
+	server  net.Conn
+	reader  *bufio.Reader
+	conn    *irc.Conn
+	timeout time.Duration
+
+	sends chan string
+	done  chan struct{}
+
+	mu  sync.Mutex
+	err error // First error writing to the client
+}
+
+// NewFakeServer returns a FakeServer reporting failures to t.
+func NewFakeServer(t testing.TB) *FakeServer {
+	client, server := net.Pipe()
+
+	fs := &FakeServer{
+		t:       t,
+		server:  server,
+		reader:  bufio.NewReader(server),
+		conn:    irc.NewConn(client),
+		timeout: DefaultTimeout,
+		sends:   make(chan string, sendQueue),
+		done:    make(chan struct{}),
+	}
+
+	go fs.write()
+	return fs
+}
+
+// Conn returns the client side of the connection.
+func (fs *FakeServer) Conn() *irc.Conn {
+	return fs.conn
+}
+
+// SetTimeout sets the time Expect waits for a line from the client. Zero
+// restores DefaultTimeout.
+func (fs *FakeServer) SetTimeout(d time.Duration) {
+	if d <= 0 {
+		d = DefaultTimeout
+	}
+	fs.timeout = d
+}
+
+// Expect reads the next line sent by the client and fails the test unless it
+// is the same message as line. Messages are compared using Message.Equal, so
+// the case of the command and the colon before the last parameter don't
+// matter. Returns the message sent by the client.
+func (fs *FakeServer) Expect(line string) *irc.Message {
+	fs.t.Helper()
+
+	expected := irc.ParseMessage(line)
+	if expected == nil {
+		fs.t.Fatalf("irctest: invalid expected message %q", line)
+	}
+
+	m := fs.read()
+	if !m.Equal(expected) {
+		fs.t.Fatalf("irctest: unexpected message from client:\n%s\nexpected:\n%s", m.Raw, line)
+	}
+	return m
+}
+
+// Read returns the next line sent by the client, failing the test if there
+// is none before the timeout expires.
+func (fs *FakeServer) Read() *irc.Message {
+	fs.t.Helper()
+	return fs.read()
+}
+
+func (fs *FakeServer) read() *irc.Message {
+	fs.t.Helper()
+
+	fs.server.SetReadDeadline(time.Now().Add(fs.timeout))
+	raw, err := fs.reader.ReadString('\n')
+	if err != nil {
+		if e, ok := err.(net.Error); ok && e.Timeout() {
+			fs.t.Fatalf("irctest: timeout waiting for the client after %v", fs.timeout)
+		}
+		fs.t.Fatalf("irctest: failed to read from the client: %v", err)
+	}
+
+	line := strings.TrimRight(raw, "\r\n")
+	m := irc.ParseMessage(line)
+	if m == nil {
+		fs.t.Fatalf("irctest: invalid message from client: %q", line)
+	}
+	m.Raw = line
+	return m
+}
+
+// Send sends line to the client, adding the line ending. Lines are written in
+// the background, so Send returns before the client reads them, unless 64
+// lines are waiting already.
+func (fs *FakeServer) Send(line string) {
+	fs.sends <- line
+}
+
+// write sends queued lines to the client until Close.
+func (fs *FakeServer) write() {
+	defer close(fs.done)
+
+	for line := range fs.sends {
+		if _, err := fs.server.Write([]byte(line + "\r\n")); err != nil {
+			fs.mu.Lock()
+			if fs.err == nil {
+				fs.err = err
+			}
+			fs.mu.Unlock()
+		}
+	}
+}
+
+// Close waits until the client read every line passed to Send, and closes
+// the connection. The test fails if the client could not read them, or sent
+// lines that were not read using Expect or Read.
+func (fs *FakeServer) Close() {
+	fs.t.Helper()
+
+	close(fs.sends)
+	select {
+	case <-fs.done:
+	case <-time.After(fs.timeout):
+		fs.server.Close()
+		<-fs.done
+		fs.t.Fatalf("irctest: timeout waiting for the client to read")
+	}
+
+	buffered := fs.reader.Buffered()
+	fs.server.Close()
+
+	fs.mu.Lock()
+	err := fs.err
+	fs.mu.Unlock()
+
+	if err != nil {
+		fs.t.Fatalf("irctest: failed to write to the client: %v", err)
+	}
+	if buffered > 0 {
+		fs.t.Fatalf("irctest: %d unexpected bytes from client", buffered)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irctest
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// recorder is a testing.TB recording the first failure instead of failing the
+// test. Like testing.T, Fatalf stops the calling goroutine.
+type recorder struct {
+	testing.TB
+	failure string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Fatalf(format string, args ...interface{}) {
+	r.failure = fmt.Sprintf(format, args...)
+	runtime.Goexit()
+}
+
+// run calls fn with a FakeServer reporting to r in a new goroutine, and
+// returns the failure if any.
+func run(fn func(fs *FakeServer)) string {
+	r := new(recorder)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		fs := NewFakeServer(r)
+		fs.SetTimeout(100 * time.Millisecond)
+		fn(fs)
+		fs.Close()
+	}()
+
+	<-done
+	return r.failure
+}
+
+func TestFakeServer(t *testing.T) {
+	fs := NewFakeServer(t)
+
+	registered := make(chan error)
+	go func() {
+		registered <- fs.Conn().Register("foo", "foo", "Foo")
+	}()
+
+	fs.Expect("NICK foo")
+	fs.Expect("user foo 0 * Foo")
+	fs.Send(":irc.example.org 001 foo :Welcome")
+
+	if err := <-registered; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	go fs.Conn().Join("#test")
+	if m := fs.Read(); m.Command != "JOIN" || m.Raw != "JOIN #test" {
+		t.Errorf("Unexpected message: %#v", m)
+	}
+
+	fs.Close()
+
+	if _, err := fs.Conn().Decode(); err == nil {
+		t.Error("Connection should be closed")
+	}
+}
+
+func TestFakeServer_failures(t *testing.T) {
+	tests := []struct {
+		fn      func(fs *FakeServer)
+		failure string
+	}{
+		{
+			func(fs *FakeServer) {
+				go fs.Conn().Nick("bar")
+				fs.Expect("NICK foo")
+			},
+			"irctest: unexpected message from client:\nNICK bar\nexpected:\nNICK foo",
+		},
+		{
+			func(fs *FakeServer) {
+				fs.Expect("NICK foo")
+			},
+			"irctest: timeout waiting for the client after 100ms",
+		},
+		{
+			func(fs *FakeServer) {
+				fs.Send("PING :irc.example.org")
+			},
+			"irctest: timeout waiting for the client to read",
+		},
+		{
+			func(fs *FakeServer) {
+				fs.Expect("")
+			},
+			"irctest: invalid expected message \"\"",
+		},
+	}
+
+	for i, test := range tests {
+		if failure := run(test.fn); failure != test.failure {
+			t.Errorf("Unexpected failure %d: %q", i, failure)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Defaults for features that were not advertised by the server.
+const (
+	defaultChanTypes = "#&"
+	defaultPrefix    = "(ov)@+"
+	defaultChanModes = "beI,k,l,imnpst"
+
+	// Limits defined by RFC 2812.
+	defaultNickLen    = 9
+	defaultChannelLen = 50
+)
+
+// ISupport collects the features a server advertises using RPL_ISUPPORT (005).
+//
+//    :irc.example.org 005 nick CHANTYPES=#& PREFIX=(ov)@+ NETWORK=Example :are supported by this server
+//
+// The zero value is an empty feature set ready to use.
+type ISupport struct {
+	// Advertised tokens. Tokens without a value are stored with an empty value.
+	Tokens map[string]string
+}
+
+// Update adds the tokens in a RPL_ISUPPORT message to the feature set.
+// Negated tokens (-FEATURE) remove a previously advertised feature.
+//
+// Returns false if m is not a RPL_ISUPPORT message.
+func (s *ISupport) Update(m *Message) bool {
+
+	// The first parameter is our own nick.
+	if m.Command != RPL_ISUPPORT || len(m.Params) < 2 {
+		return false
+	}
+
+	if s.Tokens == nil {
+		s.Tokens = make(map[string]string)
+	}
+
+	for _, token := range m.Params[1:] {
+
+		if len(token) <= 0 {
+			continue
+		}
+
+		if token[0] == '-' {
+			delete(s.Tokens, token[1:])
+			continue
+		}
+
+		if i := indexByte(token, '='); i < 0 {
+			s.Tokens[token] = ""
+		} else {
+			s.Tokens[token[:i]] = unescapeISupportValue(token[i+1:])
+		}
+	}
+
+	return true
+}
+
+// Get returns the value of a token, and whether it was advertised at all.
+func (s *ISupport) Get(token string) (value string, ok bool) {
+	value, ok = s.Tokens[token]
+	return
+}
+
+// Has returns true if the server advertised token.
+func (s *ISupport) Has(token string) bool {
+	_, ok := s.Tokens[token]
+	return ok
+}
+
+// ChanTypes returns the supported channel prefixes, like "#&".
+func (s *ISupport) ChanTypes() string {
+	if value, ok := s.Tokens["CHANTYPES"]; ok {
+		return value
+	}
+	return defaultChanTypes
+}
+
+// Prefixes returns the channel membership modes and their matching prefix
+// symbols, ordered from highest to lowest rank, like "ov" and "@+".
+func (s *ISupport) Prefixes() (modes, symbols string) {
+	value, ok := s.Tokens["PREFIX"]
+	if !ok {
+		value = defaultPrefix
+	}
+
+	i := indexByte(value, ')')
+	if len(value) <= 0 || value[0] != '(' || i < 0 {
+		return "", ""
+	}
+
+	return value[1:i], value[i+1:]
+}
+
+// ChanModes returns the supported channel modes as advertised by CHANMODES,
+// grouped by type:
+//
+//    A: Modes that manage a list, always taking a parameter.
+//    B: Modes that always take a parameter.
+//    C: Modes that only take a parameter when set.
+//    D: Modes that never take a parameter.
+//
+// Membership modes (see Prefixes) are not included.
+func (s *ISupport) ChanModes() (a, b, c, d string) {
+	value, ok := s.Tokens["CHANMODES"]
+	if !ok {
+		value = defaultChanModes
+	}
+
+	types := strings.SplitN(value, ",", 5)
+	for len(types) < 4 {
+		types = append(types, "")
+	}
+
+	return types[0], types[1], types[2], types[3]
+}
+
+// CaseMapping returns the casemapping advertised by CASEMAPPING, or rfc1459
+// if none was.
+func (s *ISupport) CaseMapping() CaseMapping {
+	if value, ok := s.Tokens["CASEMAPPING"]; ok && len(value) > 0 {
+		return CaseMapping(value)
+	}
+	return CaseMappingRFC1459
+}
+
+// MaxChannels returns the maximum number of channels a client may join,
+// using MAXCHANNELS or the first limit of CHANLIMIT.
+//
+// Returns 0 if there is no (known) limit.
+func (s *ISupport) MaxChannels() int {
+	if value, ok := s.Tokens["MAXCHANNELS"]; ok {
+		n, _ := strconv.Atoi(value)
+		return n
+	}
+
+	// CHANLIMIT=#&:100,+:10
+	if value, ok := s.Tokens["CHANLIMIT"]; ok {
+		if i := indexByte(value, ':'); i >= 0 {
+			value = value[i+1:]
+			if i = indexByte(value, ','); i >= 0 {
+				value = value[:i]
+			}
+			n, _ := strconv.Atoi(value)
+			return n
+		}
+	}
+
+	return 0
+}
+
+// TargMax returns the maximum number of targets of command advertised by
+// TARGMAX, like 4 for "TARGMAX=PRIVMSG:4,NOTICE:4,JOIN:". Returns 0 and false
+// if the token is missing, or if there is no limit for command.
+func (s *ISupport) TargMax(command string) (int, bool) {
+	for _, limit := range strings.Split(s.Tokens["TARGMAX"], ",") {
+		name, value := limit, ""
+		if i := indexByte(limit, ':'); i >= 0 {
+			name, value = limit[:i], limit[i+1:]
+		}
+		if !strings.EqualFold(name, command) {
+			continue
+		}
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n, true
+		}
+		break
+	}
+	return 0, false
+}
+
+// SplitTargets splits targets into groups no larger than the maximum number
+// of targets of command advertised by TARGMAX, to be sent as comma-separated
+// lists in separate messages:
+//
+//    TARGMAX=PRIVMSG:2  ->  [[#a #b] [#c]]
+//
+// All targets are returned as a single group if the command has no limit, or
+// is missing from TARGMAX. Returns nil if there are no targets.
+func SplitTargets(command string, targets []string, is ISupport) [][]string {
+	if len(targets) <= 0 {
+		return nil
+	}
+
+	max, ok := is.TargMax(command)
+	if !ok {
+		return [][]string{targets}
+	}
+
+	groups := make([][]string, 0, (len(targets)+max-1)/max)
+	for len(targets) > max {
+		groups = append(groups, targets[:max:max])
+		targets = targets[max:]
+	}
+	return append(groups, targets)
+}
+
+// NickLen returns the maximum length of a nick advertised by NICKLEN. Returns
+// the RFC 2812 limit of 9 and false if the token is missing or not a number.
+func (s *ISupport) NickLen() (int, bool) {
+	return s.limit("NICKLEN", defaultNickLen)
+}
+
+// ChannelLen returns the maximum length of a channel name advertised by
+// CHANNELLEN. Returns the RFC 2812 limit of 50 and false if the token is
+// missing or not a number.
+func (s *ISupport) ChannelLen() (int, bool) {
+	return s.limit("CHANNELLEN", defaultChannelLen)
+}
+
+// TopicLen returns the maximum length of a topic advertised by TOPICLEN.
+// Returns 0 and false if the token is missing or not a number, as there is
+// no known limit.
+func (s *ISupport) TopicLen() (int, bool) {
+	return s.limit("TOPICLEN", 0)
+}
+
+// AwayLen returns the maximum length of an away message advertised by
+// AWAYLEN. Returns 0 and false if the token is missing or not a number, as
+// there is no known limit.
+func (s *ISupport) AwayLen() (int, bool) {
+	return s.limit("AWAYLEN", 0)
+}
+
+// KickLen returns the maximum length of a kick reason advertised by KICKLEN.
+// Returns 0 and false if the token is missing or not a number, as there is no
+// known limit.
+func (s *ISupport) KickLen() (int, bool) {
+	return s.limit("KICKLEN", 0)
+}
+
+// NameLen returns the maximum length of a real name advertised by NAMELEN,
+// which limits SETNAME. Returns 0 and false if the token is missing or not a
+// number, as there is no known limit.
+func (s *ISupport) NameLen() (int, bool) {
+	return s.limit("NAMELEN", 0)
+}
+
+// UTF8Only returns true if the server advertises UTF8ONLY, so clients must
+// only send valid UTF-8. See Encoder.RequireUTF8.
+func (s *ISupport) UTF8Only() bool {
+	return s.Has("UTF8ONLY")
+}
+
+// limit returns the positive numeric value of token, or def and false if it
+// was not advertised or is not a valid limit.
+func (s *ISupport) limit(token string, def int) (int, bool) {
+	n, err := strconv.Atoi(s.Tokens[token])
+	if err != nil || n <= 0 {
+		return def, false
+	}
+	return n, true
+}
+
+// unescapeISupportValue replaces \xHH escape sequences in token values.
+func unescapeISupportValue(value string) string {
+
+	// Fast path, most values don't need unescaping.
+	if !strings.Contains(value, "\\x") {
+		return value
+	}
+
+	buffer := make([]byte, 0, len(value))
+
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+3 < len(value) && value[i+1] == 'x' {
+			if b, err := strconv.ParseUint(value[i+2:i+4], 16, 8); err == nil {
+				buffer = append(buffer, byte(b))
+				i += 3
+				continue
+			}
+		}
+		buffer = append(buffer, value[i])
+	}
+
+	return string(buffer)
+}
@@ -0,0 +1,146 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestISupport_Update(t *testing.T) {
+	var s ISupport
+
+	if s.Update(ParseMessage(":irc.example.org 001 nick :Welcome")) {
+		t.Fatal("Only RPL_ISUPPORT messages should be accepted!")
+	}
+
+	s.Update(ParseMessage(":irc.example.org 005 nick CHANTYPES=#& PREFIX=(qov)~@+ EXCEPTS NETWORK=Example\\x20Net :are supported by this server"))
+	s.Update(ParseMessage(":irc.example.org 005 nick MAXCHANNELS=20 SAFELIST :are supported by this server"))
+
+	if value, ok := s.Get("NETWORK"); !ok || value != "Example Net" {
+		t.Errorf("Wrong NETWORK value: %q", value)
+	}
+	if !s.Has("EXCEPTS") || !s.Has("SAFELIST") {
+		t.Error("Tokens without a value should be present!")
+	}
+	if s.ChanTypes() != "#&" {
+		t.Errorf("Wrong channel types: %q", s.ChanTypes())
+	}
+	if modes, symbols := s.Prefixes(); modes != "qov" || symbols != "~@+" {
+		t.Errorf("Wrong prefixes: %q %q", modes, symbols)
+	}
+	if s.MaxChannels() != 20 {
+		t.Errorf("Wrong channel limit: %d", s.MaxChannels())
+	}
+
+	s.Update(ParseMessage(":irc.example.org 005 nick -EXCEPTS -MAXCHANNELS CHANLIMIT=#:120,&: :are supported by this server"))
+
+	if s.Has("EXCEPTS") {
+		t.Error("Negated token should be removed!")
+	}
+	if s.MaxChannels() != 120 {
+		t.Errorf("Wrong channel limit: %d", s.MaxChannels())
+	}
+}
+
+func TestISupport_defaults(t *testing.T) {
+	var s ISupport
+
+	if s.ChanTypes() != "#&" {
+		t.Errorf("Wrong default channel types: %q", s.ChanTypes())
+	}
+	if modes, symbols := s.Prefixes(); modes != "ov" || symbols != "@+" {
+		t.Errorf("Wrong default prefixes: %q %q", modes, symbols)
+	}
+	if s.MaxChannels() != 0 {
+		t.Errorf("Wrong default channel limit: %d", s.MaxChannels())
+	}
+}
+
+func TestISupport_limits(t *testing.T) {
+	var s ISupport
+
+	limits := []func() (int, bool){s.NickLen, s.ChannelLen, s.TopicLen, s.AwayLen, s.KickLen}
+	defaults := []int{9, 50, 0, 0, 0}
+
+	for i, limit := range limits {
+		if n, ok := limit(); n != defaults[i] || ok {
+			t.Errorf("Wrong default limit %d: %d, %v", i, n, ok)
+		}
+	}
+
+	s.Update(ParseMessage(":irc.example.org 005 nick NICKLEN=30 CHANNELLEN=64 TOPICLEN=390 AWAYLEN=200 KICKLEN=255 :are supported by this server"))
+
+	for i, n := range []int{30, 64, 390, 200, 255} {
+		if limit, ok := limits[i](); limit != n || !ok {
+			t.Errorf("Wrong limit %d: %d, %v", i, limit, ok)
+		}
+	}
+
+	s.Update(ParseMessage(":irc.example.org 005 nick NICKLEN=abc CHANNELLEN= TOPICLEN=-1 -AWAYLEN :are supported by this server"))
+
+	for i, n := range []int{9, 50, 0, 0, 255} {
+		if limit, ok := limits[i](); limit != n || ok != (i == 4) {
+			t.Errorf("Wrong limit %d for an invalid value: %d, %v", i, limit, ok)
+		}
+	}
+}
+
+func TestISupport_TargMax(t *testing.T) {
+	var s ISupport
+
+	if n, ok := s.TargMax(PRIVMSG); n != 0 || ok {
+		t.Errorf("Wrong default limit: %d, %v", n, ok)
+	}
+
+	s.Update(ParseMessage(":irc.example.org 005 nick TARGMAX=NAMES:1,PRIVMSG:4,JOIN:,KICK:x :are supported by this server"))
+
+	for command, expected := range map[string]int{"privmsg": 4, NAMES: 1, JOIN: 0, KICK: 0, NOTICE: 0} {
+		if n, ok := s.TargMax(command); n != expected || ok != (expected > 0) {
+			t.Errorf("Wrong limit for %s: %d, %v", command, n, ok)
+		}
+	}
+}
+
+func TestSplitTargets(t *testing.T) {
+	var s ISupport
+	s.Update(ParseMessage(":irc.example.org 005 nick TARGMAX=PRIVMSG:2,JOIN: :are supported by this server"))
+
+	targets := []string{"#a", "#b", "#c", "#d", "#e"}
+
+	tests := []struct {
+		command  string
+		targets  []string
+		expected [][]string
+	}{
+		{PRIVMSG, targets, [][]string{{"#a", "#b"}, {"#c", "#d"}, {"#e"}}},
+		{PRIVMSG, targets[:2], [][]string{{"#a", "#b"}}},
+		{JOIN, targets, [][]string{targets}},
+		{NOTICE, targets, [][]string{targets}},
+		{PRIVMSG, nil, nil},
+	}
+
+	for i, test := range tests {
+		if groups := SplitTargets(test.command, test.targets, s); !reflect.DeepEqual(groups, test.expected) {
+			t.Errorf("Failed to split targets %d:", i)
+			t.Logf("Output: %v", groups)
+			t.Logf("Expected: %v", test.expected)
+		}
+	}
+}
+
+func TestISupport_CaseMapping(t *testing.T) {
+	var s ISupport
+
+	if s.CaseMapping() != CaseMappingRFC1459 {
+		t.Errorf("Wrong default casemapping: %q", s.CaseMapping())
+	}
+
+	s.Update(ParseMessage(":irc.example.org 005 nick CASEMAPPING=ascii :are supported by this server"))
+
+	if s.CaseMapping() != CaseMappingASCII {
+		t.Errorf("Wrong casemapping: %q", s.CaseMapping())
+	}
+}
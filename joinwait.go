@@ -0,0 +1,166 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// JoinError is returned by JoinWait when the server refused to let us join a
+// channel.
+type JoinError struct {
+	Code    string // Numeric reply, like ERR_BADCHANNELKEY
+	Channel string // Channel we tried to join
+	Text    string // Text sent by the server
+}
+
+func (e *JoinError) Error() string {
+	return "irc: cannot join " + e.Channel + ": " + e.Text + " (" + CommandName(e.Code) + ")"
+}
+
+// joins tracks the channels JoinWait is waiting for.
+type joins struct {
+	mu      sync.Mutex
+	pending map[string][]*joinWaiter // By folded channel name
+}
+
+// joinWaiter receives the result of a single JoinWait.
+type joinWaiter struct {
+	joined bool       // Our JOIN was echoed
+	done   chan error // Receives the result once
+}
+
+// JoinWait joins channel using the given key, which may be empty, and waits
+// until the server confirmed it by echoing the JOIN and sending the end of the
+// member list (RPL_ENDOFNAMES). Returns ctx.Err() if that did not happen before
+// ctx is done.
+//
+// Returns a *JoinError if the server refused, for example because the key is
+// wrong (ERR_BADCHANNELKEY) or the channel is full (ERR_CHANNELISFULL), or a
+// *StandardReply for a FAIL JOIN reply about the channel. Replies for other
+// channels are ignored. Channel names are compared using the casemapping
+// advertised by the server.
+//
+// Replies are detected while decoding messages, like Ping does, so another
+// goroutine must keep calling Decode.
+func (c *Conn) JoinWait(ctx context.Context, channel, key string) error {
+	if len(channel) <= 0 || strings.ContainsAny(channel, ", ") || strings.ContainsAny(key, ", ") {
+		return ErrInvalidParam
+	}
+
+	c.mu.Lock()
+	folded := c.support.CaseMapping().Fold(channel)
+	c.mu.Unlock()
+
+	w := &joinWaiter{done: make(chan error, 1)}
+	c.joins.add(folded, w)
+	defer c.joins.remove(folded, w)
+
+	m := &Message{Command: JOIN, Params: []string{channel}}
+	if len(key) > 0 {
+		m.Params = append(m.Params, key)
+	}
+	if err := c.EncodeContext(ctx, m); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-w.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// add starts waiting for the result of joining channel.
+func (j *joins) add(channel string, w *joinWaiter) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.pending == nil {
+		j.pending = make(map[string][]*joinWaiter)
+	}
+	j.pending[channel] = append(j.pending[channel], w)
+}
+
+// remove stops waiting using w.
+func (j *joins) remove(channel string, w *joinWaiter) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	waiters := j.pending[channel]
+	for i, other := range waiters {
+		if other == w {
+			waiters = append(waiters[:i:i], waiters[i+1:]...)
+			break
+		}
+	}
+	j.set(channel, waiters)
+}
+
+// set replaces the waiters for channel. The caller must hold j.mu.
+func (j *joins) set(channel string, waiters []*joinWaiter) {
+	if len(waiters) > 0 {
+		j.pending[channel] = waiters
+	} else {
+		delete(j.pending, channel)
+	}
+}
+
+// observe finishes the waiters for the channel m is about, if it confirms or
+// refuses our JOIN. The nick is our own, names are folded using mapping.
+func (j *joins) observe(m *Message, nick string, mapping CaseMapping) {
+	var channel string
+	var result error
+
+	switch m.Command {
+	case JOIN:
+		if !m.IsEcho(nick, mapping) {
+			return
+		}
+		channel = firstParam(m)
+	case RPL_ENDOFNAMES:
+		// :irc.example.org 366 me #channel :End of /NAMES list.
+		channel = m.param(1)
+	case ERR_NOSUCHCHANNEL, ERR_TOOMANYCHANNELS, ERR_CHANNELISFULL, ERR_INVITEONLYCHAN, ERR_BANNEDFROMCHAN, ERR_BADCHANNELKEY, ERR_BADCHANMASK:
+		// :irc.example.org 475 me #channel :Cannot join channel (+k)
+		e := m.AsError().(*NumericError)
+		channel, result = e.Target, &JoinError{Code: e.Code, Channel: e.Target, Text: e.Text}
+	case FAIL:
+		// FAIL JOIN <code> #channel :description
+		reply, ok := failure(m, JOIN).(*StandardReply)
+		if !ok || len(reply.Context) <= 0 {
+			return
+		}
+		channel, result = reply.Context[0], reply
+	default:
+		return
+	}
+
+	folded := mapping.Fold(channel)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	waiters := j.pending[folded]
+	remaining := waiters[:0]
+	for _, w := range waiters {
+		switch {
+		case m.Command == JOIN:
+			w.joined = true
+		case m.Command == RPL_ENDOFNAMES && !w.joined:
+			// Reply to an earlier NAMES command.
+		default:
+			w.done <- result
+			continue
+		}
+		remaining = append(remaining, w)
+	}
+	if waiters != nil {
+		j.set(folded, remaining)
+	}
+}
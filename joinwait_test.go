@@ -0,0 +1,97 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// joinWaitConn returns a Conn registered as "me", with a fake server sending
+// the replies to each JOIN command.
+func joinWaitConn(t *testing.T, replies map[string][]string) *Conn {
+	client, server := net.Pipe()
+
+	conn := NewConn(client)
+	go func() {
+		for {
+			if _, err := conn.Decode(); err != nil {
+				return
+			}
+		}
+	}()
+
+	peer := NewConn(server)
+	go func() {
+		defer peer.Close()
+		peer.Write([]byte(":irc.example.org 001 me :Welcome"))
+		for {
+			m, err := peer.Decode()
+			if err != nil {
+				return
+			}
+			for _, reply := range replies[m.String()] {
+				peer.Write([]byte(reply))
+			}
+		}
+	}()
+
+	return conn
+}
+
+func TestConn_JoinWait(t *testing.T) {
+	conn := joinWaitConn(t, map[string][]string{
+		"JOIN #Channel": {
+			":irc.example.org 366 me #channel :End of /NAMES list.",
+			":irc.example.org 475 me #other :Cannot join channel (+k)",
+			":me!user@host JOIN #CHANNEL",
+			":irc.example.org 353 me = #channel :me @op",
+			":irc.example.org 366 me #channel :End of /NAMES list.",
+		},
+		"JOIN #secret wrong": {":irc.example.org 475 me #Secret :Cannot join channel (+k)"},
+		"JOIN #new":          {":irc.example.org FAIL JOIN CHANNEL_RESERVED #new :Reserved"},
+	})
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := conn.JoinWait(ctx, "#Channel", ""); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	err := conn.JoinWait(ctx, "#secret", "wrong")
+	if !reflect.DeepEqual(err, &JoinError{Code: ERR_BADCHANNELKEY, Channel: "#Secret", Text: "Cannot join channel (+k)"}) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if r, ok := conn.JoinWait(ctx, "#new", "").(*StandardReply); !ok || r.Code != "CHANNEL_RESERVED" {
+		t.Errorf("Expected a standard reply: %v", r)
+	}
+
+	conn.joins.mu.Lock()
+	if len(conn.joins.pending) > 0 {
+		t.Errorf("Joins still pending: %v", conn.joins.pending)
+	}
+	conn.joins.mu.Unlock()
+}
+
+func TestConn_JoinWait_cancelled(t *testing.T) {
+	conn := joinWaitConn(t, nil)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := conn.JoinWait(ctx, "#channel", ""); err != context.DeadlineExceeded {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := conn.JoinWait(ctx, "#a,#b", ""); err != ErrInvalidParam {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidJournal is returned by ReplayJournal if the input does not start
+// with a journal entry.
+var ErrInvalidJournal = errors.New("irc: invalid journal entry")
+
+// Maximum length of a journal entry read by ReplayJournal.
+const maxJournalEntry = 64 * 1024
+
+// A JournalEntry is a line written by a journal, see Conn.SetJournal.
+type JournalEntry struct {
+	Time time.Time
+	Dir  Direction
+	Line string // Raw line, without line ending
+}
+
+// Message parses the line of the entry.
+func (e *JournalEntry) Message() *Message {
+	return ParseMessage(e.Line)
+}
+
+// SetJournal writes every line received by the Decoder and sent by the
+// Encoder to w, prefixed with the time in nanoseconds since the Unix epoch
+// and R for received lines or S for sent lines:
+//
+//    1500000000000000000 S NICK sorcix
+//    1500000000123456789 R :irc.example.org 001 sorcix :Welcome
+//
+// Lines are written in the order they were read or written, using a single
+// call to w.Write for each line. Write errors are ignored. A nil w stops
+// journaling, which is the default. Credentials are not redacted, unlike
+// SetTrafficLogger does. Use ReplayJournal to read the journal.
+func (c *Conn) SetJournal(w io.Writer) {
+	if w == nil {
+		c.Decoder.journal.Store(trafficLog(nil))
+		c.Encoder.journal.Store(trafficLog(nil))
+		return
+	}
+
+	var mu sync.Mutex
+	journal := func(dir byte) trafficLog {
+		return func(line string) {
+			line = strings.TrimRight(line, string(endline))
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			entry := strconv.AppendInt(make([]byte, 0, 24+len(line)), time.Now().UnixNano(), 10)
+			entry = append(entry, space, dir, space)
+			entry = append(append(entry, line...), '\n')
+			w.Write(entry)
+		}
+	}
+
+	c.Decoder.journal.Store(journal('R'))
+	c.Encoder.journal.Store(journal('S'))
+}
+
+// ReplayJournal reads the entries of a journal written by Conn.SetJournal
+// from r. The entries are sent on the returned channel, which is closed at
+// the end of the input. The channel should be drained.
+//
+// Returns ErrInvalidJournal if the first line is not a journal entry. Later
+// lines that are not valid entries are skipped.
+func ReplayJournal(r io.Reader) (<-chan JournalEntry, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, DefaultReadBufferSize), maxJournalEntry)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		entries := make(chan JournalEntry)
+		close(entries)
+		return entries, nil
+	}
+
+	first, ok := parseJournalEntry(scanner.Text())
+	if !ok {
+		return nil, ErrInvalidJournal
+	}
+
+	entries := make(chan JournalEntry)
+	go func() {
+		defer close(entries)
+
+		entries <- first
+		for scanner.Scan() {
+			if entry, ok := parseJournalEntry(scanner.Text()); ok {
+				entries <- entry
+			}
+		}
+	}()
+
+	return entries, nil
+}
+
+// parseJournalEntry parses a single line of a journal.
+func parseJournalEntry(line string) (entry JournalEntry, ok bool) {
+	stamp, rest := splitFirst(line)
+	dir, raw := splitFirst(rest)
+
+	nanos, err := strconv.ParseInt(stamp, 10, 64)
+	if err != nil {
+		return entry, false
+	}
+
+	switch dir {
+	case "R":
+		entry.Dir = Received
+	case "S":
+		entry.Dir = Sent
+	default:
+		return entry, false
+	}
+
+	entry.Time = time.Unix(0, nanos)
+	entry.Line = strings.TrimRight(raw, string(endline))
+	return entry, true
+}
@@ -0,0 +1,86 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConn_SetJournal(t *testing.T) {
+	conn := NewConn(&readWriter{strings.NewReader(":irc.example.org 001 sorcix :Welcome\r\nPING :irc.example.org\r\n"), new(bufferConn)})
+	journal := new(bytes.Buffer)
+
+	start := time.Now()
+	conn.SetJournal(journal)
+	conn.Nick("sorcix")
+	conn.Decode()
+	conn.Decode()
+	conn.Encode(&Message{Command: PONG, Trailing: "irc.example.org"})
+
+	conn.SetJournal(nil)
+	conn.Nick("other")
+
+	entries, err := ReplayJournal(journal)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"sent NICK sorcix",
+		"received :irc.example.org 001 sorcix :Welcome",
+		"received PING :irc.example.org",
+		"sent PONG :irc.example.org",
+	}
+
+	last := start.Add(-time.Microsecond)
+	i := 0
+	for entry := range entries {
+		if i >= len(expected) || entry.Dir.String()+" "+entry.Line != expected[i] {
+			t.Errorf("Unexpected entry %d: %v %q", i, entry.Dir, entry.Line)
+		}
+		if entry.Time.Before(last) {
+			t.Errorf("Entry %d is out of order: %v", i, entry.Time)
+		}
+		last = entry.Time
+		i++
+	}
+	if i != len(expected) {
+		t.Errorf("Expected %d entries, got %d", len(expected), i)
+	}
+}
+
+func TestReplayJournal(t *testing.T) {
+	input := "1500000000000000000 S NICK sorcix\n" +
+		"invalid\n" +
+		"1500000000123456789 R :irc.example.org 001 sorcix :Welcome\r\n"
+
+	entries, err := ReplayJournal(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	first, second := <-entries, <-entries
+	if first.Dir != Sent || first.Time.UnixNano() != 1500000000000000000 || first.Message().Command != NICK {
+		t.Errorf("Unexpected first entry: %#v", first)
+	}
+	if second.Dir != Received || second.Time.UnixNano() != 1500000000123456789 || second.Line != ":irc.example.org 001 sorcix :Welcome" {
+		t.Errorf("Unexpected second entry: %#v", second)
+	}
+	if _, ok := <-entries; ok {
+		t.Error("Channel should be closed")
+	}
+
+	if _, err := ReplayJournal(strings.NewReader("PING :irc.example.org\n")); err != ErrInvalidJournal {
+		t.Errorf("Expected ErrInvalidJournal, got: %v", err)
+	}
+	if entries, err := ReplayJournal(strings.NewReader("")); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	} else if _, ok := <-entries; ok {
+		t.Error("Empty journal should have no entries")
+	}
+}
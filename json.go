@@ -0,0 +1,85 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"encoding/json"
+)
+
+// jsonMessage is the JSON representation of a Message.
+type jsonMessage struct {
+	Tags    map[string]string `json:"tags,omitempty"`
+	Prefix  *jsonPrefix       `json:"prefix,omitempty"`
+	Command string            `json:"command"`
+	Params  []string          `json:"params"`
+}
+
+// jsonPrefix is the JSON representation of a Prefix.
+type jsonPrefix struct {
+	Nick string `json:"nick"`
+	User string `json:"user,omitempty"`
+	Host string `json:"host,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler:
+//
+//    {"tags":{"time":"2020-01-01T10:00:00.000Z"},"prefix":{"nick":"nick","user":"user","host":"host"},"command":"PRIVMSG","params":["#channel","Hello there"]}
+//
+// The trailing parameter is the last of params. Tags and the prefix are
+// omitted if there are none. The raw line is never included.
+func (m *Message) MarshalJSON() ([]byte, error) {
+	j := jsonMessage{
+		Tags:    m.Tags,
+		Command: m.Command,
+		Params:  m.allParams(),
+	}
+	if j.Params == nil {
+		j.Params = []string{}
+	}
+	if m.Prefix != nil {
+		j.Prefix = &jsonPrefix{Nick: m.Name, User: m.User, Host: m.Host}
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, see MarshalJSON. The result is
+// Equal to the marshalled message.
+//
+// Returns ErrInvalidCommand if the command is empty, and ErrInvalidParam if a
+// parameter other than the last one could only be sent as trailing parameter.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var j jsonMessage
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+
+	if len(j.Command) <= 0 {
+		return ErrInvalidCommand
+	}
+	for i := 0; i < len(j.Params)-1; i++ {
+		if needsColon(j.Params[i]) {
+			return ErrInvalidParam
+		}
+	}
+
+	*m = Message{
+		Tags:    j.Tags,
+		Command: j.Command,
+	}
+	if j.Prefix != nil {
+		m.Prefix = &Prefix{Name: j.Prefix.Nick, User: j.Prefix.User, Host: j.Prefix.Host}
+	}
+
+	// Keep the last parameter as trailing if it needs to be, so an empty one
+	// survives encoding.
+	if n := len(j.Params); n > 0 && needsColon(j.Params[n-1]) {
+		m.Params, m.Trailing = j.Params[:n-1], j.Params[n-1]
+		m.EmptyTrailing = len(m.Trailing) <= 0
+	} else if n > 0 {
+		m.Params = j.Params
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMessage_MarshalJSON(t *testing.T) {
+	m := ParseMessage("@time=2020-01-01T10:00:00.000Z;+draft/reply=abc :nick!user@host PRIVMSG #channel :Hello there")
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `{"tags":{"+draft/reply":"abc","time":"2020-01-01T10:00:00.000Z"},"prefix":{"nick":"nick","user":"user","host":"host"},"command":"PRIVMSG","params":["#channel","Hello there"]}`
+	if string(data) != expected {
+		t.Errorf("Wrong JSON: %s", data)
+	}
+
+	data, _ = json.Marshal(&Message{Command: PING})
+	if string(data) != `{"command":"PING","params":[]}` {
+		t.Errorf("Wrong JSON without prefix: %s", data)
+	}
+}
+
+func TestMessage_UnmarshalJSON(t *testing.T) {
+	for i, raw := range []string{
+		"@time=2020-01-01T10:00:00.000Z;+draft/reply=abc :nick!user@host PRIVMSG #channel :Hello there",
+		":irc.example.org 001 me :Welcome",
+		"TOPIC #channel :",
+		"MODE #channel +o nick",
+		"PING",
+	} {
+		m := ParseMessage(raw)
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatalf("Unexpected error %d: %v", i, err)
+		}
+
+		var decoded Message
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Unexpected error %d: %v", i, err)
+		}
+		if !decoded.Equal(m) {
+			t.Errorf("Failed to round-trip message %d:", i)
+			t.Logf("Output: %s", decoded.String())
+			t.Logf("Expected: %s", m.String())
+		}
+	}
+
+	invalid := map[string]error{
+		`{"command":"","params":[]}`:                    ErrInvalidCommand,
+		`{"command":"PRIVMSG","params":["a b","text"]}`: ErrInvalidParam,
+	}
+	for data, expected := range invalid {
+		var m Message
+		if err := json.Unmarshal([]byte(data), &m); err != expected {
+			t.Errorf("Wrong error for %s: %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strings"
+)
+
+// Kick removes nicks from channels, giving an optional reason:
+//
+//    KICK #channel nick1,nick2 :reason
+//    KICK #a,#b nick1,nick2 :reason
+//
+// Either a single channel is given, from which all nicks are kicked, or one
+// channel for every nick. Returns ErrInvalidParam otherwise, or if a name is
+// empty or contains a comma.
+//
+// Reasons longer than KICKLEN are truncated. If the server limits the number
+// of targets using TARGMAX, multiple KICK messages are sent.
+func (c *Conn) Kick(channels, nicks []string, reason string) error {
+	if len(nicks) <= 0 || (len(channels) != 1 && len(channels) != len(nicks)) {
+		return ErrInvalidParam
+	}
+	for _, name := range append(channels[:len(channels):len(channels)], nicks...) {
+		if len(name) <= 0 || strings.ContainsAny(name, ", ") {
+			return ErrInvalidParam
+		}
+	}
+
+	c.mu.Lock()
+	groups := SplitTargets(KICK, nicks, c.support)
+	n, ok := c.support.KickLen()
+	c.mu.Unlock()
+
+	if ok {
+		reason = truncateString(reason, n)
+	}
+
+	var msgs []*Message
+	for _, group := range groups {
+		channel := channels[0]
+		if len(channels) > 1 {
+			channel = strings.Join(channels[:len(group)], ",")
+			channels = channels[len(group):]
+		}
+
+		msgs = append(msgs, &Message{
+			Command:  KICK,
+			Params:   []string{channel, strings.Join(group, ",")},
+			Trailing: reason,
+		})
+	}
+
+	_, err := c.EncodeAll(msgs...)
+	return err
+}
+
+// KickTargets returns the comma-separated channels and nicks of a KICK
+// message:
+//
+//    :op!op@example.org KICK #a,#b nick1,nick2 :reason
+//
+// Empty names are skipped. Returns nil for other commands.
+func (m *Message) KickTargets() (channels, nicks []string) {
+	params := m.allParams()
+	if !strings.EqualFold(m.Command, KICK) || len(params) < 2 {
+		return nil, nil
+	}
+	return splitList(params[0]), splitList(params[1])
+}
@@ -0,0 +1,54 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConn_Kick(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(&readWriter{strings.NewReader(":irc.example.org 005 me TARGMAX=KICK:2 KICKLEN=5 :are supported by this server\r\n"), buffer})
+
+	conn.Kick([]string{"#a"}, []string{"nick1", "nick2", "nick3"}, "Go away")
+	conn.Decode()
+	conn.Kick([]string{"#a"}, []string{"nick1", "nick2", "nick3"}, "Go away")
+	conn.Kick([]string{"#a", "#b", "#c"}, []string{"nick1", "nick2", "nick3"}, "")
+
+	expected := "KICK #a nick1,nick2,nick3 :Go away\r\n" +
+		"KICK #a nick1,nick2 :Go aw\r\n" +
+		"KICK #a nick3 :Go aw\r\n" +
+		"KICK #a,#b nick1,nick2\r\n" +
+		"KICK #c nick3\r\n"
+
+	if buffer.String() != expected {
+		t.Errorf("Commands were not encoded correctly:\n%s", buffer.String())
+	}
+
+	for i, args := range [][2][]string{
+		{{"#a"}, nil},
+		{{"#a", "#b"}, {"nick1", "nick2", "nick3"}},
+		{nil, {"nick"}},
+		{{"#a"}, {"nick1,nick2"}},
+		{{"#a"}, {""}},
+	} {
+		if err := conn.Kick(args[0], args[1], ""); err != ErrInvalidParam {
+			t.Errorf("Invalid kick %d should fail: %v", i, err)
+		}
+	}
+}
+
+func TestMessage_KickTargets(t *testing.T) {
+	channels, nicks := ParseMessage(":op!op@example.org KICK #a,#b nick1,nick2 :reason").KickTargets()
+	if !reflect.DeepEqual(channels, []string{"#a", "#b"}) || !reflect.DeepEqual(nicks, []string{"nick1", "nick2"}) {
+		t.Errorf("Wrong targets: %v %v", channels, nicks)
+	}
+
+	if channels, nicks := ParseMessage("PART #a :reason").KickTargets(); channels != nil || nicks != nil {
+		t.Errorf("Targets for another command: %v %v", channels, nicks)
+	}
+}
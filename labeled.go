@@ -0,0 +1,199 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Number of response messages buffered by a LabeledResponse.
+const labeledBuffer = 64
+
+// ErrResponseTooLong is returned by LabeledResponse.Err if the response did
+// not fit in its buffer, because its messages were not read in time.
+var ErrResponseTooLong = errors.New("irc: labeled response too long")
+
+// A LabeledResponse delivers the server's response to a message sent using
+// SendLabeled.
+type LabeledResponse struct {
+	Label string // Value of the label tag
+
+	// Messages delivers the response, and is closed when it is complete.
+	// Messages of a labeled-response batch are delivered without the BATCH
+	// commands around them.
+	Messages <-chan *Message
+
+	ch    chan *Message
+	batch string // Reference of the labeled-response batch, if any
+	timer *time.Timer
+
+	mu   sync.Mutex
+	err  error
+	done bool
+}
+
+// Err returns ErrTimeout if the response was not complete in time, or nil.
+// It should be called after Messages is closed.
+func (r *LabeledResponse) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+// finish closes the response with err, only the first call has an effect.
+func (r *LabeledResponse) finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.done {
+		return
+	}
+	r.done, r.err = true, err
+	r.timer.Stop()
+	close(r.ch)
+}
+
+// deliver adds m to the response, or finishes it if there is no more room.
+func (r *LabeledResponse) deliver(m *Message) {
+	r.mu.Lock()
+	if r.done {
+		r.mu.Unlock()
+		return
+	}
+
+	select {
+	case r.ch <- m:
+		r.mu.Unlock()
+	default:
+		r.mu.Unlock()
+		r.finish(ErrResponseTooLong)
+	}
+}
+
+// labels tracks the responses to labeled messages.
+type labels struct {
+	mu      sync.Mutex
+	next    uint64
+	pending map[string]*LabeledResponse // By label
+	batches map[string]*LabeledResponse // By batch reference
+}
+
+// SendLabeled sends m with a unique label tag, as defined by the IRCv3
+// labeled-response capability, and returns its response. The response is
+// complete when the server sent a single labeled message, an ACK, or the end
+// of a labeled-response batch. If that does not happen within the timeout set
+// by SetTimeout, the response is closed and Err returns ErrTimeout.
+//
+// The labeled-response and batch capabilities must be enabled, see
+// NegotiateCaps. Responses are collected while decoding messages, so another
+// goroutine must keep calling Decode, for example using Messages or Mux.Run.
+// Those messages are still returned by Decode as well.
+func (c *Conn) SendLabeled(m *Message) (*LabeledResponse, error) {
+	ch := make(chan *Message, labeledBuffer)
+	r := &LabeledResponse{
+		Messages: ch,
+		ch:       ch,
+	}
+
+	c.labels.mu.Lock()
+	c.labels.next++
+	r.Label = strconv.FormatUint(c.labels.next, 10)
+	if c.labels.pending == nil {
+		c.labels.pending = make(map[string]*LabeledResponse)
+		c.labels.batches = make(map[string]*LabeledResponse)
+	}
+	c.labels.pending[r.Label] = r
+	c.labels.mu.Unlock()
+
+	r.mu.Lock()
+	r.timer = time.AfterFunc(c.replyTimeout(), func() {
+		c.labels.remove(r)
+		r.finish(ErrTimeout)
+	})
+	r.mu.Unlock()
+
+	labeled := m.Copy()
+	if labeled.Tags == nil {
+		labeled.Tags = make(map[string]string)
+	}
+	labeled.Tags["label"] = r.Label
+
+	if err := c.Encode(labeled); err != nil {
+		c.labels.remove(r)
+		r.finish(err)
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// remove stops tracking r.
+func (l *labels) remove(r *LabeledResponse) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.pending, r.Label)
+	if len(r.batch) > 0 {
+		delete(l.batches, r.batch)
+	}
+}
+
+// observe delivers m if it is part of a labeled response.
+func (l *labels) observe(m *Message) {
+	l.mu.Lock()
+
+	if len(l.pending) <= 0 {
+		l.mu.Unlock()
+		return
+	}
+
+	if ref, ok := m.Tags["batch"]; ok {
+		r := l.batches[ref]
+		l.mu.Unlock()
+
+		if r != nil {
+			r.deliver(m.Copy())
+		}
+		return
+	}
+
+	if m.Command == BATCH && len(m.Params) > 0 && len(m.Params[0]) > 1 && m.Params[0][0] == '-' {
+		r := l.batches[m.Params[0][1:]]
+		l.mu.Unlock()
+
+		if r != nil {
+			l.remove(r)
+			r.finish(nil)
+		}
+		return
+	}
+
+	r := l.pending[m.Tags["label"]]
+	if r == nil {
+		l.mu.Unlock()
+		return
+	}
+
+	// The response is a batch, wait for its end.
+	if m.Command == BATCH && len(m.Params) > 1 && len(m.Params[0]) > 1 && m.Params[0][0] == '+' && m.Params[1] == "labeled-response" {
+		r.batch = m.Params[0][1:]
+		l.batches[r.batch] = r
+		l.mu.Unlock()
+		return
+	}
+
+	l.mu.Unlock()
+
+	// A single message, or an acknowledgement without response.
+	if m.Command != "ACK" {
+		r.deliver(m.Copy())
+	}
+	l.remove(r)
+	r.finish(nil)
+}
@@ -0,0 +1,59 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConn_SendLabeled(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"@label=1 WHOIS sorcix": {
+			"@label=1 :irc.example.org BATCH +b labeled-response",
+			"@batch=b :irc.example.org 311 me sorcix sorcix example.org * :Vic Demuzere",
+			":irc.example.org NOTICE me :Unrelated",
+			"@batch=b :irc.example.org 318 me sorcix :End of /WHOIS list.",
+			":irc.example.org BATCH -b",
+		},
+		"@label=2 PRIVMSG #channel :Hello":  {"@label=2 :me!me@example.org PRIVMSG #channel :Hello"},
+		"@label=3 PONG :irc.example.org":    {"@label=3 :irc.example.org ACK"},
+		"@label=4 PRIVMSG #channel :Silent": nil,
+	})
+	defer conn.Close()
+
+	go func() {
+		for range conn.Messages() {
+		}
+	}()
+
+	whois, _ := conn.SendLabeled(&Message{Command: WHOIS, Params: []string{"sorcix"}})
+	var commands []string
+	for m := range whois.Messages {
+		commands = append(commands, m.Command)
+	}
+	if len(commands) != 2 || commands[0] != RPL_WHOISUSER || commands[1] != RPL_ENDOFWHOIS || whois.Err() != nil {
+		t.Errorf("Wrong batch response: %v, %v", commands, whois.Err())
+	}
+
+	echo, _ := conn.SendLabeled(&Message{Command: PRIVMSG, Params: []string{"#channel"}, Trailing: "Hello"})
+	if m := <-echo.Messages; m == nil || m.Trailing != "Hello" {
+		t.Errorf("Wrong echo response: %v", m)
+	}
+	if _, ok := <-echo.Messages; ok || echo.Err() != nil {
+		t.Errorf("Response should be complete: %v", echo.Err())
+	}
+
+	ack, _ := conn.SendLabeled(&Message{Command: PONG, Trailing: "irc.example.org"})
+	if _, ok := <-ack.Messages; ok || ack.Err() != nil {
+		t.Errorf("Acknowledgement should be an empty response: %v", ack.Err())
+	}
+
+	conn.SetTimeout(20 * time.Millisecond)
+	silent, _ := conn.SendLabeled(&Message{Command: PRIVMSG, Params: []string{"#channel"}, Trailing: "Silent"})
+	if _, ok := <-silent.Messages; ok || silent.Err() != ErrTimeout {
+		t.Errorf("Expected ErrTimeout, got: %v", silent.Err())
+	}
+}
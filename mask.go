@@ -0,0 +1,47 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+// MatchMask returns true if hostmask, in the nick!user@host form, matches
+// mask. The mask may contain wildcards, like ban masks do:
+//
+//    *    Any sequence of characters, including none
+//    ?    A single character
+//
+// Matching is case-insensitive using the rfc1459 casemapping, use
+// CaseMapping.MatchMask for other casemappings.
+func MatchMask(mask, hostmask string) bool {
+	return CaseMappingRFC1459.MatchMask(mask, hostmask)
+}
+
+// matchWildcard matches s against pattern, backtracking to the last star on
+// a mismatch.
+func matchWildcard(pattern, s []rune) bool {
+	p, i := 0, 0
+	star, next := -1, 0
+
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p++
+			i++
+		case p < len(pattern) && pattern[p] == '*':
+			star, next = p, i
+			p++
+		case star >= 0:
+			// Let the last star match one more character.
+			next++
+			p, i = star+1, next
+		default:
+			return false
+		}
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
@@ -0,0 +1,39 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"testing"
+)
+
+var maskTests = [...]struct {
+	mask     string
+	hostmask string
+	match    bool
+}{
+	{"*!*@*.example.com", "nick!user@host.example.com", true},
+	{"*!*@*.example.com", "nick!user@example.com", false},
+	{"*!*@*.EXAMPLE.com", "Nick!User@host.example.COM", true},
+	{"nick!*@*", "nick!user@host", true},
+	{"nick!*@*", "nick2!user@host", false},
+	{"n?ck!*@*", "nick!user@host", true},
+	{"n?ck!*@*", "nck!user@host", false},
+	{"*", "nick!user@host", true},
+	{"*", "", true},
+	{"", "", true},
+	{"**a*", "bbbab", true},
+	{"*a*b", "aaaaac", false},
+	{"[nick]!*@*", "{NICK}!user@host", true},
+	{"n\\ck^!*@*", "n|ck~!user@host", true},
+	{"ni?k!*@*", "niçk!user@host", true},
+}
+
+func TestMatchMask(t *testing.T) {
+	for i, test := range maskTests {
+		if MatchMask(test.mask, test.hostmask) != test.match {
+			t.Errorf("Failed to match mask %d: %q %q", i, test.mask, test.hostmask)
+		}
+	}
+}
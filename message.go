@@ -5,8 +5,11 @@
 package irc
 
 import (
-	"bytes"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 )
 
 // Various constants used for formatting IRC messages.
@@ -16,14 +19,32 @@ const (
 	prefixHost byte = 0x40 // Hostname
 	space      byte = 0x20 // Separator
 
+	tagPrefix byte = 0x40 // Message tags
+	tagSep    byte = 0x3B // Tag separator
+	tagValue  byte = 0x3D // Tag value
+
 	maxLength = 510 // Maximum length is 512 - 2 for the line endings.
 )
 
+// tagEscaper escapes tag values as described in the IRCv3 message-tags spec.
+var tagEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	";", "\\:",
+	" ", "\\s",
+	"\r", "\\r",
+	"\n", "\\n",
+)
+
 func cutsetFunc(r rune) bool {
 	// Characters to trim from prefixes/messages.
 	return r == '\r' || r == '\n'
 }
 
+func nulCutsetFunc(r rune) bool {
+	// Padding to trim from the end of messages, sent by some legacy servers.
+	return r == 0 || cutsetFunc(r)
+}
+
 // Sender represents objects that are able to send messages to an IRC server.
 //
 // As there might be a message queue, it is possible that Send returns a nil
@@ -48,9 +69,22 @@ type Prefix struct {
 }
 
 // ParsePrefix takes a string and attempts to create a Prefix struct.
+//
+// This is the same parser used by ParseMessage, so it can be used for prefixes
+// obtained elsewhere, such as logs. The user and host parts are optional, a
+// prefix without either is a server name or a bare nick.
 func ParsePrefix(raw string) (p *Prefix) {
 
 	p = new(Prefix)
+	p.parse(raw)
+
+	return p
+}
+
+// parse sets all fields of p to the parsed raw prefix.
+func (p *Prefix) parse(raw string) {
+
+	*p = Prefix{}
 
 	user := indexByte(raw, prefixUser)
 	host := indexByte(raw, prefixHost)
@@ -74,8 +108,6 @@ func ParsePrefix(raw string) (p *Prefix) {
 		p.Name = raw
 
 	}
-
-	return p
 }
 
 // Len calculates the length of the string representation of this prefix.
@@ -92,9 +124,7 @@ func (p *Prefix) Len() (length int) {
 
 // Bytes returns a []byte representation of this prefix.
 func (p *Prefix) Bytes() []byte {
-	buffer := new(bytes.Buffer)
-	p.writeTo(buffer)
-	return buffer.Bytes()
+	return p.appendTo(nil)
 }
 
 // String returns a string representation of this prefix.
@@ -121,24 +151,105 @@ func (p *Prefix) IsServer() bool {
 	return len(p.User) <= 0 && len(p.Host) <= 0 // && indexByte(p.Name, '.') > 0
 }
 
-// writeTo is an utility function to write the prefix to the bytes.Buffer in Message.String().
-func (p *Prefix) writeTo(buffer *bytes.Buffer) {
-	buffer.WriteString(p.Name)
+// appendTo is an utility function to append the prefix to the buffer in
+// Message.AppendBytes().
+func (p *Prefix) appendTo(buffer []byte) []byte {
+	buffer = append(buffer, p.Name...)
 	if len(p.User) > 0 {
-		buffer.WriteByte(prefixUser)
-		buffer.WriteString(p.User)
+		buffer = append(buffer, prefixUser)
+		buffer = append(buffer, p.User...)
 	}
 	if len(p.Host) > 0 {
-		buffer.WriteByte(prefixHost)
-		buffer.WriteString(p.Host)
+		buffer = append(buffer, prefixHost)
+		buffer = append(buffer, p.Host...)
 	}
-	return
+	return buffer
+}
+
+// parseTags parses the tags part of a message, without the leading '@', into
+// tags. A new map is allocated if tags is nil. See the IRCv3 message-tags
+// specification.
+//
+//    <tags>     ::= <tag> [';' <tag>]*
+//    <tag>      ::= <key> ['=' <escaped value>]
+//    <key>      ::= ['+'] [<vendor> '/'] <sequence of letters, digits, hyphens>
+func parseTags(tags map[string]string, raw string) map[string]string {
+
+	if tags == nil {
+		tags = make(map[string]string)
+	}
+
+	for len(raw) > 0 {
+
+		var tag string
+
+		if i := indexByte(raw, tagSep); i < 0 {
+			tag, raw = raw, ""
+		} else {
+			tag, raw = raw[:i], raw[i+1:]
+		}
+
+		// Ignore empty tags caused by duplicate separators.
+		if len(tag) <= 0 {
+			continue
+		}
+
+		if i := indexByte(tag, tagValue); i < 0 {
+			tags[tag] = ""
+		} else {
+			tags[tag[:i]] = unescapeTagValue(tag[i+1:])
+		}
+	}
+
+	return tags
+}
+
+// unescapeTagValue reverses the escaping done by tagEscaper.
+//
+// Unknown escape sequences are replaced by the escaped character and a
+// trailing backslash is dropped, as required by the specification.
+func unescapeTagValue(value string) string {
+
+	// Fast path, most values don't need unescaping.
+	if indexByte(value, '\\') < 0 {
+		return value
+	}
+
+	buffer := make([]byte, 0, len(value))
+
+	for i := 0; i < len(value); i++ {
+
+		if value[i] != '\\' {
+			buffer = append(buffer, value[i])
+			continue
+		}
+
+		// Skip the backslash.
+		if i++; i >= len(value) {
+			break
+		}
+
+		switch value[i] {
+		case ':':
+			buffer = append(buffer, ';')
+		case 's':
+			buffer = append(buffer, ' ')
+		case 'r':
+			buffer = append(buffer, '\r')
+		case 'n':
+			buffer = append(buffer, '\n')
+		default:
+			buffer = append(buffer, value[i])
+		}
+	}
+
+	return string(buffer)
 }
 
 // Message represents an IRC protocol message.
-// See RFC1459 section 2.3.1.
+// See RFC1459 section 2.3.1 and the IRCv3 message-tags specification.
 //
-//    <message>  ::= [':' <prefix> <SPACE> ] <command> <params> <crlf>
+//    <message>  ::= ['@' <tags> <SPACE>] [':' <prefix> <SPACE> ] <command> <params> <crlf>
 //    <prefix>   ::= <servername> | <nick> [ '!' <user> ] [ '@' <host> ]
 //    <command>  ::= <letter> { <letter> } | <number> <number> <number>
 //    <SPACE>    ::= ' ' { ' ' }
@@ -151,6 +262,13 @@ func (p *Prefix) writeTo(buffer *bytes.Buffer) {
 //
 //    <crlf>     ::= CR LF
 type Message struct {
+	// IRCv3 message tags. Tags without a value are stored with an empty value.
+	// Tags are encoded sorted by key, see Bytes.
+	Tags map[string]string
+
+	// Source of the message, nil if there is none. Relays and bouncers can set
+	// it to send messages on behalf of others. The prefix is only encoded if
+	// it has a Name.
 	*Prefix
 	Command  string
 	Params   []string
@@ -158,20 +276,91 @@ type Message struct {
 
 	// When set to true, the trailing prefix (:) will be added even if the trailing message is empty.
 	EmptyTrailing bool
+
+	// The line as received by the Decoder, without line ending and before
+	// any conversion set using SetCharset. Empty for messages created
+	// otherwise, and ignored when encoding.
+	Raw string
+}
+
+// NewMessageWithPrefix returns a message from the given source, which may be
+// a server name, a nick, or a full nick!user@host prefix:
+//
+//    m := irc.NewMessageWithPrefix(irc.ParsePrefix("nick!user@host"), irc.PRIVMSG, "#channel", "Hello there")
+//
+// The source is copied, a leading colon in its name is removed. The last of
+// params is sent as trailing parameter if it needs to be, like "Hello there".
+// A nil source returns a message without prefix.
+func NewMessageWithPrefix(source *Prefix, command string, params ...string) *Message {
+	m := &Message{
+		Command: command,
+		Params:  params,
+	}
+
+	if source != nil {
+		p := *source
+		p.Name = strings.TrimPrefix(p.Name, string(prefix))
+		m.Prefix = &p
+	}
+
+	return m
 }
 
 // ParseMessage takes a string and attempts to create a Message struct.
 // Returns nil if the Message is invalid.
+//
+// Only the line ending and NUL padding before it are removed. Everything after
+// the colon of the trailing parameter is kept as is, including spaces at the
+// end.
 func ParseMessage(raw string) (m *Message) {
 
-	// Ignore empty messages.
-	if raw = strings.TrimFunc(raw, cutsetFunc); len(raw) < 2 {
+	m = new(Message)
+
+	if !parseInto(m, raw) {
 		return nil
 	}
 
+	return m
+}
+
+// parseInto parses raw into m, like ParseMessage does. The tags map, prefix and
+// parameter slice of m are reused when possible, every other field is reset.
+// Returns false if the message is invalid.
+func parseInto(m *Message, raw string) bool {
+
+	tags, p, params := m.Tags, m.Prefix, m.Params[:0]
+	*m = Message{Params: params}
+
+	// Ignore empty messages. NUL padding before the line ending is removed.
+	raw = strings.TrimRightFunc(strings.TrimFunc(raw, cutsetFunc), nulCutsetFunc)
+	if len(raw) < 2 {
+		return false
+	}
+
 	i, j := 0, 0
 
-	m = new(Message)
+	if raw[0] == tagPrefix {
+
+		// Tags end with a space.
+		i = indexByte(raw, space)
+
+		// Tags must not be empty if the indicator is present.
+		if i < 2 {
+			return false
+		}
+
+		for key := range tags {
+			delete(tags, key)
+		}
+		m.Tags = parseTags(tags, raw[1:i])
+
+		// The rest of the message is parsed as usual.
+		if raw = raw[i+1:]; len(raw) < 2 {
+			return false
+		}
+
+		i = 0
+	}
 
 	if raw[0] == prefix {
 
@@ -180,10 +369,14 @@ func ParseMessage(raw string) (m *Message) {
 
 		// Prefix string must not be empty if the indicator is present.
 		if i < 2 {
-			return nil
+			return false
 		}
 
-		m.Prefix = ParsePrefix(raw[1:i])
+		if p == nil {
+			p = new(Prefix)
+		}
+		p.parse(raw[1:i])
+		m.Prefix = p
 
 		// Skip space at the end of the prefix
 		i++
@@ -199,7 +392,7 @@ func ParseMessage(raw string) (m *Message) {
 		m.Command = strings.ToUpper(raw[i:])
 
 		// We're done here!
-		return m
+		return true
 	}
 
 	// Skip space after command
@@ -211,10 +404,10 @@ func ParseMessage(raw string) (m *Message) {
 	if i < 0 || raw[j+i-1] != space {
 
 		// There is no trailing argument!
-		m.Params = strings.Split(raw[j:], string(space))
+		m.Params = splitParams(m.Params, raw[j:])
 
 		// We're done here!
-		return m
+		return true
 	}
 
 	// Compensate for index on substring
@@ -222,7 +415,7 @@ func ParseMessage(raw string) (m *Message) {
 
 	// Check if we need to parse arguments.
 	if i > j {
-		m.Params = strings.Split(raw[j:i-1], string(space))
+		m.Params = splitParams(m.Params, raw[j:i-1])
 	}
 
 	m.Trailing = raw[i+1:]
@@ -232,73 +425,427 @@ func ParseMessage(raw string) (m *Message) {
 		m.EmptyTrailing = true
 	}
 
-	return m
+	return true
 
 }
 
+// splitParams appends the space separated parameters in raw to params. Like
+// strings.Split, consecutive spaces result in empty parameters.
+func splitParams(params []string, raw string) []string {
+	for {
+		i := indexByte(raw, space)
+		if i < 0 {
+			return append(params, raw)
+		}
+		params = append(params, raw[:i])
+		raw = raw[i+1:]
+	}
+}
+
 // Len calculates the length of the string representation of this message.
 func (m *Message) Len() (length int) {
 
-	if m.Prefix != nil {
-		length = m.Prefix.Len() + 2 // Include prefix and trailing space
+	if len(m.Tags) > 0 {
+		length = len(m.Tags) + 1 // Include prefix, separators and trailing space
+		for key, value := range m.Tags {
+			length = length + len(key)
+			if len(value) > 0 {
+				length = length + len(tagEscaper.Replace(value)) + 1
+			}
+		}
+	}
+
+	if m.Prefix != nil && len(m.Prefix.Name) > 0 {
+		length = length + m.Prefix.Len() + 2 // Include prefix and trailing space
 	}
 
 	length = length + len(m.Command)
 
+	trailing := len(m.Trailing) > 0 || m.EmptyTrailing
+
 	if len(m.Params) > 0 {
 		length = length + len(m.Params)
 		for _, param := range m.Params {
 			length = length + len(param)
 		}
+		if !trailing && needsColon(m.Params[len(m.Params)-1]) {
+			length++
+		}
 	}
 
-	if len(m.Trailing) > 0 || m.EmptyTrailing {
+	if trailing {
 		length = length + len(m.Trailing) + 2 // Include prefix and space
 	}
 
 	return
 }
 
+// Copy returns a deep copy of this message, so it can safely be modified or
+// retained while the original is used elsewhere, for example when a single
+// decoded message is passed to several goroutines.
+func (m *Message) Copy() *Message {
+	c := new(Message)
+	*c = *m
+
+	if m.Tags != nil {
+		c.Tags = make(map[string]string, len(m.Tags))
+		for key, value := range m.Tags {
+			c.Tags[key] = value
+		}
+	}
+
+	if m.Prefix != nil {
+		c.Prefix = new(Prefix)
+		*c.Prefix = *m.Prefix
+	}
+
+	if m.Params != nil {
+		c.Params = make([]string, len(m.Params))
+		copy(c.Params, m.Params)
+	}
+
+	return c
+}
+
+// Equal returns true if m and other encode the same message. Commands are
+// compared case-insensitively, nil and empty tags, prefixes and parameters
+// are equal, and it does not matter whether the last parameter is stored in
+// Params or Trailing. The raw line is ignored.
+func (m *Message) Equal(other *Message) bool {
+	if m == nil || other == nil {
+		return m == other
+	}
+
+	if !strings.EqualFold(m.Command, other.Command) {
+		return false
+	}
+
+	var p, q Prefix
+	if m.Prefix != nil {
+		p = *m.Prefix
+	}
+	if other.Prefix != nil {
+		q = *other.Prefix
+	}
+	if p != q {
+		return false
+	}
+
+	if len(m.Tags) != len(other.Tags) {
+		return false
+	}
+	for key, value := range m.Tags {
+		if v, ok := other.Tags[key]; !ok || v != value {
+			return false
+		}
+	}
+
+	a, b := m.allParams(), other.allParams()
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// allParams returns the parameters of m, including the trailing parameter
+// if there is one.
+func (m *Message) allParams() []string {
+	if len(m.Trailing) > 0 || m.EmptyTrailing {
+		return append(m.Params[:len(m.Params):len(m.Params)], m.Trailing)
+	}
+	return m.Params
+}
+
+// Time returns the time the server received this message, as sent in the
+// time tag by servers supporting the IRCv3 server-time capability:
+//
+//    @time=2011-10-19T16:40:51.620Z :nick!user@host PRIVMSG #channel :Hello
+//
+// Returns false if the tag is missing or malformed.
+func (m *Message) Time() (time.Time, bool) {
+	value, ok := m.Tags["time"]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	// Fractional seconds are optional when parsing RFC3339.
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
+
+// MsgID returns the unique ID the server assigned to this message, as sent in
+// the msgid tag by servers supporting IRCv3 message IDs:
+//
+//    @msgid=63E1033A051D4B41B1AB1FA3CF4B243E :nick!user@host PRIVMSG #channel :Hello
+//
+// Returns false if the tag is missing or empty.
+func (m *Message) MsgID() (string, bool) {
+	id := m.Tags["msgid"]
+	return id, len(id) > 0
+}
+
+// param returns the i-th parameter, or an empty string if there is none.
+func (m *Message) param(i int) string {
+	if i < len(m.Params) {
+		return m.Params[i]
+	}
+	return ""
+}
+
+// FromServer returns true if this message was sent by a server instead of a
+// user. Messages without a prefix originate from the server we're connected to.
+func (m *Message) FromServer() bool {
+	return m.Prefix == nil || m.Prefix.IsServer()
+}
+
+// IsChannel returns true if the first parameter is a channel, like the target
+// of a PRIVMSG sent to a channel. The channel prefixes are usually obtained
+// using ISupport.ChanTypes.
+func (m *Message) IsChannel(chanTypes string) bool {
+	target := m.param(0)
+	return len(target) > 0 && indexByte(chanTypes, target[0]) >= 0
+}
+
+// ReplyTarget returns where a reply to this message should be sent: the
+// channel for messages sent to a channel, or the sender's nick for messages
+// sent directly to myNick. Nicks are compared using mapping, like in IsEcho.
+func (m *Message) ReplyTarget(myNick string, mapping CaseMapping) string {
+	target := m.param(0)
+	if mapping.Equal(target, myNick) && m.Prefix != nil {
+		return m.Prefix.Name
+	}
+	return target
+}
+
+// IsEcho returns true if this message was sent by myNick, like messages echoed
+// by servers supporting the IRCv3 echo-message capability. Nicks are compared
+// using mapping, usually obtained using ISupport.CaseMapping. Messages without
+// prefix are never echoes.
+func (m *Message) IsEcho(myNick string, mapping CaseMapping) bool {
+	if m.Prefix == nil || len(myNick) == 0 {
+		return false
+	}
+	return mapping.Equal(m.Prefix.Name, myNick)
+}
+
+// MakeReply returns a PRIVMSG with the given text, sent to the ReplyTarget of
+// this message. The label tag is copied, so the reply can be matched to this
+// message when using labeled-response.
+//
+// Returns nil if this message is not a PRIVMSG sent by a user, or was sent by
+// myNick, to avoid replying to ourselves. Never reply to a NOTICE
+// automatically, as noted in RFC2812 section 3.3.2. Nicks are compared using
+// mapping, usually obtained using ISupport.CaseMapping.
+func (m *Message) MakeReply(myNick, text string, mapping CaseMapping) *Message {
+	if m.Command != PRIVMSG || m.Prefix == nil || len(m.Prefix.Name) == 0 {
+		return nil
+	}
+	if m.IsEcho(myNick, mapping) {
+		return nil
+	}
+
+	target := m.ReplyTarget(myNick, mapping)
+	if len(target) == 0 {
+		return nil
+	}
+
+	reply := &Message{
+		Command:  PRIVMSG,
+		Params:   []string{target},
+		Trailing: text,
+	}
+	if label, ok := m.Tags["label"]; ok {
+		reply.Tags = map[string]string{"label": label}
+	}
+	return reply
+}
+
+// MakeThreadedReply is like MakeReply, but marks the reply as a response to
+// this message using the +draft/reply client tag, so clients can display it
+// as part of a thread:
+//
+//    @+draft/reply=63E1033A051D4B41B1AB1FA3CF4B243E PRIVMSG #channel :Hi!
+//
+// The tag is omitted if this message has no msgid. Servers only relay client
+// tags if they support the message-tags capability.
+func (m *Message) MakeThreadedReply(myNick, text string, mapping CaseMapping) *Message {
+	reply := m.MakeReply(myNick, text, mapping)
+	if reply == nil {
+		return nil
+	}
+
+	if id, ok := m.MsgID(); ok {
+		if reply.Tags == nil {
+			reply.Tags = make(map[string]string, 1)
+		}
+		reply.Tags["+draft/reply"] = id
+	}
+	return reply
+}
+
+// Is returns true if the command of this message is command, compared
+// case-insensitively. Commands are uppercased by ParseMessage already, so
+// this is only needed for messages created otherwise.
+func (m *Message) Is(command string) bool {
+	return strings.EqualFold(m.Command, command)
+}
+
+// IsNumeric returns true if the command is a three digit numeric reply.
+func (m *Message) IsNumeric() bool {
+	return len(m.Command) == 3 && isDigit(m.Command[0]) && isDigit(m.Command[1]) && isDigit(m.Command[2])
+}
+
+// Numeric returns the numeric reply code, or false if the command is not a
+// numeric reply.
+func (m *Message) Numeric() (int, bool) {
+	if !m.IsNumeric() {
+		return 0, false
+	}
+	n, _ := strconv.Atoi(m.Command)
+	return n, true
+}
+
 // Bytes returns a []byte representation of this message.
 //
+// The trailing parameter is always sent with a leading colon. Without one, the
+// last of Params gets a colon if it contains a space, is empty or starts with
+// a colon, so it is parsed as a single parameter. Earlier parameters are never
+// prefixed.
+//
 // As noted in rfc2812 section 2.3, messages should not exceed 512 characters
 // in length. This method forces that limit by discarding any characters
-// exceeding the length limit.
+// exceeding the length limit, without splitting UTF-8 encoded characters.
+// Message tags do not count towards this limit.
+//
+// Tags are sorted by key, with client-only tags (starting with "+") after the
+// others, so equal messages always have the same encoding.
 func (m *Message) Bytes() []byte {
+	return m.AppendBytes(nil)
+}
+
+// AppendBytes appends the representation returned by Bytes to dst, and returns
+// the extended buffer. Reusing a buffer avoids allocating a new one for every
+// message:
+//
+//    buf = m.AppendBytes(buf[:0])
+func (m *Message) AppendBytes(dst []byte) []byte {
+	buffer, start := m.appendTo(dst)
 
-	buffer := new(bytes.Buffer)
+	// We need the limit the buffer length.
+	return truncateUTF8(buffer, start+maxLength)
+}
+
+// appendTo is an utility function to append the message to the buffer in
+// Message.AppendBytes() without enforcing the length limit.
+//
+// Returns the position after the tags, where the length limit starts.
+func (m *Message) appendTo(buffer []byte) (_ []byte, start int) {
+
+	// Message tags
+	if len(m.Tags) > 0 {
+		buffer = append(buffer, tagPrefix)
+		buffer = m.appendTags(buffer)
+		buffer = append(buffer, space)
+	}
+
+	// The length limit does not include the tags.
+	start = len(buffer)
 
 	// Message prefix
-	if m.Prefix != nil {
-		buffer.WriteByte(prefix)
-		m.Prefix.writeTo(buffer)
-		buffer.WriteByte(space)
+	if m.Prefix != nil && len(m.Prefix.Name) > 0 {
+		buffer = append(buffer, prefix)
+		buffer = m.Prefix.appendTo(buffer)
+		buffer = append(buffer, space)
 	}
 
 	// Command is required
-	buffer.WriteString(m.Command)
+	buffer = append(buffer, m.Command...)
 
-	// Space separated list of arguments
-	if len(m.Params) > 0 {
-		buffer.WriteByte(space)
-		buffer.WriteString(strings.Join(m.Params, string(space)))
+	trailing := len(m.Trailing) > 0 || m.EmptyTrailing
+
+	// Space separated list of arguments. The last one needs a colon if it
+	// can't be sent as a middle parameter, earlier ones are sent as is.
+	for i, param := range m.Params {
+		buffer = append(buffer, space)
+		if i == len(m.Params)-1 && !trailing && needsColon(param) {
+			buffer = append(buffer, prefix)
+		}
+		buffer = append(buffer, param...)
 	}
 
-	if len(m.Trailing) > 0 || m.EmptyTrailing {
-		buffer.WriteByte(space)
-		buffer.WriteByte(prefix)
-		buffer.WriteString(m.Trailing)
+	if trailing {
+		buffer = append(buffer, space, prefix)
+		buffer = append(buffer, m.Trailing...)
 	}
 
-	// We need the limit the buffer length.
-	if buffer.Len() > (maxLength) {
-		buffer.Truncate(maxLength)
+	return buffer, start
+}
+
+// truncateUTF8 shortens b to at most n bytes, without splitting a UTF-8
+// encoded character.
+func truncateUTF8(b []byte, n int) []byte {
+	if len(b) <= n {
+		return b
+	}
+	for n > 0 && !utf8.RuneStart(b[n]) {
+		n--
 	}
+	return b[:n]
+}
 
-	return buffer.Bytes()
+// needsColon returns true if param can only be sent as trailing parameter.
+func needsColon(param string) bool {
+	return len(param) <= 0 || param[0] == prefix || indexByte(param, space) >= 0
 }
 
-// String returns a string representation of this message.
+// appendTags is an utility function to append the escaped tags to the buffer in Message.AppendBytes().
+func (m *Message) appendTags(buffer []byte) []byte {
+	keys := make([]string, 0, len(m.Tags))
+	for key := range m.Tags {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if a, b := isClientTag(keys[i]), isClientTag(keys[j]); a != b {
+			return b
+		}
+		return keys[i] < keys[j]
+	})
+
+	for i, key := range keys {
+		if i > 0 {
+			buffer = append(buffer, tagSep)
+		}
+
+		value := m.Tags[key]
+		buffer = append(buffer, key...)
+		if len(value) > 0 {
+			buffer = append(buffer, tagValue)
+			buffer = append(buffer, tagEscaper.Replace(value)...)
+		}
+	}
+	return buffer
+}
+
+// isClientTag returns true for client-only tags, which start with "+".
+func isClientTag(key string) bool {
+	return len(key) > 0 && key[0] == '+'
+}
+
+// String returns a string representation of this message, without the CR+LF
+// line ending. It implements fmt.Stringer.
+//
+// Parsing the result using ParseMessage returns an equivalent message, as long
+// as it does not exceed the length limit.
 //
 // As noted in rfc2812 section 2.3, messages should not exceed 512 characters
 // in length. This method forces that limit by discarding any characters
@@ -7,7 +7,9 @@ package irc
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func ExampleParseMessage() {
@@ -302,6 +304,51 @@ var messageTests = [...]*struct {
 		rawMessage: "PASS oauth:token_goes_here",
 		rawPrefix:  "",
 	},
+	{
+		parsed: &Message{
+			Tags: map[string]string{
+				"time": "2011-10-19T16:40:51.620Z",
+			},
+			Prefix: &Prefix{
+				Name: "Angel",
+				User: "angel",
+				Host: "example.org",
+			},
+			Command:  "PRIVMSG",
+			Params:   []string{"Wiz"},
+			Trailing: "Hello",
+		},
+		rawMessage: "@time=2011-10-19T16:40:51.620Z :Angel!angel@example.org PRIVMSG Wiz :Hello",
+		rawPrefix:  "Angel!angel@example.org",
+		hostmask:   true,
+	},
+	{
+		parsed: &Message{
+			Tags: map[string]string{
+				"+example.com/foo": "a b;c\\d\r\n",
+			},
+			Command:  "PRIVMSG",
+			Params:   []string{"#chan"},
+			Trailing: "Escaped tag value",
+		},
+		rawMessage: "@+example.com/foo=a\\sb\\:c\\\\d\\r\\n PRIVMSG #chan :Escaped tag value",
+	},
+	{
+		parsed: &Message{
+			Tags: map[string]string{
+				"draft/typing": "",
+			},
+			Command: "TAGMSG",
+			Params:  []string{"#chan"},
+		},
+		rawMessage: "@draft/typing TAGMSG #chan",
+	},
+	{
+		rawMessage: "@ PRIVMSG #chan :Invalid message with empty tags.",
+	},
+	{
+		rawMessage: "@tag=value",
+	},
 }
 
 // -----
@@ -405,6 +452,33 @@ func TestParsePrefix(t *testing.T) {
 	}
 }
 
+func TestParsePrefix_forms(t *testing.T) {
+	tests := []struct {
+		raw    string
+		parsed Prefix
+	}{
+		{"irc.example.org", Prefix{Name: "irc.example.org"}},
+		{"nick", Prefix{Name: "nick"}},
+		{"nick!user", Prefix{Name: "nick", User: "user"}},
+		{"nick@host", Prefix{Name: "nick", Host: "host"}},
+		{"nick!~user@host.example.org", Prefix{Name: "nick", User: "~user", Host: "host.example.org"}},
+	}
+
+	for i, test := range tests {
+		p := ParsePrefix(test.raw)
+
+		if *p != test.parsed {
+			t.Errorf("Failed to parse prefix form %d:", i)
+			t.Logf("Output: %#v", p)
+			t.Logf("Expected: %#v", test.parsed)
+		}
+
+		if p.String() != test.raw {
+			t.Errorf("Prefix form %d failed parse-string sequence: %s", i, p.String())
+		}
+	}
+}
+
 // -----
 // MESSAGE
 // -----
@@ -469,10 +543,498 @@ func TestParseMessage(t *testing.T) {
 	}
 }
 
+func TestParseMessage_tags(t *testing.T) {
+	tests := []struct {
+		raw  string
+		tags map[string]string
+	}{
+		{"@a=b;c=d;e PING", map[string]string{"a": "b", "c": "d", "e": ""}},
+		{"@a=;b PING", map[string]string{"a": "", "b": ""}},
+		{"@a=1;a=2 PING", map[string]string{"a": "2"}},
+		{"@a=b;;c=d PING", map[string]string{"a": "b", "c": "d"}},
+		{"@a=trailing\\ PING", map[string]string{"a": "trailing"}},
+		{"@a=\\x\\y PING", map[string]string{"a": "xy"}},
+		{"@a=b=c PING", map[string]string{"a": "b=c"}},
+	}
+
+	for i, test := range tests {
+		m := ParseMessage(test.raw)
+
+		if m == nil || !reflect.DeepEqual(m.Tags, test.tags) {
+			t.Errorf("Failed to parse tags %d:", i)
+			t.Logf("Output: %#v", m)
+			t.Logf("Expected: %#v", test.tags)
+			continue
+		}
+
+		// Tag order is not preserved, so compare the parsed results.
+		if p := ParseMessage(m.String()); !reflect.DeepEqual(p, m) {
+			t.Errorf("Tags %d failed decode-encode sequence!", i)
+			t.Logf("Output: %s", m.String())
+		}
+
+		if m.Len() != len(m.String()) {
+			t.Errorf("Failed to calculate message length with tags %d:", i)
+		}
+	}
+}
+
+func TestMessage_Bytes_tagOrder(t *testing.T) {
+	m := &Message{
+		Tags: map[string]string{
+			"+example.com/typing": "active",
+			"time":                "2011-10-19T16:40:51.620Z",
+			"+draft/reply":        "abc",
+			"account":             "sorcix",
+			"msgid":               "63E1033A051D4B41B1AB1FA3CF4B243E",
+			"batch":               "",
+		},
+		Command:  PRIVMSG,
+		Params:   []string{"#test"},
+		Trailing: "hello",
+	}
+
+	expected := "@account=sorcix;batch;msgid=63E1033A051D4B41B1AB1FA3CF4B243E;time=2011-10-19T16:40:51.620Z;+draft/reply=abc;+example.com/typing=active PRIVMSG #test :hello"
+
+	for i := 0; i < 10; i++ {
+		if s := m.String(); s != expected {
+			t.Fatalf("Tags are not sorted: %s", s)
+		}
+	}
+}
+
+func TestMessage_Bytes_truncate(t *testing.T) {
+	m := &Message{Command: PRIVMSG, Params: []string{"#test"}, Trailing: strings.Repeat("a", 493) + "ééé"}
+
+	if s := m.String(); s != "PRIVMSG #test :"+strings.Repeat("a", 493)+"é" {
+		t.Errorf("Message was not truncated on a character boundary: %q", s)
+	}
+}
+
+func TestMessage_Copy(t *testing.T) {
+	for i, test := range messageTests {
+
+		// Skip tests that have no valid struct
+		if test.parsed == nil {
+			continue
+		}
+
+		c := test.parsed.Copy()
+
+		if !reflect.DeepEqual(c, test.parsed) || c.String() != test.parsed.String() {
+			t.Errorf("Copy of message %d is not equal to the original!", i)
+		}
+
+		if c.Prefix != nil && c.Prefix == test.parsed.Prefix {
+			t.Errorf("Copy of message %d shares the prefix!", i)
+		}
+		if len(c.Params) > 0 && &c.Params[0] == &test.parsed.Params[0] {
+			t.Errorf("Copy of message %d shares the parameters!", i)
+		}
+	}
+
+	m := ParseMessage("@a=b :nick!user@host PRIVMSG #test :hi")
+	c := m.Copy()
+	c.Tags["a"] = "c"
+	c.Name = "other"
+	c.Params[0] = "#other"
+
+	if m.Tags["a"] != "b" || m.Name != "nick" || m.Params[0] != "#test" {
+		t.Errorf("Modifying the copy changed the original: %s", m)
+	}
+}
+
+func TestMessage_Numeric(t *testing.T) {
+	tests := []struct {
+		command string
+		numeric int
+		ok      bool
+	}{
+		{RPL_WELCOME, 1, true},
+		{ERR_NICKNAMEINUSE, 433, true},
+		{PRIVMSG, 0, false},
+		{"12", 0, false},
+		{"1234", 0, false},
+		{"12A", 0, false},
+	}
+
+	for _, test := range tests {
+		m := &Message{Command: test.command}
+
+		if m.IsNumeric() != test.ok {
+			t.Errorf("IsNumeric(%q) should be %v", test.command, test.ok)
+		}
+		if n, ok := m.Numeric(); n != test.numeric || ok != test.ok {
+			t.Errorf("Wrong numeric for %q: %d, %v", test.command, n, ok)
+		}
+	}
+}
+
+func TestCommandName(t *testing.T) {
+	tests := map[string]string{
+		"001":   "RPL_WELCOME",
+		"005":   "RPL_ISUPPORT",
+		"376":   "RPL_ENDOFMOTD",
+		"433":   "ERR_NICKNAMEINUSE",
+		"903":   "RPL_SASLSUCCESS",
+		"999":   "999",
+		PRIVMSG: PRIVMSG,
+	}
+
+	for command, name := range tests {
+		if CommandName(command) != name {
+			t.Errorf("Wrong name for %q: %s", command, CommandName(command))
+		}
+	}
+}
+
+func TestMessage_Time(t *testing.T) {
+	tests := [...]struct {
+		line string
+		time time.Time
+		ok   bool
+	}{
+		{"@time=2011-10-19T16:40:51.620Z PRIVMSG #channel :Hello", time.Date(2011, 10, 19, 16, 40, 51, 620000000, time.UTC), true},
+		{"@time=2011-10-19T16:40:51Z PRIVMSG #channel :Hello", time.Date(2011, 10, 19, 16, 40, 51, 0, time.UTC), true},
+		{"@time=2011-10-19T18:40:51+02:00 PRIVMSG #channel :Hello", time.Date(2011, 10, 19, 16, 40, 51, 0, time.UTC), true},
+		{"@time=yesterday PRIVMSG #channel :Hello", time.Time{}, false},
+		{"@msgid=abc PRIVMSG #channel :Hello", time.Time{}, false},
+		{"PRIVMSG #channel :Hello", time.Time{}, false},
+	}
+
+	for i, test := range tests {
+		tm, ok := ParseMessage(test.line).Time()
+		if ok != test.ok || !tm.Equal(test.time) {
+			t.Errorf("Wrong time %d: %v, %v", i, tm, ok)
+		}
+	}
+}
+
+func TestMessage_Bytes_lastParam(t *testing.T) {
+	tests := [...]struct {
+		m   *Message
+		raw string
+	}{
+		{&Message{Command: PRIVMSG, Params: []string{"#chan", ":weird"}}, "PRIVMSG #chan ::weird"},
+		{&Message{Command: PRIVMSG, Params: []string{"#chan", "two words"}}, "PRIVMSG #chan :two words"},
+		{&Message{Command: TOPIC, Params: []string{"#chan", ""}}, "TOPIC #chan :"},
+		{&Message{Command: TOPIC, Params: []string{"#chan"}, EmptyTrailing: true}, "TOPIC #chan :"},
+		{&Message{Command: MODE, Params: []string{"#chan", "+o", "nick"}}, "MODE #chan +o nick"},
+		{&Message{Command: PRIVMSG, Params: []string{":a", "#chan"}, Trailing: ":b"}, "PRIVMSG :a #chan ::b"},
+	}
+
+	for i, test := range tests {
+		if test.m.String() != test.raw {
+			t.Errorf("Failed to encode message %d:", i)
+			t.Logf("Output: %s", test.m.String())
+		}
+		if test.m.Len() != len(test.raw) {
+			t.Errorf("Wrong length %d: %d", i, test.m.Len())
+		}
+
+		// The parameters should survive parsing, except for the middle
+		// parameter starting with a colon.
+		if i == len(tests)-1 {
+			continue
+		}
+		p := ParseMessage(test.m.String())
+		if !reflect.DeepEqual(p.allParams(), test.m.allParams()) {
+			t.Errorf("Failed to round-trip message %d: %q", i, p.allParams())
+		}
+	}
+}
+
+func TestNewMessageWithPrefix(t *testing.T) {
+	tests := [...]struct {
+		prefix *Prefix
+		raw    string
+	}{
+		{&Prefix{Name: "nick"}, ":nick PRIVMSG #chan :Hello there"},
+		{&Prefix{Name: "nick", User: "user", Host: "host"}, ":nick!user@host PRIVMSG #chan :Hello there"},
+		{&Prefix{Name: "irc.example.org"}, ":irc.example.org PRIVMSG #chan :Hello there"},
+		{&Prefix{Name: ":nick", Host: "host"}, ":nick@host PRIVMSG #chan :Hello there"},
+		{&Prefix{}, "PRIVMSG #chan :Hello there"},
+		{nil, "PRIVMSG #chan :Hello there"},
+	}
+
+	for i, test := range tests {
+		m := NewMessageWithPrefix(test.prefix, PRIVMSG, "#chan", "Hello there")
+		if m.String() != test.raw {
+			t.Errorf("Failed to encode message %d:", i)
+			t.Logf("Output: %s", m.String())
+			t.Logf("Expected: %s", test.raw)
+		}
+		if m.Len() != len(test.raw) {
+			t.Errorf("Wrong length %d: %d", i, m.Len())
+		}
+
+		p := ParseMessage(m.String())
+		if m.Prefix != nil && len(m.Name) > 0 && !reflect.DeepEqual(p.Prefix, m.Prefix) {
+			t.Errorf("Failed to round-trip prefix %d: %+v", i, p.Prefix)
+		}
+	}
+
+	// The prefix is copied.
+	source := &Prefix{Name: "nick"}
+	m := NewMessageWithPrefix(source, PING)
+	source.Name = "other"
+	if m.Name != "nick" {
+		t.Errorf("Prefix should be copied: %s", m.Name)
+	}
+}
+
+func TestMessage_Equal(t *testing.T) {
+	tests := [...]struct {
+		a, b  *Message
+		equal bool
+	}{
+		{
+			&Message{Command: PING},
+			&Message{Command: "ping", Prefix: &Prefix{}, Params: []string{}, Tags: map[string]string{}},
+			true,
+		},
+		{
+			ParseMessage("@a=b;c :nick!user@host PRIVMSG #test :hello"),
+			&Message{Tags: map[string]string{"c": "", "a": "b"}, Prefix: &Prefix{"nick", "user", "host"}, Command: PRIVMSG, Params: []string{"#test", "hello"}},
+			true,
+		},
+		{
+			ParseMessage("NOTICE #test :"),
+			&Message{Command: NOTICE, Params: []string{"#test", ""}},
+			true,
+		},
+		{ParseMessage("NOTICE #test :"), ParseMessage("NOTICE #test"), false},
+		{ParseMessage("PRIVMSG #test :hello"), ParseMessage("NOTICE #test :hello"), false},
+		{ParseMessage(":nick PING"), ParseMessage(":other PING"), false},
+		{ParseMessage("@a=b PING"), ParseMessage("@a=c PING"), false},
+		{ParseMessage("@a=b PING"), ParseMessage("@b=b PING"), false},
+		{ParseMessage("@a PING"), ParseMessage("PING"), false},
+		{ParseMessage("PING a b"), ParseMessage("PING a :b c"), false},
+		{ParseMessage("PING"), nil, false},
+		{nil, nil, true},
+	}
+
+	for i, test := range tests {
+		if test.a.Equal(test.b) != test.equal || test.b.Equal(test.a) != test.equal {
+			t.Errorf("Wrong result for messages %d: %v and %v should be equal: %v", i, test.a, test.b, test.equal)
+		}
+	}
+}
+
+func TestMessage_source(t *testing.T) {
+	tests := [...]struct {
+		line       string
+		fromServer bool
+		isChannel  bool
+		reply      string
+	}{
+		{":irc.example.org NOTICE me :Hello", true, false, "irc.example.org"},
+		{"PING :irc.example.org", true, false, ""},
+		{":sorcix!sorcix@example.org PRIVMSG #test :Hello", false, true, "#test"},
+		{":sorcix!sorcix@example.org PRIVMSG &local :Hello", false, true, "&local"},
+		{":sorcix!sorcix@example.org PRIVMSG Me :Hello", false, false, "sorcix"},
+	}
+
+	for i, test := range tests {
+		m := ParseMessage(test.line)
+		if m.FromServer() != test.fromServer {
+			t.Errorf("Failed to detect server message %d:", i)
+		}
+		if m.IsChannel("#&") != test.isChannel {
+			t.Errorf("Failed to detect channel message %d:", i)
+		}
+		if reply := m.ReplyTarget("me", CaseMappingRFC1459); reply != test.reply {
+			t.Errorf("Wrong reply target %d: %q", i, reply)
+		}
+	}
+}
+
+func TestMessage_Is(t *testing.T) {
+	if m := ParseMessage("privmsg #channel :Hello"); m.Command != PRIVMSG || !m.Is(PRIVMSG) {
+		t.Errorf("Command should be uppercased: %q", m.Command)
+	}
+	if m := (&Message{Command: "Notice"}); !m.Is(NOTICE) || !m.Is("notice") || m.Is(PRIVMSG) {
+		t.Errorf("Commands should be compared case-insensitively.")
+	}
+}
+
+func TestMessage_IsEcho(t *testing.T) {
+	tests := [...]struct {
+		line string
+		echo bool
+	}{
+		{":me[]!user@host PRIVMSG #channel :Hello", true},
+		{":Me{}!user@host PRIVMSG #channel :Hello", true},
+		{":me!user@host PRIVMSG #channel :Hello", false},
+		{":nick!user@host PRIVMSG me{} :Hello", false},
+		{"PRIVMSG #channel :Hello", false},
+	}
+
+	for i, test := range tests {
+		if ParseMessage(test.line).IsEcho("me[]", CaseMappingRFC1459) != test.echo {
+			t.Errorf("Failed to detect echo %d, should be %v", i, test.echo)
+		}
+	}
+
+	if ParseMessage(":Me{}!user@host PRIVMSG #channel :Hello").IsEcho("me[]", CaseMappingASCII) {
+		t.Error("Nicks should be compared using the casemapping.")
+	}
+}
+
+func TestMessage_MakeReply(t *testing.T) {
+	tests := [...]struct {
+		line  string
+		reply string
+	}{
+		{":nick!user@host PRIVMSG #channel :Hello", "PRIVMSG #channel :pong"},
+		{":nick!user@host PRIVMSG Me :Hello", "PRIVMSG nick :pong"},
+		{"@label=abc;time=2011-10-19T16:40:51.620Z :nick PRIVMSG me :Hello", "@label=abc PRIVMSG nick :pong"},
+		{":me!user@host PRIVMSG #channel :Hello", ""},
+		{":nick!user@host NOTICE #channel :Hello", ""},
+		{"PRIVMSG #channel :Hello", ""},
+		{":nick!user@host PRIVMSG", ""},
+	}
+
+	for i, test := range tests {
+		reply := ParseMessage(test.line).MakeReply("me", "pong", CaseMappingRFC1459)
+		if len(test.reply) == 0 {
+			if reply != nil {
+				t.Errorf("Message %d should not get a reply: %s", i, reply)
+			}
+			continue
+		}
+		if reply == nil || reply.String() != test.reply {
+			t.Errorf("Wrong reply to message %d: %v", i, reply)
+		}
+	}
+
+	// The casemapping decides whether the message was sent to us.
+	m := ParseMessage(":nick!user@host PRIVMSG Me{} :Hello")
+	if reply := m.MakeReply("me[]", "pong", CaseMappingRFC1459); reply == nil || reply.Params[0] != "nick" {
+		t.Errorf("Wrong reply using rfc1459: %v", reply)
+	}
+	if reply := m.MakeReply("me[]", "pong", CaseMappingASCII); reply == nil || reply.Params[0] != "Me{}" {
+		t.Errorf("Wrong reply using ascii: %v", reply)
+	}
+}
+
+func TestMessage_AppendBytes(t *testing.T) {
+	m := ParseMessage("@a=b :nick!user@host PRIVMSG #channel :Hello")
+
+	buf := m.AppendBytes([]byte("> "))
+	if string(buf) != "> @a=b :nick!user@host PRIVMSG #channel :Hello" {
+		t.Errorf("Wrong result: %q", buf)
+	}
+
+	long := &Message{Tags: map[string]string{"a": "b"}, Command: PRIVMSG, Params: []string{"#channel"}, Trailing: strings.Repeat("x", 600)}
+	if buf = long.AppendBytes(buf[:2]); len(buf) != 2+len("@a=b ")+maxLength {
+		t.Errorf("Length limit not applied after dst: %d", len(buf))
+	}
+}
+
+func TestParseMessage_trailingSpaces(t *testing.T) {
+	for _, line := range []string{"PRIVMSG #c :hello   ", "PRIVMSG #c :hello   \r\n", "PRIVMSG #c :hello   \n"} {
+		if m := ParseMessage(line); m == nil || m.Trailing != "hello   " {
+			t.Errorf("Trailing spaces not preserved in %q: %v", line, m)
+		}
+	}
+
+	dec := NewDecoder(strings.NewReader("PRIVMSG #c :\x01ACTION waves \x01  \r\n"))
+	if m, err := dec.Decode(); err != nil || m.Trailing != "\x01ACTION waves \x01  " {
+		t.Errorf("Trailing spaces not preserved by the decoder: %v, %v", m, err)
+	}
+}
+
+func TestMessage_MsgID(t *testing.T) {
+	if id, ok := ParseMessage("@msgid=abc;time=2011-10-19T16:40:51.620Z PRIVMSG #channel :Hello").MsgID(); id != "abc" || !ok {
+		t.Errorf("Wrong msgid: %q, %v", id, ok)
+	}
+	for _, line := range []string{"@msgid= PRIVMSG #channel :Hello", "PRIVMSG #channel :Hello"} {
+		if id, ok := ParseMessage(line).MsgID(); id != "" || ok {
+			t.Errorf("Unexpected msgid in %q: %q, %v", line, id, ok)
+		}
+	}
+}
+
+func TestMessage_MakeThreadedReply(t *testing.T) {
+	tests := [...]struct {
+		line  string
+		reply string
+	}{
+		{"@msgid=abc :nick!user@host PRIVMSG #channel :Hello", "@+draft/reply=abc PRIVMSG #channel :pong"},
+		{"@label=x;msgid=abc :nick PRIVMSG me :Hello", "@label=x;+draft/reply=abc PRIVMSG nick :pong"},
+		{":nick!user@host PRIVMSG #channel :Hello", "PRIVMSG #channel :pong"},
+		{"@msgid=abc :me!user@host PRIVMSG #channel :Hello", ""},
+	}
+
+	for i, test := range tests {
+		reply := ParseMessage(test.line).MakeThreadedReply("me", "pong", CaseMappingRFC1459)
+		if len(test.reply) == 0 {
+			if reply != nil {
+				t.Errorf("Message %d should not get a reply: %s", i, reply)
+			}
+			continue
+		}
+		if reply == nil || reply.String() != test.reply {
+			t.Errorf("Wrong reply to message %d: %v", i, reply)
+		}
+	}
+}
+
 // -----
 // MESSAGE DECODE -> ENCODE
 // -----
 
+var roundTripTests = [...]string{
+	"PING :irc.example.org",
+	"PRIVMSG #channel word",
+	"PRIVMSG #channel :Hello world",
+	"PRIVMSG #channel ::-)",
+	"PRIVMSG #channel :: starts with a colon",
+	"PRIVMSG #channel :",
+	"PRIVMSG #channel :  leading and trailing spaces  ",
+	":nick!user@host PRIVMSG #channel :a:b :c",
+	":irc.example.org 005 nick CHANTYPES=# PREFIX=(ov)@+ :are supported by this server",
+	":irc.example.org 353 nick = #channel :@op +voice user",
+	"@time=2011-10-19T16:40:51.620Z :nick!user@host PRIVMSG #channel :Hello",
+	"@+example.com/foo=semi\\:colon\\sspace :nick PRIVMSG #channel :Hi",
+	":nick MODE nick :+i",
+	"CAP * LS * :multi-prefix sasl=PLAIN,EXTERNAL",
+}
+
+func TestMessage_String_roundTrip(t *testing.T) {
+	var _ fmt.Stringer = new(Message)
+
+	for i, line := range roundTripTests {
+		m := ParseMessage(line)
+		if m == nil {
+			t.Fatalf("Failed to parse message %d: %q", i, line)
+		}
+
+		s := m.String()
+		if strings.HasSuffix(s, "\r\n") {
+			t.Errorf("String should not include the line ending %d:", i)
+		}
+
+		if p := ParseMessage(s); !reflect.DeepEqual(p, m) {
+			t.Errorf("Failed to round-trip message %d:", i)
+			t.Logf("Output: %#v", p)
+			t.Logf("Expected: %#v", m)
+		}
+	}
+
+	// Messages from the test corpus as well.
+	for i, test := range messageTests {
+		if test.parsed == nil {
+			continue
+		}
+		if p := ParseMessage(test.parsed.String()); !reflect.DeepEqual(p, test.parsed) {
+			t.Errorf("Failed to round-trip message %d:", i)
+			t.Logf("Output: %#v", p)
+		}
+	}
+}
+
 func TestMessageDecodeEncode(t *testing.T) {
 	var (
 		p *Message
@@ -509,7 +1071,7 @@ func BenchmarkPrefix_String_short(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		prefix.String()
+		_ = prefix.String()
 	}
 }
 func BenchmarkPrefix_String_long(b *testing.B) {
@@ -522,7 +1084,7 @@ func BenchmarkPrefix_String_long(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		prefix.String()
+		_ = prefix.String()
 	}
 }
 func BenchmarkParsePrefix_short(b *testing.B) {
@@ -543,7 +1105,26 @@ func BenchmarkMessage_String(b *testing.B) {
 	b.ReportAllocs()
 
 	for i := 0; i < b.N; i++ {
-		messageTests[0].parsed.String()
+		_ = messageTests[0].parsed.String()
+	}
+}
+
+func BenchmarkMessage_Bytes(b *testing.B) {
+	m := ParseMessage("@time=2011-10-19T16:40:51.620Z :Namename!username@hostname PRIVMSG #channel :Message message message")
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_ = m.Bytes()
+	}
+}
+
+func BenchmarkMessage_AppendBytes(b *testing.B) {
+	m := ParseMessage("@time=2011-10-19T16:40:51.620Z :Namename!username@hostname PRIVMSG #channel :Message message message")
+	b.ReportAllocs()
+
+	var buf []byte
+	for i := 0; i < b.N; i++ {
+		buf = m.AppendBytes(buf[:0])
 	}
 }
 func BenchmarkParseMessage_short(b *testing.B) {
@@ -0,0 +1,69 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bytes"
+	"sync/atomic"
+)
+
+// A MetricsHook is notified of the messages and errors of a Conn, for example
+// to update Prometheus counters. See Conn.SetMetrics.
+//
+// The methods are called from the goroutines reading and writing, so they
+// must be safe to use from multiple goroutines, and should return quickly.
+type MetricsHook interface {
+	OnReceive(command string) // A message was decoded
+	OnSend(command string)    // A message was written to the stream
+	OnError(err error)        // Reading, writing or formatting failed
+}
+
+// metricsHook wraps a MetricsHook, so atomic.Value always stores the same
+// type.
+type metricsHook struct {
+	hook MetricsHook
+}
+
+// SetMetrics notifies hook of every message received using Decode and sent
+// using Encode or Write, with the command of the message, like PRIVMSG or
+// 001. Errors reading from or writing to the stream are reported, except
+// io.EOF, and so are messages that could not be encoded. A nil hook disables
+// this, which is the default.
+func (c *Conn) SetMetrics(hook MetricsHook) {
+	c.Decoder.metrics.Store(metricsHook{hook})
+	c.Encoder.metrics.Store(metricsHook{hook})
+}
+
+// loadMetrics returns the hook stored in v, or nil.
+func loadMetrics(v *atomic.Value) MetricsHook {
+	if m, ok := v.Load().(metricsHook); ok {
+		return m.hook
+	}
+	return nil
+}
+
+// failed reports err to the metrics hook, if any.
+func (enc *Encoder) failed(err error) {
+	if hook := loadMetrics(&enc.metrics); hook != nil {
+		hook.OnError(err)
+	}
+}
+
+// lineCommand returns the command of an encoded line, skipping its tags and
+// prefix.
+func lineCommand(line []byte) string {
+	for len(line) > 0 && (line[0] == tagPrefix || line[0] == prefix) {
+		i := bytes.IndexByte(line, space)
+		if i < 0 {
+			return ""
+		}
+		line = bytes.TrimLeft(line[i+1:], " ")
+	}
+
+	if i := bytes.IndexAny(line, " \r\n"); i >= 0 {
+		line = line[:i]
+	}
+	return string(line)
+}
@@ -0,0 +1,81 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordingMetrics struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recordingMetrics) record(event string) {
+	r.mu.Lock()
+	r.events = append(r.events, event)
+	r.mu.Unlock()
+}
+
+func (r *recordingMetrics) OnReceive(command string) { r.record("< " + command) }
+func (r *recordingMetrics) OnSend(command string)    { r.record("> " + command) }
+func (r *recordingMetrics) OnError(err error)        { r.record("! " + err.Error()) }
+
+func TestConn_SetMetrics(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(&readWriter{strings.NewReader("@time=x :irc.example.org 001 me :Welcome\r\nPING :x\r\n"), buffer})
+
+	metrics := new(recordingMetrics)
+	conn.SetMetrics(metrics)
+
+	conn.Decode()
+	conn.Encode(&Message{Prefix: &Prefix{Name: "me"}, Command: PRIVMSG, Params: []string{"#channel"}, Trailing: "Hi"})
+	conn.Encode(&Message{Command: PRIVMSG, Params: []string{"#channel"}, Trailing: "Line\nbreak"})
+	conn.Write([]byte("@label=1 PONG :x"))
+	conn.Decode()
+	conn.Decode()
+
+	expected := []string{
+		"< 001",
+		"> PRIVMSG",
+		"! " + ErrInvalidParam.Error(),
+		"> PONG",
+		"< PING",
+	}
+	if !reflect.DeepEqual(metrics.events, expected) {
+		t.Errorf("Wrong events: %q", metrics.events)
+	}
+
+	// Disabled hooks are not called.
+	conn.SetMetrics(nil)
+	conn.Encode(&Message{Command: PING, Trailing: "x"})
+	if len(metrics.events) != len(expected) {
+		t.Errorf("Hook called after disabling: %q", metrics.events)
+	}
+}
+
+func TestConn_SetMetrics_lineTooLong(t *testing.T) {
+	conn := NewConn(&readWriter{strings.NewReader("PING :" + strings.Repeat("x", 100) + "\r\nPING :x\r\n"), new(bufferConn)})
+	conn.Decoder.SetMaxLineLength(64, true)
+
+	metrics := new(recordingMetrics)
+	conn.SetMetrics(metrics)
+
+	if _, err := conn.Decode(); err != ErrLineTooLong {
+		t.Fatalf("Expected ErrLineTooLong, got: %v", err)
+	}
+	conn.Decode()
+
+	expected := []string{
+		"! " + ErrLineTooLong.Error(),
+		"< PING",
+	}
+	if !reflect.DeepEqual(metrics.events, expected) {
+		t.Errorf("Wrong events: %q", metrics.events)
+	}
+}
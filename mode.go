@@ -0,0 +1,60 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strings"
+)
+
+// A ModeDelta is a single mode that was set or unset by a MODE command.
+type ModeDelta struct {
+	Add  bool   // Mode was set (+) instead of unset (-)
+	Mode rune   // Mode letter
+	Arg  string // Parameter, if the mode takes one
+}
+
+// ParseModeChange splits a channel mode change into separate deltas, using
+// the channel modes advertised by the server to determine which modes take a
+// parameter from args.
+//
+//    +ovt-k nick1 nick2 oldkey
+//
+// Modes that are not advertised are assumed to take no parameter. Arg is empty
+// if the parameter is missing.
+func ParseModeChange(modes string, args []string, chanmodes ISupport) []ModeDelta {
+	typeA, typeB, typeC, _ := chanmodes.ChanModes()
+	prefixes, _ := chanmodes.Prefixes()
+
+	var deltas []ModeDelta
+	add := true
+
+	for _, mode := range modes {
+		switch mode {
+		case '+':
+			add = true
+			continue
+		case '-':
+			add = false
+			continue
+		}
+
+		delta := ModeDelta{Add: add, Mode: mode}
+
+		if takesArg(mode, add, typeA+typeB+prefixes, typeC) && len(args) > 0 {
+			delta.Arg = args[0]
+			args = args[1:]
+		}
+
+		deltas = append(deltas, delta)
+	}
+
+	return deltas
+}
+
+// takesArg returns true if the mode takes a parameter. Modes in always take
+// one, modes in whenSet only when being set.
+func takesArg(mode rune, add bool, always, whenSet string) bool {
+	return strings.ContainsRune(always, mode) || (add && strings.ContainsRune(whenSet, mode))
+}
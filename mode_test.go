@@ -0,0 +1,77 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"testing"
+)
+
+var modeTests = [...]*struct {
+	Modes  string
+	Args   []string
+	Deltas []ModeDelta
+}{
+	{
+		Modes: "+ovt-k",
+		Args:  []string{"nick1", "nick2", "oldkey"},
+		Deltas: []ModeDelta{
+			{Add: true, Mode: 'o', Arg: "nick1"},
+			{Add: true, Mode: 'v', Arg: "nick2"},
+			{Add: true, Mode: 't'},
+			{Add: false, Mode: 'k', Arg: "oldkey"},
+		},
+	},
+	{
+		Modes: "+l-l+b",
+		Args:  []string{"10", "*!*@example.org"},
+		Deltas: []ModeDelta{
+			{Add: true, Mode: 'l', Arg: "10"},
+			{Add: false, Mode: 'l'},
+			{Add: true, Mode: 'b', Arg: "*!*@example.org"},
+		},
+	},
+	{
+		Modes: "-qZ+k",
+		Args:  []string{"owner"},
+		Deltas: []ModeDelta{
+			{Add: false, Mode: 'q', Arg: "owner"},
+			{Add: false, Mode: 'Z'},
+			{Add: true, Mode: 'k'},
+		},
+	},
+	{
+		Modes:  "+",
+		Deltas: nil,
+	},
+}
+
+func TestParseModeChange(t *testing.T) {
+	var s ISupport
+	s.Update(ParseMessage(":irc.example.org 005 nick CHANMODES=beI,k,l,imnpstZ PREFIX=(qov)~@+ :are supported by this server"))
+
+	for i, test := range modeTests {
+		deltas := ParseModeChange(test.Modes, test.Args, s)
+		if !reflect.DeepEqual(deltas, test.Deltas) {
+			t.Errorf("Failed to parse mode change %d:", i)
+			t.Logf("Output: %+v", deltas)
+			t.Logf("Expected: %+v", test.Deltas)
+		}
+	}
+}
+
+func TestISupport_ChanModes(t *testing.T) {
+	var s ISupport
+
+	if a, b, c, d := s.ChanModes(); a != "beI" || b != "k" || c != "l" || d != "imnpst" {
+		t.Errorf("Wrong default channel modes: %q %q %q %q", a, b, c, d)
+	}
+
+	s.Update(ParseMessage(":irc.example.org 005 nick CHANMODES=b,k :are supported by this server"))
+
+	if a, b, c, d := s.ChanModes(); a != "b" || b != "k" || c != "" || d != "" {
+		t.Errorf("Wrong channel modes: %q %q %q %q", a, b, c, d)
+	}
+}
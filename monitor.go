@@ -0,0 +1,98 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strings"
+)
+
+// Maximum length of the nick list in a single MONITOR command.
+const monitorListLength = 400
+
+// Monitor asks the server to stop notifying us about the nicks in remove, and
+// to start notifying us when the nicks in add come online or go offline,
+// using RPL_MONONLINE and RPL_MONOFFLINE. See ParseMonitor.
+//
+//    MONITOR - nick1,nick2
+//    MONITOR + nick3,nick4
+//
+// Long lists are split over several commands. Servers limit the number of
+// monitored nicks as advertised by the MONITOR feature, and reply with
+// ERR_MONLISTFULL if the list is full.
+func (c *Conn) Monitor(add, remove []string) error {
+	for _, change := range []struct {
+		modifier string
+		nicks    []string
+	}{{"-", remove}, {"+", add}} {
+		for _, list := range chunkList(change.nicks, monitorListLength) {
+			if err := c.Encode(&Message{Command: MONITOR, Params: []string{change.modifier, list}}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// MonitorClear asks the server to stop notifying us about any nick.
+func (c *Conn) MonitorClear() error {
+	return c.Encode(&Message{Command: MONITOR, Params: []string{"C"}})
+}
+
+// MonitorList asks the server for the monitored nicks, which are sent using
+// RPL_MONLIST followed by RPL_ENDOFMONLIST.
+func (c *Conn) MonitorList() error {
+	return c.Encode(&Message{Command: MONITOR, Params: []string{"L"}})
+}
+
+// ParseMonitor returns the nicks in a RPL_MONONLINE, RPL_MONOFFLINE or
+// RPL_MONLIST message, and whether they are online:
+//
+//    :irc.example.org 730 me :nick1!user@host,nick2!user@host
+//    :irc.example.org 731 me :nick3,nick4
+//
+// Only the nicks are returned, without user and host. Online is false for
+// RPL_MONLIST, as it does not include the status. Returns false if m is
+// not one of these replies.
+func ParseMonitor(m *Message) (nicks []string, online bool, ok bool) {
+	switch m.Command {
+	case RPL_MONONLINE:
+		online = true
+	case RPL_MONOFFLINE, RPL_MONLIST:
+	default:
+		return nil, false, false
+	}
+
+	for _, target := range splitList(m.Trailing) {
+		nicks = append(nicks, ParsePrefix(target).Name)
+	}
+	return nicks, online, true
+}
+
+// chunkList joins values into comma-separated lists of at most n bytes, unless
+// a single value is longer. Empty values are skipped.
+func chunkList(values []string, n int) (lists []string) {
+	var list []string
+	length := 0
+
+	for _, value := range values {
+		if len(value) == 0 {
+			continue
+		}
+		if len(list) > 0 && length+1+len(value) > n {
+			lists = append(lists, strings.Join(list, ","))
+			list, length = nil, 0
+		}
+		if len(list) > 0 {
+			length++
+		}
+		list = append(list, value)
+		length += len(value)
+	}
+
+	if len(list) > 0 {
+		lists = append(lists, strings.Join(list, ","))
+	}
+	return lists
+}
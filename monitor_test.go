@@ -0,0 +1,78 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConn_Monitor(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(buffer)
+
+	conn.Monitor([]string{"alice", "", "bob"}, []string{"carol"})
+	conn.Monitor(nil, nil)
+	conn.MonitorList()
+	conn.MonitorClear()
+
+	expected := "MONITOR - carol\r\n" +
+		"MONITOR + alice,bob\r\n" +
+		"MONITOR L\r\n" +
+		"MONITOR C\r\n"
+
+	if buffer.String() != expected {
+		t.Errorf("Commands were not encoded correctly:\n%s", buffer.String())
+	}
+}
+
+func TestConn_Monitor_long(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(buffer)
+
+	nicks := make([]string, 100)
+	for i := range nicks {
+		nicks[i] = "nickname"
+	}
+	conn.Monitor(nicks, nil)
+
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\r\n"), "\r\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 commands, got %d", len(lines))
+	}
+
+	count := 0
+	for _, line := range lines {
+		if len(line) > MaxLineLength {
+			t.Errorf("Command too long: %d", len(line))
+		}
+		count += len(splitList(ParseMessage(line).param(1)))
+	}
+	if count != 100 {
+		t.Errorf("Expected 100 nicks, got %d", count)
+	}
+}
+
+func TestParseMonitor(t *testing.T) {
+	tests := []struct {
+		line   string
+		nicks  []string
+		online bool
+		ok     bool
+	}{
+		{":irc.example.org 730 me :alice!alice@example.org,bob!bob@example.org", []string{"alice", "bob"}, true, true},
+		{":irc.example.org 731 me :carol,dave", []string{"carol", "dave"}, false, true},
+		{":irc.example.org 732 me :alice,carol", []string{"alice", "carol"}, false, true},
+		{":irc.example.org 734 me 100 alice :Monitor list is full", nil, false, false},
+	}
+
+	for i, test := range tests {
+		nicks, online, ok := ParseMonitor(ParseMessage(test.line))
+		if !reflect.DeepEqual(nicks, test.nicks) || online != test.online || ok != test.ok {
+			t.Errorf("Failed to parse reply %d: %q, %v, %v", i, nicks, online, ok)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bytes"
+	"time"
+)
+
+// Batch type and message tag of the IRCv3 draft/multiline specification.
+const (
+	multilineBatch  = "draft/multiline"
+	multilineConcat = "draft/multiline-concat"
+)
+
+// JoinMultiline combines the messages in a draft/multiline batch into a single
+// message with the full text. Lines are separated by a line feed, unless a
+// message has the draft/multiline-concat tag, which continues the previous
+// line instead.
+//
+// The message is sent to the target of the batch, and has the tags of the
+// first message, with the earliest server-time. Returns false if b is not a
+// multiline batch, or contains no messages.
+func JoinMultiline(b *Batch) (*Message, bool) {
+	if b.Type != multilineBatch || len(b.Params) <= 0 || len(b.Messages) <= 0 {
+		return nil, false
+	}
+
+	m := b.Messages[0].Copy()
+	m.Params = []string{b.Params[0]}
+	m.Raw = ""
+
+	delete(m.Tags, "batch")
+	delete(m.Tags, multilineConcat)
+
+	var (
+		text     bytes.Buffer
+		earliest time.Time
+	)
+
+	for i, part := range b.Messages {
+		if _, concat := part.Tags[multilineConcat]; i > 0 && !concat {
+			text.WriteByte('\n')
+		}
+		// The text is the last parameter, sent with or without a colon.
+		if params := part.allParams(); len(params) > 1 {
+			text.WriteString(params[len(params)-1])
+		}
+
+		if t, ok := part.Time(); ok && (earliest.IsZero() || t.Before(earliest)) {
+			earliest = t
+		}
+	}
+
+	m.Trailing = text.String()
+	m.EmptyTrailing = len(m.Trailing) <= 0
+
+	if !earliest.IsZero() {
+		if m.Tags == nil {
+			m.Tags = map[string]string{}
+		}
+		m.Tags["time"] = earliest.UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+
+	return m, true
+}
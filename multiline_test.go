@@ -0,0 +1,72 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJoinMultiline(t *testing.T) {
+	stream := strings.Join([]string{
+		"@msgid=abc :nick!user@host BATCH +ml draft/multiline #channel",
+		"@batch=ml;time=2020-01-01T10:00:01.000Z :nick!user@host PRIVMSG #channel :Hello",
+		"@batch=ml;time=2020-01-01T10:00:00.500Z;draft/multiline-concat :nick!user@host PRIVMSG #channel : world",
+		"@batch=ml;time=2020-01-01T10:00:02.000Z :nick!user@host PRIVMSG #channel :Second line",
+		":nick!user@host BATCH -ml",
+		"",
+	}, "\r\n")
+
+	batch, err := NewBatchDecoder(NewDecoder(strings.NewReader(stream))).Decode()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	m, ok := JoinMultiline(batch)
+	if !ok {
+		t.Fatal("Failed to join multiline batch.")
+	}
+
+	if m.Command != PRIVMSG || m.Params[0] != "#channel" || m.Prefix.Name != "nick" {
+		t.Errorf("Wrong message: %s", m)
+	}
+	if m.Trailing != "Hello world\nSecond line" {
+		t.Errorf("Wrong text: %q", m.Trailing)
+	}
+	if tm, _ := m.Time(); !tm.Equal(time.Date(2020, 1, 1, 10, 0, 0, 500000000, time.UTC)) {
+		t.Errorf("Wrong time: %v", tm)
+	}
+	if _, ok := m.Tags["batch"]; ok {
+		t.Error("The batch tag should be removed.")
+	}
+
+	if _, ok := JoinMultiline(&Batch{Messages: batch.Messages[:1]}); ok {
+		t.Error("Only multiline batches should be joined.")
+	}
+}
+
+func TestJoinMultiline_noColon(t *testing.T) {
+	// A user-built batch, the first message has no tags.
+	batch := &Batch{
+		Type:   multilineBatch,
+		Params: []string{"#c"},
+		Messages: []*Message{
+			ParseMessage(":nick!user@host PRIVMSG #c hello"),
+			ParseMessage("@time=2020-01-01T10:00:00.000Z :nick!user@host PRIVMSG #c :world"),
+		},
+	}
+
+	m, ok := JoinMultiline(batch)
+	if !ok {
+		t.Fatal("Failed to join multiline batch.")
+	}
+	if m.Trailing != "hello\nworld" {
+		t.Errorf("Wrong text: %q", m.Trailing)
+	}
+	if tm, _ := m.Time(); !tm.Equal(time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Wrong time: %v", tm)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strings"
+	"sync"
+)
+
+// A Handler responds to an IRC message.
+type Handler interface {
+	ServeIRC(*Conn, *Message)
+}
+
+// The HandlerFunc type is an adapter to allow the use of ordinary functions
+// as IRC handlers.
+type HandlerFunc func(*Conn, *Message)
+
+// ServeIRC calls f(c, m).
+func (f HandlerFunc) ServeIRC(c *Conn, m *Message) {
+	f(c, m)
+}
+
+// Mux is an IRC message multiplexer. It dispatches each message to the
+// handler registered for its command, much like http.ServeMux.
+//
+// Commands are matched case-insensitively, both named commands like PRIVMSG
+// and numeric replies like RPL_WELCOME can be used.
+//
+// The zero value is an empty Mux ready to use.
+type Mux struct {
+	mu           sync.RWMutex
+	handlers     map[string]Handler
+	fallback     Handler
+	suppressEcho bool
+}
+
+// NewMux allocates and returns a new Mux.
+func NewMux() *Mux {
+	return new(Mux)
+}
+
+// Handle registers the handler for the given command, replacing any
+// previously registered handler.
+func (mux *Mux) Handle(command string, handler Handler) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	if mux.handlers == nil {
+		mux.handlers = make(map[string]Handler)
+	}
+	mux.handlers[strings.ToUpper(command)] = handler
+}
+
+// HandleFunc registers the handler function for the given command.
+func (mux *Mux) HandleFunc(command string, handler func(*Conn, *Message)) {
+	mux.Handle(command, HandlerFunc(handler))
+}
+
+// SetDefault registers the handler for commands without a handler.
+// Messages without a handler are ignored by default.
+func (mux *Mux) SetDefault(handler Handler) {
+	mux.mu.Lock()
+	mux.fallback = handler
+	mux.mu.Unlock()
+}
+
+// SetSuppressEcho controls whether PRIVMSG, NOTICE and TAGMSG messages sent
+// by ourselves are ignored, like the echoes sent by servers supporting the
+// echo-message capability, to avoid replying to them. See Conn.CurrentNick.
+// Echoes are dispatched by default.
+func (mux *Mux) SetSuppressEcho(suppress bool) {
+	mux.mu.Lock()
+	mux.suppressEcho = suppress
+	mux.mu.Unlock()
+}
+
+// ServeIRC dispatches m to the handler registered for its command.
+func (mux *Mux) ServeIRC(c *Conn, m *Message) {
+	mux.mu.RLock()
+	handler, ok := mux.handlers[strings.ToUpper(m.Command)]
+	if !ok {
+		handler = mux.fallback
+	}
+	suppressEcho := mux.suppressEcho
+	mux.mu.RUnlock()
+
+	if suppressEcho && c != nil && isText(m) && c.isEcho(m) {
+		return
+	}
+
+	if handler != nil {
+		handler.ServeIRC(c, m)
+	}
+}
+
+// Run reads messages from conn and dispatches them until reading fails,
+// returning the error.
+//
+// Handlers are called from the reading goroutine, so a slow handler delays
+// reading the next message.
+func (mux *Mux) Run(conn *Conn) error {
+	for {
+		m, err := conn.Decode()
+		if err != nil {
+			return err
+		}
+
+		if m != nil {
+			mux.ServeIRC(conn, m)
+		}
+	}
+}
+
+// isText returns true for messages that may be echoed using echo-message.
+func isText(m *Message) bool {
+	switch strings.ToUpper(m.Command) {
+	case PRIVMSG, NOTICE, TAGMSG:
+		return true
+	}
+	return false
+}
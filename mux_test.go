@@ -0,0 +1,124 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func ExampleMux() {
+	conn, err := Dial("irc.quakenet.org:6667")
+	if err != nil {
+		return
+	}
+
+	mux := NewMux()
+	mux.HandleFunc(PING, func(c *Conn, m *Message) {
+		c.Encode(&Message{Command: PONG, Params: m.Params, Trailing: m.Trailing})
+	})
+	mux.HandleFunc(RPL_WELCOME, func(c *Conn, m *Message) {
+		c.Join("#go-nuts")
+	})
+
+	mux.Run(conn)
+}
+
+func TestMux(t *testing.T) {
+	input := "PING :a\r\n:irc.example.org 001 nick :Welcome\r\nprivmsg #test :hi\r\nNOTICE nick :ignored\r\n"
+	conn := NewConn(&readWriter{strings.NewReader(input), new(bufferConn)})
+
+	var handled []string
+
+	mux := new(Mux)
+	mux.HandleFunc("ping", func(c *Conn, m *Message) {
+		handled = append(handled, "ping")
+	})
+	mux.HandleFunc(RPL_WELCOME, func(c *Conn, m *Message) {
+		handled = append(handled, "welcome")
+	})
+	mux.Handle(PRIVMSG, HandlerFunc(func(c *Conn, m *Message) {
+		if c != conn {
+			t.Error("Handler should receive the connection!")
+		}
+		handled = append(handled, "privmsg "+m.Trailing)
+	}))
+
+	if err := mux.Run(conn); err != io.EOF {
+		t.Fatalf("Run should return EOF, got: %v", err)
+	}
+
+	if strings.Join(handled, ",") != "ping,welcome,privmsg hi" {
+		t.Fatalf("Wrong handlers called: %v", handled)
+	}
+
+	// Unhandled messages go to the default handler.
+	handled = nil
+	mux.SetDefault(HandlerFunc(func(c *Conn, m *Message) {
+		handled = append(handled, "default "+m.Command)
+	}))
+	mux.ServeIRC(conn, &Message{Command: NOTICE})
+	mux.ServeIRC(conn, &Message{Command: "Ping"})
+
+	if strings.Join(handled, ",") != "default NOTICE,ping" {
+		t.Fatalf("Wrong handlers called: %v", handled)
+	}
+}
+
+func TestMux_SetSuppressEcho(t *testing.T) {
+	input := ":irc.example.org 001 Nick :Welcome\r\n" +
+		":nick!user@host PRIVMSG #test :echo\r\n" +
+		":other!user@host PRIVMSG #test :hi\r\n" +
+		":nick!user@host NICK :new[nick]\r\n" +
+		":NEW{NICK}!user@host NOTICE #test :echo\r\n" +
+		":nick!user@host PRIVMSG #test :old nick\r\n" +
+		":new[nick]!user@host JOIN #test\r\n"
+	conn := NewConn(&readWriter{strings.NewReader(input), new(bufferConn)})
+
+	var handled []string
+
+	mux := new(Mux)
+	mux.SetSuppressEcho(true)
+	mux.SetDefault(HandlerFunc(func(c *Conn, m *Message) {
+		handled = append(handled, m.Command+" "+m.Trailing)
+	}))
+
+	if err := mux.Run(conn); err != io.EOF {
+		t.Fatalf("Run should return EOF, got: %v", err)
+	}
+
+	if strings.Join(handled, ",") != "001 Welcome,PRIVMSG hi,NICK new[nick],PRIVMSG old nick,JOIN " {
+		t.Fatalf("Wrong handlers called: %q", handled)
+	}
+	if conn.CurrentNick() != "new[nick]" {
+		t.Errorf("Wrong nick: %q", conn.CurrentNick())
+	}
+}
+
+func TestMux_SetSuppressEcho_caseMapping(t *testing.T) {
+	input := ":irc.example.org 001 nick[] :Welcome\r\n" +
+		":irc.example.org 005 nick[] CASEMAPPING=ascii :are supported by this server\r\n" +
+		":NICK[]!user@host PRIVMSG #test :echo\r\n" +
+		":nick{}!user@host PRIVMSG #test :hi\r\n"
+	conn := NewConn(&readWriter{strings.NewReader(input), new(bufferConn)})
+
+	var handled []string
+
+	mux := new(Mux)
+	mux.SetSuppressEcho(true)
+	mux.Handle(PRIVMSG, HandlerFunc(func(c *Conn, m *Message) {
+		handled = append(handled, m.Trailing)
+	}))
+
+	if err := mux.Run(conn); err != io.EOF {
+		t.Fatalf("Run should return EOF, got: %v", err)
+	}
+
+	// Using ascii, nick{} is someone else.
+	if strings.Join(handled, ",") != "hi" {
+		t.Errorf("Wrong messages handled: %q", handled)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strings"
+)
+
+// Membership prefixes used by ParseNames if the server did not advertise any.
+const namesPrefixes = "~&@%+"
+
+// A NamedUser is a channel member listed in a RPL_NAMREPLY.
+type NamedUser struct {
+	Nick string
+
+	// Membership prefix symbols, like "@" for operators and "+" for voiced
+	// users, ordered from highest to lowest rank. Servers only send the
+	// highest one, unless the multi-prefix capability is enabled.
+	Prefixes string
+}
+
+// ParseNames returns the users listed in a RPL_NAMREPLY message:
+//
+//    :irc.example.org 353 nick = #channel :@+op +voice user
+//    :irc.example.org 353 nick = #channel user
+//
+// Leading characters in prefixSymbols are stored as Prefixes instead of being
+// part of the nick. The symbols are usually obtained using ISupport.Prefixes.
+// An empty prefixSymbols uses the most common ones, "~&@%+".
+//
+// Returns nil if m is not a RPL_NAMREPLY.
+func ParseNames(m *Message, prefixSymbols string) []NamedUser {
+	if m.Command != RPL_NAMREPLY {
+		return nil
+	}
+
+	if len(prefixSymbols) == 0 {
+		prefixSymbols = namesPrefixes
+	}
+
+	// The names are the last parameter, sent with or without a colon.
+	var names []string
+	if params := m.allParams(); len(params) > 2 {
+		names = strings.Fields(params[len(params)-1])
+	}
+	users := make([]NamedUser, 0, len(names))
+
+	for _, name := range names {
+		nick := strings.TrimLeft(name, prefixSymbols)
+		if len(nick) == 0 {
+			continue
+		}
+		users = append(users, NamedUser{
+			Nick:     nick,
+			Prefixes: rankPrefixes(name[:len(name)-len(nick)], prefixSymbols),
+		})
+	}
+
+	return users
+}
+
+// rankPrefixes returns the symbols in prefixes, ordered like in symbols.
+func rankPrefixes(prefixes, symbols string) string {
+	if len(prefixes) < 2 {
+		return prefixes
+	}
+
+	ranked := make([]byte, 0, len(prefixes))
+	for i := 0; i < len(symbols); i++ {
+		if indexByte(prefixes, symbols[i]) >= 0 {
+			ranked = append(ranked, symbols[i])
+		}
+	}
+	return string(ranked)
+}
+
+// setPrefix adds or removes symbol from prefixes, keeping the order of
+// symbols.
+func setPrefix(prefixes, symbols string, symbol byte, add bool) string {
+	if add {
+		return rankPrefixes(prefixes+string(symbol), symbols)
+	}
+	return strings.Replace(prefixes, string(symbol), "", -1)
+}
@@ -0,0 +1,55 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseNames(t *testing.T) {
+	m := ParseMessage(":irc.example.org 353 me = #go-nuts :+@sorcix @op +voice user ~&!weird *")
+
+	expected := []NamedUser{
+		{"sorcix", "@+"},
+		{"op", "@"},
+		{"voice", "+"},
+		{"user", ""},
+		{"!weird", "~&"},
+		{"*", ""},
+	}
+	if users := ParseNames(m, ""); !reflect.DeepEqual(users, expected) {
+		t.Errorf("Failed to parse names:")
+		t.Logf("Output: %#v", users)
+		t.Logf("Expected: %#v", expected)
+	}
+
+	// Only advertised symbols are prefixes.
+	expected = []NamedUser{
+		{"sorcix", "@+"},
+		{"op", "@"},
+		{"voice", "+"},
+		{"user", ""},
+		{"~&!weird", ""},
+		{"*", ""},
+	}
+	if users := ParseNames(m, "@+"); !reflect.DeepEqual(users, expected) {
+		t.Errorf("Failed to parse names:")
+		t.Logf("Output: %#v", users)
+		t.Logf("Expected: %#v", expected)
+	}
+
+	// A single name may be sent without a colon.
+	expected = []NamedUser{{"sorcix", "@"}}
+	if users := ParseNames(ParseMessage(":irc.example.org 353 me = #go-nuts @sorcix"), ""); !reflect.DeepEqual(users, expected) {
+		t.Errorf("Failed to parse names without colon:")
+		t.Logf("Output: %#v", users)
+		t.Logf("Expected: %#v", expected)
+	}
+
+	if users := ParseNames(ParseMessage("PRIVMSG #go-nuts :@op"), ""); users != nil {
+		t.Errorf("Only RPL_NAMREPLY should be parsed: %v", users)
+	}
+}
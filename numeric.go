@@ -0,0 +1,103 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strings"
+)
+
+// NewNumeric returns a numeric reply from the server named source to the
+// client target, as sent by servers and services:
+//
+//    :irc.example.org 001 nick :Welcome to the Internet Relay Network
+//
+// The last of params is sent as the trailing parameter, so it may contain
+// spaces. The source is omitted from the message if empty.
+func NewNumeric(source, code, target string, params ...string) *Message {
+	m := &Message{
+		Command: code,
+		Params:  append([]string{target}, params...),
+	}
+
+	if len(source) > 0 {
+		m.Prefix = &Prefix{Name: source}
+	}
+
+	if n := len(m.Params); n > 1 {
+		m.Trailing = m.Params[n-1]
+		m.EmptyTrailing = len(m.Trailing) <= 0
+		m.Params = m.Params[:n-1]
+	}
+
+	return m
+}
+
+// ValidateNumeric returns a *ParseError if m is not a valid numeric reply: the
+// command must be a three digit numeric, and the first parameter must be the
+// target of the reply.
+func ValidateNumeric(m *Message) error {
+
+	invalid := func(reason string) error {
+		return &ParseError{Line: m.String(), Reason: reason}
+	}
+
+	if !m.IsNumeric() {
+		return invalid("not a numeric reply")
+	}
+
+	if len(m.Params) <= 0 || len(m.Params[0]) <= 0 {
+		return invalid("numeric reply without target")
+	}
+
+	return nil
+}
+
+// NumericError is an error numeric reply from the server, like
+// ERR_NOSUCHNICK, returned by Message.AsError.
+type NumericError struct {
+	Code   string // Numeric reply, like ERR_NOSUCHNICK
+	Target string // Nick, channel or command the reply is about, if any
+	Text   string // Text sent by the server
+}
+
+func (e *NumericError) Error() string {
+	if len(e.Target) > 0 {
+		return "irc: " + e.Target + ": " + e.Text + " (" + CommandName(e.Code) + ")"
+	}
+	return "irc: " + e.Text + " (" + CommandName(e.Code) + ")"
+}
+
+// AsError returns a *NumericError if m is an error numeric reply, or nil
+// otherwise:
+//
+//    :irc.example.org 401 me nick :No such nick/channel
+//
+// Error replies are those numbered 400 to 599, and other numerics named ERR_
+// by CommandName, like ERR_SASLFAIL.
+func (m *Message) AsError() error {
+	if !isErrorNumeric(m) {
+		return nil
+	}
+
+	// The first parameter is our own nick, the last one the text.
+	params := m.allParams()
+	e := &NumericError{Code: m.Command}
+	if n := len(params); n > 0 {
+		e.Text = strings.TrimSpace(params[n-1])
+	}
+	if len(params) > 2 {
+		e.Target = params[1]
+	}
+	return e
+}
+
+// isErrorNumeric returns true if m is an error numeric reply.
+func isErrorNumeric(m *Message) bool {
+	n, ok := m.Numeric()
+	if !ok {
+		return false
+	}
+	return (n >= 400 && n < 600) || strings.HasPrefix(CommandName(m.Command), "ERR_")
+}
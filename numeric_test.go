@@ -0,0 +1,78 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"testing"
+)
+
+func TestNewNumeric(t *testing.T) {
+	tests := [...]struct {
+		m   *Message
+		raw string
+	}{
+		{NewNumeric("irc.example.org", RPL_WELCOME, "nick", "Welcome to the Internet Relay Network"), ":irc.example.org 001 nick :Welcome to the Internet Relay Network"},
+		{NewNumeric("irc.example.org", RPL_NAMREPLY, "nick", "=", "#channel", "@op +voice"), ":irc.example.org 353 nick = #channel :@op +voice"},
+		{NewNumeric("irc.example.org", RPL_TOPIC, "nick", "#channel", ""), ":irc.example.org 332 nick #channel :"},
+		{NewNumeric("", ERR_NOTREGISTERED, "*"), "451 *"},
+	}
+
+	for i, test := range tests {
+		if test.m.String() != test.raw {
+			t.Errorf("Failed to create numeric %d:", i)
+			t.Logf("Output: %s", test.m.String())
+		}
+		if err := ValidateNumeric(test.m); err != nil {
+			t.Errorf("Numeric %d should be valid: %v", i, err)
+		}
+	}
+}
+
+func TestValidateNumeric(t *testing.T) {
+	for i, raw := range []string{
+		":irc.example.org 001 :Welcome",
+		":irc.example.org PRIVMSG nick :Hello",
+		":irc.example.org 01 nick :Hello",
+	} {
+		if _, ok := ValidateNumeric(ParseMessage(raw)).(*ParseError); !ok {
+			t.Errorf("Numeric %d should be invalid.", i)
+		}
+	}
+}
+
+func TestMessage_AsError(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected *NumericError
+	}{
+		{":irc.example.org 401 me nick :No such nick/channel", &NumericError{ERR_NOSUCHNICK, "nick", "No such nick/channel"}},
+		{":irc.example.org 403 me #channel :No such channel", &NumericError{ERR_NOSUCHCHANNEL, "#channel", "No such channel"}},
+		{":irc.example.org 451 * :You have not registered", &NumericError{ERR_NOTREGISTERED, "", "You have not registered"}},
+		{":irc.example.org 904 me :SASL authentication failed", &NumericError{ERR_SASLFAIL, "", "SASL authentication failed"}},
+		{":irc.example.org 001 me :Welcome", nil},
+		{":irc.example.org 904", &NumericError{ERR_SASLFAIL, "", ""}},
+		{":nick!user@host PRIVMSG #channel :401", nil},
+	}
+
+	for i, test := range tests {
+		err := ParseMessage(test.line).AsError()
+		if test.expected == nil {
+			if err != nil {
+				t.Errorf("Message %d should not be an error: %v", i, err)
+			}
+			continue
+		}
+		if e, ok := err.(*NumericError); !ok || *e != *test.expected {
+			t.Errorf("Failed to convert message %d:", i)
+			t.Logf("Output: %#v", err)
+			t.Logf("Expected: %#v", test.expected)
+		}
+	}
+
+	err := ParseMessage(":irc.example.org 401 me nick :No such nick/channel").AsError()
+	if err.Error() != "irc: nick: No such nick/channel (ERR_NOSUCHNICK)" {
+		t.Errorf("Wrong error text: %q", err.Error())
+	}
+}
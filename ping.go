@@ -0,0 +1,180 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Prefix of the tokens sent by Ping, to tell its PONGs from others.
+const pingTokenPrefix = "rtt"
+
+// ErrPingTimeout is reported by KeepAlive when the server did not respond
+// to a PING in time.
+var ErrPingTimeout = errors.New("irc: ping timeout")
+
+// HandlePing enables automatic replies to PING messages.
+//
+// Every PING read using Decode or DecodeContext is answered with a PONG using
+// the same parameters. The PING message is still returned to the caller.
+func (c *Conn) HandlePing() {
+	c.mu.Lock()
+	c.handlePing = true
+	c.mu.Unlock()
+}
+
+// KeepAlive sends a PING to the server whenever no message was received for
+// the given interval, to detect dead connections.
+//
+// Any message received within timeout after sending the PING counts as a
+// sign of life, so messages must be read using Decode or DecodeContext.
+// Otherwise ErrPingTimeout is sent on the returned channel. Write errors are
+// reported the same way. The channel is closed after an error was reported,
+// which also stops sending PINGs. Cancel ctx to stop without closing the
+// connection, which closes the channel without reporting an error.
+func (c *Conn) KeepAlive(ctx context.Context, interval, timeout time.Duration) <-chan error {
+	errs := make(chan error, 1)
+
+	// Start measuring idle time now.
+	c.mu.Lock()
+	c.received = time.Now()
+	c.mu.Unlock()
+
+	// wait returns false if ctx is done before d passed.
+	wait := func(d time.Duration) bool {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	go func() {
+		defer close(errs)
+
+		for {
+			if idle := time.Since(c.lastReceived()); idle < interval {
+				if !wait(interval - idle) {
+					return
+				}
+				continue
+			}
+
+			sent := time.Now()
+			err := c.Encode(&Message{
+				Command: PING,
+				Params:  []string{strconv.FormatInt(sent.Unix(), 10)},
+			})
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			if !wait(timeout) {
+				return
+			}
+
+			if c.lastReceived().Before(sent) {
+				errs <- ErrPingTimeout
+				return
+			}
+		}
+	}()
+
+	return errs
+}
+
+// lastReceived returns the time the last message was decoded.
+func (c *Conn) lastReceived() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.received
+}
+
+// pings tracks the PINGs sent by Conn.Ping.
+type pings struct {
+	mu      sync.Mutex
+	next    uint64
+	pending map[string]chan time.Time // By token
+}
+
+// Ping sends a PING with a unique token, and returns the time until the server
+// answered with a PONG echoing that token. Returns ctx.Err() if ctx is done
+// before that. Several pings can be pending at the same time.
+//
+// PONGs are detected while decoding messages, so another goroutine must keep
+// calling Decode, for example using Messages or Mux.Run. Time spent waiting
+// for the rate limit counts towards the round-trip time.
+func (c *Conn) Ping(ctx context.Context) (time.Duration, error) {
+	token, pong := c.pings.add()
+	defer c.pings.remove(token)
+
+	sent := time.Now()
+	if err := c.EncodeContext(ctx, &Message{Command: PING, Params: []string{token}}); err != nil {
+		return 0, err
+	}
+
+	select {
+	case received := <-pong:
+		return received.Sub(sent), nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// add returns a new token, and a channel receiving the time its PONG arrived.
+func (p *pings) add() (string, <-chan time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pending == nil {
+		p.pending = make(map[string]chan time.Time)
+	}
+	p.next++
+	token := pingTokenPrefix + strconv.FormatUint(p.next, 10)
+
+	pong := make(chan time.Time, 1)
+	p.pending[token] = pong
+	return token, pong
+}
+
+// remove stops waiting for the PONG to token.
+func (p *pings) remove(token string) {
+	p.mu.Lock()
+	delete(p.pending, token)
+	p.mu.Unlock()
+}
+
+// observe delivers the arrival time of m if it answers a pending ping. The
+// token is the last parameter, servers usually send their name first:
+//
+//    :irc.example.org PONG irc.example.org :rtt1
+func (p *pings) observe(m *Message) {
+	if m.Command != PONG {
+		return
+	}
+	params := m.allParams()
+	if len(params) <= 0 {
+		return
+	}
+	token := params[len(params)-1]
+
+	p.mu.Lock()
+	pong, ok := p.pending[token]
+	delete(p.pending, token)
+	p.mu.Unlock()
+
+	if ok {
+		pong <- time.Now()
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readWriter combines a reader and a writer into an io.ReadWriteCloser.
+type readWriter struct {
+	io.Reader
+	io.Writer
+}
+
+func (rw *readWriter) Close() error {
+	return nil
+}
+
+func TestConn_HandlePing(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(&readWriter{strings.NewReader("PING :irc.example.org\r\nPING a b\r\n"), buffer})
+
+	// Don't reply unless enabled.
+	if m, err := conn.Decode(); err != nil || m.Command != PING {
+		t.Fatalf("Unexpected result: %v, %v", m, err)
+	}
+	if buffer.Len() > 0 {
+		t.Fatal("PING should not be answered by default!")
+	}
+
+	conn.HandlePing()
+
+	if m, err := conn.Decode(); err != nil || m.Command != PING {
+		t.Fatalf("Unexpected result: %v, %v", m, err)
+	}
+	if buffer.String() != "PONG a b\r\n" {
+		t.Fatalf("Wrong PONG reply: %q", buffer.String())
+	}
+}
+
+func TestConn_KeepAlive(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn := NewConn(client)
+	go func() {
+		for {
+			if _, err := conn.Decode(); err != nil {
+				return
+			}
+		}
+	}()
+
+	errs := conn.KeepAlive(context.Background(), 10*time.Millisecond, 50*time.Millisecond)
+	peer := NewConn(server)
+
+	// Answer the first PING.
+	if m, err := peer.Decode(); err != nil || m.Command != PING {
+		t.Fatalf("Expected a PING, got: %v, %v", m, err)
+	} else {
+		peer.Encode(&Message{Command: PONG, Params: m.Params})
+	}
+
+	// Ignore the next one.
+	if m, err := peer.Decode(); err != nil || m.Command != PING {
+		t.Fatalf("Expected a PING, got: %v, %v", m, err)
+	}
+
+	select {
+	case err := <-errs:
+		if err != ErrPingTimeout {
+			t.Fatalf("Expected ping timeout, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("KeepAlive did not detect the timeout!")
+	}
+
+	if _, ok := <-errs; ok {
+		t.Fatal("Error channel should be closed after reporting an error!")
+	}
+
+	conn.Close()
+}
+
+func TestConn_KeepAlive_cancel(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn := NewConn(client)
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := conn.KeepAlive(ctx, time.Hour, time.Hour)
+	cancel()
+
+	select {
+	case err, ok := <-errs:
+		if ok {
+			t.Fatalf("No error should be reported, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("KeepAlive did not stop!")
+	}
+}
+
+func TestConn_Ping(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn := NewConn(client)
+	defer conn.Close()
+	go func() {
+		for {
+			if _, err := conn.Decode(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Answer both PINGs in reverse order.
+	peer := NewConn(server)
+	go func() {
+		var tokens []string
+		for len(tokens) < 2 {
+			m, err := peer.Decode()
+			if err != nil {
+				return
+			}
+			tokens = append(tokens, m.Params[0])
+		}
+		time.Sleep(10 * time.Millisecond)
+		peer.Encode(&Message{Prefix: &Prefix{Name: "irc.example.org"}, Command: PONG, Params: []string{"irc.example.org"}, Trailing: tokens[1]})
+		peer.Encode(&Message{Prefix: &Prefix{Name: "irc.example.org"}, Command: PONG, Params: []string{"irc.example.org"}, Trailing: tokens[0]})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rtts := make(chan time.Duration, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			rtt, err := conn.Ping(ctx)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			rtts <- rtt
+		}()
+	}
+
+	for i := 0; i < 2; i++ {
+		if rtt := <-rtts; rtt < 10*time.Millisecond {
+			t.Errorf("Round-trip time too short: %v", rtt)
+		}
+	}
+}
+
+func TestConn_Ping_cancelled(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn := NewConn(client)
+	defer conn.Close()
+	go NewConn(server).Decode()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := conn.Ping(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if len(conn.pings.pending) > 0 {
+		t.Errorf("Ping still pending after cancelling")
+	}
+}
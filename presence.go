@@ -0,0 +1,265 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Maximum length of the nick list in a single ISON command.
+const isonListLength = 400
+
+// Presence tracks whether the nicks on a buddy list are online, using MONITOR
+// if the server advertises it in RPL_ISUPPORT, and ISON polling otherwise:
+//
+//    presence := irc.NewPresence(conn)
+//    presence.OnOnline = func(nick string) { ... }
+//    presence.Track("friend", "colleague")
+//
+//    for _, command := range []string{irc.RPL_ISON, irc.RPL_MONONLINE, irc.RPL_MONOFFLINE} {
+//        mux.HandleFunc(command, func(c *irc.Conn, m *irc.Message) {
+//            presence.Update(m)
+//        })
+//    }
+//
+//    for range time.Tick(time.Minute) {
+//        presence.Poll()
+//    }
+//
+// Poll sends the ISON requests, or subscribes to MONITOR notifications the
+// first time it is called once the server advertised MONITOR, so it should be
+// called periodically either way. The replies must be passed to Update.
+// Enabling the extended-monitor capability makes the server send away and
+// account changes of monitored nicks as well, which State tracks.
+//
+// A Presence may be used from multiple goroutines.
+type Presence struct {
+	// Called from Update when a tracked nick comes online or goes offline.
+	// Must be set before passing messages to Update.
+	OnOnline  func(nick string)
+	OnOffline func(nick string)
+
+	conn *Conn
+
+	mu         sync.Mutex
+	monitoring bool              // MONITOR is used for the tracked nicks
+	tracked    map[string]string // Nicks by folded nick
+	online     map[string]string // Online nicks by folded nick
+	pending    [][]string        // Folded nicks of unanswered ISON requests
+	mapping    CaseMapping       // Casemapping of the keys
+}
+
+// NewPresence returns a new Presence for the nicks sent to conn.
+func NewPresence(conn *Conn) *Presence {
+	return &Presence{
+		conn:    conn,
+		tracked: make(map[string]string),
+		online:  make(map[string]string),
+	}
+}
+
+// Track adds nicks to the buddy list. They are monitored right away if MONITOR
+// is used already, and included in the next Poll otherwise.
+func (p *Presence) Track(nicks ...string) error {
+	support := p.conn.ISupport()
+
+	p.mu.Lock()
+	p.updateMapping(support.CaseMapping())
+	for _, nick := range nicks {
+		p.tracked[p.mapping.Fold(nick)] = nick
+	}
+	monitoring := p.monitoring
+	p.mu.Unlock()
+
+	if monitoring {
+		return p.conn.Monitor(nicks, nil)
+	}
+	return nil
+}
+
+// Untrack removes nicks from the buddy list. No callbacks are called for them.
+func (p *Presence) Untrack(nicks ...string) error {
+	support := p.conn.ISupport()
+
+	p.mu.Lock()
+	p.updateMapping(support.CaseMapping())
+	for _, nick := range nicks {
+		folded := p.mapping.Fold(nick)
+		delete(p.tracked, folded)
+		delete(p.online, folded)
+	}
+	monitoring := p.monitoring
+	p.mu.Unlock()
+
+	if monitoring {
+		return p.conn.Monitor(nil, nicks)
+	}
+	return nil
+}
+
+// Poll asks the server which tracked nicks are online. Without MONITOR, the
+// nicks are sent in as many ISON requests as needed to stay below the line
+// length limit. With MONITOR, the nicks are monitored on the first call, and
+// later calls do nothing.
+func (p *Presence) Poll() error {
+	support := p.conn.ISupport()
+
+	p.mu.Lock()
+	p.updateMapping(support.CaseMapping())
+	nicks := make([]string, 0, len(p.tracked))
+	for _, nick := range p.tracked {
+		nicks = append(nicks, nick)
+	}
+	sort.Strings(nicks)
+
+	if p.monitoring {
+		p.mu.Unlock()
+		return nil
+	}
+	if support.Has("MONITOR") {
+		p.monitoring = true
+		p.mu.Unlock()
+		return p.conn.Monitor(nicks, nil)
+	}
+
+	// Servers answer every ISON with a single RPL_ISON, in order.
+	lists := chunkList(nicks, isonListLength)
+	requests := make([]*Message, len(lists))
+	for i, list := range lists {
+		requests[i] = &Message{Command: ISON, Params: strings.Split(list, ",")}
+
+		folded := make([]string, len(requests[i].Params))
+		for j, nick := range requests[i].Params {
+			folded[j] = p.mapping.Fold(nick)
+		}
+		p.pending = append(p.pending, folded)
+	}
+	p.mu.Unlock()
+
+	_, err := p.conn.EncodeAll(requests...)
+	return err
+}
+
+// Update processes RPL_ISON, RPL_MONONLINE and RPL_MONOFFLINE replies, calling
+// OnOnline and OnOffline for the tracked nicks whose status changed. Returns
+// false if m is none of these replies.
+//
+//    :irc.example.org 303 me :friend colleague
+func (p *Presence) Update(m *Message) bool {
+	switch m.Command {
+	case RPL_ISON, RPL_MONONLINE, RPL_MONOFFLINE:
+	default:
+		return false
+	}
+
+	support := p.conn.ISupport()
+	var came, went []string
+
+	p.mu.Lock()
+	p.updateMapping(support.CaseMapping())
+
+	switch m.Command {
+	case RPL_ISON:
+		if len(p.pending) <= 0 {
+			p.mu.Unlock()
+			return true
+		}
+		asked := p.pending[0]
+		p.pending = p.pending[1:]
+
+		present := make(map[string]bool)
+		for _, nick := range strings.Fields(m.Trailing) {
+			present[p.mapping.Fold(nick)] = true
+		}
+		for _, folded := range asked {
+			if present[folded] {
+				came = p.setOnline(came, folded)
+			} else {
+				went = p.setOffline(went, folded)
+			}
+		}
+
+	default:
+		nicks, online, _ := ParseMonitor(m)
+		for _, nick := range nicks {
+			if folded := p.mapping.Fold(nick); online {
+				came = p.setOnline(came, folded)
+			} else {
+				went = p.setOffline(went, folded)
+			}
+		}
+	}
+
+	onOnline, onOffline := p.OnOnline, p.OnOffline
+	p.mu.Unlock()
+
+	for _, nick := range came {
+		if onOnline != nil {
+			onOnline(nick)
+		}
+	}
+	for _, nick := range went {
+		if onOffline != nil {
+			onOffline(nick)
+		}
+	}
+	return true
+}
+
+// Online returns the tracked nicks that are online, sorted.
+func (p *Presence) Online() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	nicks := make([]string, 0, len(p.online))
+	for _, nick := range p.online {
+		nicks = append(nicks, nick)
+	}
+	sort.Strings(nicks)
+	return nicks
+}
+
+// setOnline marks a tracked nick as online, appending it to came if it was
+// offline before. The caller must hold p.mu.
+func (p *Presence) setOnline(came []string, folded string) []string {
+	nick, ok := p.tracked[folded]
+	if _, online := p.online[folded]; !ok || online {
+		return came
+	}
+	p.online[folded] = nick
+	return append(came, nick)
+}
+
+// setOffline marks a tracked nick as offline, appending it to went if it was
+// online before. The caller must hold p.mu.
+func (p *Presence) setOffline(went []string, folded string) []string {
+	nick, online := p.online[folded]
+	if !online {
+		return went
+	}
+	delete(p.online, folded)
+	return append(went, nick)
+}
+
+// updateMapping switches to the casemapping advertised by the server, folding
+// the nicks tracked before it was known again. The caller must hold p.mu.
+func (p *Presence) updateMapping(mapping CaseMapping) {
+	if mapping == p.mapping {
+		return
+	}
+	p.mapping = mapping
+
+	tracked := make(map[string]string, len(p.tracked))
+	for _, nick := range p.tracked {
+		tracked[mapping.Fold(nick)] = nick
+	}
+	online := make(map[string]string, len(p.online))
+	for _, nick := range p.online {
+		online[mapping.Fold(nick)] = nick
+	}
+	p.tracked, p.online = tracked, online
+}
@@ -0,0 +1,91 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPresence_ison(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(&readWriter{strings.NewReader(""), buffer})
+
+	var came, went []string
+	presence := NewPresence(conn)
+	presence.OnOnline = func(nick string) { came = append(came, nick) }
+	presence.OnOffline = func(nick string) { went = append(went, nick) }
+
+	nicks := []string{"Friend"}
+	for i := 0; i < 60; i++ {
+		nicks = append(nicks, "buddy"+strings.Repeat("x", i%10)+string(rune('a'+i%26))+string(rune('a'+i/26)))
+	}
+	presence.Track(nicks...)
+
+	if err := presence.Poll(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\r\n"), "\r\n")
+	if len(lines) < 2 {
+		t.Fatalf("Long lists should be split: %q", lines)
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "ISON ") || len(line) > 512 {
+			t.Errorf("Wrong ISON request %d: %q", i, line)
+		}
+	}
+
+	presence.Update(ParseMessage(":irc.example.org 303 me :friend"))
+	for range lines[1:] {
+		presence.Update(ParseMessage(":irc.example.org 303 me :"))
+	}
+	if !reflect.DeepEqual(came, []string{"Friend"}) || len(went) > 0 {
+		t.Errorf("Wrong callbacks: %v, %v", came, went)
+	}
+	if online := presence.Online(); !reflect.DeepEqual(online, []string{"Friend"}) {
+		t.Errorf("Wrong online nicks: %v", online)
+	}
+
+	// Friend went offline between polls.
+	presence.Poll()
+	for range lines {
+		presence.Update(ParseMessage(":irc.example.org 303 me :"))
+	}
+	if !reflect.DeepEqual(went, []string{"Friend"}) || len(presence.Online()) > 0 {
+		t.Errorf("Wrong callbacks: %v, %v", came, went)
+	}
+}
+
+func TestPresence_monitor(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(&readWriter{strings.NewReader(":irc.example.org 005 me MONITOR=100 :are supported by this server\r\n"), buffer})
+	conn.Decode()
+
+	var came, went []string
+	presence := NewPresence(conn)
+	presence.OnOnline = func(nick string) { came = append(came, nick) }
+	presence.OnOffline = func(nick string) { went = append(went, nick) }
+
+	presence.Track("friend", "colleague")
+	presence.Poll()
+	presence.Poll()
+	presence.Track("boss")
+
+	if expected := "MONITOR + colleague,friend\r\nMONITOR + boss\r\n"; buffer.String() != expected {
+		t.Errorf("Wrong MONITOR commands: %q", buffer.String())
+	}
+
+	presence.Update(ParseMessage(":irc.example.org 730 me :friend!user@host,stranger!user@host"))
+	presence.Update(ParseMessage(":irc.example.org 731 me :friend,colleague"))
+
+	if !reflect.DeepEqual(came, []string{"friend"}) || !reflect.DeepEqual(went, []string{"friend"}) {
+		t.Errorf("Wrong callbacks: %v, %v", came, went)
+	}
+	if presence.Update(ParseMessage(":irc.example.org 001 me :Welcome")) {
+		t.Errorf("Other messages should not be processed")
+	}
+}
@@ -0,0 +1,261 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// A Priority determines the order in which queued messages are written, see
+// Conn.EncodePriority.
+type Priority int
+
+// Message priorities.
+const (
+	Normal Priority = iota // Bulk messages, like PRIVMSG
+	High                   // Urgent messages, like PONG
+)
+
+// ErrQueueFull is returned by EncodePriority if the write queue has no room
+// for another message.
+var ErrQueueFull = errors.New("irc: write queue full")
+
+// SetWriteQueue enables a queue of up to size messages, used by
+// EncodePriority. A background goroutine writes the queued messages,
+// respecting the rate limit set using SetRateLimit, with High priority
+// messages going before Normal ones. Zero disables the queue, which is the
+// default.
+//
+// Messages still queued when the queue is replaced or disabled are discarded.
+// The queue is stopped by Close, while Shutdown writes the queued messages
+// first.
+func (c *Conn) SetWriteQueue(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.queue != nil {
+		c.queue.stop()
+		c.queue = nil
+	}
+	if size > 0 {
+		c.queue = newWriteQueue(size)
+		go c.queue.run(&c.Encoder)
+	}
+}
+
+// EncodePriority formats m and adds it to the write queue with priority p,
+// returning without waiting for it to be written. Messages of the same
+// priority are written in order. Without a queue, see SetWriteQueue, this is
+// the same as Encode.
+//
+// Returns ErrQueueFull if the queue has no room for m. If writing a queued
+// message failed, that error is returned for all later messages. Returns
+// ErrConnClosed after calling Shutdown.
+func (c *Conn) EncodePriority(m *Message, p Priority) error {
+	c.mu.Lock()
+	q := c.queue
+	c.mu.Unlock()
+
+	if atomic.LoadInt32(&c.Encoder.draining) != 0 {
+		return ErrConnClosed
+	}
+	if q == nil {
+		return c.Encode(m)
+	}
+
+	line, err := c.Encoder.format(nil, m)
+	if err != nil {
+		return err
+	}
+	return q.push(line, p)
+}
+
+// writeQueue holds formatted lines waiting to be written.
+type writeQueue struct {
+	mu     sync.Mutex
+	size   int
+	high   [][]byte
+	normal [][]byte
+	err    error // Error of the last write, if it failed
+
+	writing bool          // A popped line is being written
+	drained chan struct{} // Closed once all lines are written, see drain
+
+	ready  chan struct{} // Signalled when a line was added
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// newWriteQueue returns an empty queue with room for size lines.
+func newWriteQueue(size int) *writeQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &writeQueue{
+		size:   size,
+		ready:  make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// push adds line to the queue.
+func (q *writeQueue) push(line []byte, p Priority) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	switch {
+	case q.err != nil:
+		return q.err
+	case len(q.high)+len(q.normal) >= q.size:
+		return ErrQueueFull
+	case p >= High:
+		q.high = append(q.high, line)
+	default:
+		q.normal = append(q.normal, line)
+	}
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// pop removes and returns the line to write next, or nil if the queue is
+// empty.
+func (q *writeQueue) pop() []byte {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var line []byte
+	switch {
+	case len(q.high) > 0:
+		line, q.high = q.high[0], q.high[1:]
+	case len(q.normal) > 0:
+		line, q.normal = q.normal[0], q.normal[1:]
+	}
+	q.writing = line != nil
+	return line
+}
+
+// written marks the line returned by pop as written.
+func (q *writeQueue) written() {
+	q.mu.Lock()
+	q.writing = false
+	q.checkDrained()
+	q.mu.Unlock()
+}
+
+// drain waits until all queued lines were written, returning the error of a
+// failed write, ErrConnClosed if the queue was stopped, or ctx.Err() if ctx
+// is done first.
+func (q *writeQueue) drain(ctx context.Context) error {
+	q.mu.Lock()
+	if q.drained == nil {
+		q.drained = make(chan struct{})
+	}
+	drained := q.drained
+	q.checkDrained()
+	q.mu.Unlock()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.err
+}
+
+// checkDrained wakes up drain if nothing is left to write. The caller must
+// hold q.mu.
+func (q *writeQueue) checkDrained() {
+	if q.drained != nil && !q.writing && len(q.high)+len(q.normal) <= 0 {
+		close(q.drained)
+		q.drained = nil
+	}
+}
+
+// empty returns true if no lines are queued.
+func (q *writeQueue) empty() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.high)+len(q.normal) <= 0
+}
+
+// stop discards the queued lines and stops run.
+func (q *writeQueue) stop() {
+	q.cancel()
+
+	q.mu.Lock()
+	q.high, q.normal = nil, nil
+	if q.err == nil {
+		q.err = ErrConnClosed
+	}
+	q.writing = false
+	q.checkDrained()
+	q.mu.Unlock()
+}
+
+// fail records the error of a failed write.
+func (q *writeQueue) fail(err error) {
+	q.mu.Lock()
+	q.high, q.normal = nil, nil
+	q.err = err
+	q.writing = false
+	q.checkDrained()
+	q.mu.Unlock()
+}
+
+// run writes queued lines to enc until stopped or a write fails. The line to
+// write is picked after waiting for the rate limit, so High priority lines
+// queued in the meantime go first.
+func (q *writeQueue) run(enc *Encoder) {
+	for {
+		select {
+		case <-q.ready:
+		case <-q.ctx.Done():
+			return
+		}
+
+		for !q.empty() {
+			enc.mu.Lock()
+			limit := enc.limit
+			enc.mu.Unlock()
+
+			if limit != nil {
+				if err := limit.Wait(q.ctx); err != nil {
+					return
+				}
+			}
+
+			line := q.pop()
+			if line == nil {
+				if limit != nil {
+					limit.cancel()
+				}
+				break
+			}
+
+			enc.mu.Lock()
+			_, err := enc.send(line)
+			if err == nil {
+				err = enc.autoFlush()
+			}
+			enc.mu.Unlock()
+
+			if err != nil {
+				q.fail(err)
+				return
+			}
+			q.written()
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConn_EncodePriority(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(&readWriter{strings.NewReader(""), buffer})
+	defer conn.Close()
+
+	conn.SetRateLimit(1, 20*time.Millisecond)
+	conn.SetWriteQueue(10)
+
+	for _, text := range []string{"1", "2", "3"} {
+		if err := conn.EncodePriority(&Message{Command: PRIVMSG, Params: []string{"#channel"}, Trailing: text}, Normal); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := conn.EncodePriority(&Message{Command: PONG, Trailing: "irc.example.org"}, High); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var lines []string
+	for deadline := time.Now().Add(time.Second); len(lines) < 4 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		buffer.mu.Lock()
+		lines = strings.Split(strings.TrimSuffix(buffer.String(), "\r\n"), "\r\n")
+		buffer.mu.Unlock()
+	}
+
+	if len(lines) != 4 {
+		t.Fatalf("Wrong number of lines: %q", lines)
+	}
+
+	// The first message may be written before PONG was queued.
+	if lines[0] != "PONG :irc.example.org" && lines[1] != "PONG :irc.example.org" {
+		t.Errorf("PONG should skip the queue: %q", lines)
+	}
+	if lines[3] != "PRIVMSG #channel :3" {
+		t.Errorf("Wrong order: %q", lines)
+	}
+}
+
+func TestConn_EncodePriority_full(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(&readWriter{strings.NewReader(""), buffer})
+
+	conn.SetRateLimit(1, time.Hour)
+	conn.SetWriteQueue(2)
+
+	var err error
+	for i := 0; i < 4 && err == nil; i++ {
+		err = conn.EncodePriority(&Message{Command: PING, Trailing: "x"}, Normal)
+	}
+	if err != ErrQueueFull {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	conn.Close()
+	if err := conn.EncodePriority(&Message{Command: PING, Trailing: "x"}, High); err != ErrConnClosed {
+		t.Errorf("Unexpected error after Close: %v", err)
+	}
+}
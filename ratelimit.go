@@ -0,0 +1,94 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A Limiter is a token bucket rate limiter, limiting the rate at which
+// messages are written. A single Limiter may be shared by multiple Encoders
+// using SetLimiter, to limit their combined rate, for example for a bot
+// connected to several networks from the same host:
+//
+//    limit := irc.NewLimiter(5, 2*time.Second)
+//    for _, conn := range conns {
+//        conn.SetLimiter(limit)
+//    }
+//
+// A Limiter may be used from multiple goroutines.
+type Limiter struct {
+	mu    sync.Mutex
+	burst int
+	every time.Duration
+	full  time.Time // Time at which the bucket is full again, instead of a token count
+}
+
+// NewLimiter returns a Limiter allowing burst events at once, refilling
+// one token every given duration. Both must be positive.
+func NewLimiter(burst int, every time.Duration) *Limiter {
+	return &Limiter{
+		burst: burst,
+		every: every,
+	}
+}
+
+// reserve takes a token and returns the time to wait before using it.
+func (l *Limiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.full.Before(now) {
+		l.full = now
+	}
+
+	delay := l.full.Sub(now) - time.Duration(l.burst-1)*l.every
+	l.full = l.full.Add(l.every)
+
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// cancel returns a token that was reserved, but not used.
+func (l *Limiter) cancel() {
+	l.mu.Lock()
+	l.full = l.full.Add(-l.every)
+	l.mu.Unlock()
+}
+
+// Allow takes a token if one is available without waiting, and reports
+// whether it did.
+func (l *Limiter) Allow() bool {
+	if l.reserve() > 0 {
+		l.cancel()
+		return false
+	}
+	return true
+}
+
+// Wait blocks until a token is available or ctx is done, returning ctx.Err()
+// in the latter case.
+func (l *Limiter) Wait(ctx context.Context) error {
+	delay := l.reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	}
+}
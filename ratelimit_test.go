@@ -0,0 +1,123 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiter_reserve(t *testing.T) {
+	l := NewLimiter(3, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if delay := l.reserve(); delay != 0 {
+			t.Fatalf("Burst message %d should not be delayed: %s", i, delay)
+		}
+	}
+
+	if delay := l.reserve(); delay < 59*time.Minute {
+		t.Fatalf("Message after burst should be delayed: %s", delay)
+	}
+
+	l.cancel()
+
+	if delay := l.reserve(); delay < 59*time.Minute || delay > time.Hour {
+		t.Fatalf("Cancelled reservation should be returned: %s", delay)
+	}
+}
+
+func TestEncoder_SetRateLimit(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	enc := NewEncoder(buffer)
+	enc.SetRateLimit(2, 20*time.Millisecond)
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := enc.Encode(&Message{Command: PING, Params: []string{"test"}}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("Messages were not throttled: %s", elapsed)
+	}
+
+	if buffer.String() != "PING test\r\nPING test\r\nPING test\r\nPING test\r\n" {
+		t.Errorf("Throttled messages are wrong: %q", buffer.String())
+	}
+
+	// Disabling the limit should make writes immediate again.
+	enc.SetRateLimit(0, 0)
+
+	start = time.Now()
+	for i := 0; i < 10; i++ {
+		enc.Encode(&Message{Command: PING, Params: []string{"test"}})
+	}
+
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("Messages should not be throttled: %s", elapsed)
+	}
+}
+
+func TestEncoder_EncodeContext(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	enc := NewEncoder(buffer)
+	enc.SetRateLimit(1, time.Hour)
+
+	enc.Encode(&Message{Command: PING, Params: []string{"first"}})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if err := enc.EncodeContext(ctx, &Message{Command: PING, Params: []string{"second"}}); err != context.DeadlineExceeded {
+		t.Fatalf("Expected deadline error, got: %v", err)
+	}
+
+	if buffer.String() != "PING first\r\n" {
+		t.Errorf("Aborted message should not be written: %q", buffer.String())
+	}
+}
+
+func TestEncoder_SetLimiter(t *testing.T) {
+	limit := NewLimiter(2, time.Hour)
+
+	first, second := new(bytes.Buffer), new(bytes.Buffer)
+	a, b := NewEncoder(first), NewEncoder(second)
+	a.SetLimiter(limit)
+	b.SetLimiter(limit)
+
+	if err := a.Encode(&Message{Command: PING, Params: []string{"a"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := b.Encode(&Message{Command: PING, Params: []string{"b"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The shared burst is used up, so both encoders have to wait now.
+	for _, enc := range []*Encoder{a, b} {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		err := enc.EncodeContext(ctx, &Message{Command: PING, Params: []string{"late"}})
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Errorf("Expected deadline error, got: %v", err)
+		}
+	}
+
+	if first.String() != "PING a\r\n" || second.String() != "PING b\r\n" {
+		t.Errorf("Throttled messages are wrong: %q, %q", first.String(), second.String())
+	}
+
+	if limit.Allow() {
+		t.Errorf("Allow should fail while the limiter is empty")
+	}
+
+	a.SetLimiter(nil)
+	if err := a.Encode(&Message{Command: PING, Params: []string{"free"}}); err != nil {
+		t.Errorf("Unexpected error without limiter: %v", err)
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// BackoffPolicy configures the delay between reconnection attempts.
+//
+// The delay starts at Min and is multiplied by Factor after every failed
+// attempt, up to Max. A random fraction (Jitter) of the delay is added or
+// subtracted to avoid all clients reconnecting at the same time.
+type BackoffPolicy struct {
+	Min    time.Duration // Delay before the first attempt
+	Max    time.Duration // Maximum delay, zero means no maximum
+	Factor float64       // Multiplier, defaults to 2
+	Jitter float64       // Randomization factor between 0 and 1
+
+	// Maximum number of consecutive attempts, zero means no limit.
+	MaxAttempts int
+}
+
+// delay returns the time to wait before the given attempt, starting at 0.
+func (p BackoffPolicy) delay(attempt int) time.Duration {
+	factor := p.Factor
+	if factor < 1 {
+		factor = 2
+	}
+
+	d := float64(p.Min)
+	for i := 0; i < attempt && (p.Max <= 0 || d < float64(p.Max)); i++ {
+		d = d * factor
+	}
+	if p.Max > 0 && d > float64(p.Max) {
+		d = float64(p.Max)
+	}
+
+	if p.Jitter > 0 {
+		d = d + d*p.Jitter*(2*rand.Float64()-1)
+	}
+
+	return time.Duration(d)
+}
+
+// ReplayPolicy decides what happens when the replay buffer of a ReconnectConn
+// is full.
+type ReplayPolicy int
+
+const (
+	// ReplayDropOldest discards the oldest message to make room.
+	ReplayDropOldest ReplayPolicy = iota
+
+	// ReplayError discards the new message, Encode returns
+	// ErrReplayBufferFull.
+	ReplayError
+)
+
+// ErrReplayBufferFull is returned by ReconnectConn.Encode if a message could
+// not be buffered, using the ReplayError policy.
+var ErrReplayBufferFull = errors.New("irc: replay buffer full")
+
+// ReconnectConn wraps a Conn and transparently replaces it using the dial
+// function when reading or writing fails.
+//
+// The dial function is responsible for configuring each new Conn, for example
+// using HandlePing. The on-connect messages (NICK, USER, JOIN, ...) are sent
+// after every successful dial, including the first.
+type ReconnectConn struct {
+	dial      func() (*Conn, error)
+	policy    BackoffPolicy
+	onConnect []*Message
+
+	mu          sync.Mutex
+	conn        *Conn
+	onReconnect func(attempt int, err error)
+
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// Messages to send again after reconnecting, see SetReplayBuffer.
+	replayMu      sync.Mutex
+	replay        []*Message
+	replaySize    int
+	replayPolicy  ReplayPolicy
+	replayExclude func(*Message) bool
+}
+
+// NewReconnectConn dials a new connection and sends the on-connect messages.
+//
+// Returns an error if the first connection could not be established.
+func NewReconnectConn(dial func() (*Conn, error), policy BackoffPolicy, onConnect ...*Message) (*ReconnectConn, error) {
+	r := &ReconnectConn{
+		dial:      dial,
+		policy:    policy,
+		onConnect: onConnect,
+		done:      make(chan struct{}),
+	}
+
+	conn, err := r.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	r.conn = conn
+	return r, nil
+}
+
+// OnReconnect sets a function that is called after every reconnection
+// attempt. The error is nil if the attempt succeeded.
+//
+// The function is called while reconnecting, so it must not use r.
+func (r *ReconnectConn) OnReconnect(fn func(attempt int, err error)) {
+	r.mu.Lock()
+	r.onReconnect = fn
+	r.mu.Unlock()
+}
+
+// SetReplayBuffer keeps up to size messages that failed to send, and sends
+// them again in order once the server welcomes us on the new connection, as
+// seen by Decode. Messages encoded while others are waiting are buffered as
+// well, to keep their order. Without replay buffer, which is the default, Encode waits
+// for the new connection and sends the failed message right away, before
+// registration is complete.
+//
+// Messages for which exclude returns true are discarded instead, use this for
+// messages that are only meaningful at the time, like PONG. A nil exclude
+// buffers all messages. A size of zero disables the replay buffer.
+func (r *ReconnectConn) SetReplayBuffer(size int, policy ReplayPolicy, exclude func(*Message) bool) {
+	r.replayMu.Lock()
+	defer r.replayMu.Unlock()
+
+	r.replaySize = size
+	r.replayPolicy = policy
+	r.replayExclude = exclude
+
+	if len(r.replay) > size {
+		r.replay = r.replay[len(r.replay)-size:]
+	}
+}
+
+// Conn returns the current connection.
+func (r *ReconnectConn) Conn() *Conn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.conn
+}
+
+// Decode reads a single Message from the current connection, reconnecting
+// if the read fails.
+//
+// Returns a non-nil error if the connection could not be restored.
+func (r *ReconnectConn) Decode() (*Message, error) {
+	for {
+		conn := r.Conn()
+
+		m, err := conn.Decode()
+		if err == nil {
+			if m != nil && m.Command == RPL_WELCOME {
+				r.flushReplay(conn)
+			}
+			return m, nil
+		}
+
+		if err = r.reconnect(conn, err); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Encode writes m to the current connection. If the write fails, m is sent
+// again after reconnecting, or added to the replay buffer if enabled using
+// SetReplayBuffer.
+//
+// Returns a non-nil error if the connection could not be restored, or if m
+// could not be buffered.
+func (r *ReconnectConn) Encode(m *Message) error {
+
+	// Keep the order of messages waiting to be replayed.
+	if queued, err := r.queue(m); queued {
+		return err
+	}
+
+	for {
+		conn := r.Conn()
+
+		err := conn.Encode(m)
+		if err == nil {
+			return nil
+		}
+
+		buffered, bufErr := r.buffer(m)
+
+		if err = r.reconnect(conn, err); err != nil {
+			return err
+		}
+		if buffered || r.excluded(m) {
+			return bufErr
+		}
+	}
+}
+
+// queue adds m to the replay buffer if other messages are waiting in it.
+func (r *ReconnectConn) queue(m *Message) (bool, error) {
+	r.replayMu.Lock()
+	waiting := len(r.replay) > 0
+	r.replayMu.Unlock()
+
+	if !waiting {
+		return false, nil
+	}
+	return r.buffer(m)
+}
+
+// buffer adds m to the replay buffer. Returns false if the replay buffer is
+// disabled or m is excluded, so the caller should send m itself.
+func (r *ReconnectConn) buffer(m *Message) (bool, error) {
+	r.replayMu.Lock()
+	defer r.replayMu.Unlock()
+
+	switch {
+	case r.replaySize <= 0:
+		return false, nil
+	case r.replayExclude != nil && r.replayExclude(m):
+		return false, nil
+	case len(r.replay) < r.replaySize:
+	case r.replayPolicy == ReplayError:
+		return true, ErrReplayBufferFull
+	default:
+		r.replay = r.replay[1:]
+	}
+
+	r.replay = append(r.replay, m)
+	return true, nil
+}
+
+// excluded returns true if m should not be sent again after reconnecting.
+func (r *ReconnectConn) excluded(m *Message) bool {
+	r.replayMu.Lock()
+	defer r.replayMu.Unlock()
+
+	return r.replaySize > 0 && r.replayExclude != nil && r.replayExclude(m)
+}
+
+// flushReplay sends the buffered messages to conn. Messages that could not be
+// sent are kept for the next connection.
+func (r *ReconnectConn) flushReplay(conn *Conn) {
+	r.replayMu.Lock()
+	defer r.replayMu.Unlock()
+
+	for len(r.replay) > 0 {
+		if err := conn.Encode(r.replay[0]); err != nil {
+			return
+		}
+		r.replay = r.replay[1:]
+	}
+}
+
+// Close closes the current connection and stops reconnecting.
+func (r *ReconnectConn) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.conn.Close()
+}
+
+// reconnect replaces the failed connection, unless another goroutine has
+// done so already. Returns cause if reconnecting is not possible.
+func (r *ReconnectConn) reconnect(failed *Conn, cause error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed() {
+		return cause
+	}
+
+	// Someone else reconnected while we were waiting.
+	if r.conn != failed {
+		return nil
+	}
+
+	failed.Close()
+
+	for attempt := 0; r.policy.MaxAttempts <= 0 || attempt < r.policy.MaxAttempts; attempt++ {
+
+		select {
+		case <-time.After(r.policy.delay(attempt)):
+		case <-r.done:
+			return cause
+		}
+
+		conn, err := r.connect()
+
+		if r.onReconnect != nil {
+			r.onReconnect(attempt, err)
+		}
+
+		if err == nil {
+			r.conn = conn
+			return nil
+		}
+
+		cause = err
+	}
+
+	return cause
+}
+
+// connect dials a new connection and sends the on-connect messages.
+func (r *ReconnectConn) connect() (*Conn, error) {
+	conn, err := r.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range r.onConnect {
+		if err = conn.Encode(m); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// closed returns true if Close was called.
+func (r *ReconnectConn) closed() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoffPolicy_delay(t *testing.T) {
+	p := BackoffPolicy{Min: time.Second, Max: 10 * time.Second}
+
+	for attempt, expected := range []time.Duration{1, 2, 4, 8, 10, 10} {
+		if d := p.delay(attempt); d != expected*time.Second {
+			t.Errorf("Wrong delay for attempt %d: %s", attempt, d)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.delay(0); d < 500*time.Millisecond || d > 1500*time.Millisecond {
+			t.Fatalf("Delay outside jitter range: %s", d)
+		}
+	}
+}
+
+func TestReconnectConn(t *testing.T) {
+	var buffers []*bufferConn
+	streams := []string{"", "PING :second\r\n"}
+	errDial := errors.New("dial failed")
+	dials := 0
+
+	dial := func() (*Conn, error) {
+		dials++
+		if dials == 2 {
+			return nil, errDial
+		}
+
+		buffer := new(bufferConn)
+		buffers = append(buffers, buffer)
+		return NewConn(&readWriter{strings.NewReader(streams[len(buffers)-1]), buffer}), nil
+	}
+
+	var attempts []error
+
+	r, err := NewReconnectConn(dial, BackoffPolicy{Min: time.Millisecond}, &Message{Command: NICK, Params: []string{"sorcix"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	r.OnReconnect(func(attempt int, err error) {
+		attempts = append(attempts, err)
+	})
+
+	// The first stream ends immediately, the second dial fails.
+	m, err := r.Decode()
+	if err != nil || m.Trailing != "second" {
+		t.Fatalf("Unexpected result: %v, %v", m, err)
+	}
+
+	if len(attempts) != 2 || attempts[0] != errDial || attempts[1] != nil {
+		t.Errorf("Wrong reconnect events: %v", attempts)
+	}
+
+	for i, buffer := range buffers {
+		if buffer.String() != "NICK sorcix\r\n" {
+			t.Errorf("On-connect messages not sent on connection %d: %q", i, buffer.String())
+		}
+	}
+
+	r.Close()
+
+	if _, err := r.Decode(); err == nil {
+		t.Error("Decode should fail after Close!")
+	}
+}
+
+func TestReconnectConn_MaxAttempts(t *testing.T) {
+	errDial := errors.New("dial failed")
+	first := true
+
+	r, err := NewReconnectConn(func() (*Conn, error) {
+		if first {
+			first = false
+			return NewConn(&readWriter{strings.NewReader(""), new(bufferConn)}), nil
+		}
+		return nil, errDial
+	}, BackoffPolicy{Min: time.Millisecond, MaxAttempts: 3})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := r.Decode(); err != errDial {
+		t.Fatalf("Expected dial error, got: %v", err)
+	}
+}
+
+// failingWriter fails every write after the first n.
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n <= 0 {
+		return 0, errors.New("write failed")
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestReconnectConn_SetReplayBuffer(t *testing.T) {
+	buffer := new(bufferConn)
+	dials := 0
+
+	r, err := NewReconnectConn(func() (*Conn, error) {
+		dials++
+		if dials == 1 {
+			return NewConn(&readWriter{strings.NewReader(""), &failingWriter{n: 1}}), nil
+		}
+		return NewConn(&readWriter{strings.NewReader(":irc.example.org 001 me :Welcome\r\n"), buffer}), nil
+	}, BackoffPolicy{Min: time.Millisecond}, &Message{Command: NICK, Params: []string{"me"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	r.SetReplayBuffer(2, ReplayDropOldest, func(m *Message) bool {
+		return m.Command == PONG
+	})
+
+	// The first message causes a reconnect, later messages are buffered as
+	// well until we're welcomed, except for excluded ones.
+	for _, m := range []*Message{
+		{Command: PRIVMSG, Params: []string{"#test"}, Trailing: "first"},
+		{Command: PONG, Trailing: "excluded"},
+		{Command: PRIVMSG, Params: []string{"#test"}, Trailing: "second"},
+		{Command: PRIVMSG, Params: []string{"#test"}, Trailing: "third"},
+	} {
+		if err := r.Encode(m); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if buffer.String() != "NICK me\r\nPONG :excluded\r\n" {
+		t.Fatalf("Messages should not be sent before registration: %q", buffer.String())
+	}
+
+	if m, err := r.Decode(); err != nil || m.Command != RPL_WELCOME {
+		t.Fatalf("Unexpected result: %v, %v", m, err)
+	}
+
+	// The first message was dropped to make room.
+	expected := "NICK me\r\nPONG :excluded\r\nPRIVMSG #test :second\r\nPRIVMSG #test :third\r\n"
+	if buffer.String() != expected {
+		t.Errorf("Buffered messages not replayed correctly: %q", buffer.String())
+	}
+
+	r.SetReplayBuffer(1, ReplayError, nil)
+	r.buffer(&Message{Command: PRIVMSG, Params: []string{"#test"}, Trailing: "fourth"})
+	if err := r.Encode(&Message{Command: PRIVMSG, Params: []string{"#test"}, Trailing: "fifth"}); err != ErrReplayBufferFull {
+		t.Errorf("Expected ErrReplayBufferFull, got: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strconv"
+	"strings"
+)
+
+// RegisterError is returned by Register when the server refused the
+// registration.
+type RegisterError struct {
+	Code string // Numeric reply, like ERR_NICKNAMEINUSE, or ERROR
+	Nick string // Nick that was refused, if any
+	Text string // Text sent by the server
+}
+
+func (e *RegisterError) Error() string {
+	return "irc: registration failed: " + e.Text + " (" + CommandName(e.Code) + ")"
+}
+
+// Register registers the connection by sending PASS (if given), NICK and
+// USER, and waits until the server welcomes us using RPL_WELCOME.
+//
+// Returns a *RegisterError if the nick is in use (ERR_NICKNAMEINUSE) or
+// refused otherwise, the password is wrong, or the server closes the
+// connection. Servers refusing us using an IRCv3 standard reply, like
+// FAIL * ACCOUNT_REQUIRED_TO_CONNECT, cause a *StandardReply instead. PING
+// messages received while waiting are answered.
+//
+// Like SASLPlain it reads from the connection itself until done or the
+// timeout set by SetTimeout expires. Use Pass, Nick and User to register
+// without waiting, or RegisterNicks to try other nicks if this one is taken.
+// When connecting through a gateway, use WebIRC before calling Register.
+func (c *Conn) Register(nick, user, realname string, pass ...string) (err error) {
+	_, err = c.RegisterNicks([]string{nick}, user, realname, pass...)
+	return err
+}
+
+// RegisterNicks is like Register, but tries the next nick in nicks whenever
+// the server refuses one, until one is accepted or none are left. Use
+// AlternativeNicks to generate a list of nicks.
+//
+// Returns the nick we're registered with, which may differ from the one we
+// asked for if the server changed it.
+func (c *Conn) RegisterNicks(nicks []string, user, realname string, pass ...string) (nick string, err error) {
+	if len(nicks) == 0 {
+		return "", &RegisterError{Code: ERR_NONICKNAMEGIVEN, Text: "No nickname given"}
+	}
+
+	for _, password := range pass {
+		if err = c.Pass(password); err != nil {
+			return "", err
+		}
+	}
+
+	if err = c.Nick(nicks[0]); err != nil {
+		return "", err
+	}
+	if err = c.User(user, realname); err != nil {
+		return "", err
+	}
+
+	return c.awaitWelcome(nicks[0], nicks[1:])
+}
+
+// AlternativeNicks returns nick followed by n alternatives, created by
+// appending an underscore and then increasing numbers:
+//
+//    nick, nick_, nick2, nick3, ...
+//
+func AlternativeNicks(nick string, n int) []string {
+	nicks := make([]string, 0, n+1)
+	nicks = append(nicks, nick)
+
+	for i := 1; i <= n; i++ {
+		if i == 1 {
+			nicks = append(nicks, nick+"_")
+		} else {
+			nicks = append(nicks, nick+strconv.Itoa(i))
+		}
+	}
+
+	return nicks
+}
+
+// awaitWelcome waits for RPL_WELCOME, or an error refusing registration.
+// Refused nicks are replaced by the next one in fallback.
+func (c *Conn) awaitWelcome(nick string, fallback []string) (string, error) {
+	c.mu.Lock()
+	handlePing := c.handlePing
+	mapping := c.support.CaseMapping()
+	c.mu.Unlock()
+
+	err := c.await(func(m *Message) (bool, error) {
+		switch m.Command {
+		case RPL_WELCOME:
+			// :irc.example.org 001 nick :Welcome to the Internet Relay Network
+			if target := m.param(0); len(target) > 0 {
+				nick = target
+			}
+			return true, nil
+		case NICK:
+			// Some servers change our nick before registration is complete.
+			if m.Prefix != nil && mapping.Equal(m.Prefix.Name, nick) {
+				nick = firstParam(m)
+			}
+		case PING:
+			if !handlePing {
+				return false, c.Encode(&Message{Command: PONG, Params: m.Params, Trailing: m.Trailing, EmptyTrailing: m.EmptyTrailing})
+			}
+		case ERR_NICKNAMEINUSE, ERR_ERRONEUSNICKNAME, ERR_NICKCOLLISION, ERR_UNAVAILRESOURCE:
+			// :irc.example.org 433 * nick :Nickname is already in use
+			if len(fallback) > 0 {
+				nick, fallback = fallback[0], fallback[1:]
+				return false, c.Nick(nick)
+			}
+			e := m.AsError().(*NumericError)
+			return true, &RegisterError{Code: e.Code, Nick: e.Target, Text: e.Text}
+		case ERR_NONICKNAMEGIVEN, ERR_PASSWDMISMATCH, ERR_YOUREBANNEDCREEP, ERROR:
+			return true, &RegisterError{Code: m.Command, Text: strings.TrimSpace(m.Trailing)}
+		case FAIL:
+			// FAIL * ACCOUNT_REQUIRED_TO_CONNECT :You need to log in
+			if err := failure(m, "*", NICK, USER, PASS); err != nil {
+				return true, err
+			}
+		}
+		return false, nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+	return nick, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConn_Register(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"PASS secret":            nil,
+		"NICK sorcix":            nil,
+		"USER sorcix 0 * :Vic D": {":irc.example.org NOTICE * :Looking up your hostname", "PING :cookie"},
+		"PONG :cookie":           {":irc.example.org 001 sorcix :Welcome"},
+	})
+	defer conn.Close()
+
+	if err := conn.Register("sorcix", "sorcix", "Vic D", "secret"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestConn_Register_nickInUse(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"NICK sorcix":       nil,
+		"USER sorcix 0 * :": {":irc.example.org 433 * sorcix :Nickname is already in use"},
+	})
+	defer conn.Close()
+
+	err := conn.Register("sorcix", "sorcix", "")
+	if !reflect.DeepEqual(err, &RegisterError{Code: ERR_NICKNAMEINUSE, Nick: "sorcix", Text: "Nickname is already in use"}) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err.Error() != "irc: registration failed: Nickname is already in use (ERR_NICKNAMEINUSE)" {
+		t.Errorf("Wrong error message: %s", err.Error())
+	}
+}
+
+func TestConn_Register_fail(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"NICK sorcix":       nil,
+		"USER sorcix 0 * :": {":irc.example.org WARN * SLOW :Ignored", ":irc.example.org FAIL * ACCOUNT_REQUIRED_TO_CONNECT :You need to log in"},
+	})
+	defer conn.Close()
+
+	err := conn.Register("sorcix", "sorcix", "")
+	if r, ok := err.(*StandardReply); !ok || r.Code != "ACCOUNT_REQUIRED_TO_CONNECT" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestConn_RegisterNicks(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"NICK sorcix":       nil,
+		"USER sorcix 0 * :": {":irc.example.org 433 * sorcix :Nickname is already in use"},
+		"NICK sorcix_":      {":irc.example.org 432 * sorcix_ :Erroneous nickname"},
+		"NICK sorcix2":      {":sorcix2 NICK :Guest42", ":irc.example.org 001 :Welcome"},
+	})
+	defer conn.Close()
+
+	nick, err := conn.RegisterNicks(AlternativeNicks("sorcix", 3), "sorcix", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if nick != "Guest42" {
+		t.Errorf("Wrong nick: %s", nick)
+	}
+}
+
+func TestConn_RegisterNicks_caseMapping(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"NICK sorcix[]":     nil,
+		"USER sorcix 0 * :": {":Sorcix{}!user@host NICK :Guest42", ":irc.example.org 001 :Welcome"},
+	})
+	defer conn.Close()
+
+	// Nicks are compared using rfc1459 casemapping.
+	nick, err := conn.RegisterNicks([]string{"sorcix[]"}, "sorcix", "")
+	if err != nil || nick != "Guest42" {
+		t.Errorf("Unexpected result: %s, %v", nick, err)
+	}
+}
+
+func TestConn_RegisterNicks_exhausted(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"NICK sorcix":       nil,
+		"USER sorcix 0 * :": {":irc.example.org 433 * sorcix :Nickname is already in use"},
+		"NICK sorcix_":      {":irc.example.org 433 * sorcix_ :Nickname is already in use"},
+	})
+	defer conn.Close()
+
+	_, err := conn.RegisterNicks(AlternativeNicks("sorcix", 1), "sorcix", "")
+	if e, ok := err.(*RegisterError); !ok || e.Nick != "sorcix_" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestAlternativeNicks(t *testing.T) {
+	nicks := AlternativeNicks("sorcix", 3)
+	if !reflect.DeepEqual(nicks, []string{"sorcix", "sorcix_", "sorcix2", "sorcix3"}) {
+		t.Errorf("Wrong nicks: %q", nicks)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// Maximum length of a single AUTHENTICATE payload.
+const saslChunkLength = 400
+
+// ErrSASLUnsupported is returned when the server refuses the sasl capability.
+var ErrSASLUnsupported = errors.New("irc: server does not support SASL")
+
+// ErrSASLNotTLS is returned by SASLExternal on plaintext connections.
+var ErrSASLNotTLS = errors.New("irc: SASL EXTERNAL requires a TLS connection")
+
+// SASLError is returned when the server rejects SASL authentication.
+type SASLError struct {
+	Code string // Numeric reply, like ERR_SASLFAIL
+	Text string // Text sent by the server
+}
+
+func (e *SASLError) Error() string {
+	return "irc: SASL authentication failed: " + e.Text + " (" + e.Code + ")"
+}
+
+// SASLPlain authenticates using the SASL PLAIN mechanism.
+//
+// This requests the sasl capability unless NegotiateCaps or RequestCaps
+// enabled it already, and performs the AUTHENTICATE exchange. If capability
+// negotiation was started by requesting sasl, it is ended using CAP END, even
+// if authentication failed. Negotiation left open by RequestCaps is ended by
+// the caller using EndCaps.
+// It should be called before registering using NICK and USER, and reads from
+// the connection itself until done or the timeout set by SetTimeout expires.
+//
+// Returns a *SASLError if the server rejected the credentials, or a
+// *StandardReply if it answered with FAIL AUTHENTICATE or FAIL *.
+func (c *Conn) SASLPlain(user, pass string) error {
+	payload := user + "\x00" + user + "\x00" + pass
+	return c.sasl("PLAIN", base64.StdEncoding.EncodeToString([]byte(payload)))
+}
+
+// SASLExternal authenticates using the SASL EXTERNAL mechanism, which uses the
+// TLS client certificate to identify us instead of a password. The certificate
+// is configured in the tls.Config passed to DialTLS or StartTLS, and usually
+// has to be registered with services first, for example using NickServ CERT
+// ADD.
+//
+// Like SASLPlain, this requests the sasl capability if needed, and ends
+// capability negotiation afterwards if that started it.
+//
+// Returns ErrSASLNotTLS if the connection does not use TLS, and a *SASLError
+// if the server rejected the certificate.
+func (c *Conn) SASLExternal() error {
+	if _, ok := c.TLSConnectionState(); !ok {
+		return ErrSASLNotTLS
+	}
+	return c.sasl("EXTERNAL", "")
+}
+
+// sasl requests the sasl capability and authenticates using mechanism.
+// The payload must be base64 encoded, or empty.
+func (c *Conn) sasl(mechanism, payload string) (err error) {
+
+	// No need to request the capability again if NegotiateCaps did already.
+	if !c.capEnabled("sasl") {
+		// Negotiation is only ended here if this call started it.
+		if c.beginCaps() {
+			defer func() {
+				if end := c.EndCaps(); err == nil {
+					err = end
+				}
+			}()
+		}
+		if err = c.requestSASL(); err != nil {
+			return err
+		}
+	}
+
+	if err = c.Encode(&Message{Command: AUTHENTICATE, Params: []string{mechanism}}); err != nil {
+		return err
+	}
+
+	err = c.await(func(m *Message) (bool, error) {
+		if m.Command == AUTHENTICATE && len(m.Params) > 0 && m.Params[0] == "+" {
+			return true, nil
+		}
+		return saslResult(m)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Send the payload in chunks, followed by an empty chunk if the last
+	// one was full.
+	for {
+		chunk := payload
+		if len(chunk) > saslChunkLength {
+			chunk = chunk[:saslChunkLength]
+		}
+		payload = payload[len(chunk):]
+
+		if len(chunk) <= 0 {
+			chunk = "+"
+		}
+
+		if err = c.Encode(&Message{Command: AUTHENTICATE, Params: []string{chunk}}); err != nil {
+			return err
+		}
+
+		if len(chunk) < saslChunkLength && len(payload) <= 0 {
+			break
+		}
+	}
+
+	return c.await(func(m *Message) (bool, error) {
+		if m.Command == RPL_SASLSUCCESS {
+			return true, nil
+		}
+		return saslResult(m)
+	})
+}
+
+// requestSASL requests the sasl capability.
+func (c *Conn) requestSASL() (err error) {
+
+	if err = c.Encode(&Message{Command: CAP, Params: []string{CAP_REQ}, Trailing: "sasl"}); err != nil {
+		return err
+	}
+
+	return c.await(func(m *Message) (bool, error) {
+		if err := failure(m, "*", CAP); err != nil {
+			return true, err
+		}
+		if m.Command != CAP || len(m.Params) < 2 {
+			return false, nil
+		}
+		switch m.Params[1] {
+		case CAP_ACK:
+			return true, nil
+		case CAP_NAK:
+			return true, ErrSASLUnsupported
+		}
+		return false, nil
+	})
+}
+
+// saslResult checks m for a SASL failure, including FAIL standard replies.
+func saslResult(m *Message) (bool, error) {
+	if err := failure(m, "*", AUTHENTICATE); err != nil {
+		return true, err
+	}
+
+	switch m.Command {
+	case ERR_SASLFAIL, ERR_SASLTOOLONG, ERR_SASLABORTED, ERR_SASLALREADY, RPL_NICKLOCKED, RPL_SASLMECHS:
+		return true, &SASLError{Code: m.Command, Text: strings.TrimSpace(m.Trailing)}
+	}
+	return false, nil
+}
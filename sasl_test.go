@@ -0,0 +1,195 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// script runs a fake server that expects the given client lines, and sends the
+// server lines that follow each of them.
+func script(t *testing.T, lines map[string][]string) *Conn {
+	conn, _ := recordScript(t, lines)
+	return conn
+}
+
+// recordScript is like script, but also returns a function that waits for
+// the client to close the connection, and returns the lines it sent.
+func recordScript(t *testing.T, lines map[string][]string) (*Conn, func() []string) {
+	client, server := net.Pipe()
+	peer := NewConn(server)
+
+	var received []string
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer peer.Close()
+		for {
+			m, err := peer.Decode()
+			if err != nil {
+				return
+			}
+			received = append(received, m.String())
+
+			replies, ok := lines[m.String()]
+			if !ok {
+				t.Errorf("Unexpected line from client: %s", m.String())
+				return
+			}
+
+			for _, reply := range replies {
+				if _, err := peer.Write([]byte(reply)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	return NewConn(client), func() []string {
+		<-done
+		return received
+	}
+}
+
+func TestConn_SASLPlain(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"CAP REQ :sasl":                     {":irc.example.org CAP * ACK :sasl"},
+		"AUTHENTICATE PLAIN":                {":irc.example.org NOTICE * :Ignored", "AUTHENTICATE +"},
+		"AUTHENTICATE dXNlcgB1c2VyAHBhc3M=": {":irc.example.org 900 * * user :You are now logged in", ":irc.example.org 903 * :SASL authentication successful"},
+		"CAP END":                           nil,
+	})
+	defer conn.Close()
+
+	if err := conn.SASLPlain("user", "pass"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestConn_SASLPlain_requestCaps(t *testing.T) {
+	conn, received := recordScript(t, map[string][]string{
+		"CAP LS 302":                        {":irc.example.org CAP * LS :multi-prefix"},
+		"CAP REQ :multi-prefix":             {":irc.example.org CAP * ACK :multi-prefix"},
+		"CAP REQ :sasl":                     {":irc.example.org CAP * ACK :sasl"},
+		"AUTHENTICATE PLAIN":                {"AUTHENTICATE +"},
+		"AUTHENTICATE dXNlcgB1c2VyAHBhc3M=": {":irc.example.org 903 * :SASL authentication successful"},
+		"NICK me":                           nil,
+		"CAP END":                           nil,
+	})
+
+	if _, err := conn.RequestCaps([]string{"multi-prefix"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := conn.SASLPlain("user", "pass"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	conn.Encode(&Message{Command: NICK, Params: []string{"me"}})
+	conn.EndCaps()
+	conn.Close()
+
+	// Negotiation was left open by RequestCaps, so SASLPlain doesn't end it.
+	expected := []string{"CAP LS 302", "CAP REQ :multi-prefix", "CAP REQ :sasl", "AUTHENTICATE PLAIN", "AUTHENTICATE dXNlcgB1c2VyAHBhc3M=", "NICK me", "CAP END"}
+	if lines := received(); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Wrong lines sent:")
+		t.Logf("Output: %q", lines)
+		t.Logf("Expected: %q", expected)
+	}
+}
+
+func TestConn_SASLPlain_failed(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"CAP REQ :sasl":                     {":irc.example.org CAP * ACK :sasl"},
+		"AUTHENTICATE PLAIN":                {"AUTHENTICATE +"},
+		"AUTHENTICATE dXNlcgB1c2VyAHBhc3M=": {":irc.example.org 904 * :SASL authentication failed"},
+		"CAP END":                           nil,
+	})
+	defer conn.Close()
+
+	err := conn.SASLPlain("user", "pass")
+	if !reflect.DeepEqual(err, &SASLError{Code: ERR_SASLFAIL, Text: "SASL authentication failed"}) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestConn_SASLPlain_fail(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"CAP REQ :sasl":      {":irc.example.org CAP * ACK :sasl"},
+		"AUTHENTICATE PLAIN": {":irc.example.org FAIL AUTHENTICATE MECH_UNAVAILABLE :PLAIN is disabled"},
+		"CAP END":            nil,
+	})
+	defer conn.Close()
+
+	err := conn.SASLPlain("user", "pass")
+	if r, ok := err.(*StandardReply); !ok || r.Code != "MECH_UNAVAILABLE" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestConn_SASLPlain_unsupported(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"CAP REQ :sasl": {":irc.example.org CAP * NAK :sasl"},
+		"CAP END":       nil,
+	})
+	defer conn.Close()
+
+	if err := conn.SASLPlain("user", "pass"); err != ErrSASLUnsupported {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestConn_SASLPlain_timeout(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"CAP REQ :sasl": nil,
+		"CAP END":       nil,
+	})
+	defer conn.Close()
+
+	conn.SetTimeout(10 * time.Millisecond)
+
+	if err := conn.SASLPlain("user", "pass"); err != ErrTimeout {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestConn_sasl_chunks(t *testing.T) {
+	long := make([]byte, 800)
+	for i := range long {
+		long[i] = 'A'
+	}
+
+	conn := script(t, map[string][]string{
+		"CAP REQ :sasl":                      {":irc.example.org CAP * ACK :sasl"},
+		"AUTHENTICATE TEST":                  {"AUTHENTICATE +"},
+		"AUTHENTICATE " + string(long[:400]): nil,
+		"AUTHENTICATE +":                     {":irc.example.org 903 * :SASL authentication successful"},
+		"CAP END":                            nil,
+	})
+	defer conn.Close()
+
+	if err := conn.sasl("TEST", string(long)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestConn_SASLExternal(t *testing.T) {
+	conn := script(t, map[string][]string{
+		"CAP REQ :sasl":         {":irc.example.org CAP * ACK :sasl"},
+		"AUTHENTICATE EXTERNAL": {"AUTHENTICATE +"},
+		"AUTHENTICATE +":        {":irc.example.org 900 * * user :You are now logged in", ":irc.example.org 903 * :SASL authentication successful"},
+		"CAP END":               nil,
+	})
+	defer conn.Close()
+
+	// The exchange itself, as SASLExternal refuses to use a plaintext pipe.
+	if err := conn.SASLExternal(); err != ErrSASLNotTLS {
+		t.Fatalf("Expected ErrSASLNotTLS, got: %v", err)
+	}
+	if err := conn.sasl("EXTERNAL", ""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
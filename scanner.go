@@ -0,0 +1,66 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"io"
+)
+
+// A MessageScanner reads messages using a Decoder, like bufio.Scanner reads
+// lines:
+//
+//    s := irc.NewMessageScanner(dec)
+//    for s.Scan() {
+//        m := s.Message()
+//        ...
+//    }
+//    if err := s.Err(); err != nil {
+//        ...
+//    }
+type MessageScanner struct {
+	dec *Decoder
+	msg *Message
+	err error
+}
+
+// NewMessageScanner returns a new MessageScanner reading from dec.
+func NewMessageScanner(dec *Decoder) *MessageScanner {
+	return &MessageScanner{dec: dec}
+}
+
+// Scan reads the next message, which is then available using Message.
+// Empty lines are skipped. Returns false when reading stops, because the end
+// of the input was reached or an error occurred. After Scan returns false,
+// Err returns the error, or nil if it was io.EOF.
+func (s *MessageScanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+
+	for {
+		m, err := s.dec.Decode()
+		if err != nil {
+			s.msg, s.err = nil, err
+			return false
+		}
+		if m != nil {
+			s.msg = m
+			return true
+		}
+	}
+}
+
+// Message returns the message read by the last call to Scan.
+func (s *MessageScanner) Message() *Message {
+	return s.msg
+}
+
+// Err returns the first error that occurred while scanning, except io.EOF.
+func (s *MessageScanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
@@ -0,0 +1,56 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMessageScanner(t *testing.T) {
+	s := NewMessageScanner(NewDecoder(strings.NewReader("PING :a\r\n\r\nPING :b\r\n")))
+
+	var messages []string
+	for s.Scan() {
+		messages = append(messages, s.Message().Trailing)
+	}
+
+	if len(messages) != 2 || messages[0] != "a" || messages[1] != "b" {
+		t.Errorf("Wrong messages: %v", messages)
+	}
+	if err := s.Err(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if s.Scan() || s.Message() != nil {
+		t.Error("Scan should keep returning false.")
+	}
+}
+
+func TestMessageScanner_error(t *testing.T) {
+	failure := errors.New("failure")
+	r := io.MultiReader(strings.NewReader("PING :a\r\n"), &errorReader{failure})
+	s := NewMessageScanner(NewDecoder(r))
+
+	if !s.Scan() || s.Message().Trailing != "a" {
+		t.Fatal("Failed to scan the first message.")
+	}
+	if s.Scan() {
+		t.Error("Scan should return false on errors.")
+	}
+	if err := s.Err(); err != failure {
+		t.Errorf("Wrong error: %v", err)
+	}
+}
+
+// errorReader fails every Read with err.
+type errorReader struct {
+	err error
+}
+
+func (r *errorReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
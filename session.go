@@ -0,0 +1,168 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"sync"
+)
+
+// A Session is a ReconnectConn that registers every new connection the same
+// way, and remembers what the server told us about the session, so it stays
+// available while the connection is replaced:
+//
+//    session, err := irc.NewSession(func() (*irc.Conn, error) {
+//        return irc.Dial("irc.example.org:6667")
+//    }, policy, "nick", "user", "Real Name", []string{"multi-prefix"})
+//
+//    for {
+//        m, err := session.Decode()
+//        ...
+//        fmt.Println(session.Nick(), session.Caps())
+//    }
+//
+// Every connection returned by dial negotiates the given capabilities and is
+// registered using RegisterNicks, trying alternatives if the nick is taken,
+// before it is used. The dial function may configure each Conn further, for
+// example using HandlePing.
+//
+// Nick and Caps reflect the current connection as soon as it's registered.
+// ISupport keeps returning the features of the previous connection until the
+// new one has sent all of them, at the end of the MOTD.
+//
+// The views are updated by Decode, so they change as the messages read are
+// processed. A Session may be used from multiple goroutines.
+type Session struct {
+	*ReconnectConn
+
+	nick     string
+	user     string
+	realname string
+	pass     []string
+	wanted   []string // Capabilities to request
+
+	mu          sync.Mutex
+	current     string   // Confirmed nick
+	caps        []string // Enabled capabilities
+	support     ISupport // Features advertised by supportConn
+	supportConn *Conn    // Connection support was learned from
+}
+
+// NewSession dials a new connection and registers with the given nick,
+// username and real name, after requesting caps. The password is optional.
+//
+// Returns an error if the first connection could not be established or
+// registered. Later connections that can't be registered are treated like
+// failed dials, see ReconnectConn.
+func NewSession(dial func() (*Conn, error), policy BackoffPolicy, nick, user, realname string, caps []string, pass ...string) (*Session, error) {
+	s := &Session{
+		nick:     nick,
+		user:     user,
+		realname: realname,
+		pass:     pass,
+		wanted:   caps,
+	}
+
+	r, err := NewReconnectConn(func() (*Conn, error) {
+		return s.register(dial)
+	}, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	s.ReconnectConn = r
+	s.supportConn = r.Conn()
+	return s, nil
+}
+
+// register dials a connection and registers it.
+func (s *Session) register(dial func() (*Conn, error)) (*Conn, error) {
+	conn, err := dial()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.wanted) > 0 {
+		if _, err = conn.NegotiateCaps(s.wanted); err != nil {
+			if _, rejected := err.(*CapError); !rejected {
+				conn.Close()
+				return nil, err
+			}
+		}
+	}
+
+	nick, err := conn.RegisterNicks(AlternativeNicks(s.nick, clientAltNicks), s.user, s.realname, s.pass...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.current = nick
+	s.caps = conn.EnabledCaps()
+	s.mu.Unlock()
+
+	return conn, nil
+}
+
+// Decode reads a single Message like ReconnectConn.Decode does, and updates
+// the session using it.
+func (s *Session) Decode() (*Message, error) {
+	m, err := s.ReconnectConn.Decode()
+	if err != nil || m == nil {
+		return m, err
+	}
+
+	conn := s.Conn()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch m.Command {
+	case RPL_ENDOFMOTD, ERR_NOMOTD:
+		if conn != s.supportConn {
+			s.supportConn = conn
+			s.support = conn.ISupport()
+		}
+	case RPL_ISUPPORT:
+		if conn == s.supportConn {
+			s.support = conn.ISupport()
+		}
+	case CAP:
+		s.caps = conn.EnabledCaps()
+	case NICK:
+		if nick := conn.CurrentNick(); len(nick) > 0 {
+			s.current = nick
+		}
+	}
+
+	return m, nil
+}
+
+// Nick returns our nick, as confirmed by the server.
+func (s *Session) Nick() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+// Caps returns the enabled capabilities, sorted by name.
+func (s *Session) Caps() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.caps...)
+}
+
+// ISupport returns a copy of the features advertised by the server using
+// RPL_ISUPPORT.
+func (s *Session) ISupport() ISupport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	features := ISupport{Tokens: make(map[string]string, len(s.support.Tokens))}
+	for token, value := range s.support.Tokens {
+		features.Tokens[token] = value
+	}
+	return features
+}
@@ -0,0 +1,84 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSession(t *testing.T) {
+	dials := 0
+	dial := func() (*Conn, error) {
+		if dials++; dials == 1 {
+			return script(t, map[string][]string{
+				"CAP LS 302":             {":irc.example.org CAP * LS :multi-prefix"},
+				"CAP REQ :multi-prefix":  {":irc.example.org CAP * ACK :multi-prefix"},
+				"CAP END":                nil,
+				"NICK sorcix":            nil,
+				"USER sorcix 0 * :Vic D": {":irc.example.org 001 sorcix :Welcome", ":irc.example.org 005 sorcix NETWORK=First :are supported", ":irc.example.org 376 sorcix :End of MOTD"},
+			}), nil
+		}
+		return script(t, map[string][]string{
+			"CAP LS 302":             {":irc.example.org CAP * LS :away-notify"},
+			"CAP END":                nil,
+			"NICK sorcix":            nil,
+			"USER sorcix 0 * :Vic D": {":irc.example.org 433 * sorcix :Nickname is already in use"},
+			"NICK sorcix_":           {":irc.example.org 001 sorcix_ :Welcome", ":irc.example.org 005 sorcix_ NETWORK=Second :are supported"},
+			"PRIVMSG #channel :hi":   {":irc.example.org 376 sorcix_ :End of MOTD"},
+		}), nil
+	}
+
+	s, err := NewSession(dial, BackoffPolicy{Min: time.Millisecond}, "sorcix", "sorcix", "Vic D", []string{"multi-prefix"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer s.Close()
+
+	network := func() string {
+		features := s.ISupport()
+		value, _ := features.Get("NETWORK")
+		return value
+	}
+
+	if s.Nick() != "sorcix" || !reflect.DeepEqual(s.Caps(), []string{"multi-prefix"}) {
+		t.Errorf("Wrong session after registering: %q, %q", s.Nick(), s.Caps())
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := s.Decode(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if network() != "First" {
+		t.Errorf("Wrong ISUPPORT: %q", network())
+	}
+
+	// The next Decode reconnects, registering with an alternative nick.
+	s.Conn().Close()
+
+	if m, err := s.Decode(); err != nil || m.Command != RPL_ISUPPORT {
+		t.Fatalf("Unexpected message after reconnecting: %v, %v", m, err)
+	}
+	if dials != 2 {
+		t.Fatalf("Wrong number of dials: %d", dials)
+	}
+	if s.Nick() != "sorcix_" || len(s.Caps()) != 0 {
+		t.Errorf("Wrong session after reconnecting: %q, %q", s.Nick(), s.Caps())
+	}
+	if network() != "First" {
+		t.Errorf("ISUPPORT should be kept until the end of the MOTD: %q", network())
+	}
+
+	if err := s.Encode(&Message{Command: PRIVMSG, Params: []string{"#channel"}, Trailing: "hi"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m, err := s.Decode(); err != nil || m.Command != RPL_ENDOFMOTD {
+		t.Fatalf("Expected the end of the MOTD: %v, %v", m, err)
+	}
+	if network() != "Second" {
+		t.Errorf("ISUPPORT should be replaced after the MOTD: %q", network())
+	}
+}
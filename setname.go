@@ -0,0 +1,49 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"errors"
+)
+
+// ErrNameTooLong is returned by SetName if the real name is longer than
+// NAMELEN, as advertised by the server.
+var ErrNameTooLong = errors.New("irc: real name too long")
+
+// SetName changes our real name using the IRCv3 setname capability, which
+// must be enabled first:
+//
+//    SETNAME :New Real Name
+//
+// Returns ErrInvalidParam if realname is empty, or ErrNameTooLong if it is
+// longer than NAMELEN.
+func (c *Conn) SetName(realname string) error {
+	if len(realname) <= 0 {
+		return ErrInvalidParam
+	}
+
+	c.mu.Lock()
+	n, ok := c.support.NameLen()
+	c.mu.Unlock()
+
+	if ok && len(realname) > n {
+		return ErrNameTooLong
+	}
+
+	return c.Encode(&Message{Command: SETNAME, Trailing: realname})
+}
+
+// ParseSetName returns the nick and new real name of a user in a SETNAME
+// message sent by the server:
+//
+//    :nick!user@host SETNAME :New Real Name
+//
+// Returns false if m is not a SETNAME message from a user.
+func ParseSetName(m *Message) (nick, realname string, ok bool) {
+	if m.Command != SETNAME || m.Prefix == nil || len(m.Prefix.Name) <= 0 {
+		return "", "", false
+	}
+	return m.Prefix.Name, firstParam(m), true
+}
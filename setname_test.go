@@ -0,0 +1,46 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConn_SetName(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(&readWriter{strings.NewReader(":irc.example.org 005 me NAMELEN=10 :are supported by this server\r\n"), buffer})
+
+	if err := conn.SetName(""); err != ErrInvalidParam {
+		t.Errorf("Expected ErrInvalidParam, got: %v", err)
+	}
+
+	conn.SetName("Long Real Name")
+	conn.Decode()
+	conn.SetName("Short Name")
+
+	if err := conn.SetName("Long Real Name"); err != ErrNameTooLong {
+		t.Errorf("Expected ErrNameTooLong, got: %v", err)
+	}
+
+	if buffer.String() != "SETNAME :Long Real Name\r\nSETNAME :Short Name\r\n" {
+		t.Errorf("Commands were not encoded correctly:\n%s", buffer.String())
+	}
+}
+
+func TestParseSetName(t *testing.T) {
+	if nick, realname, ok := ParseSetName(ParseMessage(":nick!user@host SETNAME :New Real Name")); nick != "nick" || realname != "New Real Name" || !ok {
+		t.Errorf("Unexpected result: %q, %q, %v", nick, realname, ok)
+	}
+	if nick, realname, ok := ParseSetName(ParseMessage(":nick!user@host SETNAME Name")); nick != "nick" || realname != "Name" || !ok {
+		t.Errorf("Unexpected result: %q, %q, %v", nick, realname, ok)
+	}
+	if _, _, ok := ParseSetName(ParseMessage("SETNAME :New Real Name")); ok {
+		t.Error("Messages without prefix should be rejected")
+	}
+	if _, _, ok := ParseSetName(ParseMessage(":nick!user@host NICK other")); ok {
+		t.Error("Other commands should be rejected")
+	}
+}
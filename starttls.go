@@ -0,0 +1,107 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"net"
+)
+
+var (
+	// ErrStartTLSUnsupported is returned by StartTLS if the connection is not
+	// a plaintext net.Conn.
+	ErrStartTLSUnsupported = errors.New("irc: STARTTLS requires a plaintext net.Conn")
+
+	// ErrStartTLSFailed is returned by StartTLS if the server refused to
+	// start TLS.
+	ErrStartTLSFailed = errors.New("irc: server refused STARTTLS")
+
+	// ErrStartTLSData is returned by StartTLS if the server sent data after
+	// agreeing to start TLS, which could be injected by an attacker.
+	ErrStartTLSData = errors.New("irc: unexpected plaintext data after RPL_STARTTLS")
+)
+
+// StartTLS upgrades a plaintext connection to TLS using the STARTTLS command,
+// during registration and before sending any credentials. A nil config uses
+// the default configuration, which requires the ServerName or
+// InsecureSkipVerify to be set, so use DialTLS if possible.
+//
+// Returns ErrStartTLSFailed if the server refused using ERR_STARTTLS or does
+// not know the command, and ErrStartTLSData if anything was received after
+// RPL_STARTTLS, before the handshake. The connection should be closed after
+// any error.
+//
+// Like SASLPlain it reads from the connection itself until done or the
+// timeout set by SetTimeout expires. Decode and Encode must not be used
+// during the upgrade.
+func (c *Conn) StartTLS(config *tls.Config) error {
+	plain, ok := c.conn.(net.Conn)
+	if _, isWebSocket := c.conn.(*wsConn); isWebSocket {
+		return ErrStartTLSUnsupported
+	}
+	if _, isTLS := c.conn.(*tls.Conn); !ok || isTLS {
+		return ErrStartTLSUnsupported
+	}
+
+	if err := c.Encode(&Message{Command: STARTTLS}); err != nil {
+		return err
+	}
+	if err := c.Flush(); err != nil {
+		return err
+	}
+
+	err := c.await(func(m *Message) (bool, error) {
+		switch m.Command {
+		case RPL_STARTTLS:
+			// :irc.example.org 670 * :STARTTLS successful, proceed with TLS handshake
+			return true, nil
+		case ERR_STARTTLS:
+			return true, ErrStartTLSFailed
+		case ERR_UNKNOWNCOMMAND:
+			if m.param(1) == STARTTLS {
+				return true, ErrStartTLSFailed
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Buffered plaintext would otherwise be decoded as if it was encrypted.
+	c.Decoder.mu.Lock()
+	defer c.Decoder.mu.Unlock()
+
+	if c.Decoder.reader.Buffered() > 0 {
+		return ErrStartTLSData
+	}
+
+	if config == nil {
+		config = new(tls.Config)
+	}
+
+	secure := tls.Client(plain, config)
+	if err = secure.Handshake(); err != nil {
+		return err
+	}
+
+	// Keep the buffer sizes chosen using NewConnSize.
+	c.Encoder.mu.Lock()
+	if w, ok := c.Encoder.writer.(*bufio.Writer); ok {
+		w.Reset(secure)
+	} else {
+		c.Encoder.writer = secure
+	}
+	c.Encoder.deadliner = secure
+	c.Encoder.mu.Unlock()
+
+	c.Decoder.reader.Reset(secure)
+	c.Decoder.deadliner = secure
+	c.conn = secure
+
+	return nil
+}
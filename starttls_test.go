@@ -0,0 +1,93 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// startTLSServer answers STARTTLS with the given reply, written at once, and
+// upgrades the connection if it is a single RPL_STARTTLS. Then it answers a
+// PING.
+func startTLSServer(t *testing.T, reply string) (*Conn, *tls.Config) {
+	certs := httptest.NewUnstartedServer(nil)
+	certs.StartTLS()
+	certs.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(certs.Certificate())
+
+	client, server := net.Pipe()
+
+	go func() {
+		defer server.Close()
+
+		peer := NewConn(server)
+		if m, err := peer.Decode(); err != nil || m.Command != STARTTLS {
+			t.Errorf("Expected STARTTLS, got: %v, %v", m, err)
+			return
+		}
+		if _, err := server.Write([]byte(reply)); err != nil {
+			return
+		}
+		if ParseMessage(reply).Command != RPL_STARTTLS || strings.Count(reply, "\n") > 1 {
+			return
+		}
+
+		secure := tls.Server(server, certs.TLS)
+		peer = NewConn(secure)
+		if m, err := peer.Decode(); err == nil && m.Command == PING {
+			peer.Encode(&Message{Command: PONG, Trailing: m.Trailing})
+		}
+	}()
+
+	return NewConn(client), &tls.Config{RootCAs: pool, ServerName: "example.com"}
+}
+
+func TestConn_StartTLS(t *testing.T) {
+	conn, config := startTLSServer(t, ":irc.example.org 670 * :STARTTLS successful, proceed with TLS handshake\r\n")
+	defer conn.Close()
+
+	if err := conn.StartTLS(config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if state, ok := conn.TLSConnectionState(); !ok || !state.HandshakeComplete {
+		t.Fatal("Expected a completed TLS handshake!")
+	}
+
+	if err := conn.Encode(&Message{Command: PING, Trailing: "secure"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m, err := conn.Decode(); err != nil || m.Command != PONG || m.Trailing != "secure" {
+		t.Errorf("Unexpected result: %v, %v", m, err)
+	}
+
+	if err := conn.StartTLS(config); err != ErrStartTLSUnsupported {
+		t.Errorf("Expected ErrStartTLSUnsupported, got: %v", err)
+	}
+}
+
+func TestConn_StartTLS_refused(t *testing.T) {
+	conn, config := startTLSServer(t, ":irc.example.org 691 * :STARTTLS failed (Wrong moon phase)\r\n")
+	defer conn.Close()
+
+	if err := conn.StartTLS(config); err != ErrStartTLSFailed {
+		t.Errorf("Expected ErrStartTLSFailed, got: %v", err)
+	}
+}
+
+func TestConn_StartTLS_injected(t *testing.T) {
+	conn, config := startTLSServer(t, ":irc.example.org 670 * :STARTTLS successful\r\n:evil PRIVMSG you :injected\r\n")
+	defer conn.Close()
+
+	if err := conn.StartTLS(config); err != ErrStartTLSData {
+		t.Errorf("Expected ErrStartTLSData, got: %v", err)
+	}
+}
@@ -0,0 +1,597 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// State tracks the channels we're in and the users present in them, using
+// the membership messages received from the server. The membership prefixes
+// of users, like "@" for operators, are updated using RPL_NAMREPLY and MODE.
+//
+// A NAMES reply may span many RPL_NAMREPLY messages. They are collected per
+// channel, replacing the members only at RPL_ENDOFNAMES, so Users never
+// returns a partial list. Replies for different channels may interleave.
+//
+// With the account-tag and extended-join capabilities, or account-notify, the
+// accounts users are logged in to are tracked as well. Real names are learned
+// from extended-join and setname, and away messages from away-notify.
+// Hostmasks are learned from the prefixes of messages sent by users, and
+// updated by chghost. Channel topics are learned from RPL_TOPIC and
+// RPL_TOPICWHOTIME when joining, and from TOPIC changes.
+//
+// Nicks and channel names are compared using the casemapping advertised in
+// RPL_ISUPPORT, rfc1459 until then. The zero value is an empty State ready to
+// use. A State may be used from multiple goroutines.
+type State struct {
+	mu       sync.RWMutex
+	mapping  CaseMapping
+	support  ISupport                        // Features advertised by the server
+	nick     string                          // Our own nick
+	channels map[string]*channelState        // Channels we're in, by folded name
+	names    map[string]map[string]NamedUser // Incomplete RPL_NAMREPLY lists
+	details  map[string]userDetails          // Accounts, real names and away messages by folded nick
+}
+
+// userDetails holds what we know about a user besides channel membership.
+type userDetails struct {
+	nick     string
+	account  string
+	realname string
+	away     string // Away message, empty if not away
+	user     string
+	host     string
+}
+
+// unknown returns true if nothing is known about the user.
+func (d userDetails) unknown() bool {
+	return len(d.account) <= 0 && len(d.realname) <= 0 && len(d.away) <= 0 &&
+		len(d.user) <= 0 && len(d.host) <= 0
+}
+
+// channelState contains the users in a single channel.
+type channelState struct {
+	name  string
+	users map[string]NamedUser // Members by folded nick
+	topic Topic
+}
+
+// Update changes the state using m, which may be any message received from
+// the server. Returns false if m did not affect the state.
+//
+// Our own nick is learned from RPL_WELCOME, so the State should see every
+// message from the start of the connection.
+func (s *State) Update(m *Message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.channels == nil {
+		s.channels = make(map[string]*channelState)
+	}
+
+	var nick string
+	if m.Prefix != nil {
+		nick = m.Prefix.Name
+	}
+
+	// @account=name :nick!user@host PRIVMSG #channel :Hello
+	changed := false
+	if account, ok := m.Tags["account"]; ok && len(nick) > 0 && (s.isMe(nick) || s.shared(s.fold(nick))) {
+		changed = s.setAccount(nick, account)
+	}
+	if m.Prefix != nil && m.IsHostmask() && (s.isMe(nick) || s.shared(s.fold(nick))) {
+		changed = s.setHost(nick, m.User, m.Host) || changed
+	}
+
+	switch m.Command {
+	case RPL_WELCOME:
+		s.nick = m.param(0)
+
+	case RPL_ISUPPORT:
+		var features ISupport
+		if !features.Update(m) {
+			return false
+		}
+		s.support.Update(m)
+		if features.Has("CASEMAPPING") {
+			s.setCaseMapping(features.CaseMapping())
+		}
+
+	case JOIN:
+		for _, channel := range strings.Split(firstParam(m), ",") {
+			s.join(channel, nick)
+		}
+		if m.Prefix != nil && m.IsHostmask() && s.shared(s.fold(nick)) {
+			s.setHost(nick, m.User, m.Host)
+		}
+		if account, ok := m.Tags["account"]; ok && s.shared(s.fold(nick)) {
+			s.setAccount(nick, account)
+		}
+
+		// Extended join: :nick!user@host JOIN #channel account :Real Name
+		if len(m.Params) > 1 {
+			s.setAccount(nick, m.Params[1])
+			s.setRealName(nick, m.Trailing)
+		}
+
+	case PART:
+		for _, channel := range strings.Split(firstParam(m), ",") {
+			s.part(channel, nick)
+		}
+		s.pruneDetails()
+
+	case KICK:
+		s.part(m.param(0), m.param(1))
+		s.pruneDetails()
+
+	case QUIT:
+		for _, c := range s.channels {
+			delete(c.users, s.fold(nick))
+		}
+		for _, list := range s.names {
+			delete(list, s.fold(nick))
+		}
+		delete(s.details, s.fold(nick))
+
+	case MODE:
+		// :op!op@example.org MODE #channel +ov nick1 nick2
+		params := m.allParams()
+		if len(params) < 2 {
+			return false
+		}
+		c, ok := s.channels[s.fold(params[0])]
+		if !ok {
+			return changed
+		}
+		s.setModes(c, ParseModeChange(params[1], params[2:], s.support))
+
+	case ACCOUNT:
+		// :nick!user@host ACCOUNT account
+		s.setAccount(nick, firstParam(m))
+
+	case NICK:
+		s.rename(nick, firstParam(m))
+
+	case AWAY:
+		// :nick!user@host AWAY :Gone fishing
+		if !s.isMe(nick) && !s.shared(s.fold(nick)) {
+			return changed
+		}
+		return s.setAway(nick, m.Trailing) || changed
+
+	case CHGHOST:
+		// :nick!user@host CHGHOST newuser newhost
+		params := m.allParams()
+		if len(params) < 2 || (!s.isMe(nick) && !s.shared(s.fold(nick))) {
+			return changed
+		}
+		return s.setHost(nick, params[0], params[1]) || changed
+
+	case RPL_AWAY:
+		// :irc.example.org 301 me nick :Gone fishing
+		if !s.shared(s.fold(m.param(1))) {
+			return false
+		}
+		return s.setAway(m.param(1), m.Trailing)
+
+	case SETNAME:
+		// :nick!user@host SETNAME :New Real Name
+		if !s.isMe(nick) && !s.shared(s.fold(nick)) {
+			return changed
+		}
+		return s.setRealName(nick, firstParam(m)) || changed
+
+	case TOPIC, RPL_TOPIC, RPL_NOTOPIC, RPL_TOPICWHOTIME:
+		channel, topic, ok := ParseTopic(m)
+		if !ok {
+			return changed
+		}
+		c, ok := s.channels[s.fold(channel)]
+		if !ok {
+			return changed
+		}
+		if m.Command == RPL_TOPICWHOTIME {
+			// Follows RPL_TOPIC, which has the text.
+			c.topic.SetBy, c.topic.SetAt = topic.SetBy, topic.SetAt
+		} else {
+			c.topic = topic
+		}
+
+	case RPL_NAMREPLY:
+		// :irc.example.org 353 nick = #channel :@op +voice user
+		channel := m.param(2)
+		if len(m.allParams()) == 3 {
+			// Some servers omit the channel type: 353 nick #channel :user
+			channel = m.param(1)
+		}
+		key := s.fold(channel)
+		if _, ok := s.channels[key]; !ok {
+			return false
+		}
+		if s.names == nil {
+			s.names = make(map[string]map[string]NamedUser)
+		}
+		if s.names[key] == nil {
+			s.names[key] = make(map[string]NamedUser)
+		}
+		_, symbols := s.support.Prefixes()
+		for _, user := range ParseNames(m, symbols) {
+			s.names[key][s.fold(user.Nick)] = user
+		}
+
+	case RPL_ENDOFNAMES:
+		key := s.fold(m.param(1))
+		c, ok := s.channels[key]
+		if !ok {
+			return false
+		}
+		c.users = s.names[key]
+		if c.users == nil {
+			c.users = make(map[string]NamedUser)
+		}
+		delete(s.names, key)
+
+	default:
+		return changed
+	}
+
+	return true
+}
+
+// SetCaseMapping changes the casemapping used to compare names. This is only
+// needed if the State does not see the RPL_ISUPPORT messages.
+func (s *State) SetCaseMapping(mapping CaseMapping) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.setCaseMapping(mapping)
+}
+
+// setCaseMapping changes the casemapping, folding known names again.
+func (s *State) setCaseMapping(mapping CaseMapping) {
+	s.mapping = mapping
+
+	channels := make(map[string]*channelState, len(s.channels))
+	names := make(map[string]map[string]NamedUser, len(s.names))
+
+	for key, c := range s.channels {
+		c.users = s.refold(c.users)
+		channels[s.fold(c.name)] = c
+
+		if list, ok := s.names[key]; ok {
+			names[s.fold(c.name)] = s.refold(list)
+		}
+	}
+
+	details := make(map[string]userDetails, len(s.details))
+	for _, d := range s.details {
+		details[s.fold(d.nick)] = d
+	}
+
+	s.channels, s.names, s.details = channels, names, details
+}
+
+// refold returns a copy of users, using the current casemapping for keys.
+func (s *State) refold(users map[string]NamedUser) map[string]NamedUser {
+	folded := make(map[string]NamedUser, len(users))
+	for _, user := range users {
+		folded[s.fold(user.Nick)] = user
+	}
+	return folded
+}
+
+// join adds nick to channel.
+func (s *State) join(channel, nick string) {
+	key := s.fold(channel)
+
+	c, ok := s.channels[key]
+	if !ok {
+		if !s.isMe(nick) {
+			return
+		}
+		c = &channelState{name: channel, users: make(map[string]NamedUser)}
+		s.channels[key] = c
+	}
+
+	c.users[s.fold(nick)] = NamedUser{Nick: nick}
+	if list, ok := s.names[key]; ok {
+		list[s.fold(nick)] = NamedUser{Nick: nick}
+	}
+}
+
+// part removes nick from channel, or the whole channel if we left.
+func (s *State) part(channel, nick string) {
+	key := s.fold(channel)
+
+	if s.isMe(nick) {
+		delete(s.channels, key)
+		delete(s.names, key)
+		return
+	}
+
+	if c, ok := s.channels[key]; ok {
+		delete(c.users, s.fold(nick))
+	}
+	delete(s.names[key], s.fold(nick))
+}
+
+// rename changes a nick in every channel.
+func (s *State) rename(from, to string) {
+	if s.isMe(from) {
+		s.nick = to
+	}
+
+	for _, c := range s.channels {
+		renameUser(c.users, s.fold(from), s.fold(to), to)
+	}
+	for _, list := range s.names {
+		renameUser(list, s.fold(from), s.fold(to), to)
+	}
+
+	if d, ok := s.details[s.fold(from)]; ok {
+		delete(s.details, s.fold(from))
+		d.nick = to
+		s.details[s.fold(to)] = d
+	}
+}
+
+// renameUser moves the user at key from in users to key to, with nick as
+// the new nick.
+func renameUser(users map[string]NamedUser, from, to, nick string) {
+	if user, ok := users[from]; ok {
+		delete(users, from)
+		user.Nick = nick
+		users[to] = user
+	}
+}
+
+// setModes updates the membership prefixes of users in c.
+func (s *State) setModes(c *channelState, deltas []ModeDelta) {
+	modes, symbols := s.support.Prefixes()
+
+	for _, delta := range deltas {
+		i := strings.IndexRune(modes, delta.Mode)
+		if i < 0 || i >= len(symbols) {
+			continue
+		}
+		if user, ok := c.users[s.fold(delta.Arg)]; ok {
+			user.Prefixes = setPrefix(user.Prefixes, symbols, symbols[i], delta.Add)
+			c.users[s.fold(delta.Arg)] = user
+		}
+	}
+}
+
+// setAccount records the account of nick, where "*" means logged out.
+// Returns true if the account changed.
+func (s *State) setAccount(nick, account string) bool {
+	if account == "*" {
+		account = ""
+	}
+	return s.setDetails(nick, func(d *userDetails) {
+		d.account = account
+	})
+}
+
+// setRealName records the real name of nick. Returns true if it changed.
+func (s *State) setRealName(nick, realname string) bool {
+	return s.setDetails(nick, func(d *userDetails) {
+		d.realname = realname
+	})
+}
+
+// setAway records the away message of nick, where an empty message means the
+// user is back. Returns true if it changed.
+func (s *State) setAway(nick, message string) bool {
+	return s.setDetails(nick, func(d *userDetails) {
+		d.away = message
+	})
+}
+
+// setHost records the user and host of nick. Returns true if they changed.
+func (s *State) setHost(nick, user, host string) bool {
+	return s.setDetails(nick, func(d *userDetails) {
+		d.user, d.host = user, host
+	})
+}
+
+// setDetails changes what we know about nick using fn, and forgets the user
+// if nothing is left. Returns true if anything changed.
+func (s *State) setDetails(nick string, fn func(d *userDetails)) bool {
+	key := s.fold(nick)
+	previous := s.details[key]
+
+	d := previous
+	d.nick = nick
+	fn(&d)
+
+	if d.unknown() {
+		delete(s.details, key)
+	} else {
+		if s.details == nil {
+			s.details = make(map[string]userDetails)
+		}
+		s.details[key] = d
+	}
+
+	d.nick = previous.nick
+	return d != previous
+}
+
+// pruneDetails forgets the details of users we don't share a channel with,
+// as we won't be told about changes.
+func (s *State) pruneDetails() {
+	for key := range s.details {
+		if !s.shared(key) && !s.isMe(key) {
+			delete(s.details, key)
+		}
+	}
+}
+
+// shared returns true if the user with the folded nick is in one of our
+// channels.
+func (s *State) shared(key string) bool {
+	for _, c := range s.channels {
+		if _, ok := c.users[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isMe returns true if nick is our own nick.
+func (s *State) isMe(nick string) bool {
+	return len(s.nick) > 0 && s.fold(nick) == s.fold(s.nick)
+}
+
+// fold returns the name used to compare nicks and channels.
+func (s *State) fold(name string) string {
+	return s.mapping.Fold(name)
+}
+
+// Nick returns our own nick, or an empty string if we're not registered yet.
+func (s *State) Nick() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.nick
+}
+
+// Channels returns the channels we're in, sorted by name.
+func (s *State) Channels() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	channels := make([]string, 0, len(s.channels))
+	for _, c := range s.channels {
+		channels = append(channels, c.name)
+	}
+	sort.Strings(channels)
+
+	return channels
+}
+
+// Users returns the nicks present in channel, sorted by name. Returns nil if
+// we're not in the channel.
+func (s *State) Users(channel string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.channels[s.fold(channel)]
+	if !ok {
+		return nil
+	}
+
+	users := make([]string, 0, len(c.users))
+	for _, user := range c.users {
+		users = append(users, user.Nick)
+	}
+	sort.Strings(users)
+
+	return users
+}
+
+// Members is like Users, but includes the membership prefixes of every user.
+func (s *State) Members(channel string) []NamedUser {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.channels[s.fold(channel)]
+	if !ok {
+		return nil
+	}
+
+	users := make([]NamedUser, 0, len(c.users))
+	for _, user := range c.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Nick < users[j].Nick })
+
+	return users
+}
+
+// Topic returns the topic of channel. Returns false if no topic is set, or
+// we're not in the channel.
+func (s *State) Topic(channel string) (Topic, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.channels[s.fold(channel)]
+	if !ok || len(c.topic.Text) <= 0 {
+		return Topic{}, false
+	}
+	return c.topic, true
+}
+
+// InChannel returns true if nick is present in channel.
+func (s *State) InChannel(nick, channel string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.channels[s.fold(channel)]
+	if !ok {
+		return false
+	}
+
+	_, ok = c.users[s.fold(nick)]
+	return ok
+}
+
+// Account returns the account nick is logged in to. Returns false if the user
+// is not logged in, or we don't know. Unlike nicks, accounts are verified by
+// the server, so they can be trusted to identify users.
+func (s *State) Account(nick string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d := s.details[s.fold(nick)]
+	return d.account, len(d.account) > 0
+}
+
+// Away returns the away message of nick, as learned from AWAY messages sent
+// with the away-notify capability, or RPL_AWAY. Returns false if the user is
+// not away, or we don't know.
+func (s *State) Away(nick string) (reason string, away bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d := s.details[s.fold(nick)]
+	return d.away, len(d.away) > 0
+}
+
+// Hostmask returns the nick!user@host of nick, as learned from the prefixes
+// of messages sent by the user and CHGHOST messages. Returns false if we
+// don't know it.
+func (s *State) Hostmask(nick string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d := s.details[s.fold(nick)]
+	if len(d.user) <= 0 || len(d.host) <= 0 {
+		return "", false
+	}
+	return (&Prefix{Name: d.nick, User: d.user, Host: d.host}).String(), true
+}
+
+// RealName returns the real name of nick, as learned from extended-join or
+// SETNAME messages. Returns false if we don't know it.
+func (s *State) RealName(nick string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	d := s.details[s.fold(nick)]
+	return d.realname, len(d.realname) > 0
+}
+
+// firstParam returns the first parameter of m, which is sent as the trailing
+// parameter by some servers.
+func firstParam(m *Message) string {
+	if len(m.Params) > 0 {
+		return m.Params[0]
+	}
+	return m.Trailing
+}
@@ -0,0 +1,363 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestState_Update(t *testing.T) {
+	var s State
+
+	for _, line := range []string{
+		":irc.example.org 001 me :Welcome",
+		":me!me@example.org JOIN #go-nuts",
+		":irc.example.org 353 me = #go-nuts :@me +sorcix",
+		":irc.example.org 353 me = #go-nuts :alice bob",
+		":irc.example.org 366 me #go-nuts :End of /NAMES list.",
+		":me!me@example.org JOIN :#IRC",
+		":carol!carol@example.org JOIN #irc",
+		":Sorcix!sorcix@example.org JOIN #irc",
+		":stranger!x@example.org JOIN #elsewhere",
+	} {
+		s.Update(ParseMessage(line))
+	}
+
+	if s.Nick() != "me" {
+		t.Errorf("Wrong nick: %q", s.Nick())
+	}
+	if !reflect.DeepEqual(s.Channels(), []string{"#IRC", "#go-nuts"}) {
+		t.Errorf("Wrong channels: %v", s.Channels())
+	}
+	if !reflect.DeepEqual(s.Users("#go-nuts"), []string{"alice", "bob", "me", "sorcix"}) {
+		t.Errorf("Wrong users: %v", s.Users("#go-nuts"))
+	}
+	if !s.InChannel("SORCIX", "#irc") || s.InChannel("alice", "#irc") {
+		t.Error("Wrong channel membership.")
+	}
+
+	for _, line := range []string{
+		":sorcix!sorcix@example.org NICK :vic",
+		":alice!alice@example.org PART #go-nuts :Bye",
+		":me!me@example.org KICK #go-nuts bob :No bobs",
+		":carol!carol@example.org QUIT :Leaving",
+		":me!me@example.org NICK myself",
+	} {
+		s.Update(ParseMessage(line))
+	}
+
+	if !reflect.DeepEqual(s.Users("#go-nuts"), []string{"myself", "vic"}) {
+		t.Errorf("Wrong users: %v", s.Users("#go-nuts"))
+	}
+	if !reflect.DeepEqual(s.Users("#irc"), []string{"myself", "vic"}) {
+		t.Errorf("Wrong users: %v", s.Users("#irc"))
+	}
+
+	s.Update(ParseMessage(":myself!me@example.org PART #irc"))
+	s.Update(ParseMessage(":op!op@example.org KICK #go-nuts myself :Out"))
+
+	if len(s.Channels()) > 0 || s.Users("#irc") != nil {
+		t.Errorf("All channels should be left: %v", s.Channels())
+	}
+}
+
+func TestState_Update_names(t *testing.T) {
+	var s State
+
+	for _, line := range []string{
+		":irc.example.org 001 me :Welcome",
+		":me!me@example.org JOIN #a",
+		":me!me@example.org JOIN #b",
+		":old!old@example.org JOIN #a",
+		":irc.example.org 353 me = #a :@me alice",
+		":irc.example.org 353 me #b :bob",
+		":irc.example.org 353 me = #a :carol dave",
+	} {
+		s.Update(ParseMessage(line))
+	}
+
+	// The previous members are kept until the list is complete.
+	if !reflect.DeepEqual(s.Users("#a"), []string{"me", "old"}) {
+		t.Errorf("Wrong users before RPL_ENDOFNAMES: %v", s.Users("#a"))
+	}
+
+	for _, line := range []string{
+		":carol!carol@example.org NICK caroline",
+		":dave!dave@example.org PART #a",
+		":erin!erin@example.org JOIN #a",
+		":irc.example.org 366 me #a :End of /NAMES list.",
+		":irc.example.org 353 me = #b :me",
+		":irc.example.org 353 me #b zoe",
+		":irc.example.org 366 me #b :End of /NAMES list.",
+	} {
+		s.Update(ParseMessage(line))
+	}
+
+	if !reflect.DeepEqual(s.Users("#a"), []string{"alice", "caroline", "erin", "me"}) {
+		t.Errorf("Wrong users: %v", s.Users("#a"))
+	}
+	if !reflect.DeepEqual(s.Users("#b"), []string{"bob", "me", "zoe"}) {
+		t.Errorf("Wrong users: %v", s.Users("#b"))
+	}
+}
+
+func TestState_caseMapping(t *testing.T) {
+	var s State
+
+	for _, line := range []string{
+		":irc.example.org 001 me :Welcome",
+		":me!me@example.org JOIN #chan[1]",
+		":nick[]!user@example.org JOIN #chan{1}",
+	} {
+		s.Update(ParseMessage(line))
+	}
+
+	if !s.InChannel("NICK{}", "#CHAN[1]") {
+		t.Error("Names should be equal using rfc1459.")
+	}
+
+	s.Update(ParseMessage(":irc.example.org 005 me CASEMAPPING=ascii :are supported by this server"))
+
+	if s.InChannel("nick{}", "#chan[1]") || !s.InChannel("NICK[]", "#CHAN[1]") {
+		t.Error("Names should be compared using ascii.")
+	}
+	if s.Users("#chan{1}") != nil {
+		t.Error("Channel names should be compared using ascii.")
+	}
+}
+
+func TestState_Account(t *testing.T) {
+	var s State
+
+	for _, line := range []string{
+		":irc.example.org 001 me :Welcome",
+		":me!me@example.org JOIN #go-nuts * :Me",
+		":sorcix!sorcix@example.org JOIN #go-nuts Sorcix :Vic Demuzere",
+		":alice!alice@example.org JOIN #go-nuts * :Alice",
+		":bob!bob@example.org JOIN #go-nuts * :Bob",
+		":carol!carol@example.org JOIN #go-nuts carol :Carol",
+		"@account=alice :alice!alice@example.org PRIVMSG #go-nuts :Hi",
+		":bob!bob@example.org ACCOUNT bobby",
+		":sorcix!sorcix@example.org NICK vic",
+	} {
+		s.Update(ParseMessage(line))
+	}
+
+	for nick, expected := range map[string]string{"VIC": "Sorcix", "alice": "alice", "bob": "bobby", "carol": "carol"} {
+		if account, ok := s.Account(nick); !ok || account != expected {
+			t.Errorf("Wrong account for %s: %q, %v", nick, account, ok)
+		}
+	}
+
+	for _, line := range []string{
+		":bob!bob@example.org ACCOUNT *",
+		":alice!alice@example.org PART #go-nuts",
+		":carol!carol@example.org QUIT :Bye",
+	} {
+		if !s.Update(ParseMessage(line)) {
+			t.Errorf("Message should update the state: %s", line)
+		}
+	}
+
+	for _, nick := range []string{"me", "sorcix", "alice", "bob", "carol"} {
+		if account, ok := s.Account(nick); ok {
+			t.Errorf("%s should not be logged in: %q", nick, account)
+		}
+	}
+
+	if s.Update(ParseMessage("@account=Sorcix :vic!sorcix@example.org PRIVMSG #go-nuts :Hi")) {
+		t.Error("Known account should not update the state.")
+	}
+	// Users we share no channel with are not tracked.
+	if s.Update(ParseMessage("@account=stranger :stranger!s@example.org PRIVMSG me :Hi")) {
+		t.Error("Account of a stranger should not update the state.")
+	}
+	if account, ok := s.Account("stranger"); ok {
+		t.Errorf("Account of a stranger should not be stored: %q", account)
+	}
+
+	// Unless they join.
+	s.Update(ParseMessage("@account=dave :dave!dave@example.org JOIN #go-nuts"))
+	if account, ok := s.Account("dave"); !ok || account != "dave" {
+		t.Errorf("Wrong account for dave: %q, %v", account, ok)
+	}
+}
+
+func TestState_RealName(t *testing.T) {
+	var s State
+
+	for _, line := range []string{
+		":irc.example.org 001 me :Welcome",
+		":me!me@example.org JOIN #go-nuts * :Me",
+		":sorcix!sorcix@example.org JOIN #go-nuts Sorcix :Vic Demuzere",
+		":alice!alice@example.org JOIN #go-nuts * :Alice",
+		":bob!bob@example.org JOIN #go-nuts",
+	} {
+		s.Update(ParseMessage(line))
+	}
+
+	for _, line := range []string{
+		":alice!alice@example.org SETNAME :Alice Liddell",
+		":bob!bob@example.org SETNAME :Bob",
+		":me!me@example.org SETNAME :Myself",
+		":sorcix!sorcix@example.org NICK vic",
+	} {
+		if !s.Update(ParseMessage(line)) {
+			t.Errorf("Message should update the state: %s", line)
+		}
+	}
+
+	for nick, expected := range map[string]string{"me": "Myself", "vic": "Vic Demuzere", "alice": "Alice Liddell", "bob": "Bob"} {
+		if realname, ok := s.RealName(nick); !ok || realname != expected {
+			t.Errorf("Wrong real name for %s: %q, %v", nick, realname, ok)
+		}
+	}
+
+	if s.Update(ParseMessage(":carol!carol@example.org SETNAME :Carol")) {
+		t.Error("Unknown users should not update the state.")
+	}
+	if s.Update(ParseMessage(":bob!bob@example.org SETNAME :Bob")) {
+		t.Error("Known real name should not update the state.")
+	}
+
+	s.Update(ParseMessage(":alice!alice@example.org PART #go-nuts"))
+	if realname, ok := s.RealName("alice"); ok {
+		t.Errorf("Real name should be forgotten: %q", realname)
+	}
+	if account, ok := s.Account("vic"); !ok || account != "Sorcix" {
+		t.Errorf("Account should be kept: %q, %v", account, ok)
+	}
+}
+
+func TestState_Hostmask(t *testing.T) {
+	var s State
+
+	for _, line := range []string{
+		":irc.example.org 001 me :Welcome",
+		":me!me@example.org JOIN #go-nuts",
+		":alice!alice@example.org JOIN #go-nuts",
+		":bob!bob@example.org JOIN #go-nuts",
+		":stranger!x@example.org PRIVMSG me :Hello",
+	} {
+		s.Update(ParseMessage(line))
+	}
+
+	if hostmask, ok := s.Hostmask("ALICE"); !ok || hostmask != "alice!alice@example.org" {
+		t.Errorf("Wrong hostmask: %q, %v", hostmask, ok)
+	}
+	if hostmask, ok := s.Hostmask("stranger"); ok {
+		t.Errorf("Hostmask of an unknown user: %q", hostmask)
+	}
+
+	for _, line := range []string{
+		":alice!alice@example.org CHGHOST ~alice users.example.org",
+		":me!me@example.org CHGHOST me :my.vhost",
+		":bob!bob@example.org NICK robert",
+	} {
+		if !s.Update(ParseMessage(line)) {
+			t.Errorf("Message should update the state: %s", line)
+		}
+	}
+	if s.Update(ParseMessage(":stranger!x@example.org CHGHOST y elsewhere")) {
+		t.Error("Unknown users should not update the state.")
+	}
+
+	for nick, expected := range map[string]string{"alice": "alice!~alice@users.example.org", "me": "me!me@my.vhost", "robert": "robert!bob@example.org"} {
+		if hostmask, ok := s.Hostmask(nick); !ok || hostmask != expected {
+			t.Errorf("Wrong hostmask for %s: %q, %v", nick, hostmask, ok)
+		}
+	}
+
+	// Our own hostmask is kept after leaving all channels.
+	s.Update(ParseMessage(":me!me@my.vhost PART #go-nuts"))
+	if _, ok := s.Hostmask("alice"); ok {
+		t.Error("Hostmask should be forgotten.")
+	}
+	if _, ok := s.Hostmask("me"); !ok {
+		t.Error("Our own hostmask should be kept.")
+	}
+}
+
+func TestState_Away(t *testing.T) {
+	var s State
+
+	for _, line := range []string{
+		":irc.example.org 001 me :Welcome",
+		":me!me@example.org JOIN #go-nuts",
+		":alice!alice@example.org JOIN #go-nuts",
+		":bob!bob@example.org JOIN #go-nuts",
+		":carol!carol@example.org JOIN #go-nuts",
+	} {
+		s.Update(ParseMessage(line))
+	}
+
+	for _, line := range []string{
+		":alice!alice@example.org AWAY :Gone fishing",
+		":bob!bob@example.org AWAY :Lunch",
+		":irc.example.org 301 me carol :Sleeping",
+		":bob!bob@example.org AWAY",
+		":alice!alice@example.org NICK alice_",
+	} {
+		if !s.Update(ParseMessage(line)) {
+			t.Errorf("Message should update the state: %s", line)
+		}
+	}
+
+	for nick, expected := range map[string]string{"alice_": "Gone fishing", "carol": "Sleeping"} {
+		if reason, away := s.Away(nick); !away || reason != expected {
+			t.Errorf("Wrong away message for %s: %q, %v", nick, reason, away)
+		}
+	}
+	if reason, away := s.Away("bob"); away {
+		t.Errorf("bob should be back: %q", reason)
+	}
+
+	if s.Update(ParseMessage(":alice_!alice@example.org AWAY :Gone fishing")) {
+		t.Error("Known away message should not update the state.")
+	}
+	if s.Update(ParseMessage(":dave!dave@example.org AWAY :Away")) || s.Update(ParseMessage(":irc.example.org 301 me dave :Away")) {
+		t.Error("Unknown users should not update the state.")
+	}
+
+	s.Update(ParseMessage(":carol!carol@example.org QUIT :Bye"))
+	if reason, away := s.Away("carol"); away {
+		t.Errorf("Away message should be forgotten: %q", reason)
+	}
+}
+
+func TestState_Members(t *testing.T) {
+	var s State
+
+	for _, line := range []string{
+		":irc.example.org 001 me :Welcome",
+		":irc.example.org 005 me PREFIX=(qov)~@+ :are supported by this server",
+		":me!me@example.org JOIN #go-nuts",
+		":irc.example.org 353 me = #go-nuts :@+me ~+sorcix alice bob",
+		":irc.example.org 366 me #go-nuts :End of /NAMES list.",
+		":me!me@example.org MODE #go-nuts +vo-q+b alice bob sorcix *!*@example.org",
+		":me!me@example.org MODE #go-nuts -v :me",
+		":bob!bob@example.org NICK robert",
+		":carol!carol@example.org JOIN #go-nuts",
+	} {
+		s.Update(ParseMessage(line))
+	}
+
+	expected := []NamedUser{
+		{"alice", "+"},
+		{"carol", ""},
+		{"me", "@"},
+		{"robert", "@"},
+		{"sorcix", "+"},
+	}
+	if members := s.Members("#go-nuts"); !reflect.DeepEqual(members, expected) {
+		t.Errorf("Wrong members:")
+		t.Logf("Output: %#v", members)
+		t.Logf("Expected: %#v", expected)
+	}
+	if s.Members("#elsewhere") != nil {
+		t.Error("Members of unknown channels should be nil.")
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strings"
+)
+
+// A StandardReply holds an IRCv3 FAIL, WARN or NOTE message, which servers use
+// to report errors and other events in a machine-readable way:
+//
+//    FAIL <command> <code> [<context>...] :<description>
+//
+// A StandardReply can be used as an error.
+type StandardReply struct {
+	Severity    string   // FAIL, WARN or NOTE
+	Command     string   // Command the reply relates to, or "*"
+	Code        string   // Machine-readable code, like NEED_KEY
+	Context     []string // Extra parameters, depending on the code
+	Description string   // Human-readable text
+}
+
+func (r *StandardReply) Error() string {
+	return "irc: " + r.Severity + " " + r.Command + " " + r.Code + ": " + r.Description
+}
+
+// ParseStandardReply parses a FAIL, WARN or NOTE message:
+//
+//    FAIL JOIN NEED_KEY #channel :Cannot join channel without key
+//
+// Returns a *ParseError if m is not a valid standard reply.
+func ParseStandardReply(m *Message) (*StandardReply, error) {
+
+	invalid := func(reason string) error {
+		return &ParseError{Line: m.String(), Reason: reason}
+	}
+
+	switch m.Command {
+	case FAIL, WARN, NOTE:
+	default:
+		return nil, invalid("not a standard reply")
+	}
+
+	params := m.allParams()
+	if len(params) < 3 {
+		return nil, invalid("standard reply without command, code or description")
+	}
+
+	n := len(params) - 1
+	r := &StandardReply{
+		Severity:    m.Command,
+		Command:     params[0],
+		Code:        params[1],
+		Description: params[n],
+	}
+	if n > 2 {
+		r.Context = append([]string(nil), params[2:n]...)
+	}
+
+	return r, nil
+}
+
+// failure returns the parsed standard reply if m is a FAIL for one of
+// commands, or nil otherwise. Use "*" for failures not related to a command,
+// like ACCOUNT_REQUIRED_TO_CONNECT. Returns a *ParseError for malformed FAIL
+// messages for any of the commands.
+func failure(m *Message, commands ...string) error {
+	if m.Command != FAIL {
+		return nil
+	}
+
+	command := m.param(0)
+	for _, c := range commands {
+		if strings.EqualFold(command, c) {
+			reply, err := ParseStandardReply(m)
+			if err != nil {
+				return err
+			}
+			return reply
+		}
+	}
+	return nil
+}
+
+// NewStandardReply returns a FAIL, WARN or NOTE message from the server named
+// source, as sent by servers:
+//
+//    :irc.example.org FAIL JOIN NEED_KEY #channel :Cannot join channel without key
+//
+// Use "*" as command if the reply does not relate to a command. The source is
+// omitted from the message if empty.
+func NewStandardReply(source, severity, command, code, description string, context ...string) *Message {
+	m := &Message{
+		Command:       strings.ToUpper(severity),
+		Params:        append([]string{command, code}, context...),
+		Trailing:      description,
+		EmptyTrailing: len(description) <= 0,
+	}
+
+	if len(source) > 0 {
+		m.Prefix = &Prefix{Name: source}
+	}
+
+	return m
+}
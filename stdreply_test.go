@@ -0,0 +1,91 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var standardReplyTests = [...]struct {
+	line  string
+	reply *StandardReply
+}{
+	{
+		line: "FAIL JOIN NEED_KEY #channel :Cannot join channel without key",
+		reply: &StandardReply{
+			Severity:    FAIL,
+			Command:     JOIN,
+			Code:        "NEED_KEY",
+			Context:     []string{"#channel"},
+			Description: "Cannot join channel without key",
+		},
+	},
+	{
+		line: ":irc.example.org WARN REHASH CERTS_EXPIRED :Certificate has expired",
+		reply: &StandardReply{
+			Severity:    WARN,
+			Command:     "REHASH",
+			Code:        "CERTS_EXPIRED",
+			Description: "Certificate has expired",
+		},
+	},
+	{
+		line: "NOTE * OPER_MESSAGE a b Done",
+		reply: &StandardReply{
+			Severity:    NOTE,
+			Command:     "*",
+			Code:        "OPER_MESSAGE",
+			Context:     []string{"a", "b"},
+			Description: "Done",
+		},
+	},
+}
+
+func TestParseStandardReply(t *testing.T) {
+	for i, test := range standardReplyTests {
+		reply, err := ParseStandardReply(ParseMessage(test.line))
+
+		if err != nil || !reflect.DeepEqual(reply, test.reply) {
+			t.Errorf("Failed to parse standard reply %d:", i)
+			t.Logf("Output: %#v, %v", reply, err)
+			t.Logf("Expected: %#v", test.reply)
+		}
+	}
+
+	for i, line := range []string{
+		"PRIVMSG #channel :FAIL JOIN NEED_KEY",
+		"FAIL JOIN :NEED_KEY",
+	} {
+		_, err := ParseStandardReply(ParseMessage(line))
+
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("Expected a *ParseError for invalid reply %d, got: %v", i, err)
+		}
+	}
+}
+
+func TestStandardReply_Error(t *testing.T) {
+	reply, _ := ParseStandardReply(ParseMessage(standardReplyTests[0].line))
+
+	if s := reply.Error(); s != "irc: FAIL JOIN NEED_KEY: Cannot join channel without key" {
+		t.Errorf("Unexpected error string: %s", s)
+	}
+}
+
+func TestNewStandardReply(t *testing.T) {
+	m := NewStandardReply("irc.example.org", "fail", JOIN, "NEED_KEY", "Cannot join channel without key", "#channel")
+
+	if s := m.String(); s != ":irc.example.org FAIL JOIN NEED_KEY #channel :Cannot join channel without key" {
+		t.Errorf("Unexpected message: %s", s)
+	}
+
+	reply, err := ParseStandardReply(m)
+	if err != nil || !reflect.DeepEqual(reply, standardReplyTests[0].reply) {
+		t.Errorf("Unexpected result: %#v, %v", reply, err)
+	}
+}
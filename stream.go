@@ -6,9 +6,18 @@ package irc
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"io"
 	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 )
 
 // Messages are delimited with CR and LF line endings,
@@ -20,41 +29,492 @@ var endline = []byte("\r\n")
 
 // A Conn represents an IRC network protocol connection.
 // It consists of an Encoder and Decoder to manage I/O.
+//
+// The Encoder and Decoder are locked separately, so one goroutine may call
+// Decode in a loop while others call Encode. Replies sent while decoding, like
+// the PONG enabled by HandlePing, only wait for other writes to finish.
 type Conn struct {
 	Encoder
 	Decoder
 
 	conn io.ReadWriteCloser
+	tcp  *net.TCPConn // Under TLS or WebSocket if dialed, see SetKeepAlive
+
+	mu         sync.Mutex
+	handlePing bool            // Reply to PING messages
+	received   time.Time       // Time of the last decoded message
+	timeout    time.Duration   // Time to wait for replies
+	caps       map[string]bool // Enabled capabilities
+	wantedCaps []string        // Capabilities to request when offered
+	capOpen    bool            // Capability negotiation not ended, see EndCaps
+	nick       string          // Our nick, see CurrentNick
+	support    ISupport        // Features advertised using RPL_ISUPPORT
+	ctcp       *CTCPResponder  // Enabled by AutoCTCP
+	queue      *writeQueue     // Enabled by SetWriteQueue
+
+	labels    labels // Pending labeled responses
+	pings     pings  // Pending pings, see Ping
+	joins     joins  // Pending joins, see JoinWait
+	quitOnce  sync.Once
+	closeOnce sync.Once
 }
 
+// quitTimeout is the time Quit waits for the server to close the connection.
+const quitTimeout = 2 * time.Second
+
+// DefaultTimeout is the time helpers like SASLPlain wait for a server reply,
+// unless changed using SetTimeout.
+const DefaultTimeout = 30 * time.Second
+
+// ErrTimeout is returned by helpers that did not receive the expected reply
+// from the server in time.
+var ErrTimeout = errors.New("irc: timeout waiting for reply")
+
+// DefaultReadBufferSize is the size of the read buffer used by NewConn and
+// NewDecoder.
+const DefaultReadBufferSize = 4096
+
 // NewConn returns a new Conn using rwc for I/O.
+//
+// Reads are buffered using a buffer of DefaultReadBufferSize bytes, writes
+// are not buffered. Use NewConnSize to change this.
 func NewConn(rwc io.ReadWriteCloser) *Conn {
-	return &Conn{
+	return NewConnSize(rwc, DefaultReadBufferSize, 0)
+}
+
+// NewConnSize is like NewConn, but reads using a buffer of readSize bytes, and
+// buffers writes using writeSize bytes if not zero.
+//
+// A larger read buffer needs fewer reads from rwc on busy connections, at the
+// cost of memory for every connection. Lines longer than the buffer are still
+// read, see Decoder.SetMaxLineLength to limit them.
+//
+// Buffered writes are flushed after every message, unless disabled using
+// SetAutoFlush. Without auto flush, messages are only written once the buffer
+// is full or Flush is called, which reduces the number of writes when sending
+// many messages at once, but delays all of them.
+func NewConnSize(rwc io.ReadWriteCloser, readSize, writeSize int) *Conn {
+	if readSize <= 0 {
+		readSize = DefaultReadBufferSize
+	}
+
+	var w io.Writer = rwc
+	if writeSize > 0 {
+		w = bufio.NewWriterSize(rwc, writeSize)
+	}
+
+	c := &Conn{
 		Encoder: Encoder{
-			writer: rwc,
+			writer: w,
 		},
 		Decoder: Decoder{
-			reader: bufio.NewReader(rwc),
+			reader: bufio.NewReaderSize(rwc, readSize),
 		},
 		conn: rwc,
+		tcp:  tcpConn(rwc),
+	}
+	c.Decoder.observer = c.observe
+	c.Decoder.deadliner, _ = rwc.(readDeadliner)
+	c.Encoder.deadliner, _ = rwc.(writeDeadliner)
+	return c
+}
+
+// observe is called by the Decoder for every decoded message.
+func (c *Conn) observe(m *Message) {
+	c.mu.Lock()
+	c.received = time.Now()
+	handlePing := c.handlePing
+	responder := c.ctcp
+	switch {
+	case m.Command == RPL_WELCOME && len(m.Params) > 0:
+		c.nick = m.Params[0]
+	case m.Command == NICK && m.IsEcho(c.nick, c.support.CaseMapping()):
+		c.nick = firstParam(m)
+	case m.Command == RPL_ISUPPORT:
+		c.support.Update(m)
+		if c.support.UTF8Only() {
+			c.Encoder.RequireUTF8(true)
+		}
+	}
+	var requests []string
+	if m.Command == CAP {
+		requests = c.updateCaps(m)
+	}
+	nick := c.nick
+	mapping := c.support.CaseMapping()
+	c.mu.Unlock()
+
+	c.labels.observe(m)
+	c.pings.observe(m)
+	c.joins.observe(m, nick, mapping)
+
+	for _, request := range requests {
+		c.Encode(&Message{Command: CAP, Params: []string{CAP_REQ}, Trailing: request})
+	}
+
+	if responder != nil {
+		if reply, ok := responder.respond(m, nick, mapping); ok {
+			c.Encode(reply)
+		}
+	}
+
+	if handlePing && m.Command == PING {
+		c.Encode(&Message{
+			Command:       PONG,
+			Params:        m.Params,
+			Trailing:      m.Trailing,
+			EmptyTrailing: m.EmptyTrailing,
+		})
 	}
 }
 
 // Dial connects to the given address using net.Dial and
 // then returns a new Conn for the connection.
+//
+// Use DialContext for a connect timeout or a custom dialer.
 func Dial(addr string) (*Conn, error) {
-	c, err := net.Dial("tcp", addr)
+	return DialContext(context.Background(), addr)
+}
+
+// DialTLS connects to the given address using TLS and
+// then returns a new Conn for the connection.
+//
+// A nil config uses the default configuration, which verifies the server
+// certificate against the hostname in addr.
+func DialTLS(addr string, config *tls.Config) (*Conn, error) {
+	if config == nil {
+		config = new(tls.Config)
+	}
+	return DialContext(context.Background(), addr, WithTLSConfig(config))
+}
+
+// TLSConnectionState returns details about the TLS connection, such as the
+// negotiated cipher suite and the peer certificates.
+//
+// Returns false if the underlying connection does not use TLS.
+func (c *Conn) TLSConnectionState() (state tls.ConnectionState, ok bool) {
+	conn := c.conn
+	if ws, ok := conn.(*wsConn); ok {
+		conn = ws.Conn
+	}
+	if t, ok := conn.(*tls.Conn); ok {
+		return t.ConnectionState(), true
+	}
+	return state, false
+}
+
+// RemoteAddr returns the remote network address, or nil if the underlying
+// connection is not a net.Conn.
+func (c *Conn) RemoteAddr() net.Addr {
+	if n, ok := c.conn.(net.Conn); ok {
+		return n.RemoteAddr()
+	}
+	return nil
+}
+
+// LocalAddr returns the local network address, or nil if the underlying
+// connection is not a net.Conn.
+func (c *Conn) LocalAddr() net.Addr {
+	if n, ok := c.conn.(net.Conn); ok {
+		return n.LocalAddr()
+	}
+	return nil
+}
+
+// ErrNotTCP is returned by SetKeepAlive if the underlying connection is not a
+// TCP connection.
+var ErrNotTCP = errors.New("irc: connection is not a TCP connection")
+
+// SetKeepAlive enables or disables TCP keepalive probes on the underlying
+// connection, so a peer that silently disappeared is detected by the operating
+// system, even while we're not sending anything. A period of zero keeps the
+// system default interval between probes.
+//
+// This complements KeepAlive, which detects unresponsive servers using PING.
+// Connections dialed using this package are supported, including those using
+// TLS or WebSocket. Returns ErrNotTCP if the connection is not a TCP
+// connection, which includes TLS connections passed to NewConn.
+func (c *Conn) SetKeepAlive(enable bool, period time.Duration) error {
+	if c.tcp == nil {
+		return ErrNotTCP
+	}
+	return setKeepAlive(c.tcp, enable, period)
+}
+
+// tcpConn returns the TCP connection underlying conn, or nil. TLS connections
+// can't be unwrapped, so they are handled when dialing.
+func tcpConn(conn interface{}) *net.TCPConn {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			return c
+		case *wsConn:
+			conn = c.Conn
+		default:
+			return nil
+		}
+	}
+}
 
+// setKeepAlive configures TCP keepalive probes on c.
+func setKeepAlive(c *net.TCPConn, enable bool, period time.Duration) error {
+	if err := c.SetKeepAlive(enable); err != nil {
+		return err
+	}
+	if enable && period > 0 {
+		return c.SetKeepAlivePeriod(period)
+	}
+	return nil
+}
+
+// CurrentNick returns our nick as confirmed by the server, learned from
+// RPL_WELCOME and NICK messages. Returns an empty string before registration.
+func (c *Conn) CurrentNick() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.nick
+}
+
+// isEcho returns true if m was sent by us, see Message.IsEcho.
+func (c *Conn) isEcho(m *Message) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return m.IsEcho(c.nick, c.support.CaseMapping())
+}
+
+// ISupport returns a copy of the features advertised by the server using
+// RPL_ISUPPORT, as read using Decode or DecodeContext so far.
+func (c *Conn) ISupport() ISupport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	features := ISupport{Tokens: make(map[string]string, len(c.support.Tokens))}
+	for token, value := range c.support.Tokens {
+		features.Tokens[token] = value
+	}
+	return features
+}
+
+// SetTimeout sets the time helpers like SASLPlain wait for a server reply.
+// Zero restores DefaultTimeout.
+func (c *Conn) SetTimeout(d time.Duration) {
+	c.mu.Lock()
+	c.timeout = d
+	c.mu.Unlock()
+}
+
+// replyTimeout returns the time to wait for a server reply.
+func (c *Conn) replyTimeout() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.timeout <= 0 {
+		return DefaultTimeout
+	}
+	return c.timeout
+}
+
+// await reads messages until fn is done or returns an error.
+//
+// Returns ErrTimeout if fn was not done in time. Helpers using await read
+// from the connection themselves, so they must not be used while another
+// goroutine is calling Decode.
+func (c *Conn) await(fn func(m *Message) (done bool, err error)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.replyTimeout())
+	defer cancel()
+
+	for {
+		m, err := c.DecodeContext(ctx)
+
+		switch {
+		case err == context.DeadlineExceeded:
+			return ErrTimeout
+		case err != nil:
+			return err
+		case m == nil:
+			continue
+		}
+
+		if done, err := fn(m); done || err != nil {
+			return err
+		}
+	}
+}
+
+// Quit sends a QUIT message with the given reason, and closes the connection
+// once the server did, or after a short timeout.
+//
+// Messages received after sending QUIT may be discarded. Only the first call
+// of Quit or Shutdown has any effect, later calls return nil. Use Close to
+// close the connection immediately.
+func (c *Conn) Quit(reason string) (err error) {
+	c.quitOnce.Do(func() {
+		err = c.Encode(&Message{Command: QUIT, Trailing: reason})
+
+		if err == nil {
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+				for {
+					if _, err := c.Decode(); err != nil {
+						return
+					}
+				}
+			}()
+
+			timer := time.NewTimer(quitTimeout)
+			select {
+			case <-closed:
+			case <-timer.C:
+			}
+			timer.Stop()
+		}
+
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	})
+	return err
+}
+
+// Shutdown closes the connection cleanly: new messages are rejected with
+// ErrConnClosed right away, messages already queued using EncodePriority are
+// written, and buffered writers are flushed. Then a QUIT message with the
+// given reason is sent, and the connection is closed once the server did, or
+// when ctx is done.
+//
+// Returns ctx.Err() if ctx was done before the QUIT message was sent, or the
+// error of a failed write. The connection is closed in any case. Messages
+// received after starting Shutdown may be discarded.
+//
+// Like Quit, only the first call of either has any effect, later calls
+// return nil.
+func (c *Conn) Shutdown(ctx context.Context, reason string) (err error) {
+	c.quitOnce.Do(func() {
+		atomic.StoreInt32(&c.Encoder.draining, 1)
+		err = c.drain(ctx, &Message{Command: QUIT, Trailing: reason})
+
+		if err == nil {
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+				for {
+					if _, err := c.Decode(); err != nil {
+						return
+					}
+				}
+			}()
+
+			select {
+			case <-closed:
+			case <-ctx.Done():
+			}
+		}
+
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	})
+	return err
+}
+
+// drain writes the queued messages followed by last, and flushes buffered
+// writers.
+func (c *Conn) drain(ctx context.Context, last *Message) error {
+	c.mu.Lock()
+	q := c.queue
+	c.mu.Unlock()
+
+	if q != nil {
+		if err := q.drain(ctx); err != nil {
+			return err
+		}
+	}
+
+	line, err := c.Encoder.format(nil, last)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return NewConn(c), nil
+	enc := &c.Encoder
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+
+	if enc.limit != nil {
+		if err := enc.limit.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if _, err := enc.send(line); err != nil {
+		return err
+	}
+	if f, ok := enc.writer.(flusher); ok {
+		return streamError(f.Flush())
+	}
+	return nil
 }
 
-// Close closes the underlying ReadWriteCloser.
-func (c *Conn) Close() error {
-	return c.conn.Close()
+// ErrConnClosed is returned when reading from or writing to a Conn after
+// calling Close, or after the underlying connection was closed. In the latter
+// case it wraps the error of the connection, so use errors.Is to check.
+var ErrConnClosed = errors.New("irc: use of closed connection")
+
+// Close closes the underlying ReadWriteCloser. Only the first call closes the
+// connection, later calls return nil.
+//
+// Close may be called while another goroutine is blocked in Decode or Encode,
+// which then return ErrConnClosed, as do later calls. Reads from a net.Conn are
+// interrupted using a deadline first. Other readers must return from Read when
+// closed for Decode to return.
+func (c *Conn) Close() (err error) {
+	c.closeOnce.Do(func() {
+		atomic.StoreInt32(&c.Decoder.closed, 1)
+		atomic.StoreInt32(&c.Encoder.closed, 1)
+		c.Decoder.stopMessages()
+
+		c.mu.Lock()
+		if c.queue != nil {
+			c.queue.stop()
+		}
+		c.mu.Unlock()
+
+		if d, ok := c.conn.(readDeadliner); ok {
+			d.SetReadDeadline(time.Unix(1, 0))
+		}
+
+		err = c.conn.Close()
+	})
+	return err
+}
+
+// ErrNoCloseWrite is returned by CloseWrite if the underlying connection does
+// not support closing only the write direction.
+var ErrNoCloseWrite = errors.New("irc: connection does not support CloseWrite")
+
+// closeWriter is implemented by connections that can be half-closed, like
+// *net.TCPConn and *tls.Conn.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// CloseWrite shuts down the writing side of the connection, so the peer reads
+// EOF, while messages can still be decoded until the peer closes the
+// connection as well. Later writes return ErrConnClosed. Use Close afterwards
+// to release the connection.
+//
+// Returns ErrNoCloseWrite if the underlying connection does not have a
+// CloseWrite method, like connections returned by net.Pipe.
+func (c *Conn) CloseWrite() error {
+	w, ok := c.conn.(closeWriter)
+	if !ok {
+		return ErrNoCloseWrite
+	}
+
+	c.Encoder.mu.Lock()
+	defer c.Encoder.mu.Unlock()
+
+	atomic.StoreInt32(&c.Encoder.closed, 1)
+	return w.CloseWrite()
 }
 
 // A Decoder reads Message objects from an input stream.
@@ -62,73 +522,1072 @@ type Decoder struct {
 	reader *bufio.Reader
 	line   string
 	mu     sync.Mutex
+
+	// Result of a read that was started by DecodeContext, but not consumed
+	// because the context was cancelled first.
+	pending chan readResult
+
+	peeked *peekedMessage // Read by Peek, returned by the next Decode
+
+	// Called for every decoded message, used by Conn.
+	observer func(*Message)
+
+	// Underlying reader if it supports deadlines, see SetIdleTimeout.
+	deadliner   readDeadliner
+	idleTimeout int64 // time.Duration, accessed atomically
+
+	traffic atomic.Value // trafficLog, see Conn.SetTrafficLogger
+	journal atomic.Value // trafficLog, see Conn.SetJournal
+	charset atomic.Value // charsetFunc, see SetCharset
+	parser  atomic.Value // parserFunc, see SetParser
+	metrics atomic.Value // metricsHook, see Conn.SetMetrics
+	closed  int32        // Set by Conn.Close, accessed atomically
+
+	dedup dedup // See SetDedupWindow
+
+	// Line delimiter set using SetDelim, used instead of delim if customDelim
+	// is set.
+	customDelim bool
+	lineDelim   byte
+
+	skipEmpty bool // Skip blank lines, see SetSkipEmpty
+
+	maxLength   int  // Maximum line length, see SetMaxLineLength
+	discardLong bool // Skip the rest of lines that are too long
+
+	// Used by Messages.
+	messages     chan *Message
+	messagesOnce sync.Once
+	errMu        sync.Mutex
+	err          error
+	done         chan struct{} // Closed after messages
+	stop         chan struct{} // Closed by Conn.Close
+	stopOnce     sync.Once
+}
+
+// Number of messages buffered by the channel returned by Messages.
+const messagesBuffer = 16
+
+// readResult is the outcome of a background read started by DecodeContext.
+type readResult struct {
+	line string
+	err  error
 }
 
 // NewDecoder returns a new Decoder that reads from r.
 func NewDecoder(r io.Reader) *Decoder {
+	deadliner, _ := r.(readDeadliner)
 	return &Decoder{
-		reader: bufio.NewReader(r),
+		reader:    bufio.NewReaderSize(r, DefaultReadBufferSize),
+		deadliner: deadliner,
 	}
 }
 
+// NewDecoderDelim returns a new Decoder that reads from r, splitting messages
+// on the given delimiter instead of LF. See SetDelim.
+func NewDecoderDelim(r io.Reader, delim byte) *Decoder {
+	dec := NewDecoder(r)
+	dec.SetDelim(delim)
+	return dec
+}
+
+// SetDelim changes the byte separating messages in the stream, for decoding
+// non-standard streams using a bare CR or NUL. The delimiter is removed from
+// every message, as are surrounding CR and LF characters. The default is LF,
+// which handles both LF and CR+LF line endings.
+//
+// SetDelim must not be called while decoding.
+func (dec *Decoder) SetDelim(delim byte) {
+	dec.customDelim = true
+	dec.lineDelim = delim
+}
+
+// SetSkipEmpty controls whether lines without anything but whitespace, which
+// some servers send as keepalive, are skipped. By default Decode returns a nil
+// message for them, like for other invalid lines. If skip is true, Decode
+// continues reading instead, until it has a line that isn't blank or reading
+// fails. DecodeInto always skips them.
+//
+// SetSkipEmpty must not be called while decoding.
+func (dec *Decoder) SetSkipEmpty(skip bool) {
+	dec.skipEmpty = skip
+}
+
+// skip returns true if line should be skipped because of SetSkipEmpty.
+func (dec *Decoder) skip(line string) bool {
+	return dec.skipEmpty && len(strings.Trim(line, " \t\r\n\x00")) <= 0
+}
+
+// SetMaxLineLength limits the number of bytes buffered for a single received
+// line, including tags and the line ending, so a peer never sending a line
+// ending can't exhaust memory. Zero disables the limit, which is the default.
+// Keep in mind that tags may make a line up to 8191 bytes longer than
+// MaxLineLength.
+//
+// Decode returns ErrLineTooLong for longer lines. If discard is true, the rest
+// of the line is skipped first, so the next call continues with the next
+// message. Otherwise, the stream should be considered broken.
+//
+// SetMaxLineLength must not be called while decoding.
+func (dec *Decoder) SetMaxLineLength(n int, discard bool) {
+	dec.maxLength = n
+	dec.discardLong = discard
+}
+
+// SetMaxLineLength limits the length of messages written by the Encoder, see
+// Encoder.SetMaxLineLength. Use c.Decoder.SetMaxLineLength to limit the length
+// of received lines.
+func (c *Conn) SetMaxLineLength(n int, truncate bool) {
+	c.Encoder.SetMaxLineLength(n, truncate)
+}
+
+// readDeadliner is implemented by readers supporting read deadlines, like
+// net.Conn.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// SetIdleTimeout makes reads fail if no complete message was received within
+// the given duration, so a dead connection can be detected without a timer of
+// your own. The deadline is renewed before reading every message. Zero
+// disables the timeout, which is the default.
+//
+// The underlying reader must support deadlines, like net.Conn does. Otherwise
+// this is a no-op returning ErrNoDeadline.
+func (dec *Decoder) SetIdleTimeout(d time.Duration) error {
+	if dec.deadliner == nil {
+		return ErrNoDeadline
+	}
+
+	atomic.StoreInt64(&dec.idleTimeout, int64(d))
+
+	if d <= 0 {
+		return dec.deadliner.SetReadDeadline(time.Time{})
+	}
+	return nil
+}
+
 // Decode attempts to read a single Message from the stream.
 //
+// If the stream ends with a message without line ending, that message is
+// returned first, and io.EOF is returned by the next call.
+//
 // Returns a non-nil error if the read failed.
 func (dec *Decoder) Decode() (m *Message, err error) {
 
 	dec.mu.Lock()
-	dec.line, err = dec.reader.ReadString(delim)
+	if p := dec.takePeeked(); p != nil {
+		dec.mu.Unlock()
+		return p.m, nil
+	}
+	line, err := dec.readLine()
+	for err == nil && dec.skip(line) {
+		line, err = dec.readLine()
+	}
+	dec.line = line
 	dec.mu.Unlock()
 
 	if err != nil {
 		return nil, err
 	}
 
-	return ParseMessage(dec.line), nil
+	return dec.parse(line), nil
+}
+
+// DecodeBytes is like Decode, but also returns the line as received, without
+// line ending, before conversion by the function set using SetCharset.
+func (dec *Decoder) DecodeBytes() (line []byte, m *Message, err error) {
+
+	dec.mu.Lock()
+	if p := dec.takePeeked(); p != nil {
+		dec.mu.Unlock()
+		return []byte(strings.TrimRightFunc(p.line, cutsetFunc)), p.m, nil
+	}
+	raw, err := dec.readLine()
+	for err == nil && dec.skip(raw) {
+		raw, err = dec.readLine()
+	}
+	dec.line = raw
+	dec.mu.Unlock()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	line = []byte(strings.TrimRightFunc(raw, cutsetFunc))
+	return line, dec.parse(raw), nil
+}
+
+// charsetFunc converts a line to UTF-8, see Decoder.SetCharset.
+type charsetFunc func(line []byte) string
+
+// SetCharset sets a function converting every line to UTF-8 before it is
+// parsed, for networks using another encoding like CP1252. The line ending is
+// removed first. A nil fn parses lines as is, which is the default.
+//
+// Lines are never converted by the Decoder itself: the bytes of a line are
+// kept in the strings of the Message, whether they are valid UTF-8 or not.
+func (dec *Decoder) SetCharset(fn func(line []byte) string) {
+	dec.charset.Store(charsetFunc(fn))
+}
+
+// convert applies the function set using SetCharset to line.
+func (dec *Decoder) convert(line string) string {
+	if fn, ok := dec.charset.Load().(charsetFunc); ok && fn != nil {
+		return fn([]byte(strings.TrimRightFunc(line, cutsetFunc)))
+	}
+	return line
+}
+
+// parserFunc parses a line, see Decoder.SetParser.
+type parserFunc func(line string) *Message
+
+// SetParser sets a function parsing every line instead of ParseMessage, for
+// networks or IRC-like protocols using non-standard syntax. A nil fn restores
+// the default.
+//
+// The line is passed without line ending, after conversion by the function set
+// using SetCharset. Lines for which fn returns nil are skipped, like invalid
+// lines are by default. Everything else, like buffering, SetDelim and
+// SetMaxLineLength, works the same as with the default parser.
+func (dec *Decoder) SetParser(fn func(line string) *Message) {
+	dec.parser.Store(parserFunc(fn))
+}
+
+// customParser returns the function set using SetParser, or nil.
+func (dec *Decoder) customParser() parserFunc {
+	fn, _ := dec.parser.Load().(parserFunc)
+	return fn
+}
+
+// DecodeInto is like Decode, but parses the message into m instead of
+// allocating a new Message. The tags map, prefix and parameter slice of m are
+// reused, so the contents of m are only valid until the next call to
+// DecodeInto. Use Message.Copy to retain a message.
+//
+// Invalid and empty lines are skipped.
+func (dec *Decoder) DecodeInto(m *Message) (err error) {
+
+	dec.mu.Lock()
+	defer dec.mu.Unlock()
+
+	if p := dec.takePeeked(); p != nil {
+		*m = *p.m
+		return nil
+	}
+
+	for {
+		if dec.line, err = dec.readLine(); err != nil {
+			return err
+		}
+
+		raw := rawLine(dec.line)
+		dec.line = dec.convert(dec.line)
+
+		ok := false
+		if fn := dec.customParser(); fn != nil {
+			// A custom parser allocates a new Message anyway.
+			if parsed := fn(strings.TrimRightFunc(dec.line, cutsetFunc)); parsed != nil {
+				*m, ok = *parsed, true
+			}
+		} else {
+			ok = parseInto(m, dec.line)
+		}
+		if ok && !dec.dedup.duplicate(m, dec.line) {
+			m.Raw = raw
+			break
+		}
+	}
+
+	if hook := loadMetrics(&dec.metrics); hook != nil {
+		hook.OnReceive(m.Command)
+	}
+	if dec.observer != nil {
+		dec.observer(m)
+	}
+
+	return nil
+}
+
+// DecodeContext is like Decode, but returns ctx.Err() as soon as ctx is done,
+// even if no data has arrived yet.
+//
+// A cancelled call does not lose data: the read continues in the background
+// and a partially received line is completed and returned by the next call to
+// Decode or DecodeContext.
+func (dec *Decoder) DecodeContext(ctx context.Context) (m *Message, err error) {
+
+	// Don't start a read if we're cancelled already.
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	dec.mu.Lock()
+	defer dec.mu.Unlock()
+
+	if p := dec.takePeeked(); p != nil {
+		return p.m, nil
+	}
+
+	for {
+		if dec.pending == nil {
+			result := make(chan readResult, 1)
+			go func() {
+				line, err := dec.readString()
+				result <- readResult{line, err}
+			}()
+			dec.pending = result
+		}
+
+		select {
+		case r := <-dec.pending:
+			dec.pending = nil
+			dec.line, err = r.line, r.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		if !dec.skip(dec.line) {
+			return dec.parse(dec.line), nil
+		}
+	}
+}
+
+// peekedMessage is a message read by Peek.
+type peekedMessage struct {
+	line string // As received, before conversion
+	m    *Message
+}
+
+// Peek reads the next message like Decode, but keeps it so the next call to
+// Decode, DecodeContext, DecodeBytes or DecodeInto returns it again. Calling
+// Peek again before that returns the same message without reading.
+//
+// Unlike Decode, Peek skips invalid lines instead of returning a nil Message.
+// The message is passed to the Conn when it is read, so replies like PONG are
+// sent by Peek already. Returns a non-nil error if the read failed.
+func (dec *Decoder) Peek() (*Message, error) {
+	dec.mu.Lock()
+	defer dec.mu.Unlock()
+
+	if dec.peeked != nil {
+		return dec.peeked.m, nil
+	}
+
+	for {
+		line, err := dec.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if dec.skip(line) {
+			continue
+		}
+
+		dec.line = line
+		if m := dec.parse(line); m != nil {
+			dec.peeked = &peekedMessage{line: line, m: m}
+			return m, nil
+		}
+	}
+}
+
+// takePeeked returns the message read by Peek, if any, and forgets it. The
+// caller must hold dec.mu.
+func (dec *Decoder) takePeeked() *peekedMessage {
+	p := dec.peeked
+	dec.peeked = nil
+	return p
+}
+
+// Messages returns a channel delivering every message read from the stream.
+//
+// The first call starts a goroutine which calls Decode in a loop, so Decode
+// should not be used directly afterwards. Invalid messages are skipped. The
+// channel is closed when reading fails, after which Err returns the error.
+//
+// The goroutine ends when the channel is closed. If this is a Conn, closing it
+// ends the goroutine as well, even if the channel is not drained.
+func (dec *Decoder) Messages() <-chan *Message {
+	dec.messagesOnce.Do(func() {
+		dec.messages = make(chan *Message, messagesBuffer)
+		dec.signals()
+		go dec.readMessages()
+	})
+	return dec.messages
+}
+
+// Done returns a channel that is closed after the channel returned by Messages
+// is closed, when Err returns the reason.
+func (dec *Decoder) Done() <-chan struct{} {
+	done, _ := dec.signals()
+	return done
+}
+
+// Err returns the error that closed the channel returned by Messages. Returns
+// nil if the stream ended normally with io.EOF, or if the channel is still
+// open.
+func (dec *Decoder) Err() error {
+	dec.errMu.Lock()
+	defer dec.errMu.Unlock()
+	return dec.err
+}
+
+// signals returns the channels used to signal the end of Messages, creating
+// them if needed.
+func (dec *Decoder) signals() (done, stop chan struct{}) {
+	dec.errMu.Lock()
+	defer dec.errMu.Unlock()
+
+	if dec.done == nil {
+		dec.done = make(chan struct{})
+		dec.stop = make(chan struct{})
+	}
+	return dec.done, dec.stop
+}
+
+// stopMessages ends the goroutine started by Messages.
+func (dec *Decoder) stopMessages() {
+	_, stop := dec.signals()
+	dec.stopOnce.Do(func() {
+		close(stop)
+	})
+}
+
+// readMessages sends decoded messages to dec.messages until reading fails.
+func (dec *Decoder) readMessages() {
+	done, stop := dec.signals()
+
+	var err error
+	defer func() {
+		if err == io.EOF {
+			err = nil
+		}
+
+		dec.errMu.Lock()
+		dec.err = err
+		dec.errMu.Unlock()
+
+		close(dec.messages)
+		close(done)
+	}()
+
+	for {
+		var m *Message
+		if m, err = dec.Decode(); err != nil {
+			return
+		}
+
+		if m == nil {
+			continue
+		}
+
+		select {
+		case dec.messages <- m:
+		case <-stop:
+			err = ErrConnClosed
+			return
+		}
+	}
+}
+
+// rawLine returns line as received, without its line ending. That includes
+// the LF left at the start when CRLF lines are read using CR as delimiter.
+func rawLine(line string) string {
+	return strings.TrimRightFunc(strings.TrimPrefix(line, "\n"), cutsetFunc)
+}
+
+// parse parses a line and passes the result to the observer.
+func (dec *Decoder) parse(line string) (m *Message) {
+	raw := rawLine(line)
+	line = dec.convert(line)
+	if fn := dec.customParser(); fn != nil {
+		m = fn(strings.TrimRightFunc(line, cutsetFunc))
+	} else {
+		m = ParseMessage(line)
+	}
+	if m == nil || dec.dedup.duplicate(m, line) {
+		return nil
+	}
+
+	m.Raw = raw
+
+	if hook := loadMetrics(&dec.metrics); hook != nil {
+		hook.OnReceive(m.Command)
+	}
+	if dec.observer != nil {
+		dec.observer(m)
+	}
+	return m
+}
+
+// readLine reads the next line from the stream, finishing a read left behind
+// by DecodeContext first. The caller must hold dec.mu.
+func (dec *Decoder) readLine() (string, error) {
+	if dec.pending != nil {
+		r := <-dec.pending
+		dec.pending = nil
+		return r.line, r.err
+	}
+	return dec.readString()
+}
+
+// readString reads a line from the underlying reader, renewing the idle
+// timeout first.
+//
+// A final line without line ending is returned without error, the next call
+// returns io.EOF.
+func (dec *Decoder) readString() (string, error) {
+	if d := time.Duration(atomic.LoadInt64(&dec.idleTimeout)); d > 0 {
+		if err := dec.deadliner.SetReadDeadline(time.Now().Add(d)); err != nil {
+			return "", err
+		}
+	}
+
+	sep := delim
+	if dec.customDelim {
+		sep = dec.lineDelim
+	}
+
+	line, err := dec.readUntil(sep)
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if sep != delim {
+		line = strings.TrimSuffix(line, string(sep))
+	}
+	if err != nil && atomic.LoadInt32(&dec.closed) != 0 {
+		return "", ErrConnClosed
+	}
+	err = streamError(err)
+
+	if hook := loadMetrics(&dec.metrics); hook != nil && err != nil && err != io.EOF {
+		hook.OnError(err)
+	}
+	if log, ok := dec.traffic.Load().(trafficLog); ok && log != nil && err == nil {
+		log(line)
+	}
+	if log, ok := dec.journal.Load().(trafficLog); ok && log != nil && err == nil {
+		log(line)
+	}
+
+	return line, err
+}
+
+// readUntil reads up to and including sep, or returns ErrLineTooLong if that
+// would take more than the maximum line length.
+func (dec *Decoder) readUntil(sep byte) (string, error) {
+	if dec.maxLength <= 0 {
+		return dec.reader.ReadString(sep)
+	}
+
+	var line []byte
+	for {
+		chunk, err := dec.reader.ReadSlice(sep)
+
+		if len(line)+len(chunk) > dec.maxLength {
+			for dec.discardLong && err == bufio.ErrBufferFull {
+				_, err = dec.reader.ReadSlice(sep)
+			}
+			return "", ErrLineTooLong
+		}
+
+		line = append(line, chunk...)
+
+		if err != bufio.ErrBufferFull {
+			return string(line), err
+		}
+	}
 }
 
 // An Encoder writes Message objects to an output stream.
 type Encoder struct {
 	writer io.Writer
 	mu     sync.Mutex
+	limit  *Limiter // Optional rate limit
+
+	// Underlying writer if it supports deadlines, see SetWriteTimeout.
+	deadliner writeDeadliner
+
+	// Formatting options, locked separately so messages can be formatted
+	// while another goroutine is writing.
+	formatMu     sync.Mutex
+	maxLength    int  // Custom maximum line length
+	strict       bool // Return an error instead of truncating
+	stripInvalid bool // Remove line breaks instead of failing
+	alwaysColon  bool // Send the last parameter as trailing
+	requireUTF8  bool // Reject messages that are not valid UTF-8
+
+	writeTimeout time.Duration // Deadline for each write, if supported
+	noAutoFlush  bool          // Don't flush after every write
+
+	traffic atomic.Value // trafficLog, see Conn.SetTrafficLogger
+	journal atomic.Value // trafficLog, see Conn.SetJournal
+	metrics atomic.Value // metricsHook, see Conn.SetMetrics
+	closed  int32        // Set by Conn.Close, accessed atomically
+
+	draining int32 // Set by Conn.Shutdown, accessed atomically
 }
 
+// flusher is implemented by buffered writers, like bufio.Writer.
+type flusher interface {
+	Flush() error
+}
+
+// writeDeadliner is implemented by writers supporting write deadlines, like
+// net.Conn.
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// MaxLineLength is the default maximum length of an encoded message,
+// including CR+LF but excluding tags.
+const MaxLineLength = 512
+
+// ErrLineTooLong is returned when a message exceeds the maximum line length,
+// or a received line exceeds the limit set by SetMaxLineLength.
+var ErrLineTooLong = errors.New("irc: line too long")
+
+// ErrInvalidUTF8 is returned when encoding a message that is not valid UTF-8,
+// see Encoder.RequireUTF8.
+var ErrInvalidUTF8 = errors.New("irc: message is not valid UTF-8")
+
+// ErrNoDeadline is returned by SetWriteTimeout and SetIdleTimeout if the
+// underlying stream does not support deadlines.
+var ErrNoDeadline = errors.New("irc: stream does not support deadlines")
+
 // NewEncoder returns a new Encoder that writes to w.
 func NewEncoder(w io.Writer) *Encoder {
+	deadliner, _ := w.(writeDeadliner)
 	return &Encoder{
-		writer: w,
+		writer:    w,
+		deadliner: deadliner,
+	}
+}
+
+// SetRateLimit limits the rate at which messages are written, to avoid being
+// disconnected for flooding. Up to burst messages are written immediately,
+// after that one message is written every given duration.
+//
+// Writes block until they are allowed, while keeping their order. A burst or
+// duration of zero disables the rate limit, which is the default.
+func (enc *Encoder) SetRateLimit(burst int, every time.Duration) {
+	if burst > 0 && every > 0 {
+		enc.SetLimiter(NewLimiter(burst, every))
+	} else {
+		enc.SetLimiter(nil)
+	}
+}
+
+// SetLimiter limits the rate at which messages are written using l, like
+// SetRateLimit. The same Limiter may be passed to multiple Encoders to limit
+// their combined rate. A nil Limiter disables the rate limit.
+func (enc *Encoder) SetLimiter(l *Limiter) {
+	enc.mu.Lock()
+	enc.limit = l
+	enc.mu.Unlock()
+}
+
+// SetMaxLineLength sets the maximum length of an encoded message, including
+// CR+LF but excluding tags. Zero restores the default of MaxLineLength.
+//
+// Longer messages are truncated without splitting UTF-8 encoded characters.
+// If truncate is false, Encode returns ErrLineTooLong instead, without
+// writing anything.
+func (enc *Encoder) SetMaxLineLength(n int, truncate bool) {
+	enc.formatMu.Lock()
+	enc.maxLength = n
+	enc.strict = !truncate
+	enc.formatMu.Unlock()
+}
+
+// SetWriteTimeout limits the time a single write to the underlying stream may
+// take, so a dead or stuck peer causes an error instead of blocking forever.
+// Time spent waiting for the rate limit does not count. Zero disables the
+// timeout, which is the default.
+//
+// The underlying writer must support deadlines, like net.Conn does. Otherwise
+// this is a no-op returning ErrNoDeadline.
+func (enc *Encoder) SetWriteTimeout(d time.Duration) error {
+	w := enc.deadliner
+	if w == nil {
+		return ErrNoDeadline
 	}
+
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+
+	enc.writeTimeout = d
+
+	if d <= 0 {
+		return w.SetWriteDeadline(time.Time{})
+	}
+	return nil
+}
+
+// SetStripInvalid controls what Encode does with messages containing CR, LF
+// or NUL characters, other than the line ending. Those could be used to send
+// additional commands, for example by a user specifying them in a message.
+//
+// By default these messages are rejected with ErrInvalidParam. If strip is
+// true, the characters are removed and the message is sent anyway. This also
+// applies to invalid UTF-8, see RequireUTF8.
+func (enc *Encoder) SetStripInvalid(strip bool) {
+	enc.formatMu.Lock()
+	enc.stripInvalid = strip
+	enc.formatMu.Unlock()
+}
+
+// RequireUTF8 controls whether messages must be valid UTF-8, as required by
+// servers advertising UTF8ONLY in RPL_ISUPPORT, which may disconnect clients
+// sending anything else. Conn enables this when the server advertises it.
+//
+// Invalid messages are rejected with ErrInvalidUTF8, or sent with invalid
+// bytes replaced by U+FFFD if enabled using SetStripInvalid.
+func (enc *Encoder) RequireUTF8(require bool) {
+	enc.formatMu.Lock()
+	enc.requireUTF8 = require
+	enc.formatMu.Unlock()
+}
+
+// SetAutoFlush controls whether buffered writers are flushed after writing
+// every message, which is the default. Writers are buffered if they have a
+// Flush() error method, like bufio.Writer.
+//
+// Disable this to write several messages at once, using Flush afterwards.
+func (enc *Encoder) SetAutoFlush(enabled bool) {
+	enc.mu.Lock()
+	enc.noAutoFlush = !enabled
+	enc.mu.Unlock()
+}
+
+// SetAlwaysColonTrailing controls whether the last parameter is always sent
+// with a leading colon, even if it doesn't need one:
+//
+//    PRIVMSG #channel :Hello
+//    MODE #channel :+o
+//
+// By default the colon is only added when required, or when the message has
+// a trailing parameter. Enable this to match the exact output of other
+// implementations, for example when comparing against recorded traffic.
+func (enc *Encoder) SetAlwaysColonTrailing(enabled bool) {
+	enc.formatMu.Lock()
+	enc.alwaysColon = enabled
+	enc.formatMu.Unlock()
+}
+
+// Flush writes any buffered data to the underlying stream. This is a no-op
+// if the writer is not buffered.
+func (enc *Encoder) Flush() error {
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+
+	if f, ok := enc.writer.(flusher); ok {
+		return f.Flush()
+	}
+	return nil
 }
 
 // Encode writes the IRC encoding of m to the stream.
 //
+// Every message is terminated by exactly one CR+LF, stray line endings at the
+// end of the encoded message are removed. Messages containing other line
+// breaks are rejected, see SetStripInvalid. The message is written using a
+// single call to the underlying writer, followed by more calls for the rest
+// after a short write without error. Messages exceeding the maximum line
+// length are truncated, see SetMaxLineLength.
+//
 // This method may be used from multiple goroutines.
 //
 // Returns an non-nil error if the write to the underlying stream stopped early.
 func (enc *Encoder) Encode(m *Message) (err error) {
+	return enc.EncodeContext(context.Background(), m)
+}
 
-	_, err = enc.Write(m.Bytes())
+// EncodeContext is like Encode, but gives up waiting for the rate limit when
+// ctx is done. Nothing is written in that case, and ctx.Err() is returned.
+func (enc *Encoder) EncodeContext(ctx context.Context, m *Message) (err error) {
+
+	buf := getLineBuffer()
+	defer putLineBuffer(buf)
+
+	line, err := enc.format(*buf, m)
+	if err != nil {
+		enc.failed(err)
+		return err
+	}
+	*buf = line
+
+	_, err = enc.writeLine(ctx, line)
 
 	return
 }
 
+// EncodeTo writes the IRC encoding of m to w instead of the stream, formatted
+// exactly like Encode would, using a single call to w.Write. It doesn't wait
+// for writes to the stream or the rate limit, so it can be used to mirror
+// messages to a log or a second stream.
+//
+// Returns the number of bytes written, including the line ending.
+func (enc *Encoder) EncodeTo(w io.Writer, m *Message) (int, error) {
+	buf := getLineBuffer()
+	defer putLineBuffer(buf)
+
+	line, err := enc.format(*buf, m)
+	if err != nil {
+		return 0, err
+	}
+	*buf = line
+	return w.Write(line)
+}
+
+// EncodeAll writes the IRC encoding of every message to the stream, like
+// Encode does, without allowing other goroutines to write in between. Buffered
+// writers are flushed once, after writing all messages.
+//
+// Nothing is written if any of the messages is invalid. Otherwise, n is the
+// number of messages written before an error occurred.
+func (enc *Encoder) EncodeAll(msgs ...*Message) (n int, err error) {
+
+	lines := make([][]byte, len(msgs))
+	for i, m := range msgs {
+		buf := getLineBuffer()
+		defer putLineBuffer(buf)
+
+		if lines[i], err = enc.format(*buf, m); err != nil {
+			enc.failed(err)
+			return 0, err
+		}
+		*buf = lines[i]
+	}
+
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+
+	for n = 0; n < len(lines); n++ {
+		if _, err = enc.write(context.Background(), lines[n]); err != nil {
+			return n, err
+		}
+	}
+
+	return n, enc.autoFlush()
+}
+
+// Buffers larger than this are not reused, to avoid keeping the memory of a
+// few huge messages.
+const maxPooledLine = 16 * 1024
+
+// linePool holds buffers for formatting messages, see getLineBuffer.
+var linePool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, MaxLineLength)
+		return &buf
+	},
+}
+
+// getLineBuffer returns an empty buffer from linePool. The caller owns the
+// buffer until passing it to putLineBuffer.
+func getLineBuffer() *[]byte {
+	return linePool.Get().(*[]byte)
+}
+
+// putLineBuffer returns buf to linePool. Its contents must not be used
+// afterwards.
+func putLineBuffer(buf *[]byte) {
+	if cap(*buf) <= maxPooledLine {
+		*buf = (*buf)[:0]
+		linePool.Put(buf)
+	}
+}
+
+// format returns the IRC encoding of m, terminated by CR+LF. The result is
+// appended to buf[:0], which may be nil.
+func (enc *Encoder) format(buf []byte, m *Message) ([]byte, error) {
+	enc.formatMu.Lock()
+	maxLength, strict, stripInvalid := enc.maxLength, enc.strict, enc.stripInvalid
+	alwaysColon, requireUTF8 := enc.alwaysColon, enc.requireUTF8
+	enc.formatMu.Unlock()
+
+	// Send the last middle parameter as trailing parameter instead.
+	if n := len(m.Params); alwaysColon && n > 0 && len(m.Trailing) <= 0 && !m.EmptyTrailing {
+		colon := *m
+		colon.Params = m.Params[:n-1]
+		colon.Trailing = m.Params[n-1]
+		colon.EmptyTrailing = len(colon.Trailing) <= 0
+		m = &colon
+	}
+
+	if maxLength <= 0 {
+		maxLength = MaxLineLength
+	}
+	maxLength = maxLength - len(endline)
+
+	line, start := m.appendTo(buf[:0])
+	line = bytes.TrimRight(line, string(endline))
+
+	if bytes.IndexAny(line, invalidChars) >= 0 {
+		if !stripInvalid {
+			return nil, ErrInvalidParam
+		}
+		line = stripChars(line, invalidChars)
+	}
+
+	if requireUTF8 && !utf8.Valid(line) {
+		if !stripInvalid {
+			return nil, ErrInvalidUTF8
+		}
+		line = bytes.ToValidUTF8(line, []byte(string(utf8.RuneError)))
+	}
+
+	if len(line)-start > maxLength {
+		if strict {
+			return nil, ErrLineTooLong
+		}
+		line = bytes.TrimRight(truncateUTF8(line, start+maxLength), string(endline))
+	}
+
+	return append(line, endline...), nil
+}
+
+// Characters that must not appear in an encoded message.
+const invalidChars = "\r\n\x00"
+
+// stripChars removes every byte in chars from line, in place.
+func stripChars(line []byte, chars string) []byte {
+	stripped := line[:0]
+	for _, b := range line {
+		if indexByte(chars, b) < 0 {
+			stripped = append(stripped, b)
+		}
+	}
+	return stripped
+}
+
 // Write writes len(p) bytes from p followed by CR+LF.
 //
+// Unlike Encode, p is written as is. It must not contain line breaks.
+//
+// Like Encode, this writes the complete line, calling Write on the underlying
+// writer again after short writes, unless it returns an error.
+//
 // This method can be used simultaneously from multiple goroutines,
 // it guarantees to serialize access. However, writing a single IRC message
 // using multiple Write calls will cause corruption.
 func (enc *Encoder) Write(p []byte) (n int, err error) {
 
+	line := make([]byte, 0, len(p)+len(endline))
+	line = append(append(line, p...), endline...)
+
+	n, err = enc.writeLine(context.Background(), line)
+
+	// Don't report the line ending as written bytes of p.
+	if n > len(p) {
+		n = len(p)
+	}
+
+	return
+}
+
+// writeLine writes a complete line, waiting for the rate limit first.
+func (enc *Encoder) writeLine(ctx context.Context, line []byte) (n int, err error) {
 	enc.mu.Lock()
-	n, err = enc.writer.Write(p)
+	defer enc.mu.Unlock()
 
-	if err != nil {
-		enc.mu.Unlock()
+	if n, err = enc.write(ctx, line); err != nil {
 		return
 	}
 
-	_, err = enc.writer.Write(endline)
-	enc.mu.Unlock()
+	return n, enc.autoFlush()
+}
 
-	return
+// write writes a single line, waiting for the rate limit first. The caller
+// must hold enc.mu.
+func (enc *Encoder) write(ctx context.Context, line []byte) (n int, err error) {
+	if atomic.LoadInt32(&enc.closed) != 0 || atomic.LoadInt32(&enc.draining) != 0 {
+		return 0, ErrConnClosed
+	}
+
+	if enc.limit != nil {
+		if err = enc.limit.Wait(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	return enc.send(line)
+}
+
+// send writes a single line without waiting for the rate limit. The caller
+// must hold enc.mu.
+func (enc *Encoder) send(line []byte) (n int, err error) {
+	if atomic.LoadInt32(&enc.closed) != 0 {
+		return 0, ErrConnClosed
+	}
+
+	if enc.writeTimeout > 0 {
+		deadline := time.Now().Add(enc.writeTimeout)
+		if err = enc.deadliner.SetWriteDeadline(deadline); err != nil {
+			return 0, err
+		}
+	}
+
+	if log, ok := enc.traffic.Load().(trafficLog); ok && log != nil {
+		log(string(line))
+	}
+	if log, ok := enc.journal.Load().(trafficLog); ok && log != nil {
+		log(string(line))
+	}
+
+	n, err = writeFull(enc.writer, line)
+	err = streamError(err)
+
+	if hook := loadMetrics(&enc.metrics); hook != nil {
+		if err != nil {
+			hook.OnError(err)
+		} else {
+			hook.OnSend(lineCommand(line))
+		}
+	}
+	return n, err
+}
+
+// writeFull writes p to w, retrying after short writes until everything was
+// written or an error occurred. Returns io.ErrShortWrite if w accepts no data
+// without returning an error.
+func writeFull(w io.Writer, p []byte) (n int, err error) {
+	for n < len(p) {
+		var written int
+		written, err = w.Write(p[n:])
+		n += written
+		if err != nil {
+			return n, err
+		}
+		if written <= 0 {
+			return n, io.ErrShortWrite
+		}
+	}
+	return n, nil
+}
+
+// autoFlush flushes buffered writers, unless disabled using SetAutoFlush. The
+// caller must hold enc.mu.
+func (enc *Encoder) autoFlush() error {
+	if enc.noAutoFlush {
+		return nil
+	}
+
+	if f, ok := enc.writer.(flusher); ok {
+		return streamError(f.Flush())
+	}
+	return nil
+}
+
+// streamError translates errors of the underlying stream that have an
+// equivalent in this package.
+func streamError(err error) error {
+	if errors.Is(err, net.ErrClosed) || errors.Is(err, io.ErrClosedPipe) {
+		return fmt.Errorf("%w: %v", ErrConnClosed, err)
+	}
+	return err
 }
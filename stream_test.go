@@ -5,13 +5,23 @@
 package irc
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"io"
+	"io/ioutil"
 	"log"
+	"net"
+	"net/http/httptest"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // We use the Dial function as a simple shortcut for connecting to an IRC server using a standard TCP socket.
@@ -36,12 +46,59 @@ func ExampleNewConn() {
 	conn.Close()
 }
 
+// Use DialTLS to connect to servers that require an encrypted connection.
+func ExampleDialTLS() {
+	conn, err := DialTLS("irc.quakenet.org:6697", nil)
+	if err != nil {
+		log.Fatalln("Could not connect to IRC server")
+	}
+
+	conn.Close()
+}
+
+func TestDialTLS(t *testing.T) {
+
+	server := httptest.NewUnstartedServer(nil)
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	// The test certificate is not trusted by default.
+	if _, err := DialTLS(server.Listener.Addr().String(), nil); err == nil {
+		t.Fatal("DialTLS should fail to verify an unknown certificate!")
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	conn, err := DialTLS(server.Listener.Addr().String(), &tls.Config{RootCAs: pool})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	}
+	defer conn.Close()
+
+	if state, ok := conn.TLSConnectionState(); !ok || !state.HandshakeComplete {
+		t.Fatal("Expected a completed TLS handshake!")
+	}
+	if err := conn.SetKeepAlive(true, time.Minute); err != nil {
+		t.Errorf("Keepalive should be set under TLS: %v", err)
+	}
+
+	client, peer := net.Pipe()
+	defer peer.Close()
+
+	if _, ok := NewConn(client).TLSConnectionState(); ok {
+		t.Fatal("Plaintext connection should not report a TLS state!")
+	}
+}
+
 var stream = "PING port80a.se.quakenet.org\r\n:port80a.se.quakenet.org PONG port80a.se.quakenet.org :port80a.se.quakenet.org\r\nPING chat.freenode.net\r\n:wilhelm.freenode.net PONG wilhelm.freenode.net :chat.freenode.net\r\n"
 
 var result = [...]*Message{
 	{
 		Command: PING,
 		Params:  []string{"port80a.se.quakenet.org"},
+		Raw:     "PING port80a.se.quakenet.org",
 	},
 	{
 		Prefix: &Prefix{
@@ -50,10 +107,12 @@ var result = [...]*Message{
 		Command:  PONG,
 		Params:   []string{"port80a.se.quakenet.org"},
 		Trailing: "port80a.se.quakenet.org",
+		Raw:      ":port80a.se.quakenet.org PONG port80a.se.quakenet.org :port80a.se.quakenet.org",
 	},
 	{
 		Command: PING,
 		Params:  []string{"chat.freenode.net"},
+		Raw:     "PING chat.freenode.net",
 	},
 	{
 		Prefix: &Prefix{
@@ -62,6 +121,7 @@ var result = [...]*Message{
 		Command:  PONG,
 		Params:   []string{"wilhelm.freenode.net"},
 		Trailing: "chat.freenode.net",
+		Raw:      ":wilhelm.freenode.net PONG wilhelm.freenode.net :chat.freenode.net",
 	},
 }
 
@@ -85,6 +145,185 @@ func TestDecoder_Decode(t *testing.T) {
 	}
 }
 
+func TestDecoder_Decode_unterminated(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("PING :first\r\nERROR :Closing link"))
+
+	for _, command := range []string{PING, ERROR} {
+		if m, err := dec.Decode(); err != nil || m.Command != command {
+			t.Fatalf("Unexpected result: %v, %v", m, err)
+		}
+	}
+
+	if m, err := dec.Decode(); m != nil || err != io.EOF {
+		t.Errorf("Expected io.EOF, got: %v, %v", m, err)
+	}
+
+	// Nothing at all is a genuine EOF as well.
+	if m, err := NewDecoder(strings.NewReader("")).Decode(); m != nil || err != io.EOF {
+		t.Errorf("Expected io.EOF, got: %v, %v", m, err)
+	}
+}
+
+func TestDecoder_SetDelim(t *testing.T) {
+	streams := map[byte]string{
+		0:    "PING :first\x00NOTICE * :second\r\n\x00ERROR :third",
+		'\r': "PING :first\rNOTICE * :second\r\nERROR :third\r",
+	}
+
+	for sep, stream := range streams {
+		dec := NewDecoderDelim(strings.NewReader(stream), sep)
+
+		for _, command := range []string{PING, NOTICE, ERROR} {
+			m, err := dec.Decode()
+			if err != nil || m.Command != command {
+				t.Fatalf("Unexpected result for delimiter %q: %v, %v", sep, m, err)
+			}
+			if strings.ContainsAny(m.Raw, "\x00\r\n") {
+				t.Errorf("Delimiter %q not removed: %q", sep, m.Raw)
+			}
+		}
+
+		if m, err := dec.Decode(); m != nil || err != io.EOF {
+			t.Errorf("Expected io.EOF for delimiter %q, got: %v, %v", sep, m, err)
+		}
+	}
+}
+
+func TestDecoder_Decode_raw(t *testing.T) {
+	line := "@a=b;c :nick!user@host  PRIVMSG #channel :Hello"
+	dec := NewDecoder(strings.NewReader(line + "\r\n"))
+
+	m, err := dec.Decode()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m.Raw != line {
+		t.Errorf("Wrong raw line: %q", m.Raw)
+	}
+
+	// The raw line is not used when encoding.
+	m.Trailing = "Changed"
+	if strings.Contains(m.String(), "Hello") {
+		t.Errorf("Raw line should be ignored: %s", m.String())
+	}
+	if ParseMessage(line).Raw != "" {
+		t.Error("ParseMessage should not set the raw line.")
+	}
+
+	// Only the line ending is removed.
+	dec = NewDecoder(strings.NewReader(" PING server \r\n"))
+	if m, err = dec.Decode(); err != nil || m.Raw != " PING server " {
+		t.Errorf("Wrong raw line: %#v, %v", m, err)
+	}
+}
+
+func TestDecoder_DecodeContext(t *testing.T) {
+
+	reader, writer := io.Pipe()
+	dec := NewDecoder(reader)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// Nothing has been written yet, so the context should expire first.
+	if _, err := dec.DecodeContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected deadline error, got: %v", err)
+	}
+
+	// The cancelled read must not lose the line, even if it arrives in pieces.
+	go func() {
+		io.WriteString(writer, stream[:10])
+		io.WriteString(writer, stream[10:])
+		writer.Close()
+	}()
+
+	if message, err := dec.DecodeContext(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %s", err.Error())
+	} else if !reflect.DeepEqual(message, result[0]) {
+		t.Fatalf("Decoded message looks wrong!")
+	}
+
+	for i, test := range result[1:] {
+		if message, err := dec.Decode(); err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		} else if !reflect.DeepEqual(message, test) {
+			t.Fatalf("Decoded message looks wrong! (%d)", i+1)
+		}
+	}
+
+	if _, err := dec.DecodeContext(context.Background()); err != io.EOF {
+		t.Fatal("DecodeContext should return an EOF error!")
+	}
+
+	// A cancelled context should never start a read.
+	cancel()
+	if _, err := dec.DecodeContext(ctx); err == nil {
+		t.Fatal("DecodeContext should fail with a cancelled context!")
+	}
+}
+
+func TestDecoder_Messages(t *testing.T) {
+
+	dec := NewDecoder(strings.NewReader(stream + "\r\n"))
+
+	if dec.Messages() != dec.Messages() {
+		t.Fatal("Messages should always return the same channel!")
+	}
+
+	i := 0
+	for message := range dec.Messages() {
+		if i >= len(result) || !reflect.DeepEqual(message, result[i]) {
+			t.Fatalf("Decoded message looks wrong! (%d)", i)
+		}
+		i++
+	}
+
+	if i != len(result) {
+		t.Fatalf("Expected %d messages, got %d", len(result), i)
+	}
+
+	select {
+	case <-dec.Done():
+	default:
+		t.Fatal("Done should be closed.")
+	}
+
+	if dec.Err() != nil {
+		t.Fatalf("Err should return nil at EOF, got: %v", dec.Err())
+	}
+}
+
+func TestDecoder_Messages_error(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn := NewConn(client)
+	done := conn.Done()
+
+	go func() {
+		for i := 0; i < messagesBuffer+2; i++ {
+			if _, err := server.Write([]byte("PING :hello\r\n")); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Nobody is reading, so the buffer fills up.
+	<-conn.Messages()
+	time.Sleep(10 * time.Millisecond)
+	conn.Close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close should end the goroutine started by Messages.")
+	}
+
+	if conn.Err() != ErrConnClosed {
+		t.Errorf("Expected ErrConnClosed, got: %v", conn.Err())
+	}
+}
+
 func TestEncoder_Encode(t *testing.T) {
 
 	buffer := new(bytes.Buffer)
@@ -101,3 +340,1006 @@ func TestEncoder_Encode(t *testing.T) {
 	}
 
 }
+
+// countingWriter counts the number of calls to Write.
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestEncoder_Encode_lineEndings(t *testing.T) {
+
+	writer := new(countingWriter)
+	enc := NewEncoder(writer)
+
+	for _, trailing := range []string{"hello", "hello\n", "hello\r\n", "hello\n\r\n"} {
+		writer.Reset()
+		writer.writes = 0
+
+		if err := enc.Encode(&Message{Command: PRIVMSG, Params: []string{"#test"}, Trailing: trailing}); err != nil {
+			t.Fatalf("Unexpected error: %s", err.Error())
+		}
+
+		if writer.String() != "PRIVMSG #test :hello\r\n" {
+			t.Errorf("Wrong line ending for %q: %q", trailing, writer.String())
+		}
+		if writer.writes != 1 {
+			t.Errorf("Message should be written using a single Write call, got %d", writer.writes)
+		}
+	}
+}
+
+// shortWriter accepts at most n bytes per call to Write, without error.
+type shortWriter struct {
+	bytes.Buffer
+	n int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		p = p[:w.n]
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestEncoder_Encode_shortWrite(t *testing.T) {
+	writer := &shortWriter{n: 7}
+	enc := NewEncoder(writer)
+
+	if err := enc.Encode(&Message{Command: PRIVMSG, Params: []string{"#test"}, Trailing: "hello world"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n, err := enc.Write([]byte("PING :x")); n != 7 || err != nil {
+		t.Errorf("Unexpected result: %d, %v", n, err)
+	}
+	if writer.String() != "PRIVMSG #test :hello world\r\nPING :x\r\n" {
+		t.Errorf("Incomplete lines: %q", writer.String())
+	}
+
+	// Don't retry forever if the writer accepts nothing.
+	writer = &shortWriter{n: 0}
+	if err := NewEncoder(writer).Encode(&Message{Command: PING, Trailing: "x"}); err != io.ErrShortWrite {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestEncoder_Write(t *testing.T) {
+
+	writer := new(countingWriter)
+	enc := NewEncoder(writer)
+
+	if n, err := enc.Write([]byte("PING test")); err != nil || n != 9 {
+		t.Fatalf("Unexpected result: %d, %v", n, err)
+	}
+
+	if writer.String() != "PING test\r\n" || writer.writes != 1 {
+		t.Fatalf("Written line looks wrong: %q", writer.String())
+	}
+}
+
+func TestEncoder_SetMaxLineLength(t *testing.T) {
+
+	buffer := new(bytes.Buffer)
+	enc := NewEncoder(buffer)
+
+	// The default limit is 512 bytes, and a multibyte character must not be split.
+	long := &Message{Command: PRIVMSG, Params: []string{"#test"}, Trailing: strings.Repeat("a", 495) + "€€€"}
+	enc.Encode(long)
+	if buffer.String() != "PRIVMSG #test :"+strings.Repeat("a", 495)+"\r\n" {
+		t.Errorf("Message was not truncated on a character boundary: %q", buffer.String())
+	}
+
+	// Tags don't count.
+	buffer.Reset()
+	enc.Encode(&Message{Tags: map[string]string{"a": strings.Repeat("b", 1000)}, Command: PING})
+	if buffer.Len() != 1010 {
+		t.Errorf("Tags should not be truncated, got %d bytes", buffer.Len())
+	}
+
+	buffer.Reset()
+	enc.SetMaxLineLength(20, true)
+	enc.Encode(&Message{Command: PRIVMSG, Params: []string{"#test"}, Trailing: "Hello there!"})
+	if buffer.String() != "PRIVMSG #test :Hel\r\n" {
+		t.Errorf("Message was not truncated to the custom limit: %q", buffer.String())
+	}
+
+	buffer.Reset()
+	enc.SetMaxLineLength(1024, false)
+	if err := enc.Encode(long); err != nil {
+		t.Errorf("Message should fit the custom limit, got: %v", err)
+	}
+	if buffer.Len() != len(long.Trailing)+17 {
+		t.Errorf("Message should not be truncated, got %d bytes", buffer.Len())
+	}
+
+	buffer.Reset()
+	enc.SetMaxLineLength(0, false)
+	if err := enc.Encode(long); err != ErrLineTooLong {
+		t.Errorf("Expected ErrLineTooLong, got: %v", err)
+	}
+	if buffer.Len() > 0 {
+		t.Errorf("Nothing should be written, got: %q", buffer.String())
+	}
+}
+
+func TestEncoder_SetWriteTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	enc := NewEncoder(client)
+	if err := enc.SetWriteTimeout(10 * time.Millisecond); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Nobody reads from the other end of the pipe.
+	err := enc.Encode(&Message{Command: PING, Trailing: "irc.example.org"})
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		t.Errorf("Expected a timeout, got: %v", err)
+	}
+
+	if err := NewEncoder(new(bytes.Buffer)).SetWriteTimeout(time.Second); err != ErrNoDeadline {
+		t.Errorf("Expected ErrNoDeadline, got: %v", err)
+	}
+}
+
+// endlessReader never returns a line ending.
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a'
+	}
+	return len(p), nil
+}
+
+func TestDecoder_SetMaxLineLength(t *testing.T) {
+	dec := NewDecoder(endlessReader{})
+	dec.SetMaxLineLength(10000, false)
+
+	if m, err := dec.Decode(); m != nil || err != ErrLineTooLong {
+		t.Errorf("Expected ErrLineTooLong, got: %v, %v", m, err)
+	}
+
+	// The rest of a long line can be skipped.
+	long := "PRIVMSG #test :" + strings.Repeat("a", 10000) + "\r\n"
+	dec = NewDecoder(strings.NewReader(long + "PING :next\r\n"))
+	dec.SetMaxLineLength(512, true)
+
+	if m, err := dec.Decode(); m != nil || err != ErrLineTooLong {
+		t.Errorf("Expected ErrLineTooLong, got: %v, %v", m, err)
+	}
+	if m, err := dec.Decode(); err != nil || m.Command != PING {
+		t.Errorf("Expected next message, got: %v, %v", m, err)
+	}
+
+	// Lines up to the limit are fine.
+	dec = NewDecoder(strings.NewReader(long))
+	dec.SetMaxLineLength(len(long), false)
+
+	if m, err := dec.Decode(); err != nil || m.Command != PRIVMSG {
+		t.Errorf("Unexpected result: %v, %v", m, err)
+	}
+}
+
+func TestDecoder_SetIdleTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	conn := NewConn(client)
+	if err := conn.SetIdleTimeout(20 * time.Millisecond); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	go server.Write([]byte("PING :irc.example.org\r\n"))
+
+	if m, err := conn.Decode(); err != nil || m.Command != PING {
+		t.Fatalf("Unexpected result: %v, %v", m, err)
+	}
+
+	// The deadline is renewed, but nothing else is sent.
+	_, err := conn.Decode()
+	if e, ok := err.(net.Error); !ok || !e.Timeout() {
+		t.Errorf("Expected a timeout, got: %v", err)
+	}
+
+	if err := NewDecoder(strings.NewReader("")).SetIdleTimeout(time.Second); err != ErrNoDeadline {
+		t.Errorf("Expected ErrNoDeadline, got: %v", err)
+	}
+}
+
+func TestDecoder_DecodeInto(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("@a=b :nick!user@host PRIVMSG #channel :Hello\r\n:server NOTICE me\r\n\r\n@ invalid\r\n"))
+
+	var m Message
+
+	if err := dec.DecodeInto(&m); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if m.String() != "@a=b :nick!user@host PRIVMSG #channel :Hello" {
+		t.Errorf("Wrong message: %s", m.String())
+	}
+
+	prefix := m.Prefix
+
+	// Only the fields of the new message are set.
+	if err := dec.DecodeInto(&m); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := &Message{Prefix: &Prefix{Name: "server"}, Command: NOTICE, Params: []string{"me"}, Raw: ":server NOTICE me"}
+	if !reflect.DeepEqual(&m, expected) || m.Prefix != prefix {
+		t.Errorf("Wrong message: %#v", m)
+	}
+
+	if err := dec.DecodeInto(&m); err != io.EOF {
+		t.Errorf("Expected io.EOF, got: %v", err)
+	}
+}
+
+// decodeBenchmark returns a Decoder reading n messages.
+func decodeBenchmark(n int) *Decoder {
+	line := "@time=2011-10-19T16:40:51.620Z :Namename!username@hostname COMMAND arg1 arg2 arg3 :Message message message\r\n"
+	return NewDecoder(strings.NewReader(strings.Repeat(line, n)))
+}
+
+func BenchmarkDecoder_Decode(b *testing.B) {
+	dec := decodeBenchmark(b.N)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		dec.Decode()
+	}
+}
+
+func BenchmarkDecoder_DecodeInto(b *testing.B) {
+	dec := decodeBenchmark(b.N)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	var m Message
+	for i := 0; i < b.N; i++ {
+		dec.DecodeInto(&m)
+	}
+}
+
+func BenchmarkEncoder_Encode(b *testing.B) {
+	enc := NewEncoder(io.Discard)
+	m := ParseMessage("@time=2011-10-19T16:40:51.620Z :Namename!username@hostname PRIVMSG #channel :Message message message")
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		enc.Encode(m)
+	}
+}
+
+// countingConn counts the number of calls to Read and Write.
+type countingConn struct {
+	io.Reader
+	countingWriter
+	reads int
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	c.reads++
+	return c.Reader.Read(p)
+}
+
+func (c *countingConn) Close() error {
+	return nil
+}
+
+func TestNewConnSize(t *testing.T) {
+	rwc := &countingConn{Reader: strings.NewReader(strings.Repeat("PING :hello\r\n", 100))}
+	conn := NewConnSize(rwc, 16, 1024)
+
+	for i := 0; i < 100; i++ {
+		if m, err := conn.Decode(); err != nil || m.Command != PING {
+			t.Fatalf("Unexpected result: %v, %v", m, err)
+		}
+	}
+
+	// Messages are flushed by default.
+	conn.Encode(&Message{Command: PONG, Trailing: "first"})
+	if rwc.writes != 1 || rwc.String() != "PONG :first\r\n" {
+		t.Errorf("Message should be flushed: %q", rwc.String())
+	}
+
+	conn.SetAutoFlush(false)
+	conn.Encode(&Message{Command: PONG, Trailing: "second"})
+	conn.Encode(&Message{Command: PONG, Trailing: "third"})
+	if rwc.writes != 1 {
+		t.Errorf("Messages should be buffered: %q", rwc.String())
+	}
+
+	conn.Flush()
+	if rwc.writes != 2 || rwc.String() != "PONG :first\r\nPONG :second\r\nPONG :third\r\n" {
+		t.Errorf("Messages should be written at once: %q", rwc.String())
+	}
+}
+
+func BenchmarkNewConnSize(b *testing.B) {
+	for _, size := range []int{512, DefaultReadBufferSize, 65536} {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			line := "@time=2011-10-19T16:40:51.620Z :Namename!username@hostname COMMAND arg1 arg2 arg3 :Message message message\r\n"
+			rwc := &countingConn{Reader: strings.NewReader(strings.Repeat(line, b.N))}
+			conn := NewConnSize(rwc, size, 0)
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				conn.Decode()
+			}
+
+			b.ReportMetric(float64(rwc.reads)/float64(b.N), "reads/op")
+		})
+	}
+}
+
+func TestEncoder_SetAutoFlush(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	enc := NewEncoder(bufio.NewWriter(buffer))
+
+	if err := enc.Encode(&Message{Command: PING, Trailing: "first"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if buffer.String() != "PING :first\r\n" {
+		t.Errorf("Message should be flushed: %q", buffer.String())
+	}
+
+	enc.SetAutoFlush(false)
+	enc.Encode(&Message{Command: PING, Trailing: "second"})
+
+	if buffer.Len() != len("PING :first\r\n") {
+		t.Errorf("Message should not be flushed: %q", buffer.String())
+	}
+
+	if err := enc.Flush(); err != nil || buffer.String() != "PING :first\r\nPING :second\r\n" {
+		t.Errorf("Message should be flushed: %q, %v", buffer.String(), err)
+	}
+
+	if err := NewEncoder(buffer).Flush(); err != nil {
+		t.Errorf("Flush should be a no-op: %v", err)
+	}
+}
+
+func TestEncoder_SetStripInvalid(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	enc := NewEncoder(buffer)
+
+	for _, m := range []*Message{
+		{Command: PRIVMSG, Params: []string{"#chan"}, Trailing: "hi\r\nJOIN #evil"},
+		{Command: PRIVMSG, Params: []string{"#chan\nJOIN"}, Trailing: "hi"},
+		{Command: "PRIVMSG\r\nQUIT", Params: []string{"#chan"}, Trailing: "hi"},
+		{Command: PRIVMSG, Params: []string{"#chan"}, Trailing: "nul\x00byte"},
+	} {
+		if err := enc.Encode(m); err != ErrInvalidParam {
+			t.Errorf("Expected ErrInvalidParam for %q, got: %v", m.Trailing, err)
+		}
+	}
+	if buffer.Len() > 0 {
+		t.Errorf("Nothing should be written: %q", buffer.String())
+	}
+
+	enc.SetStripInvalid(true)
+	enc.Encode(&Message{Command: PRIVMSG, Params: []string{"#chan"}, Trailing: "hi\r\nJOIN #evil\x00"})
+
+	if buffer.String() != "PRIVMSG #chan :hiJOIN #evil\r\n" {
+		t.Errorf("Line breaks should be removed: %q", buffer.String())
+	}
+}
+
+func TestEncoder_RequireUTF8(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	enc := NewEncoder(buffer)
+
+	invalid := &Message{Command: PRIVMSG, Params: []string{"#chan"}, Trailing: "caf\xe9 \xff"}
+	if err := enc.Encode(invalid); err != nil {
+		t.Fatalf("Invalid UTF-8 should be allowed by default, got: %v", err)
+	}
+
+	buffer.Reset()
+	enc.RequireUTF8(true)
+
+	for _, m := range []*Message{
+		invalid,
+		{Command: PRIVMSG, Params: []string{"#caf\xe9"}, Trailing: "hi"},
+	} {
+		if err := enc.Encode(m); err != ErrInvalidUTF8 {
+			t.Errorf("Expected ErrInvalidUTF8 for %q, got: %v", m.String(), err)
+		}
+	}
+	if err := enc.Encode(&Message{Command: PRIVMSG, Params: []string{"#chan"}, Trailing: "café €"}); err != nil {
+		t.Errorf("Unexpected error for valid UTF-8: %v", err)
+	}
+	if buffer.String() != "PRIVMSG #chan :café €\r\n" {
+		t.Errorf("Only valid messages should be written: %q", buffer.String())
+	}
+
+	buffer.Reset()
+	enc.SetStripInvalid(true)
+	enc.Encode(invalid)
+
+	if buffer.String() != "PRIVMSG #chan :caf\uFFFD \uFFFD\r\n" {
+		t.Errorf("Invalid bytes should be replaced: %q", buffer.String())
+	}
+}
+
+func TestConn_RequireUTF8(t *testing.T) {
+	buffer := new(bufferConn)
+	conn := NewConn(&readWriter{strings.NewReader(":irc.example.org 005 me UTF8ONLY :are supported by this server\r\n"), buffer})
+
+	invalid := &Message{Command: PRIVMSG, Params: []string{"#chan"}, Trailing: "caf\xe9"}
+	if err := conn.Encode(invalid); err != nil {
+		t.Fatalf("Unexpected error before RPL_ISUPPORT: %v", err)
+	}
+
+	conn.Decode()
+
+	if err := conn.Encode(invalid); err != ErrInvalidUTF8 {
+		t.Errorf("Expected ErrInvalidUTF8 after UTF8ONLY, got: %v", err)
+	}
+}
+
+func TestEncoder_SetAlwaysColonTrailing(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	enc := NewEncoder(buffer)
+
+	msgs := []*Message{
+		ParseMessage("MODE #channel +o nick"),
+		ParseMessage("PRIVMSG #channel :Hello there"),
+		ParseMessage("PRIVMSG #channel Hello"),
+		ParseMessage("QUIT"),
+	}
+
+	for _, m := range msgs {
+		enc.Encode(m)
+	}
+	if buffer.String() != "MODE #channel +o nick\r\nPRIVMSG #channel :Hello there\r\nPRIVMSG #channel Hello\r\nQUIT\r\n" {
+		t.Errorf("Colons should only be added where needed: %q", buffer.String())
+	}
+
+	buffer.Reset()
+	enc.SetAlwaysColonTrailing(true)
+
+	for _, m := range msgs {
+		enc.Encode(m)
+	}
+	if buffer.String() != "MODE #channel +o :nick\r\nPRIVMSG #channel :Hello there\r\nPRIVMSG #channel :Hello\r\nQUIT\r\n" {
+		t.Errorf("The last parameter should have a colon: %q", buffer.String())
+	}
+	if msgs[0].Trailing != "" || len(msgs[0].Params) != 3 {
+		t.Errorf("The message should not be changed: %#v", msgs[0])
+	}
+}
+
+func TestConn_Close(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn := NewConn(client)
+
+	decoded := make(chan error)
+	go func() {
+		_, err := conn.Decode()
+		decoded <- err
+	}()
+
+	if err := conn.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	select {
+	case err := <-decoded:
+		if err != ErrConnClosed {
+			t.Errorf("Expected ErrConnClosed, got: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close should interrupt Decode.")
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Errorf("Second Close should return nil, got: %v", err)
+	}
+	if _, err := conn.Decode(); err != ErrConnClosed {
+		t.Errorf("Expected ErrConnClosed, got: %v", err)
+	}
+	if err := conn.Encode(&Message{Command: PING}); err != ErrConnClosed {
+		t.Errorf("Expected ErrConnClosed, got: %v", err)
+	}
+}
+
+func TestConn_Shutdown(t *testing.T) {
+	client, server := net.Pipe()
+	conn := NewConn(client)
+	peer := NewConn(server)
+
+	conn.SetRateLimit(1, 20*time.Millisecond)
+	conn.SetWriteQueue(10)
+	for _, text := range []string{"1", "2", "3"} {
+		conn.EncodePriority(&Message{Command: PRIVMSG, Params: []string{"#channel"}, Trailing: text}, Normal)
+	}
+
+	received := make(chan []string)
+	go func() {
+		var lines []string
+		for {
+			m, err := peer.Decode()
+			if err != nil {
+				break
+			}
+			lines = append(lines, m.String())
+			if m.Command == QUIT {
+				peer.Write([]byte("ERROR :Closing link"))
+				peer.Close()
+			}
+		}
+		received <- lines
+	}()
+
+	done := make(chan error)
+	go func() {
+		done <- conn.Shutdown(context.Background(), "Bye!")
+	}()
+
+	for atomic.LoadInt32(&conn.Encoder.draining) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := conn.Encode(&Message{Command: PRIVMSG, Params: []string{"#channel"}, Trailing: "late"}); err != ErrConnClosed {
+		t.Errorf("Expected ErrConnClosed during Shutdown, got: %v", err)
+	}
+	if err := conn.EncodePriority(&Message{Command: PONG, Trailing: "late"}, High); err != ErrConnClosed {
+		t.Errorf("Expected ErrConnClosed from the queue during Shutdown, got: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown should return once the server closed the connection.")
+	}
+
+	expected := []string{"PRIVMSG #channel :1", "PRIVMSG #channel :2", "PRIVMSG #channel :3", "QUIT :Bye!"}
+	if lines := <-received; !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Wrong lines written: %q", lines)
+	}
+
+	if err := conn.Shutdown(context.Background(), "Bye!"); err != nil {
+		t.Errorf("Second call should do nothing, got: %v", err)
+	}
+	if err := conn.Encode(&Message{Command: PING}); err != ErrConnClosed {
+		t.Errorf("Expected ErrConnClosed after Shutdown, got: %v", err)
+	}
+}
+
+func TestConn_Shutdown_timeout(t *testing.T) {
+	// The server never closes the connection.
+	client, server := net.Pipe()
+	defer server.Close()
+	go io.Copy(ioutil.Discard, server)
+
+	conn := NewConn(client)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := conn.Shutdown(ctx, "Bye!"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := client.Write([]byte("test")); err == nil {
+		t.Fatal("Connection should be closed!")
+	}
+
+	// Queued messages that can't be written in time.
+	client, server = net.Pipe()
+	defer server.Close()
+	go io.Copy(ioutil.Discard, server)
+
+	conn = NewConn(client)
+	conn.SetRateLimit(1, time.Hour)
+	conn.SetWriteQueue(10)
+	for i := 0; i < 3; i++ {
+		conn.EncodePriority(&Message{Command: PING, Trailing: "x"}, Normal)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := conn.Shutdown(ctx, "Bye!"); err != context.DeadlineExceeded {
+		t.Fatalf("Expected deadline error, got: %v", err)
+	}
+	if _, err := client.Write([]byte("test")); err == nil {
+		t.Fatal("Connection should be closed after an error!")
+	}
+}
+
+func TestConn_remoteClosed(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	conn := NewConn(client)
+	server.Close()
+
+	if err := conn.Encode(&Message{Command: PING}); !errors.Is(err, ErrConnClosed) {
+		t.Errorf("Expected ErrConnClosed, got: %v", err)
+	}
+	if _, err := conn.Decode(); err != io.EOF {
+		t.Errorf("Expected io.EOF, got: %v", err)
+	}
+}
+
+func TestConn_closedNetConn(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Closed behind the back of the Conn.
+	conn := NewConn(client)
+	client.Close()
+
+	// The cause is kept.
+	if _, err := conn.Decode(); !errors.Is(err, ErrConnClosed) || !strings.Contains(err.Error(), net.ErrClosed.Error()) {
+		t.Errorf("Expected ErrConnClosed, got: %v", err)
+	}
+}
+
+func TestConn_CloseWrite(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		server, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer server.Close()
+
+		// Wait for EOF before saying goodbye.
+		ioutil.ReadAll(server)
+		server.Write([]byte("ERROR :Closing link\r\n"))
+	}()
+
+	conn, err := Dial(listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	if err := conn.CloseWrite(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := conn.Encode(&Message{Command: PING}); err != ErrConnClosed {
+		t.Errorf("Expected ErrConnClosed, got: %v", err)
+	}
+	if m, err := conn.Decode(); err != nil || m.Command != ERROR {
+		t.Errorf("Unexpected result: %v, %v", m, err)
+	}
+
+	client, server := net.Pipe()
+	defer server.Close()
+
+	if err := NewConn(client).CloseWrite(); err != ErrNoCloseWrite {
+		t.Errorf("Expected ErrNoCloseWrite, got: %v", err)
+	}
+}
+
+// Run with the race detector to check the synchronization of Conn.
+func TestConn_concurrentDecodeEncode(t *testing.T) {
+	const n = 200
+
+	client, server := net.Pipe()
+	conn := NewConn(client)
+	conn.HandlePing()
+	defer conn.Close()
+
+	// The server reads every PONG and PRIVMSG while sending PING messages.
+	counted := make(chan error, 1)
+	go func() {
+		pongs, privmsgs := 0, 0
+		scanner := bufio.NewScanner(server)
+		for pongs < n || privmsgs < n {
+			if !scanner.Scan() {
+				counted <- io.ErrUnexpectedEOF
+				return
+			}
+			switch ParseMessage(scanner.Text()).Command {
+			case PONG:
+				pongs++
+			case PRIVMSG:
+				privmsgs++
+			}
+		}
+		counted <- nil
+	}()
+	go func() {
+		for i := 0; i < n; i++ {
+			if _, err := server.Write([]byte("PING :" + strconv.Itoa(i) + "\r\n")); err != nil {
+				return
+			}
+		}
+	}()
+
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			for {
+				if _, err := conn.Decode(); err != nil {
+					done <- struct{}{}
+					return
+				}
+				conn.CurrentNick()
+			}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		go func() {
+			for j := 0; j < n/4; j++ {
+				conn.Encode(&Message{Command: PRIVMSG, Params: []string{"#channel"}, Trailing: "Hello"})
+			}
+		}()
+	}
+
+	select {
+	case err := <-counted:
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for all messages")
+	}
+
+	server.Close()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Decode did not return after the connection was closed")
+		}
+	}
+}
+
+func TestConn_Addr(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		if server, err := listener.Accept(); err == nil {
+			server.Close()
+		}
+	}()
+
+	conn, err := Dial(listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer conn.Close()
+
+	if conn.RemoteAddr().String() != listener.Addr().String() {
+		t.Errorf("Unexpected remote address: %v", conn.RemoteAddr())
+	}
+	if conn.LocalAddr() == nil || conn.LocalAddr().String() == conn.RemoteAddr().String() {
+		t.Errorf("Unexpected local address: %v", conn.LocalAddr())
+	}
+
+	buffered := NewConn(new(bufferConn))
+	if buffered.RemoteAddr() != nil || buffered.LocalAddr() != nil {
+		t.Errorf("Expected nil addresses, got: %v, %v", buffered.RemoteAddr(), buffered.LocalAddr())
+	}
+}
+
+func TestDecoder_DecodeBytes(t *testing.T) {
+	input := "PRIVMSG #test :caf\xe9\r\nPRIVMSG #test :na\xefve\r\n"
+	dec := NewDecoder(strings.NewReader(input))
+
+	line, m, err := dec.DecodeBytes()
+	if err != nil || string(line) != "PRIVMSG #test :caf\xe9" || m.Trailing != "caf\xe9" {
+		t.Fatalf("Bytes should be kept as is: %q, %#v, %v", line, m, err)
+	}
+
+	// Latin-1 maps every byte to the same code point.
+	dec.SetCharset(func(line []byte) string {
+		runes := make([]rune, len(line))
+		for i, b := range line {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	})
+
+	line, m, err = dec.DecodeBytes()
+	if err != nil || string(line) != "PRIVMSG #test :na\xefve" || m.Trailing != "naïve" || m.Raw != "PRIVMSG #test :na\xefve" {
+		t.Fatalf("Line should be converted: %q, %#v, %v", line, m, err)
+	}
+
+	if _, _, err = dec.DecodeBytes(); err != io.EOF {
+		t.Errorf("Expected io.EOF, got: %v", err)
+	}
+}
+
+func TestDecoder_Peek(t *testing.T) {
+	input := "PING :first\r\n\r\n:irc.example.org\r\nPING :second\r\nPING :third\r\nPING :fourth\r\nPING :fifth\r\n"
+	dec := NewDecoder(strings.NewReader(input))
+
+	parsed := 0
+	dec.SetParser(func(line string) *Message {
+		parsed++
+		return ParseMessage(line)
+	})
+
+	for i := 0; i < 2; i++ {
+		if m, err := dec.Peek(); err != nil || m.Trailing != "first" {
+			t.Fatalf("Failed to peek %d: %#v, %v", i, m, err)
+		}
+	}
+	if m, err := dec.Decode(); err != nil || m.Trailing != "first" {
+		t.Fatalf("Decode should return the peeked message: %#v, %v", m, err)
+	}
+	if parsed != 1 {
+		t.Errorf("Peeked message should be parsed once, got: %d", parsed)
+	}
+
+	// Blank and invalid lines are skipped.
+	if m, err := dec.Peek(); err != nil || m.Trailing != "second" {
+		t.Fatalf("Failed to peek past invalid lines: %#v, %v", m, err)
+	}
+	if m, err := dec.DecodeContext(context.Background()); err != nil || m.Trailing != "second" {
+		t.Errorf("DecodeContext should return the peeked message: %#v, %v", m, err)
+	}
+
+	dec.Peek()
+	if line, m, err := dec.DecodeBytes(); err != nil || string(line) != "PING :third" || m.Trailing != "third" {
+		t.Errorf("DecodeBytes should return the peeked message: %q, %#v, %v", line, m, err)
+	}
+
+	dec.Peek()
+	var m Message
+	if err := dec.DecodeInto(&m); err != nil || m.Trailing != "fourth" {
+		t.Errorf("DecodeInto should return the peeked message: %#v, %v", m, err)
+	}
+
+	if m, err := dec.Decode(); err != nil || m.Trailing != "fifth" {
+		t.Errorf("Decode without Peek should read the next message: %#v, %v", m, err)
+	}
+
+	if _, err := dec.Peek(); err != io.EOF {
+		t.Errorf("Expected io.EOF, got: %v", err)
+	}
+	if _, err := dec.Decode(); err != io.EOF {
+		t.Errorf("Expected io.EOF after a failed Peek, got: %v", err)
+	}
+}
+
+func TestEncoder_EncodeTo(t *testing.T) {
+	writer := new(countingWriter)
+	enc := NewEncoder(writer)
+	enc.SetAlwaysColonTrailing(true)
+
+	// Formatting does not wait for writes to the stream.
+	enc.mu.Lock()
+	defer enc.mu.Unlock()
+
+	mirror := new(bytes.Buffer)
+	n, err := enc.EncodeTo(mirror, &Message{Command: MODE, Params: []string{"#channel", "+o", "nick"}})
+
+	if n != 24 || err != nil || mirror.String() != "MODE #channel +o :nick\r\n" {
+		t.Errorf("Unexpected result: %d, %v, %q", n, err, mirror.String())
+	}
+	if _, err := enc.EncodeTo(mirror, &Message{Command: PRIVMSG, Params: []string{"#channel"}, Trailing: "a\r\nQUIT"}); err != ErrInvalidParam {
+		t.Errorf("Expected ErrInvalidParam, got: %v", err)
+	}
+	if writer.writes > 0 || mirror.Len() != 24 {
+		t.Errorf("Unexpected writes: %d, %q", writer.writes, mirror.String())
+	}
+}
+
+func TestEncoder_EncodeAll(t *testing.T) {
+	writer := new(countingWriter)
+	buffered := bufio.NewWriter(writer)
+	enc := NewEncoder(buffered)
+
+	n, err := enc.EncodeAll(
+		&Message{Command: CAP, Params: []string{CAP_REQ}, Trailing: "sasl"},
+		&Message{Command: CAP, Params: []string{CAP_REQ}, Trailing: "batch"},
+		&Message{Command: CAP, Params: []string{CAP_END}},
+	)
+	if n != 3 || err != nil {
+		t.Fatalf("Unexpected result: %d, %v", n, err)
+	}
+	if writer.writes != 1 || writer.String() != "CAP REQ :sasl\r\nCAP REQ :batch\r\nCAP END\r\n" {
+		t.Errorf("Messages should be written at once: %q", writer.String())
+	}
+
+	// Nothing is written if a message is invalid.
+	n, err = enc.EncodeAll(&Message{Command: PING}, &Message{Command: PRIVMSG, Params: []string{"#a"}, Trailing: "a\nb"})
+	if n != 0 || err != ErrInvalidParam || writer.writes != 1 {
+		t.Errorf("Unexpected result: %d, %v", n, err)
+	}
+
+	// Writing stops at the first error.
+	client, server := net.Pipe()
+	go func() {
+		peer := NewDecoder(server)
+		peer.Decode()
+		server.Close()
+	}()
+
+	n, err = NewEncoder(client).EncodeAll(&Message{Command: PING}, &Message{Command: PING}, &Message{Command: PING})
+	if n != 1 || !errors.Is(err, ErrConnClosed) {
+		t.Errorf("Unexpected result: %d, %v", n, err)
+	}
+}
+
+func TestDecoder_SetSkipEmpty(t *testing.T) {
+	stream := "\r\n  \r\nPING :a\r\n\r\n\t\r\nPING :b\r\n\r\n\r\n"
+
+	dec := NewDecoder(strings.NewReader(stream))
+	if m, err := dec.Decode(); m != nil || err != nil {
+		t.Errorf("Blank lines should be returned by default: %v, %v", m, err)
+	}
+
+	dec = NewDecoder(strings.NewReader(stream))
+	dec.SetSkipEmpty(true)
+
+	if m, err := dec.Decode(); err != nil || m == nil || m.Trailing != "a" {
+		t.Errorf("Unexpected result: %v, %v", m, err)
+	}
+	if m, err := dec.DecodeContext(context.Background()); err != nil || m == nil || m.Trailing != "b" {
+		t.Errorf("Unexpected result: %v, %v", m, err)
+	}
+	if m, err := dec.Decode(); m != nil || err != io.EOF {
+		t.Errorf("Blank lines before EOF: %v, %v", m, err)
+	}
+}
+
+func TestDecoder_SetParser(t *testing.T) {
+	stream := "MOVE 3 4\r\nskip\r\nMOVE 5 6\r\n"
+
+	var lines []string
+	dec := NewDecoder(strings.NewReader(stream))
+	dec.SetParser(func(line string) *Message {
+		lines = append(lines, line)
+		if fields := strings.Fields(line); len(fields) == 3 {
+			return &Message{Command: fields[0], Params: fields[1:]}
+		}
+		return nil
+	})
+
+	if m, err := dec.Decode(); err != nil || m == nil || m.Command != "MOVE" || m.Params[1] != "4" {
+		t.Errorf("Unexpected result: %v, %v", m, err)
+	}
+
+	var m Message
+	if err := dec.DecodeInto(&m); err != nil || m.Params[0] != "5" || m.Raw != "MOVE 5 6" {
+		t.Errorf("Unexpected result: %v, %v", &m, err)
+	}
+
+	if expected := []string{"MOVE 3 4", "skip", "MOVE 5 6"}; !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Wrong lines passed to the parser: %q", lines)
+	}
+
+	dec = NewDecoder(strings.NewReader(stream))
+	dec.SetParser(nil)
+	if m, err := dec.Decode(); err != nil || m == nil || len(m.Params) != 2 {
+		t.Errorf("Unexpected result with the default parser: %v, %v", m, err)
+	}
+}
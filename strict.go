@@ -0,0 +1,203 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrMalformedMessage is wrapped by every *ParseError, except for empty
+	// messages.
+	ErrMalformedMessage = errors.New("irc: malformed message")
+
+	// ErrEmptyMessage is wrapped by the *ParseError for empty messages.
+	ErrEmptyMessage = errors.New("irc: empty message")
+)
+
+// Maximum number of parameters, including the trailing parameter.
+const maxParams = 15
+
+// ParseError is returned by ParseMessageStrict for messages that violate the
+// protocol. Use errors.Is with ErrEmptyMessage or ErrMalformedMessage to check
+// for a kind of error.
+type ParseError struct {
+	Line   string // The offending line
+	Reason string // Description of the problem
+}
+
+func (e *ParseError) Error() string {
+	return "irc: invalid message: " + e.Reason
+}
+
+// Unwrap returns ErrEmptyMessage or ErrMalformedMessage.
+func (e *ParseError) Unwrap() error {
+	if e.Reason == reasonEmpty {
+		return ErrEmptyMessage
+	}
+	return ErrMalformedMessage
+}
+
+// Reason of the *ParseError for empty messages.
+const reasonEmpty = "empty message"
+
+// ParseMessageStrict is like ParseMessage, but returns a *ParseError for
+// messages that violate RFC1459, instead of parsing them as well as possible.
+//
+// Only the line ending is removed, all other whitespace is significant.
+// Messages are rejected if they have an empty or invalid command, are longer
+// than 512 bytes (excluding tags), contain empty parameters, more than 15
+// parameters, NUL or line break characters, or an invalid prefix.
+func ParseMessageStrict(raw string) (m *Message, err error) {
+
+	line := strings.TrimSuffix(strings.TrimSuffix(raw, "\n"), "\r")
+
+	invalid := func(reason string) (*Message, error) {
+		return nil, &ParseError{Line: raw, Reason: reason}
+	}
+
+	if len(line) <= 0 {
+		return invalid(reasonEmpty)
+	}
+
+	if strings.ContainsAny(line, "\x00\r\n") {
+		return invalid("message contains NUL or line break characters")
+	}
+
+	// Tags don't count towards the length limit.
+	body := line
+	if body[0] == tagPrefix {
+		i := indexByte(body, space)
+		if i < 2 {
+			return invalid("empty tags")
+		}
+		body = body[i+1:]
+	}
+
+	if len(body) > maxLength {
+		return invalid("message too long")
+	}
+
+	if len(body) > 0 && body[0] == prefix {
+		i := indexByte(body, space)
+		if i < 2 {
+			return invalid("empty prefix")
+		}
+		if !validPrefix(body[1:i]) {
+			return invalid("invalid prefix")
+		}
+	}
+
+	if m = ParseMessage(line); m == nil || len(m.Command) <= 0 {
+		return invalid("empty command")
+	}
+
+	if !validCommand(m.Command) {
+		return invalid("invalid command")
+	}
+
+	for _, param := range m.Params {
+		if len(param) <= 0 {
+			return invalid("empty parameter")
+		}
+	}
+
+	count := len(m.Params)
+	if len(m.Trailing) > 0 || m.EmptyTrailing {
+		count++
+	}
+	if count > maxParams {
+		return invalid("too many parameters")
+	}
+
+	return m, nil
+}
+
+// ParseMessageLenient is like ParseMessage, but tolerates the sloppy
+// formatting of some legacy servers and bouncers. Runs of spaces between the
+// tags, prefix, command and parameters are treated as a single space instead
+// of separating empty parameters, and spaces and NUL bytes padding the line
+// are removed:
+//
+//    :irc.example.org  NOTICE   me  :Hello\x00\x00
+//    :irc.example.org NOTICE me :Hello
+//
+// As a consequence, spaces at the end of the trailing parameter are removed
+// as well. Returns nil if the message is invalid.
+func ParseMessageLenient(raw string) *Message {
+	line := strings.TrimLeft(raw, " \r\n")
+	line = strings.TrimRight(line, " \x00\r\n")
+
+	normalized := make([]byte, 0, len(line))
+	command := false
+
+	for {
+		if line = strings.TrimLeft(line, " "); len(line) <= 0 {
+			break
+		}
+		if len(normalized) > 0 {
+			normalized = append(normalized, space)
+		}
+
+		// The trailing parameter is kept as is.
+		if command && line[0] == prefix {
+			normalized = append(normalized, line...)
+			break
+		}
+
+		i := indexByte(line, space)
+		if i < 0 {
+			i = len(line)
+		}
+
+		// Tags and prefix come before the command.
+		tags := len(normalized) == 0 && line[0] == tagPrefix
+		if !tags && (command || line[0] != prefix) {
+			command = true
+		}
+
+		normalized = append(normalized, line[:i]...)
+		line = line[i:]
+	}
+
+	return ParseMessage(string(normalized))
+}
+
+// validPrefix returns true if the user and host parts of raw are not empty
+// when present, and the name is not empty.
+func validPrefix(raw string) bool {
+	user := indexByte(raw, prefixUser)
+	host := indexByte(raw, prefixHost)
+
+	switch {
+	case user == 0 || host == 0:
+		return false
+	case user > 0 && host > user:
+		return host > user+1 && host < len(raw)-1
+	case user > 0:
+		return user < len(raw)-1
+	case host > 0:
+		return host < len(raw)-1
+	}
+
+	return true
+}
+
+// validCommand returns true if command consists of letters only, or is a
+// three digit numeric.
+func validCommand(command string) bool {
+	if len(command) == 3 && isDigit(command[0]) && isDigit(command[1]) && isDigit(command[2]) {
+		return true
+	}
+
+	for i := 0; i < len(command); i++ {
+		if (command[i] < 'A' || command[i] > 'Z') && (command[i] < 'a' || command[i] > 'z') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,116 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMessageStrict(t *testing.T) {
+
+	// All valid messages in the table should be accepted.
+	for i, test := range messageTests {
+		if test.parsed == nil {
+			continue
+		}
+
+		// This one contains an empty parameter on purpose.
+		if test.rawMessage == "TEST $@  param :Trailing" {
+			continue
+		}
+
+		m, err := ParseMessageStrict(test.rawMessage + "\r\n")
+		if err != nil {
+			t.Errorf("Message %d should be valid: %v", i, err)
+		} else if !reflect.DeepEqual(m, test.parsed) {
+			t.Errorf("Failed to parse message %d:", i)
+			t.Logf("Output: %#v", m)
+			t.Logf("Expected: %#v", test.parsed)
+		}
+	}
+}
+
+func TestParseMessageStrict_invalid(t *testing.T) {
+	tests := []struct {
+		raw, reason string
+	}{
+		{"", "empty message"},
+		{"\r\n", "empty message"},
+		{"PRIVMSG #test :hello\x00world", "message contains NUL or line break characters"},
+		{"PRIVMSG #test :hello\rworld", "message contains NUL or line break characters"},
+		{"@ PING", "empty tags"},
+		{"PRIVMSG #test :" + strings.Repeat("a", 500), "message too long"},
+		{": PING", "empty prefix"},
+		{":nick! PING", "invalid prefix"},
+		{":nick!@host PING", "invalid prefix"},
+		{":nick@ PING", "invalid prefix"},
+		{":!user@host PING", "invalid prefix"},
+		{":nick ", "empty command"},
+		{"PRIV-MSG #test", "invalid command"},
+		{"12 #test", "invalid command"},
+		{"PRIVMSG #test  :hello", "empty parameter"},
+		{"PRIVMSG #test ", "empty parameter"},
+		{"CMD 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16", "too many parameters"},
+		{"CMD 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 :16", "too many parameters"},
+	}
+
+	for i, test := range tests {
+		m, err := ParseMessageStrict(test.raw)
+		if m != nil {
+			t.Errorf("Message %d should be invalid: %s", i, m)
+		}
+		if e, ok := err.(*ParseError); !ok || e.Reason != test.reason || e.Line != test.raw {
+			t.Errorf("Wrong error for message %d: %v", i, err)
+		}
+
+		kind := ErrMalformedMessage
+		if test.reason == "empty message" {
+			kind = ErrEmptyMessage
+		}
+		if !errors.Is(err, kind) {
+			t.Errorf("Error for message %d should wrap %v: %v", i, kind, err)
+		}
+	}
+
+	// Long tags are fine.
+	if _, err := ParseMessageStrict("@a=" + strings.Repeat("a", 1000) + " PING"); err != nil {
+		t.Errorf("Long tags should be accepted: %v", err)
+	}
+}
+
+func TestParseMessageLenient(t *testing.T) {
+	tests := []struct {
+		raw, expected string
+	}{
+		{":irc.example.org  NOTICE   me  :Hello there  \x00\x00\r\n", ":irc.example.org NOTICE me :Hello there"},
+		{"  PRIVMSG #test hello   \r\n", "PRIVMSG #test hello"},
+		{"@time=2011-10-19T16:40:51.620Z   :nick!user@host  PRIVMSG  #test :a  b", "@time=2011-10-19T16:40:51.620Z :nick!user@host PRIVMSG #test :a  b"},
+		{"MODE #test  +o  :nick", "MODE #test +o nick"},
+		{"PING\x00", "PING"},
+	}
+
+	for i, test := range tests {
+		m := ParseMessageLenient(test.raw)
+		if expected := ParseMessage(test.expected); !m.Equal(expected) {
+			t.Errorf("Failed to parse message %d:", i)
+			t.Logf("Output: %#v", m)
+			t.Logf("Expected: %#v", expected)
+		}
+	}
+
+	for _, raw := range []string{"", "   \x00\r\n", ":nick  "} {
+		if m := ParseMessageLenient(raw); m != nil && len(m.Command) > 0 {
+			t.Errorf("Message %q should be invalid: %#v", raw, m)
+		}
+	}
+
+	// The default parser keeps the empty parameters.
+	if m := ParseMessage("PRIVMSG #test  hello \x00\r\n"); len(m.Params) != 4 {
+		t.Errorf("Unexpected parameters: %q", m.Params)
+	}
+}
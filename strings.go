@@ -2,16 +2,13 @@
 //
 // Use of this source code is governed by the MIT license.
 
-// +build go1.2
-
-// Documented in strings_legacy.go
-
 package irc
 
 import (
 	"strings"
 )
 
+// indexByte returns the index of the first c in s, or -1.
 func indexByte(s string, c byte) int {
 	return strings.IndexByte(s, c)
 }
@@ -0,0 +1,65 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strings"
+)
+
+// Commands taking a comma-separated list of targets as first parameter.
+var targetCommands = map[string]bool{
+	PRIVMSG: true,
+	NOTICE:  true,
+	TAGMSG:  true,
+	JOIN:    true,
+	PART:    true,
+}
+
+// Targets returns the comma-separated targets in the first parameter of
+// PRIVMSG, NOTICE, TAGMSG, JOIN and PART messages:
+//
+//    PRIVMSG #a,#b,nick :Hello
+//
+// Empty targets, as caused by a trailing comma, are skipped. Returns nil for
+// other commands, or if there are no targets.
+func (m *Message) Targets() []string {
+	if !targetCommands[strings.ToUpper(m.Command)] {
+		return nil
+	}
+	return splitList(firstParam(m))
+}
+
+// NewPrivmsgMulti returns a PRIVMSG sending text to all targets at once.
+// Empty targets are skipped. Servers limit the number of targets, see the
+// TARGMAX feature.
+func NewPrivmsgMulti(targets []string, text string) *Message {
+	return &Message{
+		Command:  PRIVMSG,
+		Params:   []string{joinList(targets)},
+		Trailing: text,
+	}
+}
+
+// splitList splits a comma-separated list, skipping empty values.
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if len(value) > 0 {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// joinList returns a comma-separated list of the non-empty values.
+func joinList(values []string) string {
+	list := make([]string, 0, len(values))
+	for _, value := range values {
+		if len(value) > 0 {
+			list = append(list, value)
+		}
+	}
+	return strings.Join(list, ",")
+}
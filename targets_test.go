@@ -0,0 +1,42 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMessage_Targets(t *testing.T) {
+	tests := [...]struct {
+		line    string
+		targets []string
+	}{
+		{"PRIVMSG #a,#b,nick :Hello", []string{"#a", "#b", "nick"}},
+		{"NOTICE #a,,nick, :Hello", []string{"#a", "nick"}},
+		{"privmsg nick :Hello", []string{"nick"}},
+		{":nick JOIN :#a,#b", []string{"#a", "#b"}},
+		{"PART #a,#b :Bye", []string{"#a", "#b"}},
+		{"PRIVMSG , :Hello", nil},
+		{"KICK #a,#b nick", nil},
+		{"PING :a,b", nil},
+	}
+
+	for i, test := range tests {
+		if targets := ParseMessage(test.line).Targets(); !reflect.DeepEqual(targets, test.targets) {
+			t.Errorf("Wrong targets for message %d: %q", i, targets)
+		}
+	}
+}
+
+func TestNewPrivmsgMulti(t *testing.T) {
+	m := NewPrivmsgMulti([]string{"#a", "", "nick"}, "Hello")
+	if m.String() != "PRIVMSG #a,nick :Hello" {
+		t.Errorf("Wrong message: %s", m)
+	}
+	if !reflect.DeepEqual(m.Targets(), []string{"#a", "nick"}) {
+		t.Errorf("Wrong targets: %q", m.Targets())
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strconv"
+	"time"
+)
+
+// Topic is the topic of a channel.
+type Topic struct {
+	Text  string    // Empty if no topic is set
+	SetBy string    // Nick or hostmask of the user who set the topic
+	SetAt time.Time // Zero if unknown
+}
+
+// ParseTopic returns the channel and topic in a TOPIC, RPL_TOPIC,
+// RPL_NOTOPIC or RPL_TOPICWHOTIME message:
+//
+//    :nick!user@host TOPIC #channel :New topic
+//    :irc.example.org 332 me #channel :New topic
+//    :irc.example.org 333 me #channel nick!user@host 1600000000
+//
+// Servers send the text and who set it in separate replies when joining a
+// channel, so the topic returned for RPL_TOPIC only has Text, and the one
+// for RPL_TOPICWHOTIME only SetBy and SetAt. For TOPIC, SetAt is the time
+// in the server-time tag, or the current time without it. Returns false if
+// m is none of these messages, or malformed.
+func ParseTopic(m *Message) (channel string, t Topic, ok bool) {
+	params := m.allParams()
+
+	switch m.Command {
+	case TOPIC:
+		if len(params) < 2 || m.Prefix == nil {
+			return "", Topic{}, false
+		}
+		t.Text, t.SetBy = params[1], m.Prefix.String()
+		if t.SetAt, ok = m.Time(); !ok {
+			t.SetAt = time.Now()
+		}
+		return params[0], t, true
+
+	case RPL_TOPIC:
+		if len(params) < 3 {
+			return "", Topic{}, false
+		}
+		return params[1], Topic{Text: params[2]}, true
+
+	case RPL_NOTOPIC:
+		if len(params) < 2 {
+			return "", Topic{}, false
+		}
+		return params[1], Topic{}, true
+
+	case RPL_TOPICWHOTIME:
+		if len(params) < 4 {
+			return "", Topic{}, false
+		}
+		seconds, err := strconv.ParseInt(params[3], 10, 64)
+		if err != nil {
+			return "", Topic{}, false
+		}
+		return params[1], Topic{SetBy: params[2], SetAt: time.Unix(seconds, 0)}, true
+	}
+
+	return "", Topic{}, false
+}
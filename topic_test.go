@@ -0,0 +1,87 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTopic(t *testing.T) {
+	at := time.Unix(1600000000, 0)
+
+	tests := []struct {
+		line    string
+		channel string
+		topic   Topic
+		ok      bool
+	}{
+		{"@time=2020-09-13T12:26:40.000Z :vic!sorcix@example.org TOPIC #go-nuts :Go away", "#go-nuts", Topic{"Go away", "vic!sorcix@example.org", at}, true},
+		{":irc.example.org 332 me #go-nuts :Go away", "#go-nuts", Topic{Text: "Go away"}, true},
+		{":irc.example.org 333 me #go-nuts vic!sorcix@example.org 1600000000", "#go-nuts", Topic{SetBy: "vic!sorcix@example.org", SetAt: at}, true},
+		{":irc.example.org 333 me #go-nuts vic :1600000000", "#go-nuts", Topic{SetBy: "vic", SetAt: at}, true},
+		{":irc.example.org 331 me #go-nuts :No topic is set", "#go-nuts", Topic{}, true},
+		{":irc.example.org 333 me #go-nuts vic yesterday", "", Topic{}, false},
+		{":irc.example.org 332 me :Go away", "", Topic{}, false},
+		{"TOPIC #go-nuts :Go away", "", Topic{}, false},
+		{":vic!sorcix@example.org PRIVMSG #go-nuts :Go away", "", Topic{}, false},
+	}
+
+	for i, test := range tests {
+		channel, topic, ok := ParseTopic(ParseMessage(test.line))
+		if channel != test.channel || topic.Text != test.topic.Text || topic.SetBy != test.topic.SetBy || !topic.SetAt.Equal(test.topic.SetAt) || ok != test.ok {
+			t.Errorf("Failed to parse topic %d:", i)
+			t.Logf("Output: %q, %+v, %v", channel, topic, ok)
+			t.Logf("Expected: %q, %+v, %v", test.channel, test.topic, test.ok)
+		}
+	}
+
+	before := time.Now()
+	if _, topic, _ := ParseTopic(ParseMessage(":vic!sorcix@example.org TOPIC #go-nuts :Go away")); topic.SetAt.Before(before) {
+		t.Errorf("Topic without server-time should be set now: %s", topic.SetAt)
+	}
+}
+
+func TestState_Topic(t *testing.T) {
+	var s State
+
+	for _, line := range []string{
+		":irc.example.org 001 me :Welcome",
+		":me!me@example.org JOIN #go-nuts",
+		":irc.example.org 332 me #go-nuts :Go away",
+		":irc.example.org 333 me #go-nuts vic 1600000000",
+	} {
+		if !s.Update(ParseMessage(line)) {
+			t.Errorf("Message should update the state: %s", line)
+		}
+	}
+
+	if topic, ok := s.Topic("#Go-Nuts"); !ok || topic.Text != "Go away" || topic.SetBy != "vic" || !topic.SetAt.Equal(time.Unix(1600000000, 0)) {
+		t.Errorf("Wrong topic after joining: %+v, %v", topic, ok)
+	}
+
+	s.Update(ParseMessage("@time=2020-09-13T12:30:00.000Z :alice!alice@example.org TOPIC #go-nuts :Welcome"))
+	if topic, ok := s.Topic("#go-nuts"); !ok || topic.Text != "Welcome" || topic.SetBy != "alice!alice@example.org" || !topic.SetAt.Equal(time.Unix(1600000200, 0)) {
+		t.Errorf("Wrong topic after change: %+v, %v", topic, ok)
+	}
+
+	s.Update(ParseMessage(":alice!alice@example.org TOPIC #go-nuts :"))
+	if topic, ok := s.Topic("#go-nuts"); ok {
+		t.Errorf("Removed topic should not be returned: %+v", topic)
+	}
+
+	if s.Update(ParseMessage(":irc.example.org 332 me #elsewhere :Other")) {
+		t.Error("Topics of other channels should not update the state.")
+	}
+	if _, ok := s.Topic("#elsewhere"); ok {
+		t.Error("Topics of other channels should not be stored.")
+	}
+
+	s.Update(ParseMessage(":irc.example.org 332 me #go-nuts :Back"))
+	s.Update(ParseMessage(":me!me@example.org PART #go-nuts"))
+	if _, ok := s.Topic("#go-nuts"); ok {
+		t.Error("Topic should be forgotten after leaving.")
+	}
+}
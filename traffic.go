@@ -0,0 +1,83 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"strings"
+)
+
+// Direction tells whether a line was received or sent.
+type Direction int
+
+// Directions passed to a traffic logger.
+const (
+	Received Direction = iota
+	Sent
+)
+
+func (d Direction) String() string {
+	if d == Sent {
+		return "sent"
+	}
+	return "received"
+}
+
+// trafficLog is called with every line read or written, including the line
+// ending.
+type trafficLog func(line string)
+
+// Commands containing credentials, which are redacted by a traffic logger.
+var redactedCommands = map[string]bool{
+	PASS:         true,
+	OPER:         true,
+	AUTHENTICATE: true,
+}
+
+// SetTrafficLogger calls fn with every line received by the Decoder and sent
+// by the Encoder, without line ending. A nil fn stops logging, which is the
+// default.
+//
+// If redact is true, the parameters of commands containing credentials (PASS,
+// OPER and AUTHENTICATE) are replaced with "***".
+//
+// The logger is called from the goroutines reading and writing, so it must be
+// safe to use from multiple goroutines.
+func (c *Conn) SetTrafficLogger(fn func(dir Direction, line string), redact bool) {
+	if fn == nil {
+		c.Decoder.traffic.Store(trafficLog(nil))
+		c.Encoder.traffic.Store(trafficLog(nil))
+		return
+	}
+
+	logger := func(dir Direction) trafficLog {
+		return func(line string) {
+			line = strings.TrimRight(line, string(endline))
+			if redact {
+				line = redactLine(line)
+			}
+			fn(dir, line)
+		}
+	}
+
+	c.Decoder.traffic.Store(logger(Received))
+	c.Encoder.traffic.Store(logger(Sent))
+}
+
+// redactLine hides the parameters of line if its command is in
+// redactedCommands.
+func redactLine(line string) string {
+	m := ParseMessage(line)
+	if m == nil || !redactedCommands[m.Command] || (len(m.Params) <= 0 && len(m.Trailing) <= 0) {
+		return line
+	}
+
+	// Tags and prefix are kept as is.
+	i := strings.Index(strings.ToUpper(line), m.Command+string(space))
+	if i < 0 {
+		return line
+	}
+
+	return line[:i+len(m.Command)] + " ***"
+}
@@ -0,0 +1,63 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConn_SetTrafficLogger(t *testing.T) {
+	conn := NewConn(&readWriter{strings.NewReader("PING :irc.example.org\r\n:irc.example.org AUTHENTICATE +\r\n"), new(bufferConn)})
+
+	var (
+		mu    sync.Mutex
+		lines []string
+	)
+	conn.SetTrafficLogger(func(dir Direction, line string) {
+		mu.Lock()
+		lines = append(lines, dir.String()+" "+line)
+		mu.Unlock()
+	}, true)
+
+	conn.Decode()
+	conn.Pass("secret")
+	conn.Encode(&Message{Command: AUTHENTICATE, Params: []string{"dXNlcgB1c2VyAHBhc3M="}})
+	conn.Decode()
+	conn.Nick("sorcix")
+
+	conn.SetTrafficLogger(nil, false)
+	conn.Nick("other")
+
+	expected := []string{
+		"received PING :irc.example.org",
+		"sent PASS ***",
+		"sent AUTHENTICATE ***",
+		"received :irc.example.org AUTHENTICATE ***",
+		"sent NICK sorcix",
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Wrong traffic: %q", lines)
+	}
+}
+
+func TestRedactLine(t *testing.T) {
+	tests := map[string]string{
+		"PASS secret":                   "PASS ***",
+		"pass :secret words":            "pass ***",
+		"@label=1 OPER admin secret":    "@label=1 OPER ***",
+		":server AUTHENTICATE +":        ":server AUTHENTICATE ***",
+		"PRIVMSG #channel :PASS secret": "PRIVMSG #channel :PASS secret",
+		"NICK pass":                     "NICK pass",
+	}
+
+	for line, expected := range tests {
+		if redacted := redactLine(line); redacted != expected {
+			t.Errorf("Wrong redaction for %q: %q", line, redacted)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+// ValidNick returns true if nick is a valid nickname as defined by RFC 2812:
+//
+//    nickname ::= ( letter / special ) *( letter / digit / special / "-" )
+//    special  ::= "[" / "]" / "\" / "`" / "_" / "^" / "{" / "|" / "}"
+//
+// The length is not checked, as servers allow much longer nicks than the 9
+// characters of the RFC. Use ISupport.ValidNick to check NICKLEN as well.
+func ValidNick(nick string) bool {
+	if len(nick) <= 0 {
+		return false
+	}
+
+	for i := 0; i < len(nick); i++ {
+		c := nick[i]
+		switch {
+		case isLetter(c) || isSpecial(c):
+		case i > 0 && (isDigit(c) || c == '-'):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// ValidChannel returns true if channel is a valid channel name as defined by
+// RFC 2812, starting with one of the prefixes in chanTypes:
+//
+//    channel ::= <prefix> *<any octet except NUL, BELL, CR, LF, " " and ",">
+//
+// Other control characters are rejected as well. The channel prefixes are
+// usually obtained using ISupport.ChanTypes. Use ISupport.ValidChannel to
+// check CHANNELLEN as well.
+func ValidChannel(channel, chanTypes string) bool {
+	if len(channel) <= 0 || indexByte(chanTypes, channel[0]) < 0 {
+		return false
+	}
+
+	for i := 1; i < len(channel); i++ {
+		if c := channel[i]; c <= space || c == ',' || c == 0x7f {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ValidNick is like the ValidNick function, but also checks the maximum length
+// advertised by NICKLEN.
+func (s *ISupport) ValidNick(nick string) bool {
+	if n, ok := s.NickLen(); ok && len(nick) > n {
+		return false
+	}
+	return ValidNick(nick)
+}
+
+// ValidChannel is like the ValidChannel function using the prefixes advertised
+// by CHANTYPES, but also checks the maximum length advertised by CHANNELLEN.
+func (s *ISupport) ValidChannel(channel string) bool {
+	if n, ok := s.ChannelLen(); ok && len(channel) > n {
+		return false
+	}
+	return ValidChannel(channel, s.ChanTypes())
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// isSpecial returns true for the special characters allowed in nicknames.
+func isSpecial(c byte) bool {
+	return c >= 0x5b && c <= 0x60 || c >= 0x7b && c <= 0x7d
+}
@@ -0,0 +1,58 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"testing"
+)
+
+func TestValidNick(t *testing.T) {
+	for _, nick := range []string{"nick", "Nick-2", "[away]", "_bot_", "a", "`^{|}\\", "verylongnickname"} {
+		if !ValidNick(nick) {
+			t.Errorf("Nick %q should be valid", nick)
+		}
+	}
+	for _, nick := range []string{"", "2nick", "-nick", "ni ck", "nick!", "#nick", "nick,other", "nïck"} {
+		if ValidNick(nick) {
+			t.Errorf("Nick %q should be invalid", nick)
+		}
+	}
+}
+
+func TestValidChannel(t *testing.T) {
+	for _, channel := range []string{"#go-nuts", "&local", "#", "#ünïcode", "#a:b"} {
+		if !ValidChannel(channel, "#&") {
+			t.Errorf("Channel %q should be valid", channel)
+		}
+	}
+	for _, channel := range []string{"", "go-nuts", "+modeless", "#go nuts", "#a,#b", "#bell\x07", "#nul\x00", "#line\r\n"} {
+		if ValidChannel(channel, "#&") {
+			t.Errorf("Channel %q should be invalid", channel)
+		}
+	}
+}
+
+func TestISupport_Valid(t *testing.T) {
+	var s ISupport
+
+	if !s.ValidNick("verylongnickname") || !s.ValidChannel("#verylongchannelname") {
+		t.Error("Length should not be limited by default")
+	}
+	if s.ValidChannel("+modeless") {
+		t.Error("Default channel types should be used")
+	}
+
+	s.Update(ParseMessage(":irc.example.org 005 nick NICKLEN=9 CHANNELLEN=10 CHANTYPES=#+ :are supported by this server"))
+
+	if !s.ValidNick("ninechars") || s.ValidNick("tenletters") {
+		t.Error("NICKLEN should be checked")
+	}
+	if !s.ValidChannel("#ten-chars") || s.ValidChannel("#elevenchars") {
+		t.Error("CHANNELLEN should be checked")
+	}
+	if !s.ValidChannel("+modeless") || s.ValidChannel("&local") {
+		t.Error("CHANTYPES should be used")
+	}
+}
@@ -0,0 +1,386 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// WebSocket subprotocol of the IRCv3 WebSocket specification, carrying one
+// UTF-8 message per text frame.
+const webSocketProtocol = "text.ircv3.net"
+
+// Appended to the handshake key to compute Sec-WebSocket-Accept, see
+// RFC 6455 section 1.3.
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Maximum payload of a received WebSocket message. IRC messages are much
+// shorter, even with tags.
+const webSocketMaxPayload = 64 * 1024
+
+// WebSocket frame opcodes.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// ErrWebSocketHandshake is returned by WebSocketConn if the server refused to
+// upgrade the connection.
+var ErrWebSocketHandshake = errors.New("irc: websocket handshake failed")
+
+// ErrWebSocketFrame is returned when reading a WebSocket frame that violates
+// the protocol, or is too large.
+var ErrWebSocketFrame = errors.New("irc: invalid websocket frame")
+
+// WebSocketConn connects to an IRC server using WebSocket, and returns a new
+// Conn for the connection:
+//
+//    conn, err := irc.WebSocketConn("wss://irc.example.org/webirc")
+//
+// Every message is sent as a text frame without line ending. Received frames
+// are delivered to the Decoder as lines, whether or not they end with a line
+// break, so several messages per frame work as well. Pings from the server
+// are answered automatically.
+//
+// Both ws:// and wss:// URLs are supported, the latter uses TLS as configured
+// using WithTLSConfig. The text.ircv3.net subprotocol is requested, but not
+// required.
+func WebSocketConn(rawurl string, options ...DialOption) (*Conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	config := dialConfig{
+		dial: new(net.Dialer).DialContext,
+	}
+	for _, option := range options {
+		option(&config)
+	}
+
+	addr := u.Host
+	switch u.Scheme {
+	case "ws":
+		config.tls = nil
+		if len(u.Port()) <= 0 {
+			addr = net.JoinHostPort(u.Hostname(), "80")
+		}
+	case "wss":
+		if len(u.Port()) <= 0 {
+			addr = net.JoinHostPort(u.Hostname(), "443")
+		}
+	default:
+		return nil, errors.New("irc: unsupported websocket scheme " + u.Scheme)
+	}
+
+	ctx := context.Background()
+	c, err := config.connect(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	if err = config.configure(c); err != nil {
+		c.Close()
+		return nil, err
+	}
+	tcp := tcpConn(c)
+	if u.Scheme == "wss" {
+		if c, err = dialTLS(ctx, c, addr, config.tls); err != nil {
+			return nil, err
+		}
+	}
+
+	ws, err := webSocketHandshake(c, u)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	conn := NewConn(ws)
+	conn.tcp = tcp
+	return conn, nil
+}
+
+// webSocketHandshake upgrades c to a WebSocket connection for u.
+func webSocketHandshake(c net.Conn, u *url.URL) (*wsConn, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":                {"websocket"},
+			"Connection":             {"Upgrade"},
+			"Sec-Websocket-Key":      {key},
+			"Sec-Websocket-Version":  {"13"},
+			"Sec-Websocket-Protocol": {webSocketProtocol},
+		},
+		Host: u.Host,
+	}
+	if err := req.Write(c); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(c)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		!strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") ||
+		resp.Header.Get("Sec-Websocket-Accept") != webSocketAccept(key) {
+		return nil, ErrWebSocketHandshake
+	}
+
+	return &wsConn{Conn: c, reader: reader}, nil
+}
+
+// webSocketAccept returns the Sec-WebSocket-Accept value for key.
+func webSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// wsConn is a client WebSocket connection, presented as a stream of lines.
+type wsConn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	readMu  sync.Mutex
+	pending []byte // Received data not read yet
+
+	writeMu sync.Mutex
+	partial []byte // Written data without line ending yet
+	closed  bool   // Close frame sent
+}
+
+// Read reads the payload of received text and binary frames, adding a line
+// ending to messages that don't have one.
+func (ws *wsConn) Read(p []byte) (int, error) {
+	ws.readMu.Lock()
+	defer ws.readMu.Unlock()
+
+	for len(ws.pending) <= 0 {
+		message, err := ws.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		if len(message) > 0 && message[len(message)-1] != '\n' {
+			message = append(message, endline...)
+		}
+		ws.pending = message
+	}
+
+	n := copy(p, ws.pending)
+	ws.pending = ws.pending[n:]
+	return n, nil
+}
+
+// readMessage reads frames until a complete data message was received,
+// handling control frames in between.
+func (ws *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	started := false
+
+	for {
+		fin, opcode, payload, err := readWebSocketFrame(ws.reader, webSocketMaxPayload-len(message))
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case wsText, wsBinary:
+			if started {
+				return nil, ErrWebSocketFrame
+			}
+			started = true
+			message = payload
+		case wsContinuation:
+			if !started {
+				return nil, ErrWebSocketFrame
+			}
+			message = append(message, payload...)
+		case wsPing:
+			if err := ws.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			ws.writeFrame(wsClose, payload)
+			return nil, io.EOF
+		default:
+			return nil, ErrWebSocketFrame
+		}
+
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+// Write sends every complete line in p as a text frame, without its line
+// ending. Data after the last line ending is sent once the line is complete.
+func (ws *wsConn) Write(p []byte) (int, error) {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
+	data := append(ws.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		if line := bytes.TrimRight(data[:i], "\r"); len(line) > 0 {
+			if err := ws.writeFrameLocked(wsText, line); err != nil {
+				ws.partial = nil
+				return 0, err
+			}
+		}
+		data = data[i+1:]
+	}
+
+	ws.partial = append(ws.partial[:0:0], data...)
+	return len(p), nil
+}
+
+// Close sends a close frame, and closes the underlying connection.
+func (ws *wsConn) Close() error {
+	ws.writeFrame(wsClose, []byte{0x03, 0xe8}) // 1000, normal closure
+	return ws.Conn.Close()
+}
+
+// writeFrame sends a single frame.
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+
+	return ws.writeFrameLocked(opcode, payload)
+}
+
+// writeFrameLocked sends a single frame. Nothing is sent after a close
+// frame. The caller must hold ws.writeMu.
+func (ws *wsConn) writeFrameLocked(opcode byte, payload []byte) error {
+	if ws.closed {
+		return ErrConnClosed
+	}
+	if opcode == wsClose {
+		ws.closed = true
+	}
+
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	_, err := ws.Conn.Write(appendWebSocketFrame(nil, opcode, payload, mask[:]))
+	return err
+}
+
+// appendWebSocketFrame appends a final frame with payload to buf, masked
+// using mask unless it's nil.
+func appendWebSocketFrame(buf []byte, opcode byte, payload, mask []byte) []byte {
+	maskBit := byte(0)
+	if mask != nil {
+		maskBit = 0x80
+	}
+
+	buf = append(buf, 0x80|opcode)
+	switch n := len(payload); {
+	case n < 126:
+		buf = append(buf, maskBit|byte(n))
+	case n <= 0xffff:
+		buf = append(buf, maskBit|126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		buf = append(buf, maskBit|127)
+		buf = append(buf, ext[:]...)
+	}
+
+	if mask == nil {
+		return append(buf, payload...)
+	}
+
+	buf = append(buf, mask...)
+	for i, b := range payload {
+		buf = append(buf, b^mask[i%4])
+	}
+	return buf
+}
+
+// readWebSocketFrame reads a single frame from r, unmasking the payload if
+// needed. Returns ErrWebSocketFrame if the payload is longer than max.
+func readWebSocketFrame(r *bufio.Reader, max int) (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return
+	}
+
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+
+	n := uint64(header[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(r, ext[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(r, ext[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > uint64(max) {
+		return false, 0, nil, ErrWebSocketFrame
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(r, mask[:]); err != nil {
+			return
+		}
+	}
+
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return
+}
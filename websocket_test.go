@@ -0,0 +1,111 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWebSocketConn(t *testing.T) {
+	received := make(chan string, 4)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Sec-Websocket-Protocol") != webSocketProtocol {
+			t.Errorf("Wrong subprotocol: %q", r.Header.Get("Sec-Websocket-Protocol"))
+		}
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Failed to hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		rw.WriteString("Sec-WebSocket-Accept: " + webSocketAccept(r.Header.Get("Sec-Websocket-Key")) + "\r\n\r\n")
+
+		// A ping, a fragmented message and two messages in a single frame.
+		var frames []byte
+		frames = appendWebSocketFrame(frames, wsPing, []byte("hi"), nil)
+		frames = append(frames, 0x01, 4)
+		frames = append(frames, "PING"...)
+		frames = appendWebSocketFrame(frames, wsContinuation, []byte(" :one"), nil)
+		frames = appendWebSocketFrame(frames, wsText, []byte("PING :two\r\nPING :three\r\n"), nil)
+		rw.Write(frames)
+		rw.Flush()
+
+		for {
+			_, opcode, payload, err := readWebSocketFrame(rw.Reader, webSocketMaxPayload)
+			if err != nil {
+				close(received)
+				return
+			}
+			received <- strconv.Itoa(int(opcode)) + " " + string(payload)
+		}
+	}))
+	defer server.Close()
+
+	conn, err := WebSocketConn("ws" + strings.TrimPrefix(server.URL, "http"))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	for _, expected := range []string{"one", "two", "three"} {
+		m, err := conn.Decode()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if m.Command != PING || m.Trailing != expected {
+			t.Errorf("Wrong message: %s", m)
+		}
+	}
+
+	if err := conn.Encode(&Message{Command: PONG, Trailing: "one"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	conn.Close()
+
+	var frames []string
+	for frame := range received {
+		frames = append(frames, frame)
+	}
+
+	expected := []string{"10 hi", "1 PONG :one", "8 \x03\xe8"}
+	if strings.Join(frames, "|") != strings.Join(expected, "|") {
+		t.Errorf("Wrong frames: %q", frames)
+	}
+}
+
+func TestWebSocketConn_handshake(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Not a websocket endpoint", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	if _, err := WebSocketConn("ws" + strings.TrimPrefix(server.URL, "http")); err != ErrWebSocketHandshake {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestReadWebSocketFrame(t *testing.T) {
+	payload := strings.Repeat("x", 70000)
+	frame := appendWebSocketFrame(nil, wsText, []byte(payload), []byte{1, 2, 3, 4})
+
+	r := bufio.NewReader(strings.NewReader(string(frame)))
+	if _, _, _, err := readWebSocketFrame(r, webSocketMaxPayload); err != ErrWebSocketFrame {
+		t.Errorf("Unexpected error for a large frame: %v", err)
+	}
+
+	r = bufio.NewReader(strings.NewReader(string(frame)))
+	fin, opcode, data, err := readWebSocketFrame(r, len(payload))
+	if err != nil || !fin || opcode != wsText || string(data) != payload {
+		t.Errorf("Failed to read masked frame: %v", err)
+	}
+}
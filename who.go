@@ -0,0 +1,191 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WHOX fields in the order they are sent by the server, regardless of the
+// order in the request.
+const whoxOrder = "tcuihsnfdlaor"
+
+// A WhoReply holds a single RPL_WHOREPLY or RPL_WHOSPCRPL reply to a WHO
+// command. Fields not sent by the server are left empty.
+type WhoReply struct {
+	Token   string // Query type, used to match WHOX replies to a request
+	Channel string // "*" if the user shares no visible channel with us
+	User    string
+	IP      string
+	Host    string
+	Server  string
+	Nick    string
+
+	// Status flags, like "H" (here) or "G" (gone), followed by "*" for IRC
+	// operators and membership prefixes.
+	Flags string
+
+	Hops        int
+	IdleSeconds int
+	Account     string // "0" if not logged in
+	OpLevel     string
+	RealName    string
+}
+
+// Away returns true if the flags mark the user as gone.
+func (w *WhoReply) Away() bool {
+	return strings.HasPrefix(w.Flags, "G")
+}
+
+// Operator returns true if the flags mark the user as an IRC operator.
+func (w *WhoReply) Operator() bool {
+	return strings.Contains(w.Flags, "*")
+}
+
+// ParseWho parses a RPL_WHOREPLY message:
+//
+//    352 me <channel> <user> <host> <server> <nick> <flags> :<hops> <realname>
+//
+// Returns false if m is not a valid RPL_WHOREPLY.
+func ParseWho(m *Message) (*WhoReply, bool) {
+	if m.Command != RPL_WHOREPLY || len(m.Params) < 7 {
+		return nil, false
+	}
+
+	w := &WhoReply{
+		Channel: m.Params[1],
+		User:    m.Params[2],
+		Host:    m.Params[3],
+		Server:  m.Params[4],
+		Nick:    m.Params[5],
+		Flags:   m.Params[6],
+	}
+
+	hops, realname := splitFirst(m.Trailing)
+	w.Hops, _ = strconv.Atoi(hops)
+	w.RealName = realname
+
+	return w, true
+}
+
+// ParseWhox parses a RPL_WHOSPCRPL message sent in reply to a WHOX request
+// for the given fields, like "%tuihnfar" or "tuihnfar,42". The query type
+// after the comma is ignored, the reply contains it if "t" was requested:
+//
+//    354 me [token] [channel] [user] [ip] [host] [server] [nick] [flags] ...
+//
+// Returns false if m is not a RPL_WHOSPCRPL with the requested fields.
+func ParseWhox(m *Message, fields string) (*WhoReply, bool) {
+	if m.Command != RPL_WHOSPCRPL || len(m.Params) < 1 {
+		return nil, false
+	}
+
+	fields = strings.TrimPrefix(fields, "%")
+	if i := strings.IndexByte(fields, ','); i >= 0 {
+		fields = fields[:i]
+	}
+
+	values := m.Params[1:]
+	if len(m.Trailing) > 0 || m.EmptyTrailing {
+		values = append(values[:len(values):len(values)], m.Trailing)
+	}
+
+	w := new(WhoReply)
+	for _, field := range whoxOrder {
+		if !strings.ContainsRune(fields, field) {
+			continue
+		}
+		if len(values) == 0 {
+			return nil, false
+		}
+
+		value := values[0]
+		values = values[1:]
+
+		switch field {
+		case 't':
+			w.Token = value
+		case 'c':
+			w.Channel = value
+		case 'u':
+			w.User = value
+		case 'i':
+			w.IP = value
+		case 'h':
+			w.Host = value
+		case 's':
+			w.Server = value
+		case 'n':
+			w.Nick = value
+		case 'f':
+			w.Flags = value
+		case 'd':
+			w.Hops, _ = strconv.Atoi(value)
+		case 'l':
+			w.IdleSeconds, _ = strconv.Atoi(value)
+		case 'a':
+			w.Account = value
+		case 'o':
+			w.OpLevel = value
+		case 'r':
+			w.RealName = value
+		}
+	}
+
+	return w, true
+}
+
+// CollectWho reads the replies to a WHO command for mask from msgs, as
+// returned by Decoder.Messages, until RPL_ENDOFWHO. If fields is not empty,
+// RPL_WHOSPCRPL replies are parsed using ParseWhox with these fields as well.
+// Messages that are not part of the reply are discarded.
+//
+// Returns ErrTimeout if the reply was not complete in time.
+func CollectWho(msgs <-chan *Message, mask, fields string, timeout time.Duration) ([]*WhoReply, error) {
+	var replies []*WhoReply
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case m, ok := <-msgs:
+			if !ok {
+				return nil, io.ErrUnexpectedEOF
+			}
+
+			switch m.Command {
+			case RPL_WHOREPLY:
+				if w, ok := ParseWho(m); ok {
+					replies = append(replies, w)
+				}
+			case RPL_WHOSPCRPL:
+				if len(fields) == 0 {
+					break
+				}
+				if w, ok := ParseWhox(m, fields); ok {
+					replies = append(replies, w)
+				}
+			case RPL_ENDOFWHO:
+				if strings.EqualFold(m.param(1), mask) {
+					return replies, nil
+				}
+			}
+		case <-timer.C:
+			return nil, ErrTimeout
+		}
+	}
+}
+
+// splitFirst splits s at the first space.
+func splitFirst(s string) (first, rest string) {
+	if i := strings.IndexByte(s, space); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, ""
+}
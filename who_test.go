@@ -0,0 +1,108 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseWho(t *testing.T) {
+	m := ParseMessage(":irc.example.org 352 me #go-nuts sorcix example.org irc.example.org Sorcix G*@ :3 Vic Demuzere")
+
+	w, ok := ParseWho(m)
+	if !ok {
+		t.Fatal("Failed to parse WHO reply.")
+	}
+
+	expected := &WhoReply{
+		Channel:  "#go-nuts",
+		User:     "sorcix",
+		Host:     "example.org",
+		Server:   "irc.example.org",
+		Nick:     "Sorcix",
+		Flags:    "G*@",
+		Hops:     3,
+		RealName: "Vic Demuzere",
+	}
+	if !reflect.DeepEqual(w, expected) {
+		t.Errorf("Failed to parse WHO reply:")
+		t.Logf("Output: %#v", w)
+		t.Logf("Expected: %#v", expected)
+	}
+	if !w.Away() || !w.Operator() {
+		t.Errorf("Wrong flags: away %v, operator %v", w.Away(), w.Operator())
+	}
+
+	if _, ok := ParseWho(ParseMessage(":irc.example.org 352 me #go-nuts sorcix")); ok {
+		t.Error("Short WHO reply should be rejected.")
+	}
+}
+
+func TestParseWhox(t *testing.T) {
+	tests := []struct {
+		fields   string
+		raw      string
+		expected *WhoReply
+	}{
+		{
+			"%tuihnfar,42",
+			":irc.example.org 354 me 42 sorcix 192.0.2.1 example.org Sorcix H sorcix :Vic Demuzere",
+			&WhoReply{Token: "42", User: "sorcix", IP: "192.0.2.1", Host: "example.org", Nick: "Sorcix", Flags: "H", Account: "sorcix", RealName: "Vic Demuzere"},
+		},
+		{
+			// The order of the request does not matter.
+			"%ran",
+			":irc.example.org 354 me Sorcix 0 :Vic Demuzere",
+			&WhoReply{Nick: "Sorcix", Account: "0", RealName: "Vic Demuzere"},
+		},
+		{
+			"cnld",
+			":irc.example.org 354 me #go-nuts Sorcix 2 120",
+			&WhoReply{Channel: "#go-nuts", Nick: "Sorcix", Hops: 2, IdleSeconds: 120},
+		},
+	}
+
+	for i, test := range tests {
+		w, ok := ParseWhox(ParseMessage(test.raw), test.fields)
+		if !ok || !reflect.DeepEqual(w, test.expected) {
+			t.Errorf("Failed to parse WHOX reply %d:", i)
+			t.Logf("Output: %#v", w)
+			t.Logf("Expected: %#v", test.expected)
+		}
+	}
+
+	if _, ok := ParseWhox(ParseMessage(":irc.example.org 354 me 42 sorcix"), "%tuihnfar"); ok {
+		t.Error("WHOX reply with missing fields should be rejected.")
+	}
+}
+
+func TestCollectWho(t *testing.T) {
+	lines := []string{
+		":irc.example.org 352 me #go-nuts sorcix example.org irc.example.org Sorcix H :0 Vic Demuzere",
+		":irc.example.org NOTICE me :Unrelated",
+		":irc.example.org 354 me 42 Other",
+		":irc.example.org 315 me #other :End of /WHO list.",
+		":irc.example.org 315 me #go-nuts :End of /WHO list.",
+	}
+
+	msgs := make(chan *Message, len(lines))
+	for _, line := range lines {
+		msgs <- ParseMessage(line)
+	}
+
+	replies, err := CollectWho(msgs, "#go-nuts", "%tn,42", time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(replies) != 2 || replies[0].Nick != "Sorcix" || replies[1].Nick != "Other" || replies[1].Token != "42" {
+		t.Errorf("Wrong replies: %v", replies)
+	}
+
+	if _, err := CollectWho(msgs, "#go-nuts", "", 10*time.Millisecond); err != ErrTimeout {
+		t.Errorf("Expected ErrTimeout, got: %v", err)
+	}
+}
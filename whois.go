@@ -0,0 +1,102 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoSuchNick is returned by CollectWhois if the nick does not exist.
+var ErrNoSuchNick = errors.New("irc: no such nick")
+
+// A WhoisReply combines the numeric replies to a WHOIS command.
+type WhoisReply struct {
+	Nick     string
+	User     string
+	Host     string
+	RealName string
+
+	Server     string // Server the user is connected to
+	ServerInfo string // Description of the server
+
+	Account  string // Account name, if logged in
+	Operator bool   // User is an IRC operator
+
+	IdleSeconds int
+	SignOn      time.Time // Zero if not sent by the server
+
+	// Channels including membership prefixes, like "@#channel".
+	Channels []string
+}
+
+// Update adds the information in m to the reply, if it is a WHOIS reply for
+// this nick. Returns true when the reply is complete.
+func (w *WhoisReply) Update(m *Message) (done bool) {
+
+	// The first parameter is our own nick.
+	if !strings.EqualFold(m.param(1), w.Nick) {
+		return false
+	}
+
+	switch m.Command {
+	case RPL_WHOISUSER:
+		w.Nick = m.param(1)
+		w.User = m.param(2)
+		w.Host = m.param(3)
+		w.RealName = m.Trailing
+	case RPL_WHOISSERVER:
+		w.Server = m.param(2)
+		w.ServerInfo = m.Trailing
+	case RPL_WHOISOPERATOR:
+		w.Operator = true
+	case RPL_WHOISIDLE:
+		w.IdleSeconds, _ = strconv.Atoi(m.param(2))
+		if signon, err := strconv.ParseInt(m.param(3), 10, 64); err == nil {
+			w.SignOn = time.Unix(signon, 0)
+		}
+	case RPL_WHOISCHANNELS:
+		w.Channels = append(w.Channels, strings.Fields(m.Trailing)...)
+	case RPL_WHOISACCOUNT:
+		w.Account = m.param(2)
+	case RPL_ENDOFWHOIS:
+		return true
+	}
+
+	return false
+}
+
+// CollectWhois reads the replies to a WHOIS command for nick from msgs, as
+// returned by Decoder.Messages. Messages that are not part of the reply are
+// discarded.
+//
+// Returns ErrNoSuchNick if the nick does not exist, and ErrTimeout if the
+// reply was not complete in time.
+func CollectWhois(msgs <-chan *Message, nick string, timeout time.Duration) (*WhoisReply, error) {
+	w := &WhoisReply{Nick: nick}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case m, ok := <-msgs:
+			if !ok {
+				return nil, io.ErrUnexpectedEOF
+			}
+			if m.Command == ERR_NOSUCHNICK && strings.EqualFold(m.param(1), nick) {
+				return nil, ErrNoSuchNick
+			}
+			if w.Update(m) {
+				return w, nil
+			}
+		case <-timer.C:
+			return nil, ErrTimeout
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2014 Vic Demuzere
+//
+// Use of this source code is governed by the MIT license.
+
+package irc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+var whoisReply = []string{
+	":irc.example.org 311 me Sorcix sorcix example.org * :Vic Demuzere",
+	":irc.example.org 311 me other other example.org * :Someone else",
+	":irc.example.org 319 me sorcix :@#go-nuts +#irc",
+	":irc.example.org NOTICE me :Unrelated",
+	":irc.example.org 319 me sorcix :#test",
+	":irc.example.org 312 me sorcix irc.example.org :Example server",
+	":irc.example.org 313 me sorcix :is an IRC operator",
+	":irc.example.org 330 me sorcix sorcix :is logged in as",
+	":irc.example.org 317 me sorcix 42 1400000000 :seconds idle, signon time",
+	":irc.example.org 318 me other :End of /WHOIS list.",
+	":irc.example.org 318 me sorcix :End of /WHOIS list.",
+}
+
+func TestCollectWhois(t *testing.T) {
+	msgs := make(chan *Message, len(whoisReply))
+	for _, line := range whoisReply {
+		msgs <- ParseMessage(line)
+	}
+
+	w, err := CollectWhois(msgs, "sorcix", time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := &WhoisReply{
+		Nick:        "Sorcix",
+		User:        "sorcix",
+		Host:        "example.org",
+		RealName:    "Vic Demuzere",
+		Server:      "irc.example.org",
+		ServerInfo:  "Example server",
+		Account:     "sorcix",
+		Operator:    true,
+		IdleSeconds: 42,
+		SignOn:      time.Unix(1400000000, 0),
+		Channels:    []string{"@#go-nuts", "+#irc", "#test"},
+	}
+
+	if !reflect.DeepEqual(w, expected) {
+		t.Errorf("Wrong WHOIS reply: %#v", w)
+	}
+}
+
+func TestCollectWhois_errors(t *testing.T) {
+	msgs := make(chan *Message, 2)
+	msgs <- ParseMessage(":irc.example.org 401 me sorcix :No such nick/channel")
+
+	if _, err := CollectWhois(msgs, "sorcix", time.Second); err != ErrNoSuchNick {
+		t.Errorf("Expected ErrNoSuchNick, got: %v", err)
+	}
+
+	if _, err := CollectWhois(msgs, "sorcix", 10*time.Millisecond); err != ErrTimeout {
+		t.Errorf("Expected ErrTimeout, got: %v", err)
+	}
+}